@@ -0,0 +1,325 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/temoto/robotstxt"
+)
+
+// Crawl archives are modeled on WARC (ISO 28500). Each file starts with a warcinfo record, followed by a response record for every
+// fetched url. Each record is its own gzip member, like .warc.gz files, so a file can be read from any record. Smallnet protocols
+// don't have response headers like HTTP does, so a response record's block is the gemini-style header the fetcher mapped the
+// response onto ("20 text/gemini\r\n"), followed by the body. The protocol the url was fetched with is kept in WARC-Protocol, and the
+// SHA-256 fingerprint of the server's certificate (for TLS protocols) in WARC-Cert-Fingerprint.
+
+// An archive file is closed and a new one started once it reaches this size (compressed)
+var archiveMaxFileSize int64 = 1024 * 1024 * 1024
+
+// Bodies larger than this are cut off
+const maxBodySize = 1024 * 1024 * 200 // 200 MiB
+
+// Records with a larger block than a cut off body and its header line are corrupted
+const maxArchiveBlockSize = maxBodySize + 4096
+
+// ArchiveRecord is a response stored in a crawl archive
+type ArchiveRecord struct {
+	Url             string
+	Protocol        string
+	Date            time.Time
+	Status          int
+	Meta            string
+	CertFingerprint string // Hex of the SHA-256 of the certificate, empty if there wasn't one
+	Body            []byte
+}
+
+// ArchiveWriter writes the responses of crawls to rotating archive files in a directory. Safe to use from multiple crawl threads.
+type ArchiveWriter struct {
+	mutex  sync.Mutex
+	dir    string
+	prefix string
+	file   *os.File
+	size   int64 // Of the current file
+	serial int   // Of the current file
+}
+
+// SetArchive makes the crawl write every fetched response to the archive. Sub-crawls created afterwards write to it too.
+func (gd *GlobalData) SetArchive(archive *ArchiveWriter) {
+	gd.archive = archive
+}
+
+// NewArchiveWriter creates the directory if needed. Files are named with the prefix, the time they were started, and a serial number.
+func NewArchiveWriter(dir string, prefix string) (*ArchiveWriter, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &ArchiveWriter{dir: dir, prefix: prefix}, nil
+}
+
+// Close closes the current archive file. The next record written starts a new file.
+func (archive *ArchiveWriter) Close() error {
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+	if archive.file == nil {
+		return nil
+	}
+	err := archive.file.Close()
+	archive.file = nil
+	return err
+}
+
+// Write adds a response record to the current archive file, starting a new file first if the current one is full
+func (archive *ArchiveWriter) Write(record ArchiveRecord) error {
+	archive.mutex.Lock()
+	defer archive.mutex.Unlock()
+	if archive.file != nil && archive.size >= archiveMaxFileSize {
+		archive.file.Close()
+		archive.file = nil
+	}
+	if archive.file == nil {
+		if err := archive.startFile(); err != nil {
+			return err
+		}
+	}
+
+	block := append([]byte(fmt.Sprintf("%d %s\r\n", record.Status, record.Meta)), record.Body...)
+	payloadDigest := sha256.Sum256(record.Body)
+	headers := [][2]string{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", newRecordId()},
+		{"WARC-Date", record.Date.UTC().Format(time.RFC3339)},
+		{"WARC-Target-URI", record.Url},
+		{"WARC-Protocol", record.Protocol},
+		{"WARC-Cert-Fingerprint", ""},
+		{"WARC-Payload-Digest", "sha256:" + base32.StdEncoding.EncodeToString(payloadDigest[:])},
+		{"Content-Type", "application/gemini; msgtype=response"},
+	}
+	if record.CertFingerprint != "" {
+		headers[5][1] = "sha256:" + record.CertFingerprint
+	}
+	return archive.writeRecord(headers, block)
+}
+
+// Must hold the mutex
+func (archive *ArchiveWriter) startFile() error {
+	archive.serial++
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", archive.prefix, time.Now().UTC().Format("20060102150405"), archive.serial)
+	file, err := os.OpenFile(filepath.Join(archive.dir, name), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	archive.file = file
+	archive.size = 0
+
+	info := fmt.Sprintf("software: AuraGem Search Crawler\r\nformat: WARC File Format 1.1\r\ncrawlIndex: %d\r\n", CrawlIndex)
+	return archive.writeRecord([][2]string{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", newRecordId()},
+		{"WARC-Date", time.Now().UTC().Format(time.RFC3339)},
+		{"WARC-Filename", name},
+		{"Content-Type", "application/warc-fields"},
+	}, []byte(info))
+}
+
+// Writes a record as its own gzip member. Headers with empty values are left out. Must hold the mutex.
+func (archive *ArchiveWriter) writeRecord(headers [][2]string, block []byte) error {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	fmt.Fprintf(gz, "WARC/1.1\r\n")
+	for _, header := range headers {
+		if header[1] != "" {
+			fmt.Fprintf(gz, "%s: %s\r\n", header[0], header[1])
+		}
+	}
+	fmt.Fprintf(gz, "Content-Length: %d\r\n\r\n", len(block))
+	gz.Write(block)
+	fmt.Fprintf(gz, "\r\n\r\n")
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	n, err := archive.file.Write(buffer.Bytes())
+	archive.size += int64(n)
+	return err
+}
+
+// A random (version 4) UUID as a urn
+func newRecordId() string {
+	var id [16]byte
+	rand.Read(id[:])
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
+
+func certFingerprint(cert *x509.Certificate) string {
+	if cert == nil {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Archives a fetched response. The body of a success response is read into memory to be archived, and the response is given back
+// with a body that reads from memory, so that the crawler can handle it as usual.
+func (archive *ArchiveWriter) archiveResponse(url string, resp Response) Response {
+	var body []byte
+	if resp.Status >= 20 && resp.Status < 30 && resp.Body != nil {
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		resp.Body.Close()
+		if err != nil {
+			resp.Body = io.NopCloser(failedReader{err})
+			return resp
+		}
+		body = data
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+	}
+
+	scheme, _, _ := strings.Cut(url, "://")
+	record := ArchiveRecord{url, scheme, time.Now(), resp.Status, resp.Description, certFingerprint(resp.Cert), body}
+	if err := archive.Write(record); err != nil {
+		logger.Error().Str("url", url).Err(err).Msg("Couldn't archive response")
+	}
+	return resp
+}
+
+// A body whose read failed while it was being archived
+type failedReader struct {
+	err error
+}
+
+func (reader failedReader) Read(p []byte) (int, error) {
+	return 0, reader.err
+}
+
+// ArchiveReader reads the response records of an archive file
+type ArchiveReader struct {
+	file   *os.File
+	reader *bufio.Reader
+}
+
+var ErrBadArchiveRecord = errors.New("bad archive record")
+
+func OpenArchive(path string) (*ArchiveReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(file) // Reads through all of the gzip members
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &ArchiveReader{file, bufio.NewReader(gz)}, nil
+}
+
+func (archive *ArchiveReader) Close() error {
+	return archive.file.Close()
+}
+
+// Next returns the next response record, skipping other types of records. Returns io.EOF after the last record.
+func (archive *ArchiveReader) Next() (ArchiveRecord, error) {
+	for {
+		version, err := archive.reader.ReadString('\n')
+		if err == io.EOF && strings.TrimSpace(version) == "" {
+			return ArchiveRecord{}, io.EOF
+		} else if err != nil {
+			return ArchiveRecord{}, err
+		}
+		if strings.TrimSpace(version) == "" {
+			continue // The end of the previous record
+		} else if !strings.HasPrefix(version, "WARC/") {
+			return ArchiveRecord{}, fmt.Errorf("%w: expected a WARC version line, got %q", ErrBadArchiveRecord, version)
+		}
+
+		headers, err := textproto.NewReader(archive.reader).ReadMIMEHeader()
+		if err != nil {
+			return ArchiveRecord{}, err
+		}
+		length, err := strconv.ParseInt(headers.Get("Content-Length"), 10, 64)
+		if err != nil || length < 0 || length > maxArchiveBlockSize {
+			return ArchiveRecord{}, fmt.Errorf("%w: bad Content-Length %q", ErrBadArchiveRecord, headers.Get("Content-Length"))
+		}
+		block := make([]byte, length)
+		if _, err := io.ReadFull(archive.reader, block); err != nil {
+			return ArchiveRecord{}, err
+		}
+		if headers.Get("WARC-Type") != "response" {
+			continue
+		}
+
+		header, body, found := bytes.Cut(block, []byte("\r\n"))
+		if !found {
+			return ArchiveRecord{}, fmt.Errorf("%w: response of '%s' has no header line", ErrBadArchiveRecord, headers.Get("WARC-Target-URI"))
+		}
+		statusString, meta, _ := strings.Cut(string(header), " ")
+		status, err := strconv.Atoi(statusString)
+		if err != nil {
+			return ArchiveRecord{}, fmt.Errorf("%w: response of '%s' has bad status %q", ErrBadArchiveRecord, headers.Get("WARC-Target-URI"), statusString)
+		}
+		date, _ := time.Parse(time.RFC3339, headers.Get("WARC-Date"))
+		return ArchiveRecord{headers.Get("WARC-Target-URI"), headers.Get("WARC-Protocol"), date, status, meta, strings.TrimPrefix(headers.Get("WARC-Cert-Fingerprint"), "sha256:"), body}, nil
+	}
+}
+
+// ReplayArchive runs the success responses of an archive file back through handleSuccess, as if they were just fetched, so that
+// pages get re-indexed without fetching them again. Pages are parsed even if they haven't changed since they were last indexed.
+// Links to pages that come later in the archive are added once those pages are replayed. Returns the number of responses replayed.
+func ReplayArchive(globalData *GlobalData, path string) (int, error) {
+	archive, err := OpenArchive(path)
+	if err != nil {
+		return 0, err
+	}
+	defer archive.Close()
+
+	// Robots.txt was already respected when the responses were fetched
+	robots, _ := robotstxt.FromString("User-agent: *\nAllow: /")
+	allowAll := Robots{robots, robots.FindGroup("indexer")}
+
+	globalData.replay = true
+	ctx := newCrawlContext(globalData)
+	replayed := 0
+	for {
+		record, err := archive.Next()
+		if err == io.EOF {
+			return replayed, nil
+		} else if err != nil {
+			return replayed, err
+		}
+		if record.Status < 20 || record.Status >= 30 {
+			continue
+		}
+		url, err := neturl.Parse(record.Url)
+		if err != nil {
+			continue
+		}
+
+		// Take the crawl data of the page that linked to this one earlier in the archive
+		crawlData, _ := globalData.urlsToCrawl.Get(record.Url)
+		globalData.urlsCrawled.Set(record.Url, Page{CrawlIndex: CrawlIndex, Date_added: time.Now().UTC()})
+
+		ctx.currentURL = url
+		ctx.currentRobots = allowAll
+		ctx.isRootPage = ctx.GetCurrentHostname() == ctx.GetCurrentURL()
+		ctx.resp = Response{Status: record.Status, Description: record.Meta, Body: io.NopCloser(bytes.NewReader(record.Body))}
+		handleSuccess(ctx, 0, crawlData)
+		replayed++
+	}
+}
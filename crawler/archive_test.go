@@ -0,0 +1,166 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveRotation(t *testing.T) {
+	previousMaxFileSize := archiveMaxFileSize
+	archiveMaxFileSize = 1 // Every record after the first starts a new file
+	t.Cleanup(func() { archiveMaxFileSize = previousMaxFileSize })
+
+	dir := t.TempDir()
+	archive, err := NewArchiveWriter(dir, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []ArchiveRecord{
+		{"gemini://example.com/", "gemini", time.Now(), 20, "text/gemini; lang=en", "ab12", []byte("# Hello\r\n\r\nWARC/1.1\r\n")},
+		{"nex://example.com/missing", "nex", time.Now(), 51, "Not found", "", nil},
+	}
+	for _, record := range records {
+		if err := archive.Write(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "test-*.warc.gz"))
+	if len(files) != 2 {
+		t.Fatalf("expected a file for each record, got %v", files)
+	}
+	for i, file := range files {
+		reader, err := OpenArchive(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		record, err := reader.Next()
+		if err != nil {
+			t.Fatalf("couldn't read %s: %v", file, err)
+		}
+		expected := records[i]
+		if record.Url != expected.Url || record.Protocol != expected.Protocol || record.Status != expected.Status || record.Meta != expected.Meta || record.CertFingerprint != expected.CertFingerprint || !bytes.Equal(record.Body, expected.Body) {
+			t.Fatalf("expected %+v, got %+v", expected, record)
+		}
+		if _, err := reader.Next(); err != io.EOF {
+			t.Fatalf("expected the end of %s, got %v", file, err)
+		}
+		reader.Close()
+	}
+}
+
+func TestArchiveReplay(t *testing.T) {
+	// No politeness delays against the local server
+	previousSlowDown := defaultSlowDown
+	defaultSlowDown = 0
+	t.Cleanup(func() { defaultSlowDown = previousSlowDown })
+
+	server := newGeminiStandIn(t, map[string]string{
+		"/":      "# Root\n=> /a.gmi Page A\n=> /missing.gmi Missing\n",
+		"/a.gmi": "# A\nSome text on page A.\n=> / Back\n",
+	})
+
+	dir := t.TempDir()
+	archive, err := NewArchiveWriter(dir, "crawl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gd := NewGlobalData(nil, false, true, 0)
+	gd.SetArchive(archive)
+	gd.AddUrl(server.url("/"), UrlToCrawlData{})
+	newCrawlJob("test", gd).run(0, 1, 1)
+	archive.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "crawl-*.warc.gz"))
+	if len(files) != 1 {
+		t.Fatalf("expected one archive file, got %v", files)
+	}
+	reader, err := OpenArchive(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := make(map[string]int)
+	for {
+		record, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		statuses[record.Url] = record.Status
+		if record.Protocol != "gemini" || record.CertFingerprint == "" {
+			t.Fatalf("expected the protocol and cert of %s to be archived, got %+v", record.Url, record)
+		}
+	}
+	reader.Close()
+	if len(statuses) != 3 || statuses[server.url("/missing.gmi")] != 51 {
+		t.Fatalf("expected all 3 responses archived, got %v", statuses)
+	}
+
+	// Replaying doesn't fetch anything
+	requests := server.requestCount("/a.gmi")
+	var output bytes.Buffer
+	sink := NewJSONLSink(&output)
+	replayData := NewGlobalData(nil, true, true, 0)
+	replayData.SetPageSink(sink)
+	replayed, err := ReplayArchive(replayData, files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Flush()
+	if replayed != 2 {
+		t.Fatalf("expected the 2 success responses replayed, got %d", replayed)
+	}
+	if server.requestCount("/a.gmi") != requests {
+		t.Fatal("replay fetched a page again")
+	}
+
+	titles := make(map[string]string)
+	links := make(map[string]bool)
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var record struct{ Type, Url, Title, From, To string }
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("bad line %q: %v", line, err)
+		}
+		if record.Type == "page" {
+			titles[record.Url] = record.Title
+		} else {
+			links[record.From+" -> "+record.To] = true
+		}
+	}
+	if titles[server.url("/")] != "Root" || titles[server.url("/a.gmi")] != "A" {
+		t.Fatalf("expected both pages replayed, got %v", titles)
+	}
+	if !links[server.url("/")+" -> "+server.url("/a.gmi")] || !links[server.url("/a.gmi")+" -> "+server.url("/")] {
+		t.Fatalf("expected the links between the pages restored, got %v", links)
+	}
+}
+
+func TestArchiveRejectsHugeContentLength(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corrupted.warc.gz")
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	gz.Write([]byte("WARC/1.1\r\nWARC-Type: response\r\nContent-Length: 999999999999\r\n\r\n20 text/gemini\r\n"))
+	gz.Close()
+	if err := os.WriteFile(path, buffer.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := OpenArchive(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if _, err := reader.Next(); !errors.Is(err, ErrBadArchiveRecord) {
+		t.Fatalf("expected ErrBadArchiveRecord for a Content-Length past the largest record, got %v", err)
+	}
+}
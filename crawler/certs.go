@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"context"
+	"crypto/x509"
+	"database/sql"
+	"strconv"
+	"time"
+)
+
+// Records the certificate the current host responded with in the certs table. Each certificate a host is seen with is kept, along
+// with the one it replaced, so that users can check their TOFU pins against the certificates the crawler saw over time. Only the
+// first response of a host in a crawl touches the DB, unless the host's certificate changes during the crawl.
+func recordCert(ctx CrawlContext, cert *x509.Certificate) {
+	domain := ctx.GetDomain()
+	fingerprint := certFingerprint(cert)
+	key := domain.Domain + ":" + strconv.Itoa(domain.Port)
+	if seen, ok := ctx.globalData.certsSeen.Get(key); ok && seen.(string) == fingerprint {
+		return
+	}
+	ctx.globalData.certsSeen.Set(key, fingerprint)
+	if ctx.globalData.dbConn == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	var id int64
+	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT id FROM certs WHERE domain=? AND port=? AND fingerprint=?", domain.Domain, domain.Port, fingerprint)
+	err := row.Scan(&id)
+	if err == nil {
+		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE certs SET last_seen=? WHERE id=?", now, id)
+		if err != nil {
+			logger.Error().Str("host", key).Err(err).Msg("Couldn't update certificate")
+		}
+		return
+	} else if err != sql.ErrNoRows {
+		logger.Error().Str("host", key).Err(err).Msg("Couldn't get certificate")
+		return
+	}
+
+	// A certificate the host hasn't been seen with before
+	var previous sql.Null[string]
+	row = ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT FIRST 1 fingerprint FROM certs WHERE domain=? AND port=? ORDER BY last_seen DESC", domain.Domain, domain.Port)
+	if err := row.Scan(&previous.V); err == nil {
+		previous.Valid = true
+		logger.Warn().Str("host", key).Str("previous", previous.V).Str("fingerprint", fingerprint).Msg("Certificate changed")
+	} else if err != sql.ErrNoRows {
+		logger.Error().Str("host", key).Err(err).Msg("Couldn't get certificate")
+		return
+	}
+
+	_, err = ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO certs (domain, port, fingerprint, subject, issuer, not_before, not_after, previous_fingerprint, first_seen, last_seen, crawlIndex) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", domain.Domain, domain.Port, fingerprint, truncateRunes(cert.Subject.String(), 1020), truncateRunes(cert.Issuer.String(), 1020), cert.NotBefore.UTC(), cert.NotAfter.UTC(), previous, now, now, CrawlIndex)
+	if err != nil {
+		logger.Error().Str("host", key).Err(err).Msg("Couldn't add certificate")
+	}
+}
@@ -0,0 +1,37 @@
+package crawler
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestRecordCertOncePerCrawl(t *testing.T) {
+	server := newGeminiStandIn(t, map[string]string{})
+	conn, err := tls.Dial("tcp", server.listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := conn.ConnectionState().PeerCertificates[0]
+	conn.Close()
+
+	gd := NewGlobalData(nil, false, true, 0)
+	ctx := newCrawlContext(gd)
+	resp, err := getAfterRobotsTxt(&ctx, server.url("/missing.gmi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Cert == nil || certFingerprint(resp.Cert) != certFingerprint(cert) {
+		t.Fatal("expected the response to have the server's certificate")
+	}
+
+	recordCert(ctx, resp.Cert)
+	key := "127.0.0.1:" + ctx.currentURL.Port()
+	if seen, ok := gd.certsSeen.Get(key); !ok || seen.(string) != certFingerprint(cert) {
+		t.Fatalf("expected the certificate of %s to be recorded as seen, got %v", key, seen)
+	}
+
+	gd.Reset()
+	if gd.certsSeen.Count() != 0 {
+		t.Fatal("a new crawl should record the certificates of hosts again")
+	}
+}
@@ -0,0 +1,279 @@
+package crawler
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gitlab.com/clseibold/auragem_sis/db"
+)
+
+var crawlDepth int
+var crawlInternal bool
+var crawlExternal bool
+var crawlThreads int
+var crawlToDb bool
+var crawlOutput string
+var crawlRulesFile string
+var crawlArchive string
+
+// InitCrawlCommands adds the crawl command, which runs a crawl without the rest of the server
+func InitCrawlCommands(Command *cobra.Command) {
+	crawlCommand := &cobra.Command{
+		Use:   "crawl <seed file or url>",
+		Short: "Crawl from a seed file or a single url",
+		Long:  "Crawl from a single url, or from a seed file with a url on each line (blank lines and lines starting with # are skipped). Pages and links are written to a JSONL file, or to the Search DB with --db.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) <= 0 {
+				fmt.Printf("Error: No seed file or url specified\n")
+				os.Exit(1)
+			}
+
+			seeds, err := readSeeds(args[0])
+			if err != nil {
+				fmt.Printf("Error: Couldn't read seeds: %s\n", err.Error())
+				os.Exit(1)
+			} else if len(seeds) == 0 {
+				fmt.Printf("Error: No seeds in '%s'\n", args[0])
+				os.Exit(1)
+			}
+			RunCrawlCommand(seeds)
+		},
+	}
+	crawlCommand.Flags().IntVar(&crawlDepth, "depth", 0, "Max depth of internal links to follow from the seeds (0 for no limit)")
+	crawlCommand.Flags().BoolVar(&crawlInternal, "internal", true, "Follow links within the capsules of the seeds")
+	crawlCommand.Flags().BoolVar(&crawlExternal, "external", false, "Follow links to other capsules")
+	crawlCommand.Flags().IntVar(&crawlThreads, "threads", 4, "Number of crawl threads")
+	crawlCommand.Flags().BoolVar(&crawlToDb, "db", false, "Write to the Search DB instead of a JSONL file")
+	crawlCommand.Flags().StringVar(&crawlOutput, "output", "crawl.jsonl", "JSONL file the pages and links are written to")
+	crawlCommand.Flags().StringVar(&crawlRulesFile, "rules", "", "Crawl rules file to use along with the default rules (and the crawl_rules table with --db)")
+	crawlCommand.Flags().StringVar(&crawlArchive, "archive", "", "Directory to archive the fetched responses in")
+
+	replayCommand := &cobra.Command{
+		Use:   "replay <archive files...>",
+		Short: "Index the responses of crawl archives without fetching them again",
+		Long:  "Run the responses of crawl archives (made with crawl --archive, or the server's SearchArchiveDirectory) back through the crawler's parsers, in the order given. Pages and links are written to a JSONL file, or to the Search DB with --db.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) <= 0 {
+				fmt.Printf("Error: No archive files specified\n")
+				os.Exit(1)
+			}
+			RunReplayCommand(args)
+		},
+	}
+	replayCommand.Flags().BoolVar(&crawlToDb, "db", false, "Write to the Search DB instead of a JSONL file")
+	replayCommand.Flags().StringVar(&crawlOutput, "output", "crawl.jsonl", "JSONL file the pages and links are written to")
+
+	linkSignalsCommand := &cobra.Command{
+		Use:   "linksignals",
+		Short: "Compute the link-graph ranking signals of pages in the Search DB",
+		Long:  "Compute the anchor text and the number of capsules linking to each page from the links in the Search DB, for the search to blend with its FTS score (see SearchAnchorTextWeight and SearchInboundHostsWeight in the config). Run it after crawls.",
+		Run: func(cmd *cobra.Command, args []string) {
+			conn := db.NewConn(db.SearchDB)
+			defer conn.Close()
+			count, err := ComputeLinkSignals(conn)
+			if err != nil {
+				fmt.Printf("Error: Couldn't compute the link signals: %s\n", err.Error())
+				os.Exit(1)
+			}
+			fmt.Printf("Computed the link signals of %d pages.\n", count)
+		},
+	}
+
+	backfillCommand := &cobra.Command{
+		Use:   "backfill",
+		Short: "Re-parse the pages in the Search DB that have no body text stored",
+		Long:  "Fetch the pages of the markup formats in the Search DB that have no body text in page_contents, like pages indexed before it was added, and parse them again even if they haven't changed. Their links aren't followed. Regular crawls re-parse unchanged pages on their own whenever the crawler's parser version is bumped.",
+		Run: func(cmd *cobra.Command, args []string) {
+			RunBackfillCommand()
+		},
+	}
+	backfillCommand.Flags().IntVar(&crawlThreads, "threads", 4, "Number of crawl threads")
+
+	Command.AddCommand(crawlCommand)
+	Command.AddCommand(replayCommand)
+	Command.AddCommand(linkSignalsCommand)
+	Command.AddCommand(backfillCommand)
+}
+
+// Gets the seeds from the seed file, or the url itself if it has a scheme
+func readSeeds(seedFileOrUrl string) ([]string, error) {
+	if strings.Contains(seedFileOrUrl, "://") {
+		return []string{seedFileOrUrl}, nil
+	}
+
+	file, err := os.Open(seedFileOrUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var seeds []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		seeds = append(seeds, line)
+	}
+	return seeds, scanner.Err()
+}
+
+// RunCrawlCommand crawls from the seeds with the settings of the crawl command's flags, until the frontier runs out or the crawl is
+// interrupted. An interrupt cancels the crawl, and whatever was crawled so far is kept.
+func RunCrawlCommand(seeds []string) {
+	var conn *sql.DB
+	if crawlToDb {
+		conn = db.NewConn(db.SearchDB)
+		defer conn.Close()
+	}
+	if err := LoadCrawlRules(crawlRulesFile, conn); err != nil {
+		fmt.Printf("Error: Couldn't load crawl rules: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	globalData := NewGlobalData(conn, crawlExternal, crawlInternal, crawlDepth)
+	var sink *JSONLSink
+	if conn == nil {
+		file, err := os.Create(crawlOutput)
+		if err != nil {
+			fmt.Printf("Error: Couldn't create output file: %s\n", err.Error())
+			os.Exit(1)
+		}
+		defer file.Close()
+		sink = NewJSONLSink(file)
+		globalData.SetPageSink(sink)
+	}
+	if crawlArchive != "" {
+		archive, err := NewArchiveWriter(crawlArchive, "crawl")
+		if err != nil {
+			fmt.Printf("Error: Couldn't open archive directory: %s\n", err.Error())
+			os.Exit(1)
+		}
+		defer archive.Close()
+		globalData.SetArchive(archive)
+	}
+	for _, seed := range seeds {
+		globalData.AddUrl(seed, UrlToCrawlData{})
+	}
+
+	job := newCrawlJob("Command Crawl", globalData)
+	stopCancelling := cancelOnInterrupt(job)
+	defer stopCancelling()
+
+	fmt.Printf("Crawling from %d seeds with %d threads.\n", len(seeds), max(crawlThreads, 1))
+	job.run(0, max(crawlThreads, 1), 5)
+
+	if sink != nil {
+		if err := sink.Flush(); err != nil {
+			fmt.Printf("Error: Couldn't write to output file: %s\n", err.Error())
+		}
+	} else {
+		rebuildSearchIndexes(conn)
+	}
+	printCrawlSummary(job)
+}
+
+// RunBackfillCommand re-crawls the pages in the Search DB that have no body text stored, parsing them even if they haven't changed,
+// until they've all been crawled or the backfill is interrupted
+func RunBackfillCommand() {
+	conn := db.NewConn(db.SearchDB)
+	defer conn.Close()
+	if err := LoadCrawlRules("", conn); err != nil {
+		fmt.Printf("Error: Couldn't load crawl rules: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	urls, err := getUrlsWithoutContents(conn)
+	if err != nil {
+		fmt.Printf("Error: Couldn't get the pages without body text: %s\n", err.Error())
+		os.Exit(1)
+	} else if len(urls) == 0 {
+		fmt.Printf("Every page has its body text stored.\n")
+		return
+	}
+
+	globalData := NewGlobalData(conn, false, false, 0) // Only the pages themselves
+	globalData.reparse = true
+	for _, url := range urls {
+		globalData.AddUrl(url, UrlToCrawlData{})
+	}
+
+	job := newCrawlJob("Backfill", globalData)
+	stopCancelling := cancelOnInterrupt(job)
+	defer stopCancelling()
+
+	fmt.Printf("Backfilling %d pages with %d threads.\n", len(urls), max(crawlThreads, 1))
+	job.run(0, max(crawlThreads, 1), 5)
+	rebuildSearchIndexes(conn)
+	printCrawlSummary(job)
+}
+
+// Cancels the job on an interrupt, so that whatever was crawled so far is kept. The returned function stops listening for interrupts.
+func cancelOnInterrupt(job *CrawlJob) func() {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		if _, ok := <-interrupts; ok {
+			fmt.Printf("Interrupted. Stopping the crawl.\n")
+			job.Cancel()
+		}
+	}()
+	return func() {
+		signal.Stop(interrupts)
+	}
+}
+
+func printCrawlSummary(job *CrawlJob) {
+	progress := job.Progress()
+	failed := 0
+	for _, count := range progress.Failures {
+		failed += count
+	}
+	fmt.Printf("Crawl %s: %d fetched, %d failed, %d slow downs, %.2f MB downloaded.\n", progress.State, progress.Fetched, failed, progress.SlowDowns, float64(progress.Bytes)/1024/1024)
+}
+
+// RunReplayCommand replays the archive files into a JSONL file or the Search DB, with the settings of the replay command's flags
+func RunReplayCommand(paths []string) {
+	var conn *sql.DB
+	if crawlToDb {
+		conn = db.NewConn(db.SearchDB)
+		defer conn.Close()
+	}
+
+	globalData := NewGlobalData(conn, true, true, 0) // Follows all links, so that links between archived pages are kept
+	var sink *JSONLSink
+	if conn == nil {
+		file, err := os.Create(crawlOutput)
+		if err != nil {
+			fmt.Printf("Error: Couldn't create output file: %s\n", err.Error())
+			os.Exit(1)
+		}
+		defer file.Close()
+		sink = NewJSONLSink(file)
+		globalData.SetPageSink(sink)
+	}
+
+	total := 0
+	for _, path := range paths {
+		replayed, err := ReplayArchive(globalData, path)
+		total += replayed
+		if err != nil {
+			fmt.Printf("Error: Couldn't read all of '%s': %s\n", path, err.Error())
+		}
+	}
+
+	if sink != nil {
+		if err := sink.Flush(); err != nil {
+			fmt.Printf("Error: Couldn't write to output file: %s\n", err.Error())
+		}
+	} else {
+		rebuildSearchIndexes(conn)
+	}
+	fmt.Printf("Replayed %d responses from %d archive files.\n", total, len(paths))
+}
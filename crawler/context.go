@@ -5,21 +5,15 @@ import (
 	"database/sql"
 	"errors"
 	"io"
-	"math"
-	"math/rand"
-	"net"
 	neturl "net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	//geminiParser "git.sr.ht/~adnano/go-gemini"
-	"github.com/clseibold/go-gemini"
 	cmap "github.com/orcaman/concurrent-map"
 	"github.com/temoto/robotstxt"
-	"gitlab.com/clseibold/gonex/nex_client"
-	spartan_client "gitlab.com/clseibold/profectus/spartan"
-	scroll "gitlab.com/clseibold/scroll-term/scroll_client"
 )
 
 var CrawlIndex = 4
@@ -58,11 +52,39 @@ type UrlToCrawlData struct {
 type GlobalData struct {
 	domainsCrawled cmap.ConcurrentMap // DomainInfo
 	urlsCrawled    cmap.ConcurrentMap // map[string]struct{}
-	urlsToCrawl    cmap.ConcurrentMap // bool is whether robots.txt should be checked or not
+	urlsToCrawl    *crawlScheduler    // Per-host queues of UrlToCrawlData, handed out as each host's crawl delay allows
 	robotsMap      cmap.ConcurrentMap
 	dbConn         *sql.DB
+	pageSink       PageSink       // Where pages go when there's no DB connection
+	archive        *ArchiveWriter // Where fetched responses are archived, nil to not archive them
 	crawlStartTime time.Time
 
+	// Frontier checkpointing
+	checkpointPath  string
+	checkpointMutex sync.Mutex
+
+	// Retrying failed pages
+	failurePolicy FailurePolicy
+	retries       cmap.ConcurrentMap // int, retries of each url in this crawl
+
+	redirects *redirectMap // Permanent redirects, shared with sub-crawls
+
+	certsSeen cmap.ConcurrentMap // string, fingerprint of the certificate each host (domain:port) was last seen with in this crawl
+
+	// Skip fetching pages that aren't due to be re-crawled yet, see RecrawlCrawler
+	useRecrawlSchedule bool
+
+	// Only follow the entries of feeds that are new since their last crawl, see FeedCrawler
+	feedEntriesOnly bool
+
+	job *CrawlJob // The job the crawl runs as, nil if it isn't one
+
+	// Responses are replayed from an archive rather than fetched, see ReplayArchive
+	replay bool
+
+	// Pages are parsed again even if they haven't changed since the last crawl, see RunBackfillCommand
+	reparse bool
+
 	// Whether to follow links
 	followExternalLinks bool
 	followInternalLinks bool
@@ -71,7 +93,14 @@ type GlobalData struct {
 }
 
 func NewGlobalData(db *sql.DB, followExternalLinks bool, followInternalLinks bool, maxDepth int) *GlobalData {
-	return &GlobalData{cmap.New(), cmap.New(), cmap.New(), cmap.New(), db, time.Now(), followExternalLinks, followInternalLinks, maxDepth, false}
+	gd := &GlobalData{cmap.New(), cmap.New(), nil, cmap.New(), db, nil, nil, time.Now(), "", sync.Mutex{}, DefaultFailurePolicy, cmap.New(), newRedirectMap(), cmap.New(), false, false, nil, false, false, followExternalLinks, followInternalLinks, maxDepth, false}
+	gd.urlsToCrawl = newCrawlScheduler(gd.domainsCrawled, gd.urlsCrawled.Has)
+	if db != nil {
+		gd.redirects.load(db)
+	} else {
+		gd.pageSink = NewJSONLSink(io.Discard)
+	}
+	return gd
 }
 
 // NewSubGlobalData creates a new global data with the same domainsCrawled, urlsCrawled, and robots maps but a different urlsToCrawl List
@@ -81,12 +110,16 @@ func NewGlobalData(db *sql.DB, followExternalLinks bool, followInternalLinks boo
 
 // NewSubGlobalData creates a new global data with the same robots map and domainsCrawled, but with different urlsToCrawl and urlsCrawled Lists
 func NewSubGlobalData(globalData *GlobalData, followExternalLinks bool, followInternalLinks bool, maxDepth int) *GlobalData {
-	return &GlobalData{globalData.domainsCrawled, cmap.New(), cmap.New(), globalData.robotsMap, globalData.dbConn, time.Now(), followExternalLinks, followInternalLinks, maxDepth, true}
+	gd := &GlobalData{globalData.domainsCrawled, cmap.New(), nil, globalData.robotsMap, globalData.dbConn, globalData.pageSink, globalData.archive, time.Now(), "", sync.Mutex{}, globalData.failurePolicy, cmap.New(), globalData.redirects, cmap.New(), false, false, nil, false, globalData.reparse, followExternalLinks, followInternalLinks, maxDepth, true}
+	gd.urlsToCrawl = newCrawlScheduler(gd.domainsCrawled, gd.urlsCrawled.Has)
+	return gd
 }
 
 func (gd *GlobalData) Reset() {
 	gd.urlsCrawled.Clear()
 	gd.urlsToCrawl.Clear()
+	gd.retries.Clear()
+	gd.certsSeen.Clear()
 	gd.crawlStartTime = time.Now()
 
 	if gd.sub {
@@ -96,11 +129,11 @@ func (gd *GlobalData) Reset() {
 }
 
 func (gd *GlobalData) AddUrl(url string, crawlData UrlToCrawlData) {
-	gd.urlsToCrawl.Set(url, crawlData)
+	gd.urlsToCrawl.Add(url, crawlData)
 }
 
 func (gd *GlobalData) ToCrawlCount() int {
-	return gd.urlsToCrawl.Count()
+	return gd.urlsToCrawl.Len()
 }
 
 func (gd *GlobalData) CrawledCount() int {
@@ -108,7 +141,7 @@ func (gd *GlobalData) CrawledCount() int {
 }
 
 func (gd *GlobalData) IsCrawling() bool {
-	return !gd.urlsToCrawl.IsEmpty()
+	return gd.urlsToCrawl.Active()
 }
 
 func (gd *GlobalData) StartCrawlTime() time.Time {
@@ -118,22 +151,18 @@ func (gd *GlobalData) StartCrawlTime() time.Time {
 // CrawlContext supports concurrency
 // TODO: Separate the thread-specific info from the universal info
 type CrawlContext struct {
-	client         gemini.Client
-	nex_client     nex_client.Client
-	scroll_client  scroll.Client
-	spartan_client spartan_client.Client
-	resp           Response
-	currentURL     *neturl.URL
-	isRootPage     bool // If hostname == currentURL
-	currentRobots  Robots
-	globalData     *GlobalData
+	resp          Response
+	currentURL    *neturl.URL
+	isRootPage    bool // If hostname == currentURL
+	currentRobots Robots
+	globalData    *GlobalData
 }
 
 var timeout, _ = time.ParseDuration("10m")
 
 func newCrawlContext(globalData *GlobalData) CrawlContext {
 	url, _ := neturl.Parse("gemini://gemini.circumlunar.space/")
-	return CrawlContext{gemini.Client{NoTimeCheck: true, ReadTimeout: timeout, ConnectTimeout: 15 * time.Second}, nex_client.Client{ReadTimeout: timeout, ConnectTimeout: 15 * time.Second}, scroll.Client{ReadTimeout: timeout, ConnectTimeout: 15 * time.Second, NoTimeCheck: true}, spartan_client.Client{ConnectTimeout: 15 * time.Second, ReadTimeout: timeout}, Response{}, url, true, Robots{}, globalData}
+	return CrawlContext{Response{}, url, true, Robots{}, globalData}
 }
 
 // GetCurrentURL should always return the URL with a slash after the hostname
@@ -191,6 +220,10 @@ func _getPortStringFromScheme(scheme string) string {
 		return "300"
 	} else if scheme == "scroll" {
 		return "5699"
+	} else if scheme == "finger" {
+		return "79"
+	} else if scheme == "guppy" {
+		return "6775"
 	}
 
 	return "1965"
@@ -207,6 +240,10 @@ func _getPortFromScheme(scheme string) int {
 		return 300
 	} else if scheme == "scroll" {
 		return 5699
+	} else if scheme == "finger" {
+		return 79
+	} else if scheme == "guppy" {
+		return 6775
 	}
 
 	return 1965
@@ -268,38 +305,7 @@ func GetHostname(url string) (string, error) {
 func (ctx *CrawlContext) addUrl(url string, crawlData UrlToCrawlData) {
 	//var exists = struct{}{}
 	//c.urlsToCrawl[url] = exists
-	ctx.globalData.urlsToCrawl.Set(url, crawlData)
-}
-
-// Map of domains and their DomainInfo (slowDown time, and lastCrawlTime)
-// Returns true if already existed
-func (ctx *CrawlContext) addDomain(domain string) (bool, DomainInfo) {
-	//var exists = struct{}{}
-	//_, preexists := c.domainsCrawled[domain]
-	//c.domainsCrawled[domain] = exists
-	//return preexists
-
-	if r, ok := ctx.globalData.domainsCrawled.Get(domain); ok {
-		// Domain already exists
-		return true, r.(DomainInfo)
-	} else {
-		domainInfo := DomainInfo{defaultSlowDown, time.Now().UTC()} // NOTE: Added .UTC()
-		ctx.globalData.domainsCrawled.Set(domain, domainInfo)
-		return false, domainInfo
-	}
-}
-
-func (ctx *CrawlContext) getDomain(domain string) (bool, DomainInfo) {
-	r, ok := ctx.globalData.domainsCrawled.Get(domain)
-	return ok, r.(DomainInfo)
-}
-
-func (ctx *CrawlContext) removeUrl(url string) {
-	//var exists = struct{}{}
-	//delete(c.urlsToCrawl, url)
-	ctx.globalData.urlsToCrawl.Remove(url)
-	//c.urlsCrawled[url] = exists
-	ctx.globalData.urlsCrawled.Set(url, Page{})
+	ctx.globalData.urlsToCrawl.Add(url, crawlData)
 }
 
 func (ctx *CrawlContext) setUrlCrawledPageData(url string, page Page) {
@@ -313,69 +319,6 @@ func (c *CrawlContext) removeDomain(domain string) {
 }
 */
 
-func (ctx *CrawlContext) getNextUrl() (string, UrlToCrawlData) {
-	// Randomize getting from the map a little bit
-	var skip int64 = 0
-	if ctx.globalData.urlsToCrawl.Count() > 1 {
-		skip = rand.Int63n(int64(ctx.globalData.urlsToCrawl.Count() - 1)) // TODO
-	}
-	var i int64 = 0
-	for k := range ctx.globalData.urlsToCrawl.IterBuffered() {
-		if i < skip {
-			i++
-			continue
-		}
-		i++
-
-		//c.urlsToCrawl.Remove(k.Key)
-		removed := ctx.globalData.urlsToCrawl.RemoveCb(k.Key, func(key string, v any, exists bool) bool {
-			return exists
-			/*if !exists {
-				return false
-			}*/
-
-			// Check if url's hostname can be crawled at this time. If not, don't remove it and continue on to next url
-			/*host := GetHostname(k.Key)
-			var crawlDelay time.Duration = time.Second
-			if r, ok := c.robotsMap.Get(host); ok {
-				crawlDelay = r.(Robots).indexerGroup.CrawlDelay
-				allow := r.(Robots).indexerGroup.Test(c.currentURL.Path)
-				if !allow {
-					// Not allowed by robots.txt. Skip this URL
-					return false
-				}
-				c.currentRobots = r.(Robots)
-			}*/
-
-			// Check if enough time has passed to be able to crawl
-			/*if domainExists, domainInfo := c.getDomain(host); domainExists {
-				elapsed := time.Since(domainInfo.lastCrawlTime).Seconds()
-				if elapsed >= domainInfo.slowDown && elapsed >= float64(crawlDelay.Seconds()) {
-					// set the new lastCrawlTime
-					newDomainInfo := DomainInfo{math.Max(domainInfo.slowDown, crawlDelay.Seconds()), time.Now().UTC()}
-					c.domainsCrawled.Set(host, newDomainInfo)
-					return exists
-				}
-			}*/
-			// return false
-		})
-		if !removed {
-			continue
-		}
-
-		// If already crawled, continue to next url and leave this one as removed
-		if _, exists := ctx.globalData.urlsCrawled.Get(k.Key); exists {
-			continue
-		}
-
-		// Set as crawled
-		ctx.globalData.urlsCrawled.Set(k.Key, Page{CrawlIndex: CrawlIndex, Date_added: time.Now().UTC()})
-		return k.Key, k.Val.(UrlToCrawlData) // TODO: k.Value should be the URLToCrawlData
-	}
-
-	return "", UrlToCrawlData{}
-}
-
 // GetRobotsTxt gets the robots of a host. The given host must have "/" at the end
 func (ctx *CrawlContext) GetRobotsTxt(host string) (Robots, error) {
 	// Defaults
@@ -383,110 +326,22 @@ func (ctx *CrawlContext) GetRobotsTxt(host string) (Robots, error) {
 	robotsStr := "User-agent: *\nAllow: /"
 	robotsData.robots, _ = robotstxt.FromString(robotsStr) // TODO: Add domains with robots.txt problems to a database table to keep track of them
 
-	if strings.HasPrefix(host, "gemini://") {
-		resp, err := ctx.client.Fetch(host + "robots.txt")
+	u, _ := neturl.Parse(host)
+	if fetcher, ok := GetProtocolFetcher(u.Scheme); ok {
+		dataStr, err := fetcher.FetchRobotsTxt(host)
 		if err != nil && strings.HasSuffix(err.Error(), "bind: An operation on a socket could not be performed because the system lacked sufficient buffer space or because a queue was full.") {
-			logError("Gemini Get Error on robots.txt: %s; %v", err.Error(), err)
+			logger.Error().Str("host", host).Err(err).Msg("Couldn't get robots.txt")
 			return Robots{}, err
-		}
-
-		if err != nil || resp == nil {
-			//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", robotsStr)
-		} else if resp.Status == 44 {
-			return Robots{}, errors.New("Slow down.")
-		} else if resp.Status != gemini.StatusSuccess {
-			//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", robotsStr)
-			resp.Body.Close()
-		} else {
-			data, read_err := io.ReadAll(resp.Body)
-			dataStr := string(data)
-
-			if !strings.Contains(dataStr, "User-Agent:") {
-				// If data doesn't contain "User-Agent:" anywhere, then prepend "User-Agent: *\n" to it.
-				dataStr = "User-Agent: *\n" + dataStr
-			}
-			if read_err == nil {
-				robotsData.robots, _ = robotstxt.FromString(dataStr)
-				//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", dataStr)
-			}
-			resp.Body.Close()
-		}
-	} else if strings.HasPrefix(host, "nex://") {
-		conn, err := ctx.nex_client.Request(host + "robots.txt")
-		if err != nil && strings.HasSuffix(err.Error(), "bind: An operation on a socket could not be performed because the system lacked sufficient buffer space or because a queue was full.") {
-			logError("Nex Get Error on robots.txt: %s; %v", err.Error(), err)
-			return Robots{}, err
-		} else if err != nil {
-		} else {
-			data, read_err := io.ReadAll(conn)
-			dataStr := string(data)
-
-			if !strings.Contains(dataStr, "User-Agent:") {
-				// If data doesn't contain "User-Agent:" anywhere, then prepend "User-Agent: *\n" to it.
-				dataStr = "User-Agent: *\n" + dataStr
-			}
-			if read_err == nil {
-				robotsData.robots, _ = robotstxt.FromString(dataStr)
-				//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", dataStr)
-			}
-			conn.Close()
-		}
-	} else if strings.HasPrefix(host, "scroll://") {
-		resp, err := ctx.scroll_client.Fetch(host+"robots.txt", []string{"en"}, false)
-		if err != nil && strings.HasSuffix(err.Error(), "bind: An operation on a socket could not be performed because the system lacked sufficient buffer space or because a queue was full.") {
-			logError("Scroll Get Error on robots.txt: %s; %v", err.Error(), err)
-			return Robots{}, err
-		}
-
-		if err != nil || resp == nil {
-			//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", robotsStr)
-		} else if resp.Status == 44 {
-			return Robots{}, errors.New("Slow down.")
-		} else if scroll.CleanStatus(resp.Status) != 20 {
-			//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", robotsStr)
-			resp.Body.Close()
-		} else {
-			data, read_err := io.ReadAll(resp.Body)
-			dataStr := string(data)
-
-			if !strings.Contains(dataStr, "User-Agent:") {
-				// If data doesn't contain "User-Agent:" anywhere, then prepend "User-Agent: *\n" to it.
-				dataStr = "User-Agent: *\n" + dataStr
-			}
-			if read_err == nil {
-				robotsData.robots, _ = robotstxt.FromString(dataStr)
-				//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", dataStr)
-			}
-			resp.Body.Close()
-		}
-	} else if strings.HasPrefix(host, "spartan://") {
-		resp, err := ctx.spartan_client.Request(host+"robots.txt", []byte{})
-		if err != nil && strings.HasSuffix(err.Error(), "bind: An operation on a socket could not be performed because the system lacked sufficient buffer space or because a queue was full.") {
-			logError("Scroll Get Error on robots.txt: %s; %v", err.Error(), err)
-			return Robots{}, err
-		}
-
-		if err != nil || resp == nil {
-			//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", robotsStr)
-		} else if resp.Status == 44 {
+		} else if errors.Is(err, ErrSlowDown) {
 			// Return error when there's a slowdown
-			return Robots{}, errors.New("Slow down.")
-		} else if resp.Status != spartan_client.StatusSuccess {
-			//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", robotsStr)
-			resp.Body.Close()
-		} else {
-			data, read_err := io.ReadAll(resp.Body)
-			dataStr := string(data)
-
+			return Robots{}, ErrSlowDown
+		} else if err == nil && dataStr != "" {
 			if !strings.Contains(dataStr, "User-Agent:") {
 				// If data doesn't contain "User-Agent:" anywhere, then prepend "User-Agent: *\n" to it.
 				dataStr = "User-Agent: *\n" + dataStr
 			}
-			if read_err == nil {
-				robotsData.robots, _ = robotstxt.FromString(dataStr)
-				//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", dataStr)
-			}
-			resp.Body.Close()
+			robotsData.robots, _ = robotstxt.FromString(dataStr)
+			//fmt.Printf("Robots: %s\n%s\n\n", host+"robots.txt", dataStr)
 		}
 	}
 
@@ -501,11 +356,13 @@ func (ctx *CrawlContext) GetRobotsTxt(host string) (Robots, error) {
 
 // Get gemini page data
 // Be sure to call cancel
-func (ctx *CrawlContext) Get(url string, crawlThread int, crawlData UrlToCrawlData) (Response, error) {
+// Sets the url as the current url of the context and gets the robots.txt of its host. Returns ErrNotAllowed if robots.txt disallows the url,
+// and ErrRobotsTxtFetched if robots.txt had to be fetched first, in which case the url should be requeued.
+func (ctx *CrawlContext) setCurrentURL(url string) error {
 	ctx.currentURL, _ = neturl.Parse(url)
-	if ctx.currentURL.Scheme != "gemini" && ctx.currentURL.Scheme != "nex" && ctx.currentURL.Scheme != "scroll" && ctx.currentURL.Scheme != "spartan" {
+	if _, ok := GetProtocolFetcher(ctx.currentURL.Scheme); !ok {
 		//c.removeUrl(url) // TODO
-		return Response{}, ErrNotSupportedScheme
+		return ErrNotSupportedScheme
 	}
 
 	// Check if url already crawled
@@ -524,143 +381,59 @@ func (ctx *CrawlContext) Get(url string, crawlThread int, crawlData UrlToCrawlDa
 		//fmt.Printf("Is Root Page[%d]! %s == %s\n", crawlThread, host, c.GetCurrentURL())
 	}
 
-	var crawlDelay time.Duration
 	// Check if host is in robotsMap. If not, get robots.txt. If so, check if allowed to crawl, and return if not.
 	if r, ok := ctx.globalData.robotsMap.Get(host); ok {
-		crawlDelay = r.(Robots).indexerGroup.CrawlDelay
-		allow := r.(Robots).indexerGroup.Test(ctx.currentURL.Path)
+		allow := r.(Robots).indexerGroup.Test(robotsPath(ctx.currentURL))
 		if !allow {
 			//c.removeUrl(url)
-			return Response{}, ErrNotAllowed
+			return ErrNotAllowed
 		}
 		ctx.currentRobots = r.(Robots)
 	} else {
 		// Get robots.txt and insert into map if exists
 		r, err := ctx.GetRobotsTxt(host)
-		if err != nil { // Robots.txt couldn't be fetched, because of no space in buffer (due to socket TIME_WAITs)
-			ctx.globalData.urlsCrawled.Remove(url)
-			ctx.addUrl(url, crawlData)
-			return Response{}, err
+		if err != nil { // Robots.txt couldn't be fetched, because of no space in buffer (due to socket TIME_WAITs), or a slow down
+			return err
 		}
-		crawlDelay = r.indexerGroup.CrawlDelay
-		allow := r.indexerGroup.Test(ctx.currentURL.Path)
+
+		// First time seeing this host, so make sure its root gets crawled too
+		ctx.addUrl(host, UrlToCrawlData{})
+
+		// Let the scheduler space out the requests to this host by its Crawl-Delay
+		crawlDelay := r.indexerGroup.CrawlDelay
+		ctx.globalData.urlsToCrawl.SetCrawlDelay(host, crawlDelay)
+		allow := r.indexerGroup.Test(robotsPath(ctx.currentURL))
 		if !allow {
 			//c.removeUrl(url)
-			return Response{}, ErrNotAllowed
+			return ErrNotAllowed
 		}
 		ctx.currentRobots = r
-		time.Sleep((time.Duration(crawlDelay.Milliseconds()) * time.Millisecond) + time.Second)
-	}
 
-	// Default to crawl delay of 2 seconds
-	if crawlDelay == time.Duration(0) {
-		crawlDelay = time.Duration(defaultSlowDown) * time.Second
+		// Fetching robots.txt was this host's request for now, so the url waits in the frontier for the host's crawl delay
+		return ErrRobotsTxtFetched
 	}
+	return nil
+}
 
-	domainPreexists, domainInfo := ctx.addDomain(host)
-	if !domainPreexists { // TODO
-		ctx.addUrl(host, UrlToCrawlData{})
-	} else {
-		// Check if enough time has passed
-		elapsed := time.Since(domainInfo.lastCrawlTime).Seconds()
-		if elapsed >= domainInfo.slowDown && elapsed >= crawlDelay.Seconds() {
-			// Go Ahead and crawl the page and set the new lastCrawlTime
-			newDomainInfo := DomainInfo{math.Max(domainInfo.slowDown, crawlDelay.Seconds()), time.Now().UTC()} // NOTE: Added .UTC()
-			ctx.globalData.domainsCrawled.Set(host, newDomainInfo)
-			//fmt.Printf("Allowed Crawl: %s; %v\n", ctx.GetCurrentURL(), newDomainInfo)
-		} else {
-			// Skip the page, add the url back in, and remove from urlsCrawled
-			//fmt.Printf("Not Allowed to Crawl Yet: %s (%fs); %v\n", ctx.GetCurrentURL(), domainInfo.slowDown, domainInfo)
-			ctx.globalData.urlsCrawled.Remove(url)
-			ctx.addUrl(url, crawlData)
-			return Response{}, ErrSlowDown
-		}
+func (ctx *CrawlContext) Get(url string, crawlThread int, crawlData UrlToCrawlData) (Response, error) {
+	if err := ctx.setCurrentURL(url); err != nil {
+		return Response{}, err
 	}
 
-	//c.removeUrl(url)
-	var err error
-	var resp Response
-	if ctx.currentURL.Scheme == "gemini" {
-		var g_resp *gemini.Response
-		g_resp, err = ctx.client.Fetch(url)
-		if err == nil {
-			resp.Status = g_resp.Status
-			resp.Description = g_resp.Meta
-			if resp.Description == "" && (resp.Status >= 20 && resp.Status <= 29) {
-				if beforeQuery, _, _ := strings.Cut(url, "?"); strings.HasSuffix(beforeQuery, ".scroll") {
-					resp.Description = "text/scroll"
-				} else if strings.HasSuffix(beforeQuery, ".gmi") || strings.HasSuffix(beforeQuery, ".gemini") {
-					resp.Description = "text/gemini"
-				} else if strings.HasSuffix(beforeQuery, "/") {
-					resp.Description = "text/gemini"
-				}
-			}
-			resp.Body = g_resp.Body
-			resp.Cert = g_resp.Cert
-			ctx.resp = resp
-		}
-	} else if ctx.currentURL.Scheme == "nex" {
-		var conn net.Conn
-		conn, err = ctx.nex_client.Request(url)
-		if err == nil {
-			resp.Status = 20
-			resp.Description = ""
-			if beforeQuery, _, _ := strings.Cut(url, "?"); strings.HasSuffix(beforeQuery, "/") {
-				// Nex Listings use a "/" at the end of the path.
-				resp.Description = "text/nex"
-			}
-			resp.Body = conn
-			resp.Cert = nil
-			ctx.resp = resp
-		}
-	} else if ctx.currentURL.Scheme == "scroll" {
-		var s_resp *scroll.Response
-		s_resp, err = ctx.scroll_client.Fetch(url, []string{}, false)
-		if err == nil {
-			resp.Status = s_resp.Status
-			resp.Description = s_resp.Description
-			if resp.Description == "" && (resp.Status >= 20 && resp.Status <= 29) {
-				if beforeQuery, _, _ := strings.Cut(url, "?"); strings.HasSuffix(beforeQuery, ".scroll") {
-					resp.Description = "text/scroll"
-				} else if strings.HasSuffix(beforeQuery, ".gmi") || strings.HasSuffix(beforeQuery, ".gemini") {
-					resp.Description = "text/gemini"
-				} else if strings.HasSuffix(beforeQuery, "/") {
-					resp.Description = "text/scroll"
-				}
-			}
-			resp.Body = s_resp.Body
-			resp.Author = s_resp.Author
-			resp.PublishDate = s_resp.PublishDate
-			resp.ModificationDate = s_resp.ModificationDate
-			resp.Cert = s_resp.Cert
-			ctx.resp = resp
-		}
-	} else if ctx.currentURL.Scheme == "spartan" {
-		var s_resp *spartan_client.Response
-		s_resp, err = ctx.spartan_client.Request(url, []byte{})
-		if err == nil {
-			if s_resp.Status == spartan_client.StatusSuccess {
-				resp.Status = 20
-			} else if s_resp.Status == spartan_client.StatusRedirect {
-				resp.Status = gemini.StatusRedirect
-			} else if s_resp.Status == 4 { // Client Error
-				resp.Status = gemini.StatusBadRequest
-			} else if s_resp.Status == 5 { // Server Error
-				resp.Status = gemini.StatusTemporaryFailure
-			}
-			resp.Description = s_resp.Meta
-			if resp.Description == "" && (resp.Status >= 20 && resp.Status <= 29) {
-				if beforeQuery, _, _ := strings.Cut(url, "?"); strings.HasSuffix(beforeQuery, ".scroll") {
-					resp.Description = "text/scroll"
-				} else if strings.HasSuffix(beforeQuery, ".gmi") || strings.HasSuffix(beforeQuery, ".gemini") {
-					resp.Description = "text/gemini"
-				} else if strings.HasSuffix(beforeQuery, "/") {
-					resp.Description = "text/gemini"
-				}
-			}
-			resp.Body = s_resp.Body
-			ctx.resp = resp
+	// setCurrentURL only accepts schemes with a registered fetcher
+	fetcher, _ := GetProtocolFetcher(ctx.currentURL.Scheme)
+	resp, err := fetcher.Fetch(url)
+	if err != nil {
+		metrics.countFetch(ctx.currentURL.Scheme, "error")
+	} else {
+		metrics.countFetch(ctx.currentURL.Scheme, strconv.Itoa(resp.Status))
+		resp.Body = metrics.countBody(resp.Body)
+		ctx.globalData.job.countFetch(resp.Status)
+		resp.Body = ctx.globalData.job.countBody(resp.Body)
+		if ctx.globalData.archive != nil {
+			resp = ctx.globalData.archive.archiveResponse(url, resp)
 		}
+		ctx.resp = resp
 	}
 
 	return resp, err
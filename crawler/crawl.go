@@ -8,69 +8,23 @@ import (
 	"fmt"
 	"io"
 	"mime"
-	"os"
+	neturl "net/url"
 	"path"
 	"runtime/debug"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
-	"github.com/barasher/go-exiftool"
 	gemini "github.com/clseibold/go-gemini"
 	"github.com/dhowden/tag"
 	"github.com/gabriel-vasile/mimetype"
 	"github.com/go-enry/go-enry/v2"
 	"github.com/pemistahl/lingua-go"
+	"github.com/rivo/uniseg"
 )
 
-var skip = map[string]bool{
-	"gemini://gemini.bortzmeyer.org/": true,
-	"gemini://techrights.org/":        true,
-	"gemini://gemini.techrights.org/": true,
-	"gemini://selve.xyz/":             true, // application/octet-stream weirdness
-	"gemini://kvazar.duckdns.org/":    true,
-
-	//"gemini://diesenbacher.net/": true, // robots.txt weirdness (no User-Agent groups specified)
-
-	"gemini://localhost/":                        true,
-	"gemini://192.168.4.26/":                     true,
-	"gemini://fumble-around.mediocregopher.com/": true,
-	"gemini://akewebdump.ddns.net/":              true, // Error on homepage
-	"gemini://illegaldrugs.net/":                 true,
-	"gemini://source.community/":                 true, // Error on invite link
-	"gemini://singletona082.flounder.online/":    true, // Malformed strings
-	"gemini://godocs.io/":                        true,
-	"gemini://taz.de/":                           true,
-
-	"gemini://scrollprotocol.us.to/": true, // Scroll to Gemini proxy/mirror
-}
-
-var skipUrls = map[string]bool{
-	"gemini://eph.smol.pub/Alegreya.fontpack":                  true,
-	"gemini://tskaalgard.midnight.pub:1965/Autumn.jpg":         true,
-	"gemini://gemini.conman.org/test/torture/":                 true,
-	"gemini://gemini.conman.org/test/torture":                  true,
-	"gemini://gemi.dev/cgi-bin/witw.cgi/play":                  true,
-	"gemini://gemi.dev/cgi-bin":                                true, // TODO
-	"gemini://kennedy.gemi.dev/image-search":                   true,
-	"gemini://kennedy.gemi.dev/hashtags":                       true,
-	"gemini://kennedy.gemi.dev/mentions":                       true,
-	"gemini://hashnix.club/cgi/radio.cgi":                      true,
-	"gemini://gemini.circumlunar.space/users/fgaz/calculator/": true,
-
-	"gemini://topotun.hldns.ru/music/%D0%AE%D1%80%D0%B8%D0%B9_%D0%A8%D0%B8%D0%BC%D0%B0%D0%BD%D0%BE%D0%B2%D1%81%D0%BA%D0%B8%D0%B9-%D0%9C%D0%B0%D0%B9%D0%B4%D0%B0%D0%BD.mp3": true, // malformed string (possibly in mp3 metadata)
-	"gemini://topotun.dynu.com/music/%D0%AE%D1%80%D0%B8%D0%B9_%D0%A8%D0%B8%D0%BC%D0%B0%D0%BD%D0%BE%D0%B2%D1%81%D0%BA%D0%B8%D0%B9-%D0%9C%D0%B0%D0%B9%D0%B4%D0%B0%D0%BD.mp3": true, // malformed string (possibly in mp3 metadata), seems to be a mirror or alt. url of the above link
-	"gemini://asdfghasdfgh.de/media/1860-scott-au-clair-de-la-lune-05-09.ogg":                                                                                              true, // malformed string in audio metadata
-	"gemini://gemini.ctrl-c.club/~singletona082/fiction/blue_shadows/nightwatch.gmi":                                                                                       true, // malformed string in headings
-	"gemini://singletona082.flounder.online/fiction/blue_shadows/nightwatch.gmi":                                                                                           true, // malformed string
-
-	"gemini://source.community/invite/":       true, // Some error with the db, possibly prompt is too long
-	"spartan://gmi.noulin.net/stackoverflow/": true, // Mirror
-
-	"nex://auragem.ddns.net/scrollprotocol/": true, // Scroll to nex proxy/mirror
-}
-
 // breakSeconds is the number of seconds to wait when there's no new URLs before breaking.
 func Crawl(globalData *GlobalData, crawlThread int, wg *sync.WaitGroup, breakSeconds int) {
 	defer func() {
@@ -86,7 +40,7 @@ func Crawl(globalData *GlobalData, crawlThread int, wg *sync.WaitGroup, breakSec
 			case string:
 				panicString = r
 			}
-			fmt.Printf("Cralwer panic: %s\n%s\n", panicString, string(debug.Stack()))
+			logger.Error().Int("thread", crawlThread).Str("panic", panicString).Str("stack", string(debug.Stack())).Msg("Crawler panic")
 
 			// Restart the crawler goroutine
 			if wg != nil {
@@ -98,113 +52,120 @@ func Crawl(globalData *GlobalData, crawlThread int, wg *sync.WaitGroup, breakSec
 
 	ctx := newCrawlContext(globalData)
 
-	breakCounter := 0
-	//for i := 0; i < 900000; i++ {
 	for {
-		//fmt.Printf("\n")
-		nextUrl, crawlData := ctx.getNextUrl()                                                     // Note: Removes the url from urlsToCrawl
-		if nextUrl == "" && breakCounter >= ((1000/threadSleepDurationMiliSeconds)*breakSeconds) { // Break only after 60 seconds (since 10ms delay with each)
-			fmt.Printf("Nothing next. Breaking.\n")
+		if !globalData.job.waitIfPaused() {
+			logger.Info().Int("thread", crawlThread).Msg("Crawl cancelled")
+			break
+		}
+		nextUrl, crawlData, ok := globalData.urlsToCrawl.Next(time.Duration(breakSeconds) * time.Second) // Note: Waits until a host is ready to be crawled
+		if !ok {
+			logger.Info().Int("thread", crawlThread).Msg("Nothing left to crawl")
 			break
-		} else if nextUrl == "" {
-			breakCounter++
-			sleepDuration, _ := time.ParseDuration(threadSleepDurationString)
-			time.Sleep(sleepDuration)
-			continue
-		} else {
-			breakCounter = 0
 		}
 
-		hostname, hostnameErr := GetHostname(nextUrl)
-		if hostnameErr != nil || skip[hostname] || skipUrls[nextUrl] || strings.HasPrefix(nextUrl, "gemini://kennedy.gemi.dev/hashtags/") || strings.HasPrefix(nextUrl, "gemini://kennedy.gemi.dev/hashtags") || strings.HasPrefix(nextUrl, "gemini://kennedy.gemi.dev/mentions/") || strings.HasPrefix(nextUrl, "gemini://kennedy.gemi.dev/mentions") || strings.HasPrefix(nextUrl, "gemini://gemi.dev/cgi-bin/witw.cgi/play") || strings.HasPrefix(nextUrl, "gemini://gemini.thegonz.net/gemsokoban") {
-			//sleepDuration, _ := time.ParseDuration(threadSleepDurationString)
-			//time.Sleep(sleepDuration)
-			continue
+		// Set as crawled
+		globalData.urlsCrawled.Set(nextUrl, Page{CrawlIndex: CrawlIndex, Date_added: time.Now().UTC()})
+		crawlUrl(&ctx, crawlThread, nextUrl, crawlData)
+	}
+
+	//ctx.flush()
+
+	//fmt.Printf("\n%v", ctx.urlsToCrawl)
+	logger.Info().Int("thread", crawlThread).Msg("Thread exited")
+}
+
+// Fetches and handles a single url taken from the frontier
+func crawlUrl(ctx *CrawlContext, crawlThread int, nextUrl string, crawlData UrlToCrawlData) {
+	// Done with this url (whether it got crawled or requeued), so the next url of this host can be scheduled
+	defer ctx.globalData.urlsToCrawl.Done(nextUrl)
+
+	if _, hostnameErr := GetHostname(nextUrl); hostnameErr != nil || MatchCrawlRules(nextUrl).Skip {
+		return
+	}
+	skipped, err := skipNotDueUrl(ctx, nextUrl, crawlData)
+	if skipped {
+		return
+	}
+
+	//fmt.Printf("[%d] %d out of %d left to crawl\n", crawlThread, globalData.urlsToCrawl.Count(), globalData.urlsCrawled.Count()+globalData.urlsToCrawl.Count())
+
+	var resp Response
+	if err == nil {
+		resp, err = ctx.Get(nextUrl, crawlThread, crawlData)
+	}
+	if err != nil && strings.HasSuffix(err.Error(), "bind: An operation on a socket could not be performed because the system lacked sufficient buffer space or because a queue was full.") {
+		//logError("Waiting for a socket's TIME_WAIT to end")
+		time.Sleep(timeWaitDelay)
+		// Add url back to crawl list and remove from urlsCrawled
+		ctx.globalData.urlsCrawled.Remove(nextUrl)
+		ctx.addUrl(nextUrl, crawlData)
+		return
+	} else if errors.Is(err, ErrRobotsTxtFetched) {
+		// Add url back to crawl list so that the scheduler crawls it once the host's crawl delay has passed
+		ctx.globalData.urlsCrawled.Remove(nextUrl)
+		ctx.addUrl(nextUrl, crawlData)
+		return
+	} else if errors.Is(err, ErrSlowDown) {
+		// Slow down while getting robots.txt
+		handleSlowDown(*ctx, crawlThread, nextUrl, crawlData)
+		return
+	} else if err != nil || (resp == Response{}) || resp.Body == nil {
+		if err != nil && !errors.Is(err, ErrNotAllowed) {
+			ctx.globalData.job.countFailure(0)
 		}
-		// Go through each skip url to check them as a prefix
-		for prefix := range skipUrls {
-			if strings.HasPrefix(nextUrl, prefix) {
-				continue
-			}
+		if err != nil && !errors.Is(err, ErrNotAllowed) && !strings.HasSuffix(err.Error(), "connectex: No connection could be made because the target machine actively refused it.") {
+			logger.Error().Int("thread", crawlThread).Str("url", nextUrl).Err(err).Msg("Couldn't fetch url")
 		}
+		return
+	}
 
-		//fmt.Printf("[%d] %d out of %d left to crawl\n", crawlThread, globalData.urlsToCrawl.Count(), globalData.urlsCrawled.Count()+globalData.urlsToCrawl.Count())
+	if resp.Cert != nil {
+		recordCert(*ctx, resp.Cert)
+	}
 
-		resp, err := ctx.Get(nextUrl, crawlThread, crawlData)
-		if err != nil && strings.HasSuffix(err.Error(), "bind: An operation on a socket could not be performed because the system lacked sufficient buffer space or because a queue was full.") {
-			//logError("Waiting for a socket's TIME_WAIT to end")
-			time.Sleep(timeWaitDelay)
-			// Add url back to crawl list and remove from urlsCrawled
-			ctx.globalData.urlsCrawled.Remove(nextUrl)
-			ctx.addUrl(nextUrl, crawlData)
-			continue
-		} else if err != nil || (resp == Response{}) || resp.Body == nil {
-			if !errors.Is(err, ErrSlowDown) && !strings.HasSuffix(err.Error(), "not allowed by robots.txt; not allowed by robots.txt") && !strings.HasSuffix(err.Error(), "connectex: No connection could be made because the target machine actively refused it.") {
-				logError("Gemini Get Error for '%s': %s; %v", nextUrl, err.Error(), err)
-				sleepDuration, _ := time.ParseDuration(threadSleepDurationString)
-				time.Sleep(sleepDuration)
-				continue
-			}
-			sleepDuration, _ := time.ParseDuration(threadSleepDurationString)
-			time.Sleep(sleepDuration)
-			// Add url back to crawl list and remove from urlsCrawled
-			ctx.globalData.urlsCrawled.Remove(nextUrl)
-			ctx.addUrl(nextUrl, crawlData)
-			continue
-		}
+	//defer cancel()
+	var status int = resp.Status
+	var meta string = resp.Description
 
-		//defer cancel()
-		var status int = resp.Status
-		var meta string = resp.Description
-
-		if meta == "" {
-			domainIncrementEmptyMeta(ctx, ctx.GetDomain())
-		}
-
-		//fmt.Printf("Status: %d\n", status)
-		//defer resp.Body.Close()
-		switch status {
-		case gemini.StatusInput:
-			handleInput(ctx, crawlData)
-		case gemini.StatusSensitiveInput:
-		case gemini.StatusSuccess, 21, 22, 23, 24, 25, 26, 27, 28, 29:
-			handleSuccess(ctx, crawlThread, crawlData)
-		case gemini.StatusRedirect:
-			handleRedirect(ctx, false, crawlData)
-		//case gemini.StatusPermanentRedirect:
-		case gemini.StatusRedirectPermanent:
-			handleRedirect(ctx, true, crawlData)
-			// TODO: Add this to a permanent redirect list, and remove the original url from the index if it exists
-		case gemini.StatusTemporaryFailure:
-		case gemini.StatusUnavailable: // StatusServerUnavailable
-		case gemini.StatusCGIError: // TODO
-		case gemini.StatusProxyError: // TODO
-		case gemini.StatusSlowDown:
-			handleSlowDown(ctx, crawlThread, nextUrl, crawlData)
-		case gemini.StatusPermanentFailure:
-			handleFailure(ctx)
-		case gemini.StatusNotFound:
-			handleFailure(ctx)
-		case gemini.StatusGone:
-			handleFailure(ctx)
-		case gemini.StatusProxyRequestRefused:
-		case gemini.StatusBadRequest:
-			handleFailure(ctx)
-		case gemini.StatusClientCertificateRequired: //StatusCertificateRequired:
-		case gemini.StatusCertificateNotAuthorised: //StatusCertificateNotAuthorized:
-		case gemini.StatusCertificateNotValid:
-		}
-
-		resp.Body.Close()
-
-		sleepDuration, _ := time.ParseDuration(threadSleepDurationString)
-		time.Sleep(sleepDuration)
+	if meta == "" {
+		domainIncrementEmptyMeta(*ctx, ctx.GetDomain())
 	}
 
-	//ctx.flush()
+	//fmt.Printf("Status: %d\n", status)
+	//defer resp.Body.Close()
+	if status < 40 {
+		clearPageFailures(*ctx, nextUrl)
+	}
+	switch status {
+	case gemini.StatusInput:
+		handleInput(*ctx, crawlData)
+	case gemini.StatusSensitiveInput:
+	case gemini.StatusSuccess, 21, 22, 23, 24, 25, 26, 27, 28, 29:
+		handleSuccess(*ctx, crawlThread, crawlData)
+	case gemini.StatusRedirect:
+		handleRedirect(*ctx, false, crawlData)
+	//case gemini.StatusPermanentRedirect:
+	case gemini.StatusRedirectPermanent:
+		handleRedirect(*ctx, true, crawlData)
+	case gemini.StatusTemporaryFailure, gemini.StatusUnavailable, gemini.StatusCGIError, gemini.StatusProxyError: // StatusServerUnavailable
+		handleTemporaryFailure(*ctx, crawlThread, nextUrl, crawlData)
+	case gemini.StatusSlowDown:
+		handleSlowDown(*ctx, crawlThread, nextUrl, crawlData)
+	case gemini.StatusPermanentFailure:
+		handleFailure(*ctx)
+	case gemini.StatusNotFound:
+		handleFailure(*ctx)
+	case gemini.StatusGone:
+		handleFailure(*ctx)
+	case gemini.StatusProxyRequestRefused:
+	case gemini.StatusBadRequest:
+		handleFailure(*ctx)
+	case gemini.StatusClientCertificateRequired: //StatusCertificateRequired:
+	case gemini.StatusCertificateNotAuthorised: //StatusCertificateNotAuthorized:
+	case gemini.StatusCertificateNotValid:
+	}
 
-	//fmt.Printf("\n%v", ctx.urlsToCrawl)
-	fmt.Printf("Thread %d exited.\n", crawlThread)
+	resp.Body.Close()
 }
 
 func handleInput(ctx CrawlContext, crawlData UrlToCrawlData) {
@@ -225,7 +186,7 @@ func handleInput(ctx CrawlContext, crawlData UrlToCrawlData) {
 	hashStr := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
 
 	UDCClass := "4" // Unclassed
-	page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, "text/plain", "UTF-8", "", linecount, UDCClass, "", prompt, "", len(prompt), hashStr, false, time.Time{}, time.Now().UTC(), "", "", "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), false, false}
+	page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, "text/plain", "UTF-8", "", linecount, 0, UDCClass, "", prompt, "", len(prompt), hashStr, false, time.Time{}, time.Now().UTC(), "", "", "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), false, false}
 	success = false
 	page, success = addPageToDb(ctx, page)
 	if !success {
@@ -238,33 +199,41 @@ func handleInput(ctx CrawlContext, crawlData UrlToCrawlData) {
 		link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
 		if !link_success {
 			// TODO: Log error and Ignore for now
-			logError("Couldn't Add Link to Db: %v; Page: %v", link, page)
+			logger.Error().Str("url", page.Url).Int("from", link.FromPageId).Int("to", link.ToPageId).Msg("Couldn't add link")
 		}
 	}
 }
 
-// Hides URL from DB: used for Permanent Failure, Not Found, Gone, and Bad Request statuses.
-// TODO: Add a retry mechanism (with a max number of retries)
-func handleFailure(ctx CrawlContext) {
-	setPageToHidden(ctx, ctx.GetCurrentURL())
-}
-
 func handleRedirect(ctx CrawlContext, permanent bool, crawlData UrlToCrawlData) {
 	meta := strings.TrimSpace(ctx.resp.Description)
 	url, err := ctx.currentURL.Parse(meta)
 	if err != nil {
 		return
 	}
-	if _, ok := ctx.globalData.urlsCrawled.Get(url.String()); /*ctx.urlsCrawled[url.String()];*/ ok {
-		return
+	url.Fragment = "" // Strip the fragment
+
+	if permanent {
+		// Record the redirect so that links to the old url get rewritten before they're fetched, and hide the old url from results.
+		// The old page's links get merged into the new page once it's added.
+		if url.String() == ctx.GetCurrentURL() || !ctx.globalData.redirects.Add(ctx.GetCurrentURL(), url.String()) {
+			logger.Error().Str("from", ctx.GetCurrentURL()).Str("to", url.String()).Msg("Redirect loop")
+			return
+		}
+		addRedirectToDb(ctx, ctx.GetCurrentURL(), url.String())
+		setPageToHidden(ctx, ctx.GetCurrentURL())
 	}
 
-	/*if permanent {
-		// TODO: Add to a permanent redirects table.
-		// TODO: Fetch this table into a list of urls before the crawler starts crawling, that way all links can be checked and changed before having to fetch the url that will redirect
-	}*/
+	// Go straight to the end of any known redirect chain
+	target, ok := ctx.globalData.redirects.Resolve(url.String())
+	if !ok {
+		logger.Error().Str("from", ctx.GetCurrentURL()).Str("to", url.String()).Msg("Redirect loop")
+		return
+	}
+	if _, ok := ctx.globalData.urlsCrawled.Get(target); /*ctx.urlsCrawled[url.String()];*/ ok {
+		return
+	}
 
-	ctx.addUrl(url.String(), crawlData) // NOTE: The crawlData passes over into the redirect url. Do I want this?
+	ctx.addUrl(target, crawlData) // NOTE: The crawlData passes over into the redirect url. Do I want this?
 }
 
 func handleSlowDown(ctx CrawlContext, crawlThread int, url string, crawlData UrlToCrawlData) {
@@ -273,6 +242,8 @@ func handleSlowDown(ctx CrawlContext, crawlThread int, url string, crawlData Url
 	// Increment SlowDownCount in Db
 	domain := ctx.GetDomain()
 	domainIncrementSlowDownCount(ctx, domain)
+	ctx.globalData.job.countSlowDown()
+	metrics.slowDowns.Add(1)
 
 	//meta := ctx.resp.Meta
 	// Parse meta into int and add to SlowDown // No longer parse META field as int.
@@ -280,22 +251,10 @@ func handleSlowDown(ctx CrawlContext, crawlThread int, url string, crawlData Url
 	if err != nil {
 	}*/
 
-	r, exists := ctx.globalData.domainsCrawled.Get(hostname)
-	if exists {
-		domainInfo := r.(DomainInfo)
-		domainInfo.slowDown = defaultSlowDown * 2
-		ctx.globalData.domainsCrawled.Set(hostname, domainInfo)
-		fmt.Printf("[%d] Slow Down: %v (%.0fs); %v", crawlThread, hostname, defaultSlowDown*2, domainInfo)
-		//logError("Slow Down: %v (%ds)", hostname, i)
-	} else {
-		domainInfo := DomainInfo{defaultSlowDown, time.Now().UTC()}
-		ctx.globalData.domainsCrawled.Set(hostname, domainInfo)
-		fmt.Printf("[%d] Slow Down: %v (%.0fs); %v", crawlThread, hostname, defaultSlowDown, domainInfo)
-		//logError("Slow Down: %v (%ds)", hostname, i)
-	}
-
-	// Give time for other threads to get other links before adding this one back onto the map
-	time.Sleep(time.Second * 1)
+	// Back off the host. The scheduler won't hand out any of its urls until the new slowdown has passed.
+	slowDown := ctx.globalData.urlsToCrawl.Backoff(hostname)
+	logger.Info().Int("thread", crawlThread).Str("host", hostname).Float64("slowDown", slowDown).Msg("Slow down")
+	//logError("Slow Down: %v (%ds)", hostname, i)
 
 	// Add url back to crawl list and remove from urlsCrawled
 	ctx.globalData.urlsCrawled.Remove(url)
@@ -306,6 +265,7 @@ var langDetector = lingua.NewLanguageDetectorBuilder().FromAllLanguages().Build(
 
 func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData) {
 	meta := ctx.resp.Description
+	rules := MatchCrawlRules(ctx.GetCurrentURL())
 	/*if meta == "" && ctx.currentURL.Scheme == "gemini" {
 		meta = "text/gemini; charset=utf-8"
 	} else if meta == "" && ctx.currentURL.Scheme == "scroll" {
@@ -324,13 +284,22 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 	mediatype := ""
 	var charset string = ""
 	var language string = ""
-	data, err := io.ReadAll(io.LimitReader(ctx.resp.Body, 1024*1024*200)) // 200 MiB Max
+	data, err := io.ReadAll(io.LimitReader(ctx.resp.Body, maxBodySize))
 	if err != nil {
 		// Add url back to crawl list and remove from urlsCrawled
 		//ctx.globalData.urlsCrawled.Remove(ctx.GetCurrentURL())
 		//ctx.addUrl(ctx.GetCurrentURL(), crawlData)
 		return
 	}
+
+	// Skip re-parsing if the content hasn't changed since the last crawl. Replayed and backfilled responses are always re-parsed.
+	if !recordContentHash(ctx, ctx.GetCurrentURL(), hashContent(data)) && !ctx.globalData.replay && !ctx.globalData.reparse {
+		if page, exists := getPageFromDb(ctx, ctx.GetCurrentURL()); exists && !page.Hidden {
+			handleUnchangedPage(ctx, page, crawlData, true)
+			return
+		}
+	}
+
 	if meta != "" && !strings.HasPrefix(meta, "application/octet-stream") && !strings.HasPrefix(meta, "octet-stream") {
 		var params map[string]string
 		mediatype, params, _ = mime.ParseMediaType(meta)
@@ -349,6 +318,8 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 			mediatype = "text/gemini"
 		} else if strings.HasPrefix(ctx.GetCurrentURL(), "nex://") {
 			mediatype = "text/nex"
+		} else if strings.HasPrefix(ctx.GetCurrentURL(), "gopher://") {
+			mediatype = GophermapMediatype
 		}
 	} else {
 		if strings.HasSuffix(ctx.currentURL.Path, ".gmi") || strings.HasSuffix(ctx.currentURL.Path, ".gemini") {
@@ -384,236 +355,36 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 		//fmt.Printf("Not Root, Domain: %s, %d\n", domain.Domain, domain.Id)
 	}
 
-	if mediatype == "text/gemini" || mediatype == "text/spartan" || mediatype == "text/scroll" {
-		var strippedTextBuilder strings.Builder
-		tagsMap := make(map[string]float64)
-		mentionsMap := make(map[string]bool)
-		links := make([]GeminiLink, 0)
-		update := true
-		// TODO: Some articles have "📅" on a line prefixed before a publication date
-		geminiTitle, linecount, headings, _, size, isFeed := ctx.GetGeminiPageInfo2(bytes.NewReader(data), &tagsMap, &mentionsMap, &links, &strippedTextBuilder, update)
-		// Exclude tag pages from being considered feeds
-		if strings.Contains(ctx.GetCurrentURL(), "/tag/") || strings.Contains(ctx.GetCurrentURL(), "/tags/") {
-			isFeed = false
-		}
-		// Manually handle title for gemini://station.martinrue.com
-		if ctx.GetCurrentURL() == "gemini://station.martinrue.com/" {
-			geminiTitle = "Station"
-		} else if ctx.GetCurrentURL() == "gemini://hashnix.club/" {
-			geminiTitle = "Hashnix Club"
-		} else if ctx.GetCurrentURL() == "gemini://warmedal.se/~antenna-dev/" {
-			geminiTitle = "Antenna Dev"
-		}
-
-		if geminiTitle == "" || !ContainsLetterRunes(geminiTitle) {
-			if crawlData.PageFrom_InternalLink {
-				geminiTitle = crawlData.PageFrom_LinkText
-			}
-		}
-
-		if strings.ToLower(strings.TrimSpace(geminiTitle)) == "directory listing" {
-			geminiTitle = ctx.GetCurrentURL()
-		}
-
-		// Publication Date Handling: Get from internal link, overwrite from title or filename if available // TODO: Check for dates in the path directories just above the file
-		timeCutoff := time.Now().Add(time.Hour * 24).UTC()
-		publicationDate := ctx.resp.PublishDate
-		if crawlData.PageFrom_InternalLink {
-			date := getTimeDate(crawlData.PageFrom_LinkText, false)
-			if (date != time.Time{} && !date.After(timeCutoff)) {
-				publicationDate = date
-			}
-		}
-		if !strings.Contains(ctx.GetCurrentURL(), "~Cosmos/thread") {
-			date := getTimeDate(geminiTitle, false)
-			if (date != time.Time{} && !date.After(timeCutoff)) {
-				publicationDate = date
-			}
-		}
-		// TODO: Hacky - don't get publishdate from filename if "commit" or "~Cosmos/thread" is in the URL, so that there's no false positives with hashes, and Cosmos threads aren't included
-		if !strings.Contains(ctx.GetCurrentURL(), "commit/") && !strings.Contains(ctx.GetCurrentURL(), "commits/") && !strings.Contains(ctx.GetCurrentURL(), "~Cosmos/thread") {
-			_, filename := path.Split(ctx.GetCurrentURL())
-			publicationDate2 := getTimeDate(filename, true)
-			if (publicationDate2 != time.Time{} && !publicationDate2.After(timeCutoff)) {
-				publicationDate = publicationDate2
-			}
-		}
-
-		// If publication date is in the future, then reset publicationDate to time.Time{}
-		if publicationDate.After(timeCutoff) {
-			publicationDate = time.Time{}
-		}
-
+	if parser, ok := GetDocumentParser(mediatype); ok { // Gemtext, nex listings, gophermaps, markdown, and the other markup formats
+		handleDocument(ctx, crawlData, rules, parser.ParseDocument(data), data, domain, mediatype, charset, language, UDCClass)
+	} else if feedTitle, feedEntries, isXMLFeed := parseXMLFeed(mediatype, data); isXMLFeed { // Atom and RSS feeds
 		textStr := string(data)
-		hasher := sha256.New()
-		hasher.Write([]byte(textStr))
-		hashStr := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
-
-		// If root page of domain, update the db domain information to include title
-		if ctx.isRootPage {
-			//fmt.Printf("Getting Domain for Root %s\n", ctx.currentURL)
-			domain.Title = geminiTitle
-			var success bool = false
-			domain, success = addDomainToDb(ctx, domain, true)
-			if !success {
-				return // TODO
-			}
-			//fmt.Printf("DomainId of %s: %d\n", ctx.currentURL, domain.Id)
-		}
-
-		// Update the entry in the db if needed.
-		//if update {
-		urlString := ctx.GetCurrentURL()
-		scheme := strings.ToLower(strings.TrimSuffix(ctx.currentURL.Scheme, "://"))
-		hidden := false
-
-		// If there's non-hidden duplicates from same scheme, hide this page
-		if len(getPagesWithHashAndScheme(ctx, urlString, hashStr, scheme)) > 0 {
-			hidden = true
-		}
-
-		hasDuplicateOnGemini := false
-		if scheme == "gemini" {
-			// If there's pages on other protocols with the hash, and current scheme is gemini, then set all of those others as having gemini duplicate.
-			if len(getPagesWithHashAndNotScheme(ctx, urlString, hashStr, scheme)) > 0 {
-				setPageHashHasGeminiDuplicate(ctx, urlString, hashStr, true)
-			}
-		} else {
-			// If there's a gemini page with the hash that is not hidden, then set hasDuplicateOnGemini
-			if len(getPagesWithHashAndScheme(ctx, urlString, hashStr, "gemini")) > 0 {
-				hasDuplicateOnGemini = true
-			}
-		}
-
-		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, linecount, UDCClass, geminiTitle, "", headings, size, hashStr, isFeed, publicationDate, time.Now().UTC(), "", "", "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
-		var success bool = false
-		page, success = addPageToDb(ctx, page)
-		if !success {
-			return
-		}
-		ctx.setUrlCrawledPageData(urlString, page)
+		size := len(data)
+		linecount := strings.Count(textStr, "\n")
+		feedEntries = ctx.resolveFeedEntries(feedEntries)
 
-		// If this page was linked to from another page, add the link to the db here
-		if crawlData.PageFromId != 0 {
-			link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
-			if !link_success {
-				// TODO: Log error and Ignore for now
-				logError("Couldn't Add Link to Db: %v; Page: %v", link, page)
-			}
+		title := feedTitle
+		if title == "" && crawlData.PageFrom_InternalLink {
+			title = crawlData.PageFrom_LinkText
 		}
 
-		/*
-			for tag, rank := range tagsMap {
-				graphemeCount := uniseg.GraphemeClusterCount(tag)
-				if len(tag) <= 2 || graphemeCount > 250 {
-					continue
-				}
-				addTagToDb(ctx, page.Id, tag, rank)
-			}
-
-			for mention := range mentionsMap {
-				graphemeCount := uniseg.GraphemeClusterCount(mention)
-				if graphemeCount > 250 {
-					continue
-				}
-				addMentionToDb(ctx, page.Id, mention)
-			}
-		*/
-		//}
-
-		for _, link := range links {
-			if link.spartanInput {
-				// Skip spartan input links for now
-				continue
-			}
-			url, _ := ctx.currentURL.Parse(link.url) // NOTE: This call will translate all relative and absolute links in the context of the current page's URL.
-			if url == nil {
-				continue
-			}
-			if url.Scheme == "nex" && strings.HasSuffix(url.Path, "index") {
-				url.Path = strings.TrimSuffix(url.Path, "index")
-			} else if url.Scheme == "scroll" && strings.HasSuffix(url.Path, "index.scroll") {
-				url.Path = strings.TrimSuffix(url.Path, "index.scroll")
-			} else if (url.Scheme == "gemini" || url.Scheme == "spartan") && (strings.HasSuffix(url.Path, "index.gmi") || strings.HasSuffix(url.Path, "index.gemini")) {
-				url.Path = strings.TrimSuffix(url.Path, "index.gmi")
-				url.Path = strings.TrimSuffix(url.Path, "index.gemini")
-			}
-			url.Fragment = "" // Strip the fragment
-			internalLink := ctx.currentURL.Hostname() == url.Hostname() && ctx.currentURL.Port() == url.Port() && ctx.currentURL.Scheme == url.Scheme
-			if crawledPage, ok := ctx.globalData.urlsCrawled.Get(url.String()); /*ctx.urlsCrawled[url.String()]*/ ok {
-				// Link is already crawled. TODO: What if the crawledPage's info hasn't been set yet?
-				if crawledPage.(Page).Id != 0 {
-					dbLink, db_success := addLinkToDb(ctx, Link{0, page.Id, crawledPage.(Page).Id, link.name, !internalLink, CrawlIndex, time.Now().UTC()})
-					if !db_success {
-						logError("Couldn't Add Link to Db: %v; From Page: %v", dbLink, page)
-					}
-				}
-				continue
-			}
-			if internalLink && ctx.globalData.followInternalLinks {
-				allow := ctx.currentRobots.indexerGroup.Test(url.Path)
-				// If not in robots.txt, or if depth is greater than max depth, then skip link
-				if !allow || (ctx.globalData.maxDepth != 0 && crawlData.currentDepth+1 > ctx.globalData.maxDepth) {
-					continue
-				}
-				ctx.addUrl(url.String(), UrlToCrawlData{page.Id, true, link.name, crawlData.currentDepth + 1})
-			} else if (url.Scheme == "gemini" || url.Scheme == "nex" || url.Scheme == "scroll" || url.Scheme == "spartan") && ctx.globalData.followExternalLinks {
-				ctx.addUrl(url.String(), UrlToCrawlData{page.Id, false, link.name, 0})
-			}
-		}
-		// TODO: text/markdown and text/html
-	} else if mediatype == "text/nex" { // Nex Listing file
+		// The titles of the entries are the text of the feed
 		var strippedTextBuilder strings.Builder
-		links := make([]NexLink, 0)
-		title, linecount, headings, _, size, isFeed := ctx.GetNexPageInfo(bytes.NewReader(data), nil, nil, &links, &strippedTextBuilder, true)
-		// Exclude tag pages from being considered feeds
-		if strings.Contains(ctx.GetCurrentURL(), "/tag/") || strings.Contains(ctx.GetCurrentURL(), "/tags/") {
-			isFeed = false
-		} else if ctx.GetCurrentURL() == "nex://station.martinrue.com/" {
-			title = "Station"
-		} else if ctx.GetCurrentURL() == "nex://hashnix.club/" {
-			title = "Hashnix Club"
-		}
-
-		if title == "" || !ContainsLetterRunes(title) {
-			if crawlData.PageFrom_InternalLink {
-				title = crawlData.PageFrom_LinkText
-			}
-		}
-
-		// Publication Date Handling: Get from title or filename // TODO: Check for dates in the path directories just above the file
-		publicationDate := time.Time{}
-		if !strings.Contains(ctx.GetCurrentURL(), "~Cosmos/thread") {
-			publicationDate = getTimeDate(title, false)
-		}
-		// TODO: Hacky - don't get publishdate from filename if "commit" or "~Cosmos/thread" is in the URL, so that there's no false positives with hashes, and Cosmos threads aren't included
-		if !strings.Contains(ctx.GetCurrentURL(), "commit/") && !strings.Contains(ctx.GetCurrentURL(), "commits/") && !strings.Contains(ctx.GetCurrentURL(), "~Cosmos/thread") {
-			_, filename := path.Split(ctx.GetCurrentURL())
-			publicationDate2 := getTimeDate(filename, true)
-			if (publicationDate2 != time.Time{}) {
-				publicationDate = publicationDate2
-			}
-		}
-
-		// If publication date is in the future, then reset publicationDate to time.Time{}
-		if publicationDate.After(time.Now().Add(time.Hour * 24).UTC()) {
-			publicationDate = time.Time{}
+		for _, entry := range feedEntries {
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", entry.Title)
 		}
 
 		hasher := sha256.New()
 		hasher.Write(data)
 		hashStr := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
 
-		// If root page of domain, add it if it's not a thing yet
+		// If root page of domain, add the domain still
 		if ctx.isRootPage {
-			//fmt.Printf("Getting Domain for Root %s\n", ctx.currentURL)
-			//domain.Title = title
 			var success bool = false
 			domain, success = addDomainToDb(ctx, domain, false)
 			if !success {
 				return // TODO
 			}
-			//fmt.Printf("DomainId of %s: %d\n", ctx.currentURL, domain.Id)
 		}
 
 		urlString := ctx.GetCurrentURL()
@@ -638,182 +409,31 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 			}
 		}
 
-		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, linecount, UDCClass, title, "", headings, size, hashStr, isFeed, publicationDate, time.Now().UTC(), "", "", "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
+		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, linecount, 0, UDCClass, title, "", "", size, hashStr, true, time.Time{}, time.Now().UTC(), "", "", "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
 		var success bool = false
 		page, success = addPageToDb(ctx, page)
 		if !success {
 			return
 		}
 		ctx.setUrlCrawledPageData(urlString, page)
+		addPageContentToDb(ctx, page, strippedTextBuilder.String(), "")
 
 		// If this page was linked to from another page, add the link to the db here
 		if crawlData.PageFromId != 0 {
 			link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
 			if !link_success {
 				// TODO: Log error and Ignore for now
-				logError("Couldn't Add Link to Db: %v; Page: %v", link, page)
+				logger.Error().Str("url", page.Url).Int("from", link.FromPageId).Int("to", link.ToPageId).Msg("Couldn't add link")
 			}
 		}
 
-		for _, link := range links {
-			url, _ := ctx.currentURL.Parse(link.url) // NOTE: This call will translate all relative and absolute links in the context of the current page's URL.
-			if url == nil {
-				continue
-			}
-			if url.Scheme == "nex" && strings.HasSuffix(url.Path, "index") {
-				url.Path = strings.TrimSuffix(url.Path, "index")
-			} else if url.Scheme == "scroll" && strings.HasSuffix(url.Path, "index.scroll") {
-				url.Path = strings.TrimSuffix(url.Path, "index.scroll")
-			} else if (url.Scheme == "gemini" || url.Scheme == "spartan") && (strings.HasSuffix(url.Path, "index.gmi") || strings.HasSuffix(url.Path, "index.gemini")) {
-				url.Path = strings.TrimSuffix(url.Path, "index.gmi")
-				url.Path = strings.TrimSuffix(url.Path, "index.gemini")
-			}
-			url.Fragment = "" // Strip the fragment
-			internalLink := ctx.currentURL.Hostname() == url.Hostname() && ctx.currentURL.Port() == url.Port() && ctx.currentURL.Scheme == url.Scheme
-			if crawledPage, ok := ctx.globalData.urlsCrawled.Get(url.String()); /*ctx.urlsCrawled[url.String()]*/ ok {
-				// Link is already crawled. TODO: What if the crawledPage's info hasn't been set yet?
-				if crawledPage.(Page).Id != 0 {
-					dbLink, db_success := addLinkToDb(ctx, Link{0, page.Id, crawledPage.(Page).Id, link.name, !internalLink, CrawlIndex, time.Now().UTC()})
-					if !db_success {
-						logError("Couldn't Add Link to Db: %v; From Page: %v", dbLink, page)
-					}
-				}
-				continue
-			}
-			if internalLink && ctx.globalData.followInternalLinks {
-				allow := ctx.currentRobots.indexerGroup.Test(url.Path)
-				// If not in robots.txt, or if depth is greater than max depth, then skip link
-				if !allow || (ctx.globalData.maxDepth != 0 && crawlData.currentDepth+1 > ctx.globalData.maxDepth) {
-					continue
-				}
-				ctx.addUrl(url.String(), UrlToCrawlData{page.Id, true, link.name, crawlData.currentDepth + 1})
-			} else if (url.Scheme == "gemini" || url.Scheme == "nex" || url.Scheme == "scroll" || url.Scheme == "spartan") && ctx.globalData.followExternalLinks {
-				ctx.addUrl(url.String(), UrlToCrawlData{page.Id, false, link.name, 0})
-			}
+		newEntries := addFeedEntriesToDb(ctx, page, feedEntries)
+		if ctx.globalData.feedEntriesOnly {
+			// Only crawl the entries that are new since the feed was last crawled
+			feedEntries = newEntries
 		}
-	} else if strings.HasPrefix(mediatype, "text/markdown") {
-		var strippedTextBuilder strings.Builder
-		links := make([]MarkdownLink, 0)
-		title, linecount, headings, _, size, isFeed := ctx.GetMarkdownPageInfo(bytes.NewReader(data), nil, nil, &links, &strippedTextBuilder, true)
-		// Exclude tag pages from being considered feeds
-		if strings.Contains(ctx.GetCurrentURL(), "/tag/") || strings.Contains(ctx.GetCurrentURL(), "/tags/") {
-			isFeed = false
-		}
-		if title == "" || !ContainsLetterRunes(title) {
-			if crawlData.PageFrom_InternalLink {
-				title = crawlData.PageFrom_LinkText
-			}
-		}
-
-		// Publication Date Handling: Get from title or filename // TODO: Check for dates in the path directories just above the file
-		publicationDate := time.Time{}
-		if !strings.Contains(ctx.GetCurrentURL(), "~Cosmos/thread") {
-			publicationDate = getTimeDate(title, false)
-		}
-		// TODO: Hacky - don't get publishdate from filename if "commit" or "~Cosmos/thread" is in the URL, so that there's no false positives with hashes, and Cosmos threads aren't included
-		if !strings.Contains(ctx.GetCurrentURL(), "commit/") && !strings.Contains(ctx.GetCurrentURL(), "commits/") && !strings.Contains(ctx.GetCurrentURL(), "~Cosmos/thread") {
-			_, filename := path.Split(ctx.GetCurrentURL())
-			publicationDate2 := getTimeDate(filename, true)
-			if (publicationDate2 != time.Time{}) {
-				publicationDate = publicationDate2
-			}
-		}
-
-		// If publication date is in the future, then reset publicationDate to time.Time{}
-		if publicationDate.After(time.Now().Add(time.Hour * 24).UTC()) {
-			publicationDate = time.Time{}
-		}
-
-		hasher := sha256.New()
-		hasher.Write(data)
-		hashStr := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
-
-		// If root page of domain, add it if it's not a thing yet
-		if ctx.isRootPage {
-			//fmt.Printf("Getting Domain for Root %s\n", ctx.currentURL)
-			domain.Title = title
-			var success bool = false
-			domain, success = addDomainToDb(ctx, domain, true)
-			if !success {
-				return // TODO
-			}
-			//fmt.Printf("DomainId of %s: %d\n", ctx.currentURL, domain.Id)
-		}
-
-		urlString := ctx.GetCurrentURL()
-		scheme := strings.ToLower(strings.TrimSuffix(ctx.currentURL.Scheme, "://"))
-		hidden := false
-
-		// If there's non-hidden duplicates from same scheme, hide this page
-		if len(getPagesWithHashAndScheme(ctx, urlString, hashStr, scheme)) > 0 {
-			hidden = true
-		}
-
-		hasDuplicateOnGemini := false
-		if scheme == "gemini" {
-			// If there's pages on other protocols with the hash, and current scheme is gemini, then set all of those others as having gemini duplicate.
-			if len(getPagesWithHashAndNotScheme(ctx, urlString, hashStr, scheme)) > 0 {
-				setPageHashHasGeminiDuplicate(ctx, urlString, hashStr, true)
-			}
-		} else {
-			// If there's a gemini page with the hash that is not hidden, then set hasDuplicateOnGemini
-			if len(getPagesWithHashAndScheme(ctx, urlString, hashStr, "gemini")) > 0 {
-				hasDuplicateOnGemini = true
-			}
-		}
-
-		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, linecount, UDCClass, title, "", headings, size, hashStr, isFeed, publicationDate, time.Now().UTC(), "", "", "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
-		var success bool = false
-		page, success = addPageToDb(ctx, page)
-		if !success {
-			return
-		}
-		ctx.setUrlCrawledPageData(urlString, page)
-
-		// If this page was linked to from another page, add the link to the db here
-		if crawlData.PageFromId != 0 {
-			link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
-			if !link_success {
-				// TODO: Log error and Ignore for now
-				logError("Couldn't Add Link to Db: %v; Page: %v", link, page)
-			}
-		}
-
-		for _, link := range links {
-			url, _ := ctx.currentURL.Parse(link.url) // NOTE: This call will translate all relative and absolute links in the context of the current page's URL.
-			if url == nil {
-				continue
-			}
-			if url.Scheme == "nex" && strings.HasSuffix(url.Path, "index") {
-				url.Path = strings.TrimSuffix(url.Path, "index")
-			} else if url.Scheme == "scroll" && strings.HasSuffix(url.Path, "index.scroll") {
-				url.Path = strings.TrimSuffix(url.Path, "index.scroll")
-			} else if (url.Scheme == "gemini" || url.Scheme == "spartan") && (strings.HasSuffix(url.Path, "index.gmi") || strings.HasSuffix(url.Path, "index.gemini")) {
-				url.Path = strings.TrimSuffix(url.Path, "index.gmi")
-				url.Path = strings.TrimSuffix(url.Path, "index.gemini")
-			}
-			url.Fragment = "" // Strip the fragment
-			internalLink := ctx.currentURL.Hostname() == url.Hostname() && ctx.currentURL.Port() == url.Port() && ctx.currentURL.Scheme == url.Scheme
-			if crawledPage, ok := ctx.globalData.urlsCrawled.Get(url.String()); /*ctx.urlsCrawled[url.String()]*/ ok {
-				// Link is already crawled. TODO: What if the crawledPage's info hasn't been set yet?
-				if crawledPage.(Page).Id != 0 {
-					dbLink, db_success := addLinkToDb(ctx, Link{0, page.Id, crawledPage.(Page).Id, link.name, !internalLink, CrawlIndex, time.Now().UTC()})
-					if !db_success {
-						logError("Couldn't Add Link to Db: %v; From Page: %v", dbLink, page)
-					}
-				}
-				continue
-			}
-			if internalLink && ctx.globalData.followInternalLinks {
-				allow := ctx.currentRobots.indexerGroup.Test(url.Path)
-				// If not in robots.txt, or if depth is greater than max depth, then skip link
-				if !allow || (ctx.globalData.maxDepth != 0 && crawlData.currentDepth+1 > ctx.globalData.maxDepth) {
-					continue
-				}
-				ctx.addUrl(url.String(), UrlToCrawlData{page.Id, true, link.name, crawlData.currentDepth + 1})
-			} else if (url.Scheme == "gemini" || url.Scheme == "nex" || url.Scheme == "scroll" || url.Scheme == "spartan") && ctx.globalData.followExternalLinks {
-				ctx.addUrl(url.String(), UrlToCrawlData{page.Id, false, link.name, 0})
-			}
+		for _, entry := range feedEntries {
+			ctx.handlePageLink(page, crawlData, rules, entry.Title, entry.Url)
 		}
 	} else if strings.HasPrefix(mediatype, "text/") {
 		textBytes := data
@@ -879,7 +499,23 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 		if crawlData.PageFrom_InternalLink {
 			title = crawlData.PageFrom_LinkText
 		}
-		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, linecount, UDCClass, title, "", "", size, hashStr, false, time.Time{}, time.Now().UTC(), "", "", "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
+
+		// Twtxt files are feeds of their timestamped lines
+		isFeed := false
+		var feedEntries []FeedEntry
+		if isTwtxtUrl(urlString) {
+			var nick string
+			var err error
+			nick, feedEntries, err = parseTwtxtFeed(textBytes, urlString)
+			if err != nil {
+				logger.Error().Str("url", urlString).Err(err).Msg("Couldn't parse twtxt feed")
+			}
+			isFeed = len(feedEntries) > 0
+			if title == "" && nick != "" {
+				title = nick
+			}
+		}
+		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, linecount, 0, UDCClass, title, "", "", size, hashStr, isFeed, time.Time{}, time.Now().UTC(), "", "", "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
 		var success bool = false
 		page, success = addPageToDb(ctx, page)
 		if !success {
@@ -887,12 +523,22 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 		}
 		ctx.setUrlCrawledPageData(urlString, page)
 
+		// Plain text files are indexed as body text, source code as preformatted text
+		if language == "" || language == "Text" {
+			addPageContentToDb(ctx, page, textStr, "")
+		} else {
+			addPageContentToDb(ctx, page, "", textStr)
+		}
+		if isFeed {
+			addFeedEntriesToDb(ctx, page, feedEntries)
+		}
+
 		// If this page was linked to from another page, add the link to the db here
 		if crawlData.PageFromId != 0 {
 			link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
 			if !link_success {
 				// TODO: Log error and Ignore for now
-				logError("Couldn't Add Link to Db: %v; Page: %v", link, page)
+				logger.Error().Str("url", page.Url).Int("from", link.FromPageId).Int("to", link.ToPageId).Msg("Couldn't add link")
 			}
 		}
 
@@ -907,6 +553,8 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 
 		urlString := ctx.GetCurrentURL()
 		*/
+	} else if strings.HasPrefix(mediatype, "image/") { // Images, with their EXIF, XMP, and IPTC metadata
+		handleImage(ctx, crawlData, rules, parseImageMetadata(mediatype, data), data, domain, mediatype, charset, language, UDCClass)
 	} else if mediatype == "audio/mpeg" || mediatype == "audio/mp3" || mediatype == "audio/ogg" || mediatype == "audio/flac" || mediatype == "audio/x-flac" {
 		p := data
 		size := len(data)
@@ -958,7 +606,7 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 		urlHasher.Write([]byte(urlString))
 		urlHash := base64.URLEncoding.EncodeToString(hasher.Sum(nil))*/
 
-		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, 0, UDCClass, title, "", "", size, hashStr, false, time.Time{}, time.Now().UTC(), m.Album(), m.Artist(), m.AlbumArtist(), m.Composer(), track, disc, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
+		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, 0, 0, UDCClass, title, "", "", size, hashStr, false, time.Time{}, time.Now().UTC(), m.Album(), m.Artist(), m.AlbumArtist(), m.Composer(), track, disc, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
 		var success bool = false
 		page, success = addPageToDb(ctx, page)
 		if !success {
@@ -971,77 +619,17 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 			link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
 			if !link_success {
 				// TODO: Log error and Ignore for now
-				logError("Couldn't Add Link to Db: %v; Page: %v", link, page)
+				logger.Error().Str("url", page.Url).Int("from", link.FromPageId).Int("to", link.ToPageId).Msg("Couldn't add link")
 			}
 		}
-	} else if mediatype == "application/pdf" || mediatype == "image/vnd.djvu" || mediatype == "application/epub" || mediatype == "application/epub+zip" {
-		et, err := exiftool.NewExiftool()
-		if err != nil {
-			logError("Error when intializing: %v\n", err)
-			return
+	} else {
+		if ctx.isRootPage {
+			logger.Error().Str("url", ctx.currentURL.String()).Str("meta", meta).Msg("Root page without a title")
+			panic("Weirdness happening!")
 		}
-		defer et.Close()
 
 		p := data
 		size := len(data)
-		tmpFilename := fmt.Sprintf("tmp_pdf_thread_%d%s", crawlThread, path.Ext(ctx.currentURL.Path))
-		err = os.WriteFile(tmpFilename, p, 0644)
-		if err != nil {
-			fmt.Printf("Error writing file: %v\n", err)
-			logError("Error writing file '%s' for '%s': %s; %v", tmpFilename, ctx.GetCurrentURL(), err.Error(), err)
-			return
-		}
-
-		fileInfos := et.ExtractMetadata(tmpFilename)
-		fileInfo := fileInfos[0]
-		if fileInfo.Err != nil {
-			fmt.Printf("Error with fileinfo for file %s: %v\n", fileInfo.File, fileInfo.Err)
-			logError("Error getting fileinfo '%s' for '%s': %s; %v", fileInfo.File, ctx.GetCurrentURL(), fileInfo.Err.Error(), fileInfo.Err)
-			return
-		}
-		os.Remove(tmpFilename)
-
-		/* Author
-		author, authorExists := fileInfo.Fields["Author"]
-		if !authorExists {
-			author, authorExists = fileInfo.Fields["author"]
-			if !authorExists {
-				author = ""
-			}
-		}
-		*/
-
-		title, titleExists := fileInfo.Fields["Title"]
-		if !titleExists {
-			title, titleExists = fileInfo.Fields["title"]
-			if !titleExists {
-				title, titleExists = fileInfo.Fields["booktitle"]
-				if !titleExists {
-					if crawlData.PageFrom_InternalLink {
-						title = crawlData.PageFrom_LinkText
-					}
-				}
-			}
-		}
-
-		copyright, copyrightExists := fileInfo.Fields["Copyright"]
-		if !copyrightExists {
-			copyright = ""
-		}
-
-		if language == "" {
-			language2, languageExists := fileInfo.Fields["Lang"]
-			if !languageExists {
-				language2, languageExists = fileInfo.Fields["Language"]
-				if !languageExists {
-					language2 = ""
-				}
-			}
-			language = language2.(string)
-		}
-
-		// TODO: Add keywords stuff here?
-
 		hasher := sha256.New()
 		hasher.Write(p[:size])
 		hashStr := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
@@ -1068,7 +656,11 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 			}
 		}
 
-		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, 0, UDCClass, title.(string), "", "", size, hashStr, false, time.Time{}, time.Now().UTC(), "", "", "", "", 0, 0, copyright.(string), CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
+		var title string
+		if crawlData.PageFrom_InternalLink {
+			title = crawlData.PageFrom_LinkText
+		}
+		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, 0, 0, UDCClass, title, "", "", size, hashStr, false, time.Time{}, time.Now().UTC(), "", "", "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
 		var success bool = false
 		page, success = addPageToDb(ctx, page)
 		if !success {
@@ -1081,62 +673,314 @@ func handleSuccess(ctx CrawlContext, crawlThread int, crawlData UrlToCrawlData)
 			link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
 			if !link_success {
 				// TODO: Log error and Ignore for now
-				logError("Couldn't Add Link to Db: %v; Page: %v", link, page)
+				logger.Error().Str("url", page.Url).Int("from", link.FromPageId).Int("to", link.ToPageId).Msg("Couldn't add link")
 			}
 		}
+	}
+}
+
+// Adds a page of one of the markup formats to the db, along with its tags, mentions, and feed entries, and then handles its links
+func handleDocument(ctx CrawlContext, crawlData UrlToCrawlData, rules RuleMatch, doc Document, data []byte, domain Domain, mediatype string, charset string, language string, UDCClass string) {
+	// Exclude tag pages from being considered feeds
+	if strings.Contains(ctx.GetCurrentURL(), "/tag/") || strings.Contains(ctx.GetCurrentURL(), "/tags/") {
+		doc.IsFeed = false
+	}
+	title := doc.Title
+
+	if title == "" || !ContainsLetterRunes(title) {
+		if crawlData.PageFrom_InternalLink {
+			title = crawlData.PageFrom_LinkText
+		}
+	}
+
+	if strings.ToLower(strings.TrimSpace(title)) == "directory listing" {
+		title = ctx.GetCurrentURL()
+	}
+	// Titles are limited to 250 bytes in the db, and file metadata doesn't keep to that
+	for len(title) > 250 {
+		_, size := utf8.DecodeLastRuneInString(title)
+		title = title[:len(title)-size]
+	}
+
+	// Use the language of the document when the response doesn't give one, and detect the language of extracted text otherwise
+	if language == "" && doc.Language != "" {
+		language, _, _ = strings.Cut(strings.ToLower(doc.Language), "-")
+	} else if language == "" && !MediatypeIsTextual(mediatype) && strings.TrimSpace(doc.StrippedText) != "" {
+		if lang, reliable := langDetector.DetectLanguageOf(doc.StrippedText); reliable {
+			language = lang.IsoCode639_1().String()
+		}
+	}
+
+	// Publication Date Handling: Get from internal link, overwrite from title or filename if available // TODO: Check for dates in the path directories just above the file
+	timeCutoff := time.Now().Add(time.Hour * 24).UTC()
+	publicationDate := time.Time{}
+	if crawlData.PageFrom_InternalLink {
+		date := getTimeDate(crawlData.PageFrom_LinkText, false)
+		if (date != time.Time{} && !date.After(timeCutoff)) {
+			publicationDate = date
+		}
+	}
+	if !strings.Contains(ctx.GetCurrentURL(), "~Cosmos/thread") {
+		date := getTimeDate(title, false)
+		if (date != time.Time{} && !date.After(timeCutoff)) {
+			publicationDate = date
+		}
+	}
+	// TODO: Hacky - don't get publishdate from filename if "commit" or "~Cosmos/thread" is in the URL, so that there's no false positives with hashes, and Cosmos threads aren't included
+	if !strings.Contains(ctx.GetCurrentURL(), "commit/") && !strings.Contains(ctx.GetCurrentURL(), "commits/") && !strings.Contains(ctx.GetCurrentURL(), "~Cosmos/thread") {
+		_, filename := path.Split(ctx.GetCurrentURL())
+		date := getTimeDate(filename, true)
+		if (date != time.Time{} && !date.After(timeCutoff)) {
+			publicationDate = date
+		}
+	}
+
+	// Metadata given by the document (like front matter) or its response (like scroll's) is more reliable than the guesses above
+	if doc.PublishDate.IsZero() {
+		doc.PublishDate = ctx.resp.PublishDate
+	}
+	if doc.ModificationDate.IsZero() {
+		doc.ModificationDate = ctx.resp.ModificationDate
+	}
+	if doc.Author == "" {
+		doc.Author = ctx.resp.Author
+	}
+	if !doc.PublishDate.IsZero() {
+		publicationDate = doc.PublishDate
+	} else if !doc.ModificationDate.IsZero() && publicationDate.IsZero() {
+		publicationDate = doc.ModificationDate
+	}
+
+	// Feeds give the real publication date of their entries
+	if date, ok := getFeedEntryPublishDate(ctx, ctx.GetCurrentURL()); ok {
+		publicationDate = date
+	}
+
+	// If publication date is in the future, then reset publicationDate to time.Time{}
+	if publicationDate.After(timeCutoff) {
+		publicationDate = time.Time{}
+	}
+
+	hasher := sha256.New()
+	hasher.Write(data)
+	hashStr := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+
+	urlString := ctx.GetCurrentURL()
+	scheme := strings.ToLower(strings.TrimSuffix(ctx.currentURL.Scheme, "://"))
+	hidden := false
+
+	// If there's non-hidden duplicates from same scheme, hide this page
+	if len(getPagesWithHashAndScheme(ctx, urlString, hashStr, scheme)) > 0 {
+		hidden = true
+	}
+
+	hasDuplicateOnGemini := false
+	if scheme == "gemini" {
+		// If there's pages on other protocols with the hash, and current scheme is gemini, then set all of those others as having gemini duplicate.
+		if len(getPagesWithHashAndNotScheme(ctx, urlString, hashStr, scheme)) > 0 {
+			setPageHashHasGeminiDuplicate(ctx, urlString, hashStr, true)
+		}
 	} else {
-		if ctx.isRootPage {
-			fmt.Printf("Weird %s: %s\n", ctx.currentURL, meta)
-			panic("Weirdness happening!")
+		// If there's a gemini page with the hash that is not hidden, then set hasDuplicateOnGemini
+		if len(getPagesWithHashAndScheme(ctx, urlString, hashStr, "gemini")) > 0 {
+			hasDuplicateOnGemini = true
 		}
+	}
 
-		p := data
-		size := len(data)
-		hasher := sha256.New()
-		hasher.Write(p[:size])
-		hashStr := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+	// The author of the document is stored as its artist
+	page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, doc.Linecount, doc.PageCount, UDCClass, title, "", doc.Headings, doc.Size, hashStr, doc.IsFeed, publicationDate, time.Now().UTC(), "", truncateRunes(doc.Author, 250), "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
+	var success bool = false
+	page, success = addPageToDb(ctx, page)
+	if !success {
+		return
+	}
+	ctx.setUrlCrawledPageData(urlString, page)
+	addPageContentToDb(ctx, page, doc.StrippedText, doc.Preformatted)
 
-		urlString := ctx.GetCurrentURL()
-		scheme := strings.ToLower(strings.TrimSuffix(ctx.currentURL.Scheme, "://"))
-		hidden := false
+	// If root page of domain, update the db domain information to include title (as overridden by the crawl rules)
+	if ctx.isRootPage {
+		domain.Title = page.Title
+		domain, success = addDomainToDb(ctx, domain, true)
+		if !success {
+			return // TODO
+		}
+	}
 
-		// If there's non-hidden duplicates from same scheme, hide this page
-		if len(getPagesWithHashAndScheme(ctx, urlString, hashStr, scheme)) > 0 {
-			hidden = true
+	// If this page was linked to from another page, add the link to the db here
+	if crawlData.PageFromId != 0 {
+		link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
+		if !link_success {
+			// TODO: Log error and Ignore for now
+			logger.Error().Str("url", page.Url).Int("from", link.FromPageId).Int("to", link.ToPageId).Msg("Couldn't add link")
 		}
+	}
 
-		hasDuplicateOnGemini := false
-		if scheme == "gemini" {
-			// If there's pages on other protocols with the hash, and current scheme is gemini, then set all of those others as having gemini duplicate.
-			if len(getPagesWithHashAndNotScheme(ctx, urlString, hashStr, scheme)) > 0 {
-				setPageHashHasGeminiDuplicate(ctx, urlString, hashStr, true)
-			}
-		} else {
-			// If there's a gemini page with the hash that is not hidden, then set hasDuplicateOnGemini
-			if len(getPagesWithHashAndScheme(ctx, urlString, hashStr, "gemini")) > 0 {
-				hasDuplicateOnGemini = true
+	// Replace the tags and mentions from the last crawl of the page
+	removeTagsAndMentionsFromDb(ctx, page.Id)
+	for tag, rank := range doc.Tags {
+		graphemeCount := uniseg.GraphemeClusterCount(tag)
+		if len(tag) <= 2 || graphemeCount > 250 || isNumber(tag) {
+			continue
+		}
+		addTagToDb(ctx, page.Id, tag, rank)
+	}
+
+	for mention := range doc.Mentions {
+		graphemeCount := uniseg.GraphemeClusterCount(mention)
+		if graphemeCount > 250 {
+			continue
+		}
+		addMentionToDb(ctx, page.Id, mention)
+	}
+
+	links := doc.Links
+	if doc.IsFeed {
+		newEntries := addFeedEntriesToDb(ctx, page, ctx.resolveFeedEntries(gemsubEntries(links)))
+		if ctx.globalData.feedEntriesOnly {
+			// Only crawl the entries that are new since the feed was last crawled
+			links = make([]DocumentLink, 0, len(newEntries))
+			for _, entry := range newEntries {
+				links = append(links, DocumentLink{entry.Title, entry.Url, false, false})
 			}
 		}
+	}
 
-		var title string
-		if crawlData.PageFrom_InternalLink {
-			title = crawlData.PageFrom_LinkText
+	for _, link := range links {
+		if link.Input {
+			// Skip spartan input links for now
+			continue
 		}
-		page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, 0, UDCClass, title, "", "", size, hashStr, false, time.Time{}, time.Now().UTC(), "", "", "", "", 0, 0, "", CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
-		var success bool = false
-		page, success = addPageToDb(ctx, page)
-		if !success {
+		ctx.handlePageLink(page, crawlData, rules, link.Name, link.Url)
+	}
+}
+
+// Adds an image to the db, along with its metadata. Its alt text is the text of the link it was found through, since gemtext has no
+// other way to describe images, or the alt text embedded in the image when the link has no text.
+func handleImage(ctx CrawlContext, crawlData UrlToCrawlData, rules RuleMatch, metadata ImageMetadata, data []byte, domain Domain, mediatype string, charset string, language string, UDCClass string) {
+	size := len(data)
+	hasher := sha256.New()
+	hasher.Write(data)
+	hashStr := base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+
+	urlString := ctx.GetCurrentURL()
+	scheme := strings.ToLower(strings.TrimSuffix(ctx.currentURL.Scheme, "://"))
+	hidden := false
+
+	// If there's non-hidden duplicates from same scheme, hide this page
+	if len(getPagesWithHashAndScheme(ctx, urlString, hashStr, scheme)) > 0 {
+		hidden = true
+	}
+
+	hasDuplicateOnGemini := false
+	if scheme == "gemini" {
+		// If there's pages on other protocols with the hash, and current scheme is gemini, then set all of those others as having gemini duplicate.
+		if len(getPagesWithHashAndNotScheme(ctx, urlString, hashStr, scheme)) > 0 {
+			setPageHashHasGeminiDuplicate(ctx, urlString, hashStr, true)
+		}
+	} else {
+		// If there's a gemini page with the hash that is not hidden, then set hasDuplicateOnGemini
+		if len(getPagesWithHashAndScheme(ctx, urlString, hashStr, "gemini")) > 0 {
+			hasDuplicateOnGemini = true
+		}
+	}
+
+	title := truncateRunes(metadata.Title, 250)
+	if title == "" && crawlData.PageFrom_InternalLink {
+		title = crawlData.PageFrom_LinkText
+	}
+	altText := strings.TrimSpace(crawlData.PageFrom_LinkText)
+	if altText == "" {
+		altText = metadata.AltText
+	}
+
+	page := Page{0, urlString, ctx.currentURL.Scheme, domain.Id, mediatype, charset, language, 0, 0, UDCClass, title, "", "", size, hashStr, false, time.Time{}, time.Now().UTC(), "", truncateRunes(metadata.Creator, 250), "", "", 0, 0, truncateRunes(metadata.Copyright, 250), CrawlIndex, time.Now().UTC(), time.Now().UTC(), hidden, hasDuplicateOnGemini}
+	var success bool = false
+	page, success = addPageToDb(ctx, page)
+	if !success {
+		return
+	}
+	ctx.setUrlCrawledPageData(urlString, page)
+	addImageToDb(ctx, page, metadata, altText)
+
+	// If this page was linked to from another page, add the link to the db here
+	if crawlData.PageFromId != 0 {
+		link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
+		if !link_success {
+			// TODO: Log error and Ignore for now
+			logger.Error().Str("url", page.Url).Int("from", link.FromPageId).Int("to", link.ToPageId).Msg("Couldn't add link")
+		}
+	}
+}
+
+// Resolves a link of the current page into the url it gets crawled as, without index filenames and fragments. Returns nil if the link isn't a valid url.
+func (ctx *CrawlContext) resolveLink(linkUrl string) *neturl.URL {
+	url, _ := ctx.currentURL.Parse(linkUrl) // NOTE: This call will translate all relative and absolute links in the context of the current page's URL.
+	if url == nil {
+		return nil
+	}
+	if url.Scheme == "nex" && strings.HasSuffix(url.Path, "index") {
+		url.Path = strings.TrimSuffix(url.Path, "index")
+	} else if url.Scheme == "scroll" && strings.HasSuffix(url.Path, "index.scroll") {
+		url.Path = strings.TrimSuffix(url.Path, "index.scroll")
+	} else if (url.Scheme == "gemini" || url.Scheme == "spartan" || url.Scheme == "guppy") && (strings.HasSuffix(url.Path, "index.gmi") || strings.HasSuffix(url.Path, "index.gemini")) {
+		url.Path = strings.TrimSuffix(url.Path, "index.gmi")
+		url.Path = strings.TrimSuffix(url.Path, "index.gemini")
+	} else if url.Scheme == "gopher" && (url.Path == "/1" || url.Path == "/1/") && url.RawQuery == "" {
+		url.Path = "/" // The root gophermap
+	}
+	url.Fragment = "" // Strip the fragment
+	return url
+}
+
+// Adds a link from the page to the db if the linked url has already been crawled. Otherwise, queues the linked url to be crawled,
+// unless the crawl rules or robots.txt say not to.
+func (ctx *CrawlContext) handlePageLink(page Page, crawlData UrlToCrawlData, rules RuleMatch, linkName string, linkUrl string) {
+	url := ctx.resolveLink(linkUrl)
+	if url == nil {
+		return
+	}
+
+	// Rewrite links to permanently redirected urls, so the final target is fetched directly
+	if target, ok := ctx.globalData.redirects.Resolve(url.String()); !ok {
+		return
+	} else if target != url.String() {
+		if url, _ = url.Parse(target); url == nil {
 			return
 		}
-		ctx.setUrlCrawledPageData(urlString, page)
+	}
 
-		// If this page was linked to from another page, add the link to the db here
-		if crawlData.PageFromId != 0 {
-			link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
-			if !link_success {
-				// TODO: Log error and Ignore for now
-				logError("Couldn't Add Link to Db: %v; Page: %v", link, page)
+	internalLink := ctx.currentURL.Hostname() == url.Hostname() && ctx.currentURL.Port() == url.Port() && ctx.currentURL.Scheme == url.Scheme
+	if crawledPage, ok := ctx.globalData.urlsCrawled.Get(url.String()); /*ctx.urlsCrawled[url.String()]*/ ok {
+		// Link is already crawled. TODO: What if the crawledPage's info hasn't been set yet?
+		if crawledPage.(Page).Id != 0 {
+			dbLink, db_success := addLinkToDb(*ctx, Link{0, page.Id, crawledPage.(Page).Id, linkName, !internalLink, CrawlIndex, time.Now().UTC()})
+			if !db_success {
+				logger.Error().Str("url", page.Url).Int("from", dbLink.FromPageId).Int("to", dbLink.ToPageId).Msg("Couldn't add link")
 			}
 		}
+		return
+	}
+
+	if rules.NoFollow {
+		return
+	}
+	linkRules := MatchCrawlRules(url.String())
+	if linkRules.Skip {
+		return
+	}
+
+	if internalLink && ctx.globalData.followInternalLinks {
+		maxDepth := ctx.globalData.maxDepth
+		if linkRules.MaxDepth != 0 && (maxDepth == 0 || linkRules.MaxDepth < maxDepth) {
+			maxDepth = linkRules.MaxDepth
+		}
+		allow := ctx.currentRobots.indexerGroup.Test(url.Path)
+		// If not in robots.txt, or if depth is greater than max depth, then skip link
+		if !allow || (maxDepth != 0 && crawlData.currentDepth+1 > maxDepth) {
+			return
+		}
+		ctx.addUrl(url.String(), UrlToCrawlData{page.Id, true, linkName, crawlData.currentDepth + 1})
+	} else if _, supported := GetProtocolFetcher(url.Scheme); supported && ctx.globalData.followExternalLinks {
+		ctx.addUrl(url.String(), UrlToCrawlData{page.Id, false, linkName, 0})
 	}
 }
@@ -5,9 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 	"net/url"
-	"os"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -56,6 +54,7 @@ type Page struct {
 	Charset      string
 	Language     string
 	Linecount    int
+	PageCount    int // PDF, EPUB, and DjVu documents
 	Udc          string
 
 	Title string // Used for text/gemini and text/markdown files with page titles
@@ -70,7 +69,7 @@ type Page struct {
 
 	// Audio/Video-only info
 	Album               string
-	Artist              string
+	Artist              string // Also the author of documents
 	AlbumArtist         string
 	Composer            string
 	Track               int
@@ -90,7 +89,7 @@ type Tag struct {
 	//Page Page
 	PageId     int
 	Name       string
-	Rank       int
+	Rank       float64
 	CrawlIndex int
 	Date_added time.Time
 }
@@ -107,15 +106,14 @@ type Link struct {
 	Date_added time.Time
 }
 
-func logError(format string, a ...interface{}) {
-	f, err := os.OpenFile("errors.log",
-		os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Println(err)
+// Rebuilds the FTS indexes, so that they include the pages crawled since they were last built
+func rebuildSearchIndexes(conn *sql.DB) {
+	indexes := []string{"FTS_DOMAIN_ID", "FTS_IMAGE_ID_EN"}
+	for _, language := range SearchLanguages {
+		indexes = append(indexes, language.PageIndex(), language.PageContentIndex())
 	}
-	defer f.Close()
-	if _, err := f.WriteString("[" + time.Now().String() + "] " + fmt.Sprintf(format, a...) + "\n"); err != nil {
-		log.Println(err)
+	for _, index := range indexes {
+		conn.Exec("EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX(?);", index)
 	}
 }
 
@@ -166,7 +164,7 @@ func GetFeedsAsSeeds(gd *GlobalData) []Seed {
 
 func setPageToHidden(ctx CrawlContext, URL string) {
 	if !utf8.ValidString(URL) {
-		logError("Error from Page: Page Url not valid utf8; %v", URL)
+		logger.Error().Str("url", URL).Msg("Page url not valid utf8")
 		return
 	}
 
@@ -174,6 +172,9 @@ func setPageToHidden(ctx CrawlContext, URL string) {
 	if parseErr != nil {
 		panic(parseErr)
 	}
+	if ctx.globalData.dbConn == nil {
+		return
+	}
 
 	// Check if exists in db, then update. Otherwise, don't add it in the first place
 	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM pages WHERE url=?", URL)
@@ -189,53 +190,66 @@ func setPageToHidden(ctx CrawlContext, URL string) {
 	} else if count > 0 {
 		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE pages SET scheme=?, indextime=?, crawlIndex=?, last_successful_visit=?, hidden=true WHERE url=?", strings.ToLower(strings.TrimSuffix(parsedUrl.Scheme, "://")), time.Now().UTC(), CrawlIndex, time.Now().UTC(), URL)
 		if err != nil {
-			fmt.Printf("Error from Page URL: %v\n", URL)
+			logger.Error().Str("url", URL).Err(err).Msg("Couldn't hide page")
 			panic(err)
 		}
 	}
 }
 
+// Adds or updates a page. This is where the override-title and no-index crawl rules are applied to every page.
 func addPageToDb(ctx CrawlContext, page Page) (Page, bool) {
+	rules := MatchCrawlRules(page.Url)
+	if rules.Title != "" {
+		page.Title = rules.Title
+	}
+	if rules.NoIndex {
+		page.Hidden = true
+	}
+
 	if !utf8.ValidString(page.Title) {
-		logError("Error from Page: Page Title not valid utf8; %v", page)
+		logger.Error().Str("url", page.Url).Msg("Page title not valid utf8")
 		return Page{}, false
 	}
 	if !utf8.ValidString(page.Url) {
-		logError("Error from Page: Page Url not valid utf8; %v", page)
+		logger.Error().Str("url", page.Url).Msg("Page url not valid utf8")
 		return Page{}, false
 	}
 	//titleGraphemeCount := uniseg.GraphemeClusterCount(page.Title)
 	if len(page.Title) > 250 {
-		logError("Error from Page: Title over 250 characters; %v", page)
+		logger.Error().Str("url", page.Url).Str("title", page.Title).Msg("Page title over 250 characters")
 		return Page{}, false
 	}
+	if ctx.globalData.dbConn == nil {
+		return ctx.globalData.pageSink.AddPage(page), true
+	}
+	defer metrics.observeDBWrite("page", time.Now())
 
 	// Check if exists in db, then update or insert
 	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM pages WHERE url=?", page.Url)
 	count := 0
 	err := row.Scan(&count)
 	if err != sql.ErrNoRows && err != nil { // TODO
-		logError("Error from Page: %v\n%v\n", page, err.Error())
+		logger.Error().Str("url", page.Url).Err(err).Msg("Couldn't write page")
 		return Page{}, false
 		//panic(err)
 		//return Page{}, false
 	}
 	if page.DomainId == 0 {
-		fmt.Printf("Page's DomainId is 0: %v\n", page)
+		logger.Error().Str("url", page.Url).Msg("Page's DomainId is 0")
 		panic("DomainId Value Cannot Be Zero")
 	}
 	if err == sql.ErrNoRows || count <= 0 {
-		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO pages (url, scheme, domainid, contenttype, charset, language, linecount, udc, title, prompt, headings, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlIndex, date_added, last_successful_visit, hidden, has_duplicate_on_gemini) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", page.Url, page.Scheme, page.DomainId, page.Content_type, page.Charset, page.Language, page.Linecount, page.Udc, page.Title, page.Prompt, page.Headings, page.Size, page.Hash, page.Feed, page.PublishDate, time.Now().UTC(), page.Album, page.Artist, page.AlbumArtist, page.Composer, page.Track, page.Disc, page.Copyright, CrawlIndex, time.Now().UTC(), time.Now().UTC(), page.Hidden, page.HasDuplicateOnGemini)
+		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO pages (url, scheme, domainid, contenttype, charset, language, linecount, pagecount, udc, title, prompt, headings, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlIndex, date_added, last_successful_visit, hidden, has_duplicate_on_gemini) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", page.Url, page.Scheme, page.DomainId, page.Content_type, page.Charset, page.Language, page.Linecount, page.PageCount, page.Udc, page.Title, page.Prompt, page.Headings, page.Size, page.Hash, page.Feed, page.PublishDate, time.Now().UTC(), page.Album, page.Artist, page.AlbumArtist, page.Composer, page.Track, page.Disc, page.Copyright, CrawlIndex, time.Now().UTC(), time.Now().UTC(), page.Hidden, page.HasDuplicateOnGemini)
 		if err != nil {
-			logError("Error from Page: %v\n%v\n", page, err.Error())
+			logger.Error().Str("url", page.Url).Err(err).Msg("Couldn't write page")
 			return Page{}, false
 			/*fmt.Printf("Error from Page: %v\n", page)
 			panic(err)*/
 		}
 	} else if count > 0 {
-		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE pages SET scheme=?, domainid=?, contenttype=?, charset=?, language=?, linecount=?, udc=?, title=?, prompt=?, headings=?, size=?, hash=?, feed=?, publishdate=?, indextime=?, album=?, artist=?, albumartist=?, composer=?, track=?, disc=?, copyright=?, crawlIndex=?, last_successful_visit=?, hidden=?, has_duplicate_on_gemini=? WHERE url=?", page.Scheme, page.DomainId, page.Content_type, page.Charset, page.Language, page.Linecount, page.Udc, page.Title, page.Prompt, page.Headings, page.Size, page.Hash, page.Feed, page.PublishDate, time.Now().UTC(), page.Album, page.Artist, page.AlbumArtist, page.Composer, page.Track, page.Disc, page.Copyright, CrawlIndex, time.Now().UTC(), page.Hidden, page.HasDuplicateOnGemini, page.Url)
+		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE pages SET scheme=?, domainid=?, contenttype=?, charset=?, language=?, linecount=?, pagecount=?, udc=?, title=?, prompt=?, headings=?, size=?, hash=?, feed=?, publishdate=?, indextime=?, album=?, artist=?, albumartist=?, composer=?, track=?, disc=?, copyright=?, crawlIndex=?, last_successful_visit=?, hidden=?, has_duplicate_on_gemini=? WHERE url=?", page.Scheme, page.DomainId, page.Content_type, page.Charset, page.Language, page.Linecount, page.PageCount, page.Udc, page.Title, page.Prompt, page.Headings, page.Size, page.Hash, page.Feed, page.PublishDate, time.Now().UTC(), page.Album, page.Artist, page.AlbumArtist, page.Composer, page.Track, page.Disc, page.Copyright, CrawlIndex, time.Now().UTC(), page.Hidden, page.HasDuplicateOnGemini, page.Url)
 		if err != nil {
-			logError("Error from Page: %v\n%v\n", page, err.Error())
+			logger.Error().Str("url", page.Url).Err(err).Msg("Couldn't write page")
 			return Page{}, false
 			/*fmt.Printf("Error from Page: %v\n", page)
 			panic(err)*/
@@ -244,12 +258,85 @@ func addPageToDb(ctx CrawlContext, page Page) (Page, bool) {
 
 	// Get the page
 	var result Page
-	row2 := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT FIRST 1 id, url, scheme, domainid, contenttype, charset, language, linecount, udc, title, prompt, headings, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlindex, date_added, last_successful_visit, hidden, has_duplicate_on_gemini FROM pages WHERE url=?", page.Url)
-	row2.Scan(&result.Id, &result.Url, &result.Scheme, &result.DomainId, &result.Content_type, &result.Charset, &result.Language, &result.Linecount, &result.Udc, &result.Title, &result.Prompt, &result.Headings, &result.Size, &result.Hash, &result.Feed, &result.PublishDate, &result.Index_time, &result.Album, &result.Artist, &result.AlbumArtist, &result.Composer, &result.Track, &result.Disc, &result.Copyright, &result.CrawlIndex, &result.Date_added, &result.LastSuccessfulVisit, &result.Hidden, &result.HasDuplicateOnGemini)
+	row2 := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT FIRST 1 id, url, scheme, domainid, contenttype, charset, language, linecount, pagecount, udc, title, prompt, headings, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlindex, date_added, last_successful_visit, hidden, has_duplicate_on_gemini FROM pages WHERE url=?", page.Url)
+	row2.Scan(&result.Id, &result.Url, &result.Scheme, &result.DomainId, &result.Content_type, &result.Charset, &result.Language, &result.Linecount, &result.PageCount, &result.Udc, &result.Title, &result.Prompt, &result.Headings, &result.Size, &result.Hash, &result.Feed, &result.PublishDate, &result.Index_time, &result.Album, &result.Artist, &result.AlbumArtist, &result.Composer, &result.Track, &result.Disc, &result.Copyright, &result.CrawlIndex, &result.Date_added, &result.LastSuccessfulVisit, &result.Hidden, &result.HasDuplicateOnGemini)
+
+	// Take over the links of pages that permanently redirect here, if they haven't been merged already
+	for _, fromUrl := range ctx.globalData.redirects.TakeUnmerged(result.Url) {
+		mergeRedirectedPage(ctx, fromUrl, result)
+	}
 	return result, true
 }
 
+// Stores the stripped body text and the preformatted text of a page, replacing what was stored from the last crawl, so that both are covered by the content FTS index
+func addPageContentToDb(ctx CrawlContext, page Page, content string, preformatted string) bool {
+	if ctx.globalData.dbConn == nil {
+		return true
+	}
+	defer metrics.observeDBWrite("content", time.Now())
+	content = strings.ToValidUTF8(content, "")
+	preformatted = strings.ToValidUTF8(preformatted, "")
+
+	_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE OR INSERT INTO page_contents (pageid, content, preformatted, date_added) VALUES (?, ?, ?, ?) MATCHING (pageid)", page.Id, content, preformatted, time.Now().UTC())
+	if err != nil {
+		logger.Error().Str("url", page.Url).Err(err).Msg("Couldn't add page contents")
+		return false
+	}
+	return true
+}
+
+// Returns the urls of the visible pages of the markup formats that have no body text stored in page_contents, like pages
+// that were indexed before it was added
+func getUrlsWithoutContents(conn *sql.DB) ([]string, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT p.url, p.contenttype FROM pages p WHERE p.hidden = false AND NOT EXISTS (SELECT 1 FROM page_contents c WHERE c.pageid = p.id)")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		var contentType sql.NullString
+		if err := rows.Scan(&url, &contentType); err != nil {
+			return nil, err
+		}
+		mediatype, _, _ := strings.Cut(contentType.String, ";")
+		if _, ok := GetDocumentParser(strings.ToLower(strings.TrimSpace(mediatype))); ok {
+			urls = append(urls, url)
+		}
+	}
+	return urls, rows.Err()
+}
+
+// Stores the metadata of an image page, along with its alt text
+func addImageToDb(ctx CrawlContext, page Page, metadata ImageMetadata, altText string) bool {
+	if ctx.globalData.dbConn == nil {
+		return true
+	}
+	defer metrics.observeDBWrite("image", time.Now())
+	var captureDate interface{} = nil
+	if !metadata.CaptureDate.IsZero() {
+		captureDate = metadata.CaptureDate.UTC()
+	}
+	cameraMake := truncateRunes(strings.ToValidUTF8(metadata.CameraMake, ""), 250)
+	cameraModel := truncateRunes(strings.ToValidUTF8(metadata.CameraModel, ""), 250)
+	title := truncateRunes(strings.ToValidUTF8(metadata.Title, ""), 1020)
+	description := strings.ToValidUTF8(metadata.Description, "")
+	altText = truncateRunes(strings.ToValidUTF8(altText, ""), 1020)
+
+	_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE OR INSERT INTO images (pageid, width, height, cameramake, cameramodel, capturedate, title, description, alttext, crawlIndex, date_added) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) MATCHING (pageid)", page.Id, metadata.Width, metadata.Height, cameraMake, cameraModel, captureDate, title, description, altText, CrawlIndex, time.Now().UTC())
+	if err != nil {
+		logger.Error().Str("url", page.Url).Err(err).Msg("Couldn't add image metadata")
+		return false
+	}
+	return true
+}
+
 func getPagesWithHashAndScheme(ctx CrawlContext, url string, pageHash string, scheme string) []Page {
+	if ctx.globalData.dbConn == nil {
+		return nil
+	}
 	query := "SELECT id, url, scheme, domainid, contenttype, charset, language, linecount, udc, title, prompt, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlindex, date_added, last_successful_visit, hidden, has_duplicate_on_gemini FROM pages WHERE url<>? AND hash=?"
 	if scheme != "" {
 		query += " AND scheme=? AND hidden=false"
@@ -290,6 +377,9 @@ func getPagesWithHashAndScheme(ctx CrawlContext, url string, pageHash string, sc
 }
 
 func getPagesWithHashAndNotScheme(ctx CrawlContext, url string, pageHash string, scheme string) []Page {
+	if ctx.globalData.dbConn == nil {
+		return nil
+	}
 	query := "SELECT id, url, scheme, domainid, contenttype, charset, language, linecount, udc, title, prompt, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlindex, date_added, last_successful_visit, hidden, has_duplicate_on_gemini FROM pages WHERE url<>? AND hash=?"
 	if scheme != "" {
 		query += " AND scheme<>?"
@@ -331,6 +421,9 @@ func getPagesWithHashAndNotScheme(ctx CrawlContext, url string, pageHash string,
 
 // Sets has_duplicate_on_gemini to true on all pages of schemes outside of 'gemini' with the given hash.
 func setPageHashHasGeminiDuplicate(ctx CrawlContext, url string, pageHash string, value bool) {
+	if ctx.globalData.dbConn == nil {
+		return
+	}
 	_, err := ctx.globalData.dbConn.Exec("UPDATE pages SET has_duplicate_on_gemini=? WHERE url<>? AND hash=? AND scheme<>'gemini'", value, url, pageHash)
 	if err != sql.ErrNoRows && err != nil { // TODO
 		panic(err)
@@ -339,48 +432,54 @@ func setPageHashHasGeminiDuplicate(ctx CrawlContext, url string, pageHash string
 }
 
 func domainIncrementSlowDownCount(ctx CrawlContext, domain Domain) {
+	if ctx.globalData.dbConn == nil {
+		return
+	}
 	// Check if exists in db, then update or insert
 	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM domains WHERE domain=?", domain.Domain)
 	count := 0
 	err := row.Scan(&count)
 	if err != sql.ErrNoRows && err != nil {
-		fmt.Printf("Error from Domain: %v\n", domain)
+		logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Err(err).Msg("Couldn't write domain")
 		panic(err)
 	}
 	if err == sql.ErrNoRows || count <= 0 { // Insert domain
 		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO domains (domain, title, port, has_robots, has_favicon, has_security, crawlIndex, date_added, slowdowncount, emptymetacount) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", domain.Domain, domain.Title, domain.Port, domain.HasRobots, domain.HasSecurity, domain.HasFavicon, CrawlIndex, time.Now().UTC(), 1, 0)
 		if err != nil {
-			fmt.Printf("Error from Domain: %v\n", domain)
+			logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Err(err).Msg("Couldn't write domain")
 			panic(err)
 		}
 	} else if count > 0 { // Otherwise, just increment the slowdowncount
 		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE domains SET slowdowncount=slowdowncount+1 WHERE domain=?", domain.Domain)
 		if err != nil {
-			fmt.Printf("Error from Domain: %v\n", domain)
+			logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Err(err).Msg("Couldn't write domain")
 			panic(err)
 		}
 	}
 }
 
 func domainIncrementEmptyMeta(ctx CrawlContext, domain Domain) {
+	if ctx.globalData.dbConn == nil {
+		return
+	}
 	// Check if exists in db, then update or insert
 	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM domains WHERE domain=?", domain.Domain)
 	count := 0
 	err := row.Scan(&count)
 	if !errors.Is(err, sql.ErrNoRows) && err != nil {
-		fmt.Printf("Error from Domain: %v\n", domain)
+		logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Err(err).Msg("Couldn't write domain")
 		panic(err)
 	}
 	if errors.Is(err, sql.ErrNoRows) || count <= 0 { // Insert domain
 		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO domains (domain, title, port, has_robots, has_favicon, has_security, crawlIndex, date_added, slowdowncount, emptymetacount) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", domain.Domain, domain.Title, domain.Port, domain.HasRobots, domain.HasSecurity, domain.HasFavicon, CrawlIndex, time.Now().UTC(), 0, 1)
 		if err != nil {
-			fmt.Printf("Error from Domain: %v\n", domain)
+			logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Err(err).Msg("Couldn't write domain")
 			panic(err)
 		}
 	} else if count > 0 { // Otherwise, just increment the emptymetacount
 		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE domains SET emptymetacount=emptymetacount+1 WHERE domain=?", domain.Domain)
 		if err != nil {
-			fmt.Printf("Error from Domain: %v\n", domain)
+			logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Err(err).Msg("Couldn't write domain")
 			panic(err)
 		}
 	}
@@ -388,33 +487,37 @@ func domainIncrementEmptyMeta(ctx CrawlContext, domain Domain) {
 
 func addDomainToDb(ctx CrawlContext, domain Domain, update bool) (Domain, bool) {
 	if !utf8.ValidString(domain.Title) {
-		logError("Error from Domain: Domain Title not valid utf8; %v", domain)
+		logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Msg("Domain title not valid utf8")
 		return Domain{}, false
 	}
 	//titleGraphemeCount := uniseg.GraphemeClusterCount(domain.Title)
 	if len(domain.Title) > 250 {
-		logError("Error from Domain: Domain Title over 250 characters; %v", domain)
+		logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Str("title", domain.Title).Msg("Domain title over 250 characters")
 		return Domain{}, false
 	}
+	if ctx.globalData.dbConn == nil {
+		return ctx.globalData.pageSink.AddDomain(domain), true
+	}
+	defer metrics.observeDBWrite("domain", time.Now())
 
 	// Check if exists in db, then update or insert
 	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM domains WHERE domain=? AND port=?", domain.Domain, domain.Port)
 	count := 0
 	err := row.Scan(&count)
 	if err != sql.ErrNoRows && err != nil {
-		fmt.Printf("Error from Domain: %v\n", domain)
+		logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Err(err).Msg("Couldn't write domain")
 		panic(err)
 	}
 	if err == sql.ErrNoRows || count <= 0 {
 		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO domains (domain, title, port, has_robots, has_favicon, has_security, crawlIndex, date_added, slowdowncount, emptymetacount) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", domain.Domain, domain.Title, domain.Port, domain.HasRobots, domain.HasSecurity, domain.HasFavicon, CrawlIndex, time.Now().UTC(), 0, 0)
 		if err != nil {
-			fmt.Printf("Error from Domain: %v\n", domain)
+			logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Err(err).Msg("Couldn't write domain")
 			panic(err)
 		}
 	} else if count > 0 && update {
 		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE domains SET title=?, has_robots=?, has_security=?, has_favicon=?, crawlIndex=? WHERE domain=? AND port=?", domain.Title, domain.HasRobots, domain.HasSecurity, domain.HasFavicon, CrawlIndex, domain.Domain, domain.Port)
 		if err != nil {
-			fmt.Printf("Error from Domain: %v\n", domain)
+			logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Err(err).Msg("Couldn't write domain")
 			panic(err)
 		}
 	}
@@ -424,7 +527,7 @@ func addDomainToDb(ctx CrawlContext, domain Domain, update bool) (Domain, bool)
 	row2 := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT FIRST 1 id, domain, title, port, has_robots, has_security, has_favicon, crawlIndex, date_added FROM domains WHERE domain=? AND port=?", domain.Domain, domain.Port)
 	err_result := row2.Scan(&result.Id, &result.Domain, &result.Title, &result.Port, &result.HasRobots, &result.HasSecurity, &result.HasFavicon, &result.CrawlIndex, &result.Date_added)
 	if err_result != nil {
-		fmt.Printf("Get Error from Domain: %v\n", domain)
+		logger.Error().Str("domain", domain.Domain).Int("port", domain.Port).Err(err_result).Msg("Couldn't get domain")
 		panic(err_result)
 	}
 	return result, true
@@ -432,14 +535,19 @@ func addDomainToDb(ctx CrawlContext, domain Domain, update bool) (Domain, bool)
 
 func addLinkToDb(ctx CrawlContext, link Link) (Link, bool) {
 	if !utf8.ValidString(link.Title) {
-		logError("Error from Link: Link Title not valid utf8; %v", link)
+		logger.Error().Int("from", link.FromPageId).Int("to", link.ToPageId).Msg("Link title not valid utf8")
 		return Link{}, false
 	}
 	//titleGraphemeCount := uniseg.GraphemeClusterCount(link.Title)
 	if len(link.Title) > 250 {
-		logError("Error from Link: Title over 250 characters; %v", link)
+		logger.Error().Int("from", link.FromPageId).Int("to", link.ToPageId).Str("title", link.Title).Msg("Link title over 250 characters")
 		return Link{}, false
 	}
+	if ctx.globalData.dbConn == nil {
+		ctx.globalData.pageSink.AddLink(link)
+		return link, true
+	}
+	defer metrics.observeDBWrite("link", time.Now())
 
 	// Check if exists in db, then update or insert
 	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM links WHERE pageid_from=? AND pageid_to=?", link.FromPageId, link.ToPageId)
@@ -450,19 +558,19 @@ func addLinkToDb(ctx CrawlContext, link Link) (Link, bool) {
 		//return Page{}, false
 	}
 	if link.FromPageId == 0 || link.ToPageId == 0 {
-		logError("Link's From/To Page Id is 0: %v\n", link)
+		logger.Error().Int("from", link.FromPageId).Int("to", link.ToPageId).Msg("Link's from or to page id is 0")
 		//panic("DomainId Value Cannot Be Zero")
 	}
 	if err == sql.ErrNoRows || count <= 0 {
 		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO links (pageid_from, pageid_to, title, crosshost, crawlIndex, date_added) VALUES (?, ?, ?, ?, ?, ?)", link.FromPageId, link.ToPageId, link.Title, link.Cross_host, CrawlIndex, time.Now().UTC())
 		if err != nil {
-			fmt.Printf("Error from Link: %v\n", link)
+			logger.Error().Int("from", link.FromPageId).Int("to", link.ToPageId).Err(err).Msg("Couldn't write link")
 			panic(err)
 		}
 	} else if count > 0 {
 		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE links SET title=?, crawlIndex=? WHERE pageid_from=? AND pageid_to=?", link.Title, CrawlIndex, link.FromPageId, link.ToPageId)
 		if err != nil {
-			fmt.Printf("Error from Link: %v\n", link)
+			logger.Error().Int("from", link.FromPageId).Int("to", link.ToPageId).Err(err).Msg("Couldn't write link")
 			panic(err)
 		}
 	}
@@ -473,3 +581,109 @@ func addLinkToDb(ctx CrawlContext, link Link) (Link, bool) {
 	row2.Scan(&result.Id, &result.FromPageId, &result.ToPageId, &result.Title, &result.Cross_host, &result.CrawlIndex, &result.Date_added)
 	return result, true
 }
+
+// Removes the tags and mentions of a page, so they can be replaced with the ones from its latest crawl
+func removeTagsAndMentionsFromDb(ctx CrawlContext, pageId int) {
+	if ctx.globalData.dbConn == nil {
+		return
+	}
+	if _, err := ctx.globalData.dbConn.ExecContext(context.Background(), "DELETE FROM tags WHERE pageid=?", pageId); err != nil {
+		logger.Error().Int("page", pageId).Err(err).Msg("Couldn't remove tags")
+	}
+	if _, err := ctx.globalData.dbConn.ExecContext(context.Background(), "DELETE FROM mentions WHERE pageid=?", pageId); err != nil {
+		logger.Error().Int("page", pageId).Err(err).Msg("Couldn't remove mentions")
+	}
+}
+
+func addTagToDb(ctx CrawlContext, pageId int, name string, rank float64) bool {
+	if !utf8.ValidString(name) {
+		logger.Error().Int("page", pageId).Str("tag", name).Msg("Tag not valid utf8")
+		return false
+	}
+	if ctx.globalData.dbConn == nil {
+		return true
+	}
+
+	_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO tags (pageid, name, rank, crawlIndex, date_added) VALUES (?, ?, ?, ?, ?)", pageId, name, rank, CrawlIndex, time.Now().UTC())
+	if err != nil {
+		logger.Error().Int("page", pageId).Str("tag", name).Err(err).Msg("Couldn't add tag")
+		return false
+	}
+	return true
+}
+
+func addMentionToDb(ctx CrawlContext, pageId int, name string) bool {
+	if !utf8.ValidString(name) {
+		logger.Error().Int("page", pageId).Str("mention", name).Msg("Mention not valid utf8")
+		return false
+	}
+	if ctx.globalData.dbConn == nil {
+		return true
+	}
+
+	_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO mentions (pageid, name, crawlIndex, date_added) VALUES (?, ?, ?, ?)", pageId, name, CrawlIndex, time.Now().UTC())
+	if err != nil {
+		logger.Error().Int("page", pageId).Str("mention", name).Err(err).Msg("Couldn't add mention")
+		return false
+	}
+	return true
+}
+
+// Stores the entries of a feed, updating the ones stored by earlier crawls of it. Returns the entries that are new since the last crawl of the feed.
+// Without a DB, all of the entries are new.
+func addFeedEntriesToDb(ctx CrawlContext, page Page, entries []FeedEntry) []FeedEntry {
+	if ctx.globalData.dbConn == nil {
+		return entries
+	}
+	defer metrics.observeDBWrite("feed_entries", time.Now())
+	rows, err := ctx.globalData.dbConn.QueryContext(context.Background(), "SELECT url FROM feed_entries WHERE feedid=?", page.Id)
+	if err != nil {
+		logger.Error().Str("url", page.Url).Err(err).Msg("Couldn't get feed entries")
+		return nil
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err == nil {
+			existing[strings.ToLower(url)] = true // The url column is case-insensitive
+		}
+	}
+	rows.Close()
+
+	newEntries := make([]FeedEntry, 0)
+	for _, entry := range entries {
+		if !utf8.ValidString(entry.Url) || utf8.RuneCountInString(entry.Url) > 1020 {
+			continue
+		}
+		title := truncateRunes(strings.ToValidUTF8(entry.Title, ""), 1020)
+		author := truncateRunes(strings.ToValidUTF8(entry.Author, ""), 250)
+
+		key := strings.ToLower(entry.Url)
+		if existing[key] {
+			_, err = ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE feed_entries SET title=?, author=?, published=?, updated=?, crawlIndex=? WHERE feedid=? AND url=?", title, author, entry.Published.UTC(), entry.Updated.UTC(), CrawlIndex, page.Id, entry.Url)
+		} else {
+			_, err = ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO feed_entries (feedid, url, title, author, published, updated, crawlIndex, date_added) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", page.Id, entry.Url, title, author, entry.Published.UTC(), entry.Updated.UTC(), CrawlIndex, time.Now().UTC())
+			if err == nil {
+				existing[key] = true
+				newEntries = append(newEntries, entry)
+			}
+		}
+		if err != nil {
+			logger.Error().Str("url", page.Url).Str("entry", entry.Url).Err(err).Msg("Couldn't add feed entry")
+		}
+	}
+	return newEntries
+}
+
+// Gets the publication date a feed gave the url as one of its entries
+func getFeedEntryPublishDate(ctx CrawlContext, url string) (time.Time, bool) {
+	if ctx.globalData.dbConn == nil {
+		return time.Time{}, false
+	}
+	var published time.Time
+	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT FIRST 1 published FROM feed_entries WHERE url=? AND published IS NOT NULL ORDER BY published DESC", url)
+	if err := row.Scan(&published); err != nil || published.Year() <= 1 {
+		return time.Time{}, false
+	}
+	return published, true
+}
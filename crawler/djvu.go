@@ -0,0 +1,170 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// Parses the metadata of DjVu files: their page count, the metadata of their uncompressed annotation chunks (ANTa), and the text of
+// their uncompressed text chunks (TXTa). The compressed variants of these chunks (ANTz, TXTz) use DjVu's own BZZ compression and aren't read.
+type djvuParser struct{}
+
+// A chunk of the IFF container of DjVu files. FORM chunks contain other chunks after their 4-byte form type.
+type djvuChunk struct {
+	id   string
+	data []byte
+}
+
+func (p djvuParser) ParseDocument(data []byte) Document {
+	doc := newDocument(len(data))
+	if !bytes.HasPrefix(data, []byte("AT&TFORM")) {
+		return doc
+	}
+	root, _, ok := readDjVuChunk(data[4:])
+	if !ok || len(root.data) < 4 {
+		return doc
+	}
+
+	var strippedTextBuilder strings.Builder
+	switch string(root.data[:4]) {
+	case "DJVU":
+		// Single page document
+		doc.PageCount = 1
+		doc.readDjVuPage(root.data[4:], &strippedTextBuilder)
+	case "DJVM":
+		// Bundled documents contain a FORM:DJVU chunk per page. Indirect documents only have a directory of the files of their pages.
+		for _, chunk := range readDjVuChunks(root.data[4:]) {
+			if chunk.id == "FORM" && len(chunk.data) >= 4 && string(chunk.data[:4]) == "DJVU" {
+				doc.PageCount++
+				doc.readDjVuPage(chunk.data[4:], &strippedTextBuilder)
+			} else if chunk.id == "DIRM" && len(chunk.data) >= 3 && chunk.data[0]&0x80 == 0 {
+				doc.PageCount = int(binary.BigEndian.Uint16(chunk.data[1:3]))
+			} else if chunk.id == "ANTa" {
+				doc.addDjVuMetadata(chunk.data)
+			}
+		}
+	}
+
+	doc.StrippedText = cleanExtractedText(strippedTextBuilder.String())
+	doc.Linecount = strings.Count(doc.StrippedText, "\n")
+	addTagsAndMentions(doc.StrippedText, 1, &doc.Tags, &doc.Mentions)
+	return doc
+}
+
+func readDjVuChunk(data []byte) (djvuChunk, int, bool) {
+	if len(data) < 8 {
+		return djvuChunk{}, 0, false
+	}
+	size := int(binary.BigEndian.Uint32(data[4:8]))
+	if size < 0 || 8+size > len(data) {
+		return djvuChunk{}, 0, false
+	}
+	// Chunks are padded to an even size
+	next := 8 + size + size%2
+	return djvuChunk{string(data[:4]), data[8 : 8+size]}, min(next, len(data)), true
+}
+
+func readDjVuChunks(data []byte) []djvuChunk {
+	chunks := make([]djvuChunk, 0)
+	for len(data) > 0 {
+		chunk, next, ok := readDjVuChunk(data)
+		if !ok {
+			break
+		}
+		chunks = append(chunks, chunk)
+		data = data[next:]
+	}
+	return chunks
+}
+
+func (doc *Document) readDjVuPage(data []byte, strippedTextBuilder *strings.Builder) {
+	for _, chunk := range readDjVuChunks(data) {
+		switch chunk.id {
+		case "ANTa":
+			doc.addDjVuMetadata(chunk.data)
+		case "TXTa":
+			// The text starts with its length as a 24-bit integer, and is followed by the zones of the text layer
+			if len(chunk.data) >= 3 && strippedTextBuilder.Len() < maxExtractedTextSize {
+				length := int(chunk.data[0])<<16 | int(chunk.data[1])<<8 | int(chunk.data[2])
+				if 3+length <= len(chunk.data) {
+					strippedTextBuilder.Write(chunk.data[3 : 3+length])
+					strippedTextBuilder.WriteString("\n")
+				}
+			}
+		}
+	}
+}
+
+// Reads the "(metadata (key "value") ...)" expression of an annotation chunk, as written by djvused's set-meta
+func (doc *Document) addDjVuMetadata(data []byte) {
+	start := bytes.Index(data, []byte("(metadata"))
+	if start == -1 {
+		return
+	}
+	s := string(data[start+len("(metadata"):])
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if !strings.HasPrefix(s, "(") {
+			return
+		}
+		key, rest, found := strings.Cut(s[1:], " ")
+		if !found {
+			return
+		}
+		value, rest, ok := readDjVuString(strings.TrimLeft(rest, " \t\r\n"))
+		if !ok {
+			return
+		}
+		end := strings.IndexByte(rest, ')')
+		if end == -1 {
+			return
+		}
+		s = rest[end+1:]
+
+		switch strings.ToLower(key) {
+		case "title":
+			doc.Title = value
+		case "author":
+			doc.Author = value
+		case "year":
+			if doc.PublishDate.IsZero() {
+				doc.PublishDate = parseFeedDate(value, []string{"2006"})
+			}
+		case "creationdate":
+			doc.PublishDate = parseFeedDate(value, []string{time.RFC3339, "2006-01-02", "2006"})
+		case "moddate":
+			doc.ModificationDate = parseFeedDate(value, []string{time.RFC3339, "2006-01-02", "2006"})
+		}
+	}
+}
+
+// Reads a quoted string with backslash escapes. Returns the string and the rest of s after it.
+func readDjVuString(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, "\"") {
+		return "", s, false
+	}
+	var builder strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					builder.WriteByte('\n')
+				case 't':
+					builder.WriteByte('\t')
+				default:
+					builder.WriteByte(s[i])
+				}
+			}
+		case '"':
+			return strings.TrimSpace(builder.String()), s[i+1:], true
+		default:
+			builder.WriteByte(s[i])
+		}
+	}
+	return "", s, false
+}
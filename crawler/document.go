@@ -0,0 +1,95 @@
+package crawler
+
+import (
+	"strings"
+	"time"
+)
+
+// DocumentLink is a link of a parsed document, with the text it's linked with
+type DocumentLink struct {
+	Name  string
+	Url   string
+	Input bool // Spartan input links, which need a query and aren't crawled
+	Image bool // Embedded images, like markdown's ![alt](url)
+}
+
+// Document is what the crawler gets out of a page of one of the markup formats, or out of a file whose text can be extracted
+type Document struct {
+	Title        string
+	Linecount    int
+	Headings     string // One heading per line, with the heading markup of the format
+	Links        []DocumentLink
+	Preformatted string // The text of the preformatted blocks, which isn't part of the stripped text
+	StrippedText string // The text of the document without its markup
+	Size         int
+	IsFeed       bool
+	Tags         map[string]float64 // Hashtags with their rank, see addTagsAndMentions
+	Mentions     map[string]bool
+
+	// Metadata given by the document (like markdown front matter or a PDF's document information) or its response (like scroll's response metadata)
+	Author           string
+	PublishDate      time.Time
+	ModificationDate time.Time
+	Language         string // BCP 47 language tag, like "en-US"
+	PageCount        int    // Pages of paginated documents, like PDF
+}
+
+// DocumentParser parses the documents of a markup or file format
+type DocumentParser interface {
+	ParseDocument(data []byte) Document
+}
+
+// Parsers of the markup and file formats, by mediatype
+var documentParsers = map[string]DocumentParser{
+	"text/gemini":      gemtextParser{},
+	"text/spartan":     gemtextParser{},
+	"text/scroll":      gemtextParser{}, // Scroll documents extend gemtext, with their metadata in the response
+	"text/nex":         nexParser{},
+	GophermapMediatype: gophermapParser{},
+	"text/markdown":    markdownParser{},
+
+	// Documents whose metadata and text are extracted
+	"application/pdf":      pdfParser{},
+	"application/epub+zip": epubParser{},
+	"application/epub":     epubParser{},
+	"image/vnd.djvu":       djvuParser{},
+	"image/x-djvu":         djvuParser{},
+}
+
+func GetDocumentParser(mediatype string) (DocumentParser, bool) {
+	parser, ok := documentParsers[mediatype]
+	return parser, ok
+}
+
+func newDocument(size int) Document {
+	return Document{Size: size, Links: make([]DocumentLink, 0), Tags: make(map[string]float64), Mentions: make(map[string]bool)}
+}
+
+// Documents with more than one gemsub entry, which are links whose titles start with a date, are feeds
+func documentIsFeed(links []DocumentLink) bool {
+	return len(gemsubEntries(links)) > 1
+}
+
+// Keeps track of the title of a document as its lines are parsed. The first non-blank line with letters is the title until a heading
+// is found, and higher level headings replace lower level ones.
+type titleTracker struct {
+	title     string
+	lastLevel int
+}
+
+func newTitleTracker() titleTracker {
+	return titleTracker{"", 7}
+}
+
+func (t *titleTracker) line(line string, maxLength int) {
+	if t.title == "" && strings.TrimSpace(line) != "" && ContainsLetterRunes(line) && (maxLength == 0 || len(line) < maxLength) {
+		t.title = strings.TrimSpace(line)
+	}
+}
+
+func (t *titleTracker) heading(text string, level int) {
+	if t.title == "" || t.lastLevel > level {
+		t.title = strings.TrimSpace(text)
+		t.lastLevel = level
+	}
+}
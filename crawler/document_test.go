@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of the document parser tests")
+
+// Mediatypes of the documents in testdata/documents, by file extension
+var documentTestMediatypes = map[string]string{
+	".gmi":       "text/gemini",
+	".spartan":   "text/spartan",
+	".scroll":    "text/scroll",
+	".nex":       "text/nex",
+	".gophermap": GophermapMediatype,
+	".md":        "text/markdown",
+}
+
+// Renders a parsed document in a stable form for its golden file
+func renderDocument(doc Document) string {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "title: %q\n", doc.Title)
+	fmt.Fprintf(&builder, "linecount: %d\nsize: %d\nfeed: %v\n", doc.Linecount, doc.Size, doc.IsFeed)
+	fmt.Fprintf(&builder, "author: %q\n", doc.Author)
+	fmt.Fprintf(&builder, "published: %s\nmodified: %s\n", renderDate(doc.PublishDate), renderDate(doc.ModificationDate))
+
+	builder.WriteString("\n[headings]\n")
+	builder.WriteString(doc.Headings)
+	builder.WriteString("\n[links]\n")
+	for _, link := range doc.Links {
+		flags := ""
+		if link.Input {
+			flags += " input"
+		}
+		if link.Image {
+			flags += " image"
+		}
+		fmt.Fprintf(&builder, "%s %q%s\n", link.Url, link.Name, flags)
+	}
+
+	builder.WriteString("\n[tags]\n")
+	tags := make([]string, 0, len(doc.Tags))
+	for tag := range doc.Tags {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	for _, tag := range tags {
+		fmt.Fprintf(&builder, "%s %g\n", tag, doc.Tags[tag])
+	}
+	builder.WriteString("\n[mentions]\n")
+	mentions := make([]string, 0, len(doc.Mentions))
+	for mention := range doc.Mentions {
+		mentions = append(mentions, mention)
+	}
+	slices.Sort(mentions)
+	for _, mention := range mentions {
+		fmt.Fprintf(&builder, "%s\n", mention)
+	}
+
+	builder.WriteString("\n[preformatted]\n")
+	builder.WriteString(doc.Preformatted)
+	builder.WriteString("\n[text]\n")
+	builder.WriteString(doc.StrippedText)
+	return builder.String()
+}
+
+func renderDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func TestDocumentParsersGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "documents", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, input := range inputs {
+		mediatype, ok := documentTestMediatypes[filepath.Ext(input)]
+		if !ok {
+			continue
+		}
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			parser, ok := GetDocumentParser(mediatype)
+			if !ok {
+				t.Fatalf("no document parser for %s", mediatype)
+			}
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := renderDocument(parser.ParseDocument(data))
+
+			golden := strings.TrimSuffix(input, filepath.Ext(input)) + ".golden"
+			if *updateGolden {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run the tests with -update to create it)", err)
+			}
+			if got != string(want) {
+				t.Errorf("parsed document doesn't match %s:\n--- got ---\n%s\n--- want ---\n%s", golden, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package crawler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Parses EPUB files. The package document gives the title, authors, language, and dates, and the text is taken from the documents
+// of the spine, in reading order. EPUBs only have a page count when they have a page list, which maps to the pages of a print edition.
+type epubParser struct{}
+
+// Documents of an EPUB larger than this aren't read, so that a compressed document can't expand to gigabytes
+const epubMaxDocumentSize = 32 * 1024 * 1024
+
+type epubContainer struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type epubPackage struct {
+	Metadata struct {
+		Titles    []string `xml:"title"`
+		Creators  []string `xml:"creator"`
+		Languages []string `xml:"language"`
+		Dates     []string `xml:"date"`
+		Metas     []struct {
+			Property string `xml:"property,attr"`
+			Value    string `xml:",chardata"`
+		} `xml:"meta"`
+	} `xml:"metadata"`
+	Manifest []struct {
+		Id         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine []struct {
+		Idref string `xml:"idref,attr"`
+	} `xml:"spine>itemref"`
+}
+
+func (p epubParser) ParseDocument(data []byte) Document {
+	doc := newDocument(len(data))
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return doc
+	}
+	files := make(map[string]*zip.File, len(archive.File))
+	for _, file := range archive.File {
+		files[file.Name] = file
+	}
+
+	var container epubContainer
+	if err := decodeEpubXML(files["META-INF/container.xml"], &container); err != nil || len(container.Rootfiles) == 0 {
+		return doc
+	}
+	packagePath := container.Rootfiles[0].FullPath
+	var pkg epubPackage
+	if err := decodeEpubXML(files[packagePath], &pkg); err != nil {
+		return doc
+	}
+
+	if len(pkg.Metadata.Titles) > 0 {
+		doc.Title = strings.TrimSpace(pkg.Metadata.Titles[0])
+	}
+	authors := make([]string, 0, len(pkg.Metadata.Creators))
+	for _, creator := range pkg.Metadata.Creators {
+		if creator = strings.TrimSpace(creator); creator != "" {
+			authors = append(authors, creator)
+		}
+	}
+	doc.Author = strings.Join(authors, ", ")
+	if len(pkg.Metadata.Languages) > 0 {
+		doc.Language = strings.TrimSpace(pkg.Metadata.Languages[0])
+	}
+	if len(pkg.Metadata.Dates) > 0 {
+		doc.PublishDate = parseFeedDate(pkg.Metadata.Dates[0], xmpDateLayouts)
+	}
+	for _, meta := range pkg.Metadata.Metas {
+		if meta.Property == "dcterms:modified" {
+			doc.ModificationDate = parseFeedDate(meta.Value, xmpDateLayouts)
+		}
+	}
+
+	// Hrefs of the manifest are relative to the package document
+	manifest := make(map[string]string, len(pkg.Manifest))
+	packageDir := path.Dir(packagePath)
+	resolve := func(href string) string {
+		if unescaped, err := neturl.PathUnescape(href); err == nil {
+			href = unescaped
+		}
+		return path.Join(packageDir, href)
+	}
+	for _, item := range pkg.Manifest {
+		manifest[item.Id] = resolve(item.Href)
+		if strings.Contains(item.Properties, "nav") {
+			doc.PageCount = max(doc.PageCount, epubNavPageCount(files[resolve(item.Href)]))
+		} else if item.MediaType == "application/x-dtbncx+xml" {
+			doc.PageCount = max(doc.PageCount, epubNCXPageCount(files[resolve(item.Href)]))
+		}
+	}
+
+	var strippedTextBuilder strings.Builder
+	var headingsBuilder strings.Builder
+	var preformattedTextBuilder strings.Builder
+	for _, itemref := range pkg.Spine {
+		if strippedTextBuilder.Len() >= maxExtractedTextSize {
+			break
+		}
+		file, ok := files[manifest[itemref.Idref]]
+		if !ok {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			continue
+		}
+		extractEpubDocument(&doc, io.LimitReader(reader, epubMaxDocumentSize), &strippedTextBuilder, &headingsBuilder, &preformattedTextBuilder)
+		reader.Close()
+	}
+
+	doc.StrippedText = cleanExtractedText(strippedTextBuilder.String())
+	doc.Headings = headingsBuilder.String()
+	doc.Preformatted = preformattedTextBuilder.String()
+	doc.Linecount = strings.Count(doc.StrippedText, "\n")
+	addTagsAndMentions(doc.StrippedText, 1, &doc.Tags, &doc.Mentions)
+	return doc
+}
+
+func decodeEpubXML(file *zip.File, v any) error {
+	if file == nil {
+		return zip.ErrFormat
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	decoder := xml.NewDecoder(io.LimitReader(reader, epubMaxDocumentSize))
+	decoder.Strict = false
+	return decoder.Decode(v)
+}
+
+// Elements whose end breaks the text into lines
+var epubBlockElements = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "tr": true, "blockquote": true, "section": true, "article": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "pre": true, "dt": true, "dd": true, "figcaption": true,
+}
+
+// Extracts the text, headings, and links of an XHTML document of the spine. Only links with a scheme are kept, since the other links
+// are to documents within the EPUB.
+func extractEpubDocument(doc *Document, reader io.Reader, strippedTextBuilder *strings.Builder, headingsBuilder *strings.Builder, preformattedTextBuilder *strings.Builder) {
+	tokenizer := html.NewTokenizer(reader)
+	skipDepth := 0 // Inside the head, scripts, and styles
+	preDepth := 0
+	heading := 0
+	var headingText strings.Builder
+	linkUrl := ""
+	var linkText strings.Builder
+	for strippedTextBuilder.Len() < maxExtractedTextSize {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return
+		}
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			switch token.Data {
+			case "head", "script", "style":
+				if tokenType == html.StartTagToken {
+					skipDepth++
+				}
+			case "pre":
+				preDepth++
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				heading = int(token.Data[1] - '0')
+				headingText.Reset()
+			case "a":
+				for _, attr := range token.Attr {
+					if attr.Key == "href" {
+						if u, err := neturl.Parse(attr.Val); err == nil && u.Scheme != "" && u.Scheme != "mailto" {
+							linkUrl, _, _ = strings.Cut(attr.Val, "#")
+							linkText.Reset()
+						}
+					}
+				}
+			case "br":
+				strippedTextBuilder.WriteString("\n")
+			}
+		case html.EndTagToken:
+			switch token.Data {
+			case "head", "script", "style":
+				skipDepth = max(skipDepth-1, 0)
+			case "pre":
+				preDepth = max(preDepth-1, 0)
+			case "h1", "h2", "h3", "h4", "h5", "h6":
+				if text := strings.Join(strings.Fields(headingText.String()), " "); heading != 0 && text != "" {
+					fmt.Fprintf(headingsBuilder, "%s %s\n", strings.Repeat("#", heading), text)
+					addTagsAndMentions(text, 2, &doc.Tags, &doc.Mentions) // The text is ranked once more with the rest of the text
+				}
+				heading = 0
+			case "a":
+				if linkUrl != "" {
+					doc.Links = append(doc.Links, DocumentLink{strings.Join(strings.Fields(linkText.String()), " "), linkUrl, false, false})
+					linkUrl = ""
+				}
+			}
+			if epubBlockElements[token.Data] {
+				strippedTextBuilder.WriteString("\n")
+			}
+		case html.TextToken:
+			if skipDepth > 0 {
+				continue
+			}
+			if preDepth > 0 {
+				preformattedTextBuilder.WriteString(token.Data)
+				continue
+			}
+			strippedTextBuilder.WriteString(token.Data)
+			if heading != 0 {
+				headingText.WriteString(token.Data)
+			}
+			if linkUrl != "" {
+				linkText.WriteString(token.Data)
+			}
+		}
+	}
+}
+
+// Counts the entries of the page-list nav of an EPUB 3 navigation document
+func epubNavPageCount(file *zip.File) int {
+	if file == nil {
+		return 0
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return 0
+	}
+	defer reader.Close()
+
+	count := 0
+	navDepth := 0 // Depth of navs, counted from the page list
+	tokenizer := html.NewTokenizer(io.LimitReader(reader, epubMaxDocumentSize))
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			return count
+		}
+		token := tokenizer.Token()
+		if tokenType == html.StartTagToken && token.Data == "nav" {
+			if navDepth > 0 {
+				navDepth++
+			}
+			for _, attr := range token.Attr {
+				if strings.HasSuffix(attr.Key, "type") && strings.Contains(attr.Val, "page-list") {
+					navDepth = 1
+				}
+			}
+		} else if tokenType == html.EndTagToken && token.Data == "nav" && navDepth > 0 {
+			navDepth--
+		} else if tokenType == html.StartTagToken && token.Data == "a" && navDepth > 0 {
+			count++
+		}
+	}
+}
+
+// Counts the page targets of the page list of an EPUB 2 NCX
+func epubNCXPageCount(file *zip.File) int {
+	if file == nil {
+		return 0
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return 0
+	}
+	defer reader.Close()
+
+	count := 0
+	decoder := xml.NewDecoder(io.LimitReader(reader, epubMaxDocumentSize))
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return count
+		}
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "pageTarget" {
+			count++
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package crawler
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+)
+
+func deflate(t testing.TB, data string) string {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zlib.NewWriter(&buffer)
+	writer.Write([]byte(data))
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.String()
+}
+
+func pdfStreamObject(num int, dict string, data string) string {
+	return fmt.Sprintf("%d 0 obj\n<< %s /Length %d >>\nstream\n%s\nendstream\nendobj\n", num, dict, len(data), data)
+}
+
+// Builds a two page PDF. The information dictionary is in a compressed object stream, the first page shows text with a simple font,
+// and the second page with a two-byte font mapped by a ToUnicode CMap.
+func buildTestPDF(t testing.TB) []byte {
+	var builder strings.Builder
+	builder.WriteString("%PDF-1.5\n")
+	builder.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R /Lang (en-GB) >>\nendobj\n")
+	builder.WriteString("2 0 obj\n<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>\nendobj\n")
+	builder.WriteString("3 0 obj\n<< /Type /Page /Parent 2 0 R /Contents 7 0 R /Annots [10 0 R] >>\nendobj\n")
+	builder.WriteString("4 0 obj\n<< /Type /Page /Parent 2 0 R /Contents [8 0 R] >>\nendobj\n")
+	builder.WriteString("5 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>\nendobj\n")
+	builder.WriteString("6 0 obj\n<< /Type /Font /Subtype /Type0 /BaseFont /Noto /ToUnicode 9 0 R >>\nendobj\n")
+	builder.WriteString(pdfStreamObject(7, "/Filter /FlateDecode", deflate(t, "BT /F1 12 Tf 72 720 Td (Hello \\(PDF\\) #world) Tj 0 -14 Td [(Second) -300 (line)] TJ ET")))
+	builder.WriteString(pdfStreamObject(8, "", "BT /F2 12 Tf 72 720 Td <00010002> Tj ET"))
+	builder.WriteString(pdfStreamObject(9, "", "1 begincodespacerange <0000> <FFFF> endcodespacerange\n1 beginbfchar <0001> <00C9> endbfchar\n1 beginbfrange <0002> <0003> <0074> endbfrange"))
+	builder.WriteString("10 0 obj\n<< /Type /Annot /Subtype /Link /A << /S /URI /URI (gemini://example.org/paper.gmi#section) >> >>\nendobj\n")
+
+	info := "<< /Title <FEFF005000610070006500720020004E0031> /Author (Ada \\(A.\\) Lovelace) /CreationDate (D:20240506101500+02'00') >>"
+	header := "11 0 "
+	objectStream := deflate(t, header+info)
+	builder.WriteString(pdfStreamObject(12, fmt.Sprintf("/Type /ObjStm /N 1 /First %d /Filter /FlateDecode", len(header)), objectStream))
+	builder.WriteString("trailer\n<< /Root 1 0 R /Info 11 0 R /Size 13 >>\n%%EOF\n")
+	return []byte(builder.String())
+}
+
+func TestPDFParser(t *testing.T) {
+	doc := pdfParser{}.ParseDocument(buildTestPDF(t))
+
+	if doc.Title != "Paper N1" || doc.Author != "Ada (A.) Lovelace" {
+		t.Errorf("got title %q and author %q from the information dictionary", doc.Title, doc.Author)
+	}
+	if want := time.Date(2024, 5, 6, 8, 15, 0, 0, time.UTC); !doc.PublishDate.Equal(want) {
+		t.Errorf("got creation date %v, want %v", doc.PublishDate, want)
+	}
+	if doc.Language != "en-GB" || doc.PageCount != 2 {
+		t.Errorf("got language %q and %d pages, want en-GB and 2 pages", doc.Language, doc.PageCount)
+	}
+	if want := "Hello (PDF) #world\nSecond line\n\nÉt\n"; doc.StrippedText != want {
+		t.Errorf("got text %q, want %q", doc.StrippedText, want)
+	}
+	if len(doc.Links) != 1 || doc.Links[0].Url != "gemini://example.org/paper.gmi" {
+		t.Errorf("got links %v, want the URI annotation without its fragment", doc.Links)
+	}
+	if doc.Tags["world"] != 1 {
+		t.Errorf("tags of the text weren't extracted: %v", doc.Tags)
+	}
+}
+
+// Truncated and malformed files are parsed as far as they go
+func TestPDFParserTruncated(t *testing.T) {
+	full := buildTestPDF(t)
+	for _, input := range []string{"%PDF-1.4\n1 0 obj << /A <abc", "%PDF-0 0 obj<<<", "%PDF-1.4\n1 0 obj (unterminated", "%PDF-1.4\n1 0 obj [1 2", string(full[:len(full)/2])} {
+		pdfParser{}.ParseDocument([]byte(input))
+	}
+}
+
+func TestPDFCMapMappingLimit(t *testing.T) {
+	var builder strings.Builder
+	for i := 0; i < 100; i++ {
+		builder.WriteString("1 beginbfrange <0000> <FFFF> <0041> endbfrange\n")
+	}
+	builder.WriteString("1 beginbfchar <0001> <0043> endbfchar\n")
+	cmap := &pdfCMap{2, nil}
+	cmap.parse([]byte(builder.String()))
+	if len(cmap.mapping) != maxCMapMappings {
+		t.Errorf("expected the CMap to have %d mappings, got %d", maxCMapMappings, len(cmap.mapping))
+	}
+	if cmap.mapping[1] != "B" {
+		t.Errorf("expected mappings after the limit to be ignored, got %q for code 1", cmap.mapping[1])
+	}
+}
+
+// Any file is parsed without panicking
+func FuzzPDFParser(f *testing.F) {
+	f.Add(buildTestPDF(f))
+	for _, seed := range []string{"%PDF-1.4\n1 0 obj << /A <abc", "%PDF-0 0 obj<<<", "%PDF-1.4\ntrailer << /Root 1 0 R", "1 0 obj << /Length 5 >> stream\nab"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		pdfParser{}.ParseDocument(data)
+	})
+}
+
+func TestParsePDFDate(t *testing.T) {
+	tests := []struct {
+		date string
+		want time.Time
+	}{
+		{"D:20240506101500Z", time.Date(2024, 5, 6, 10, 15, 0, 0, time.UTC)},
+		{"D:20240506101500-05'30'", time.Date(2024, 5, 6, 15, 45, 0, 0, time.UTC)},
+		{"D:2024", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"D:202405", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{"yesterday", time.Time{}},
+	}
+	for _, test := range tests {
+		if got := parsePDFDate(test.date); !got.Equal(test.want) {
+			t.Errorf("parsePDFDate(%q) = %v, want %v", test.date, got, test.want)
+		}
+	}
+}
+
+func buildTestEPUB(t *testing.T) []byte {
+	files := []struct{ name, content string }{
+		{"mimetype", "application/epub+zip"},
+		{"META-INF/container.xml", `<?xml version="1.0"?><container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container"><rootfiles><rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/></rootfiles></container>`},
+		{"OEBPS/content.opf", `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>A Small Book</dc:title>
+    <dc:creator>First Author</dc:creator>
+    <dc:creator>Second Author</dc:creator>
+    <dc:language>fr</dc:language>
+    <dc:date>2023-09-01</dc:date>
+    <meta property="dcterms:modified">2024-01-02T03:04:05Z</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ch1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch2" href="text/chapter2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine><itemref idref="ch1"/><itemref idref="ch2"/></spine>
+</package>`},
+		{"OEBPS/nav.xhtml", `<html xmlns:epub="http://www.idpf.org/2007/ops"><body><nav epub:type="toc"><ol><li><a href="text/chapter%201.xhtml">One</a></li></ol></nav><nav epub:type="page-list"><ol><li><a href="text/chapter%201.xhtml#p1">1</a></li><li><a href="text/chapter%201.xhtml#p2">2</a></li><li><a href="text/chapter2.xhtml#p3">3</a></li></ol></nav></body></html>`},
+		{"OEBPS/text/chapter 1.xhtml", `<html><head><title>Ignored</title><style>p { color: red; }</style></head><body><h1>Chapter One</h1><p>It begins with #tags and a <a href="gemini://example.org/ref.gmi">reference</a>.</p><p>See <a href="chapter2.xhtml">the next chapter</a>.</p><pre>code block</pre></body></html>`},
+		{"OEBPS/text/chapter2.xhtml", `<html><body><h2>Chapter Two</h2><p>It ends.</p></body></html>`},
+	}
+
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, file := range files {
+		w, err := writer.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(file.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestEPUBParser(t *testing.T) {
+	doc := epubParser{}.ParseDocument(buildTestEPUB(t))
+
+	if doc.Title != "A Small Book" || doc.Author != "First Author, Second Author" || doc.Language != "fr" {
+		t.Errorf("got title %q, author %q, and language %q from the package document", doc.Title, doc.Author, doc.Language)
+	}
+	if want := time.Date(2023, 9, 1, 0, 0, 0, 0, time.UTC); !doc.PublishDate.Equal(want) {
+		t.Errorf("got publication date %v, want %v", doc.PublishDate, want)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !doc.ModificationDate.Equal(want) {
+		t.Errorf("got modification date %v, want %v", doc.ModificationDate, want)
+	}
+	if doc.PageCount != 3 {
+		t.Errorf("got %d pages, want the 3 of the page list", doc.PageCount)
+	}
+	if want := "Chapter One\nIt begins with #tags and a reference.\nSee the next chapter.\n\nChapter Two\nIt ends.\n"; doc.StrippedText != want {
+		t.Errorf("got text %q, want %q", doc.StrippedText, want)
+	}
+	if doc.Headings != "# Chapter One\n## Chapter Two\n" || doc.Preformatted != "code block" {
+		t.Errorf("got headings %q and preformatted text %q", doc.Headings, doc.Preformatted)
+	}
+	if len(doc.Links) != 1 || doc.Links[0] != (DocumentLink{"reference", "gemini://example.org/ref.gmi", false, false}) {
+		t.Errorf("got links %v, want only the link with a scheme", doc.Links)
+	}
+}
+
+func djvuTestChunk(id string, data []byte) []byte {
+	chunk := append([]byte(id), binary.BigEndian.AppendUint32(nil, uint32(len(data)))...)
+	chunk = append(chunk, data...)
+	if len(data)%2 != 0 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func TestDjVuParser(t *testing.T) {
+	text := "Scanned page text"
+	textLayer := append([]byte{0, 0, byte(len(text))}, text...)
+	annotations := []byte(`(metadata (title "A \"Scanned\" Book") (author "Someone") (year "1999"))`)
+	page1 := djvuTestChunk("FORM", append([]byte("DJVU"), append(djvuTestChunk("INFO", make([]byte, 10)), append(djvuTestChunk("ANTa", annotations), djvuTestChunk("TXTa", textLayer)...)...)...))
+	page2 := djvuTestChunk("FORM", append([]byte("DJVU"), djvuTestChunk("INFO", make([]byte, 10))...))
+	directory := djvuTestChunk("DIRM", []byte{0x81, 0, 2})
+	data := append([]byte("AT&T"), djvuTestChunk("FORM", append([]byte("DJVM"), append(directory, append(page1, page2...)...)...))...)
+
+	doc := djvuParser{}.ParseDocument(data)
+	if doc.Title != `A "Scanned" Book` || doc.Author != "Someone" {
+		t.Errorf("got title %q and author %q from the annotations", doc.Title, doc.Author)
+	}
+	if doc.PublishDate.Year() != 1999 || doc.PageCount != 2 {
+		t.Errorf("got year %d and %d pages, want 1999 and 2 pages", doc.PublishDate.Year(), doc.PageCount)
+	}
+	if doc.StrippedText != text+"\n" {
+		t.Errorf("got text %q from the text layer", doc.StrippedText)
+	}
+}
+
+func TestParseXMP(t *testing.T) {
+	packet := `<?xpacket begin=""?><x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:xmp="http://ns.adobe.com/xap/1.0/" xmp:CreateDate="2021-03-04T05:06:07Z">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">XMP Title</rdf:li></rdf:Alt></dc:title>
+<dc:creator><rdf:Seq><rdf:li>One</rdf:li><rdf:li>Two</rdf:li></rdf:Seq></dc:creator>
+<xmp:ModifyDate>2022-01-01</xmp:ModifyDate>
+</rdf:Description></rdf:RDF></x:xmpmeta><?xpacket end="w"?>`
+
+	doc := newDocument(0)
+	doc.addXMPMetadata(parseXMP([]byte("binary data before the packet" + packet)))
+	if doc.Title != "XMP Title" || doc.Author != "One, Two" {
+		t.Errorf("got title %q and author %q", doc.Title, doc.Author)
+	}
+	if doc.PublishDate != time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC) || doc.ModificationDate != time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC) {
+		t.Errorf("got dates %v and %v", doc.PublishDate, doc.ModificationDate)
+	}
+}
+
+type testTIFFEntry struct {
+	tag       uint16
+	valueType uint16
+	value     []byte
+}
+
+// Appends a big-endian image file directory to data, followed by the values that don't fit in its entries
+func appendTestTIFFDirectory(data []byte, entries []testTIFFEntry) []byte {
+	valuesOffset := len(data) + 2 + len(entries)*12 + 4
+	var values []byte
+	data = binary.BigEndian.AppendUint16(data, uint16(len(entries)))
+	for _, entry := range entries {
+		data = binary.BigEndian.AppendUint16(data, entry.tag)
+		data = binary.BigEndian.AppendUint16(data, entry.valueType)
+		data = binary.BigEndian.AppendUint32(data, uint32(len(entry.value)/tiffTypeSizes[entry.valueType]))
+		if len(entry.value) <= 4 {
+			data = append(data, append(entry.value, make([]byte, 4-len(entry.value))...)...)
+		} else {
+			data = binary.BigEndian.AppendUint32(data, uint32(valuesOffset+len(values)))
+			values = append(values, entry.value...)
+		}
+	}
+	data = binary.BigEndian.AppendUint32(data, 0)
+	return append(data, values...)
+}
+
+func jpegTestSegment(marker byte, data []byte) []byte {
+	return append(binary.BigEndian.AppendUint16([]byte{0xFF, marker}, uint16(len(data)+2)), data...)
+}
+
+func iptcTestDataset(dataset byte, value string) []byte {
+	return append(binary.BigEndian.AppendUint16([]byte{0x1C, 2, dataset}, uint16(len(value))), value...)
+}
+
+func pngTestChunk(chunkType string, data []byte) []byte {
+	chunk := append([]byte(chunkType), data...)
+	return binary.BigEndian.AppendUint32(append(binary.BigEndian.AppendUint32(nil, uint32(len(data))), chunk...), crc32.ChecksumIEEE(chunk))
+}
+
+func TestJPEGMetadata(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 3, 2)), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The EXIF directory comes after the first directory and its values
+	ifd0 := []testTIFFEntry{
+		{0x010E, 2, []byte("OLYMPUS DIGITAL CAMERA\x00")},
+		{0x010F, 2, []byte("Canon\x00")},
+		{0x0110, 2, []byte("Canon EOS R5\x00")},
+		{0x8769, 4, nil},
+	}
+	exifOffset := len(appendTestTIFFDirectory([]byte("MM\x00\x2a\x00\x00\x00\x08"), ifd0))
+	ifd0[3].value = binary.BigEndian.AppendUint32(nil, uint32(exifOffset))
+	tiff := appendTestTIFFDirectory([]byte("MM\x00\x2a\x00\x00\x00\x08"), ifd0)
+	tiff = appendTestTIFFDirectory(tiff, []testTIFFEntry{
+		{0x9003, 2, []byte("2024:05:06 10:15:00\x00")},
+		{0x9011, 2, []byte("+02:00\x00")},
+	})
+	if len(tiff) != exifOffset+2+2*12+4+20+7 {
+		t.Fatalf("the EXIF directory isn't at its offset")
+	}
+
+	iptc := append(iptcTestDataset(5, "Harbour"), append(iptcTestDataset(120, "A harbour at dusk"), iptcTestDataset(80, "Photographer")...)...)
+	resource := append([]byte("8BIM\x04\x04\x00\x00"), binary.BigEndian.AppendUint32(nil, uint32(len(iptc)))...)
+	resource = append(resource, iptc...)
+
+	data := append([]byte{0xFF, 0xD8}, jpegTestSegment(0xE1, append([]byte("Exif\x00\x00"), tiff...))...)
+	data = append(data, jpegTestSegment(0xED, append([]byte("Photoshop 3.0\x00"), resource...))...)
+	data = append(data, encoded.Bytes()[2:]...)
+
+	metadata := parseImageMetadata("image/jpeg", data)
+	want := ImageMetadata{3, 2, "Canon", "Canon EOS R5", time.Date(2024, 5, 6, 8, 15, 0, 0, time.UTC), "Harbour", "A harbour at dusk", "", "Photographer", ""}
+	if metadata != want {
+		t.Errorf("got %+v, want %+v", metadata, want)
+	}
+}
+
+func TestPNGMetadata(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewGray(image.Rect(0, 0, 4, 5))); err != nil {
+		t.Fatal(err)
+	}
+	xmp := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><rdf:Description xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:Iptc4xmpCore="http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/">
+<dc:title><rdf:Alt><rdf:li xml:lang="x-default">Not the title</rdf:li></rdf:Alt></dc:title>
+<dc:description><rdf:Alt><rdf:li xml:lang="x-default">A cat asleep on a keyboard</rdf:li></rdf:Alt></dc:description>
+<Iptc4xmpCore:AltTextAccessibility><rdf:Alt><rdf:li xml:lang="x-default">Grey cat</rdf:li></rdf:Alt></Iptc4xmpCore:AltTextAccessibility>
+</rdf:Description></rdf:RDF></x:xmpmeta>`
+
+	// Text chunks go after the header chunk, which is 33 bytes into the file
+	data := append([]byte{}, encoded.Bytes()[:33]...)
+	data = append(data, pngTestChunk("tEXt", []byte("Title\x00Keyboard Cat"))...)
+	data = append(data, pngTestChunk("zTXt", append([]byte("Author\x00\x00"), deflate(t, "Someone")...))...)
+	data = append(data, pngTestChunk("iTXt", []byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"+xmp))...)
+	data = append(data, encoded.Bytes()[33:]...)
+
+	metadata := parseImageMetadata("image/png", data)
+	want := ImageMetadata{Width: 4, Height: 5, Title: "Keyboard Cat", Description: "A cat asleep on a keyboard", AltText: "Grey cat", Creator: "Someone"}
+	if metadata != want {
+		t.Errorf("got %+v, want %+v", metadata, want)
+	}
+}
+
+func TestSVGMetadata(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg" width="100%" viewBox="0 0 120 80"><title>Logo</title><g><title>Not the title</title></g><desc>
+  The logo of the capsule
+</desc></svg>`)
+	metadata := parseImageMetadata("image/svg+xml", data)
+	want := ImageMetadata{Width: 120, Height: 80, Title: "Logo", Description: "The logo of the capsule"}
+	if metadata != want {
+		t.Errorf("got %+v, want %+v", metadata, want)
+	}
+}
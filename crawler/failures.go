@@ -0,0 +1,127 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"time"
+	"unicode/utf8"
+)
+
+// FailurePolicy configures how the crawler treats pages that fail to fetch
+type FailurePolicy struct {
+	TemporaryRetries int // Times a url is retried within one crawl after a temporary failure (40-43) before giving up until the next crawl
+	HideAfter        int // Consecutive crawls a page must fail permanently (50, 51, 52, 59) in before it gets hidden from search results. A temporary failure in between starts the count over.
+}
+
+var DefaultFailurePolicy = FailurePolicy{2, 3}
+
+func (gd *GlobalData) SetFailurePolicy(policy FailurePolicy) {
+	gd.failurePolicy = policy
+}
+
+func (gd *GlobalData) FailurePolicy() FailurePolicy {
+	return gd.failurePolicy
+}
+
+// Increments the number of times the url has been retried in this crawl and returns the new count
+func (gd *GlobalData) incrementRetries(url string) int {
+	var retries int
+	gd.retries.Upsert(url, nil, func(exists bool, valueInMap any, newValue any) any {
+		retries = 1
+		if exists {
+			retries = valueInMap.(int) + 1
+		}
+		return retries
+	})
+	return retries
+}
+
+// Records a failed fetch of the url in the page_failures table and returns the number of consecutive crawls the url has failed
+// permanently in. Failures within the same crawl only count once, and a temporary failure resets the permanent failures, so that
+// a page is only hidden when it keeps failing permanently.
+func recordPageFailure(ctx CrawlContext, URL string, status int, meta string, permanent bool) int {
+	if !utf8.ValidString(URL) || !utf8.ValidString(meta) {
+		logger.Error().Str("url", URL).Msg("Page failure url or meta not valid utf8")
+		return 0
+	}
+	if ctx.globalData.dbConn == nil {
+		return 0
+	}
+	meta = truncateRunes(meta, 1024)
+	hostname, _ := GetHostname(URL)
+
+	var consecutiveFailures, permanentFailures int
+	var lastFailure time.Time
+	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT consecutive_failures, permanent_failures, last_failure FROM page_failures WHERE url=?", URL)
+	err := row.Scan(&consecutiveFailures, &permanentFailures, &lastFailure)
+	if err == sql.ErrNoRows {
+		if permanent {
+			permanentFailures = 1
+		}
+		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO page_failures (url, domain, status, meta, permanent, consecutive_failures, permanent_failures, total_failures, first_failure, last_failure) VALUES (?, ?, ?, ?, ?, 1, ?, 1, ?, ?)", URL, hostname, status, meta, permanent, permanentFailures, time.Now().UTC(), time.Now().UTC())
+		if err != nil {
+			logger.Error().Str("url", URL).Err(err).Msg("Couldn't add page failure")
+			return 0
+		}
+		return permanentFailures
+	} else if err != nil {
+		logger.Error().Str("url", URL).Err(err).Msg("Couldn't get page failure")
+		return 0
+	}
+
+	// Only count one failure per crawl, so that a page isn't hidden from a single bad crawl
+	newCrawl := lastFailure.Before(ctx.globalData.crawlStartTime)
+	if newCrawl {
+		consecutiveFailures++
+	}
+	if !permanent {
+		permanentFailures = 0
+	} else if newCrawl || permanentFailures == 0 {
+		permanentFailures++
+	}
+	_, err = ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE page_failures SET status=?, meta=?, permanent=?, consecutive_failures=?, permanent_failures=?, total_failures=total_failures+1, last_failure=? WHERE url=?", status, meta, permanent, consecutiveFailures, permanentFailures, time.Now().UTC(), URL)
+	if err != nil {
+		logger.Error().Str("url", URL).Err(err).Msg("Couldn't update page failure")
+	}
+	return permanentFailures
+}
+
+// Resets the consecutive failures of a url after it has been fetched successfully. The total failures are kept to show flaky pages.
+func clearPageFailures(ctx CrawlContext, URL string) {
+	if ctx.globalData.dbConn == nil {
+		return
+	}
+	_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE page_failures SET consecutive_failures=0, permanent_failures=0, last_success=? WHERE url=? AND consecutive_failures > 0", time.Now().UTC(), URL)
+	if err != nil {
+		logger.Error().Str("url", URL).Err(err).Msg("Couldn't clear page failures")
+	}
+}
+
+// Retries the current url after a temporary failure (40-43), up to the failure policy's TemporaryRetries. After that, the failure is recorded and the url is left until the next crawl.
+func handleTemporaryFailure(ctx CrawlContext, crawlThread int, url string, crawlData UrlToCrawlData) {
+	status := ctx.resp.Status
+	retries := ctx.globalData.incrementRetries(url)
+	if retries <= ctx.globalData.failurePolicy.TemporaryRetries {
+		// Server Unavailable is about the whole server, so give it some time before hitting it again. Other urls of the host also wait.
+		if status == 41 {
+			ctx.globalData.urlsToCrawl.Backoff(ctx.GetCurrentHostname())
+		}
+		logger.Info().Int("thread", crawlThread).Int("status", status).Str("url", url).Int("retry", retries).Int("retries", ctx.globalData.failurePolicy.TemporaryRetries).Msg("Temporary failure")
+
+		// Add url back to crawl list and remove from urlsCrawled. It goes to the back of its host's queue.
+		ctx.globalData.urlsCrawled.Remove(url)
+		ctx.addUrl(url, crawlData)
+		return
+	}
+
+	recordPageFailure(ctx, url, status, ctx.resp.Description, false)
+}
+
+// Records a permanent failure (Permanent Failure, Not Found, Gone, and Bad Request statuses). The page is hidden once it has
+// failed in the failure policy's HideAfter consecutive crawls.
+func handleFailure(ctx CrawlContext) {
+	permanentFailures := recordPageFailure(ctx, ctx.GetCurrentURL(), ctx.resp.Status, ctx.resp.Description, true)
+	if permanentFailures >= ctx.globalData.failurePolicy.HideAfter {
+		setPageToHidden(ctx, ctx.GetCurrentURL())
+	}
+}
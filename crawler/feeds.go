@@ -0,0 +1,285 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"mime"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// FeedEntry is an entry of an Atom, RSS, gemsub, or twtxt feed
+type FeedEntry struct {
+	Title     string
+	Url       string
+	Author    string
+	Published time.Time
+	Updated   time.Time
+}
+
+// Layouts of the dates in RSS feeds. RFC 822 is the standard, but feeds often use RFC 3339 or drop the day of the week.
+var rssDateLayouts = []string{time.RFC1123Z, time.RFC1123, "Mon, 2 Jan 2006 15:04:05 -0700", "Mon, 2 Jan 2006 15:04:05 MST", "2 Jan 2006 15:04:05 -0700", "2 Jan 2006 15:04:05 MST", time.RFC822Z, time.RFC822, time.RFC3339}
+
+// Layouts of the dates that start the link titles of gemsub entries
+var gemsubDateLayouts = []string{"2006-01-02", time.RFC3339, ISO8601Layout}
+
+// Layouts of the timestamps of twtxt entries. The spec requires RFC 3339, but some clients leave out the seconds.
+var twtxtDateLayouts = []string{time.RFC3339, "2006-01-02T15:04Z07:00"}
+
+func parseFeedDate(s string, layouts []string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+type atomFeed struct {
+	Title   string       `xml:"title"`
+	Authors []atomPerson `xml:"author"`
+	Entries []atomEntry  `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title     string       `xml:"title"`
+	Id        string       `xml:"id"`
+	Links     []atomLink   `xml:"link"`
+	Authors   []atomPerson `xml:"author"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type rssFeed struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	Guid    string `xml:"guid"`
+	Author  string `xml:"author"`
+	Creator string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+// RSS 1.0 feeds are RDF documents, where the items are next to the channel instead of in it
+type rdfFeed struct {
+	Title string    `xml:"channel>title"`
+	Items []rssItem `xml:"item"`
+}
+
+// Parses an Atom, RSS 2.0, or RSS 1.0 feed. Returns false if the mediatype isn't xml or the document isn't a feed.
+func parseXMLFeed(mediatype string, data []byte) (string, []FeedEntry, bool) {
+	mediatype, _, _ = mime.ParseMediaType(mediatype)
+	if mediatype != "application/atom+xml" && mediatype != "application/rss+xml" && mediatype != "application/xml" && mediatype != "text/xml" {
+		return "", nil, false
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return "", nil, false
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "feed":
+			var feed atomFeed
+			if err := decoder.DecodeElement(&feed, &start); err != nil {
+				return "", nil, false
+			}
+			return strings.TrimSpace(feed.Title), feed.feedEntries(), true
+		case "rss":
+			var feed rssFeed
+			if err := decoder.DecodeElement(&feed, &start); err != nil {
+				return "", nil, false
+			}
+			return strings.TrimSpace(feed.Channel.Title), feed.feedEntries(), true
+		case "RDF":
+			var feed rdfFeed
+			if err := decoder.DecodeElement(&feed, &start); err != nil {
+				return "", nil, false
+			}
+			return strings.TrimSpace(feed.Title), rssFeedEntries(feed.Items), true
+		default:
+			// The first element isn't the root of a feed
+			return "", nil, false
+		}
+	}
+}
+
+func (feed atomFeed) feedEntries() []FeedEntry {
+	feedAuthor := ""
+	if len(feed.Authors) > 0 {
+		feedAuthor = strings.TrimSpace(feed.Authors[0].Name)
+	}
+
+	entries := make([]FeedEntry, 0, len(feed.Entries))
+	for _, entry := range feed.Entries {
+		// The alternate link is the entry itself. Fall back to the id, which is often the url.
+		url := ""
+		for _, link := range entry.Links {
+			if link.Rel == "" || link.Rel == "alternate" {
+				url = strings.TrimSpace(link.Href)
+				break
+			}
+		}
+		if url == "" && strings.Contains(entry.Id, "://") {
+			url = strings.TrimSpace(entry.Id)
+		}
+		if url == "" {
+			continue
+		}
+
+		author := feedAuthor
+		if len(entry.Authors) > 0 {
+			author = strings.TrimSpace(entry.Authors[0].Name)
+		}
+		updated := parseFeedDate(entry.Updated, []string{time.RFC3339})
+		published := parseFeedDate(entry.Published, []string{time.RFC3339})
+		if published.IsZero() {
+			published = updated
+		} else if updated.IsZero() {
+			updated = published
+		}
+		entries = append(entries, FeedEntry{strings.TrimSpace(entry.Title), url, author, published, updated})
+	}
+	return entries
+}
+
+func (feed rssFeed) feedEntries() []FeedEntry {
+	return rssFeedEntries(feed.Channel.Items)
+}
+
+func rssFeedEntries(items []rssItem) []FeedEntry {
+	entries := make([]FeedEntry, 0, len(items))
+	for _, item := range items {
+		url := strings.TrimSpace(item.Link)
+		if url == "" && strings.Contains(item.Guid, "://") {
+			url = strings.TrimSpace(item.Guid)
+		}
+		if url == "" {
+			continue
+		}
+
+		author := strings.TrimSpace(item.Author)
+		if author == "" {
+			author = strings.TrimSpace(item.Creator)
+		}
+		// RSS 1.0 items only have the Dublin Core date, which is RFC 3339
+		published := parseFeedDate(item.PubDate, rssDateLayouts)
+		if published.IsZero() {
+			published = parseFeedDate(item.Date, []string{time.RFC3339})
+		}
+		entries = append(entries, FeedEntry{strings.TrimSpace(item.Title), url, author, published, published})
+	}
+	return entries
+}
+
+// Gets the entries of a gemsub feed, which are the links of a document whose titles start with a date (YYYY-MM-DD). The rest of the link title,
+// without separators like " - ", is the title of the entry.
+func gemsubEntries(links []DocumentLink) []FeedEntry {
+	entries := make([]FeedEntry, 0)
+	for _, link := range links {
+		if link.Input || link.Image {
+			continue
+		}
+		dateStr, title, _ := CutAny(strings.TrimSpace(link.Name), " \t")
+		published := parseFeedDate(dateStr, gemsubDateLayouts)
+		if published.IsZero() {
+			continue
+		}
+		title = strings.TrimLeft(title, " \t-–—:|")
+		entries = append(entries, FeedEntry{strings.TrimSpace(title), link.Url, "", published, published})
+	}
+	return entries
+}
+
+// Whether the url is a twtxt file, going by the filenames twtxt clients use
+func isTwtxtUrl(url string) bool {
+	beforeQuery, _, _ := strings.Cut(url, "?")
+	return strings.HasSuffix(beforeQuery, "/twtxt.txt") || strings.HasSuffix(beforeQuery, "/tw.txt")
+}
+
+// Parses a twtxt file, where every line is an RFC 3339 timestamp and the text of the entry, separated by a tab. The nick from the
+// metadata comments ("# nick = name") is the author. Entries have no url of their own, so the timestamp is used as the fragment of the file's url.
+// Returns an error instead of a partial feed if a line is too long to read.
+func parseTwtxtFeed(data []byte, feedUrl string) (string, []FeedEntry, error) {
+	nick := ""
+	entries := make([]FeedEntry, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		if strings.HasPrefix(line, "#") {
+			key, value, found := strings.Cut(strings.TrimPrefix(line, "#"), "=")
+			if found && strings.TrimSpace(key) == "nick" && nick == "" {
+				nick = strings.TrimSpace(value)
+			}
+			continue
+		}
+
+		timestamp, text, found := strings.Cut(line, "\t")
+		if !found {
+			continue
+		}
+		published := parseFeedDate(timestamp, twtxtDateLayouts)
+		if published.IsZero() {
+			continue
+		}
+		url := feedUrl + "#" + strings.TrimSpace(timestamp)
+		entries = append(entries, FeedEntry{strings.TrimSpace(text), url, "", published, published})
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+
+	for i := range entries {
+		entries[i].Author = nick
+	}
+	return nick, entries, nil
+}
+
+// Truncates a string to at most the given number of runes, to fit varchar columns
+func truncateRunes(s string, maxRunes int) string {
+	if utf8.RuneCountInString(s) <= maxRunes {
+		return s
+	}
+	return string([]rune(s)[:maxRunes])
+}
+
+// Resolves the urls of feed entries against the url of the feed, the same way its links are. Drops entries with invalid urls.
+func (ctx *CrawlContext) resolveFeedEntries(entries []FeedEntry) []FeedEntry {
+	resolved := make([]FeedEntry, 0, len(entries))
+	for _, entry := range entries {
+		if url := ctx.resolveLink(entry.Url); url != nil {
+			entry.Url = url.String()
+			resolved = append(resolved, entry)
+		}
+	}
+	return resolved
+}
@@ -0,0 +1,253 @@
+package crawler
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFeedDate(t *testing.T) {
+	want := time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		input   string
+		layouts []string
+		want    time.Time
+	}{
+		{"Tue, 05 Mar 2024 14:30:00 +0000", rssDateLayouts, want},
+		{"Tue, 05 Mar 2024 14:30:00 GMT", rssDateLayouts, want},
+		{"Tue, 5 Mar 2024 14:30:00 +0000", rssDateLayouts, want},
+		{"5 Mar 2024 14:30:00 +0000", rssDateLayouts, want},
+		{"05 Mar 24 14:30 +0000", rssDateLayouts, want},
+		{"2024-03-05T14:30:00Z", rssDateLayouts, want},
+		{"  Tue, 05 Mar 2024 14:30:00 +0000\n", rssDateLayouts, want},
+		{"March 5th, 2024", rssDateLayouts, time.Time{}},
+		{"2024-03-05", gemsubDateLayouts, time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{"2024-03-05T14:30:00Z", twtxtDateLayouts, want},
+		{"2024-03-05T14:30Z", twtxtDateLayouts, want},
+		{"", twtxtDateLayouts, time.Time{}},
+	}
+	for _, test := range tests {
+		if got := parseFeedDate(test.input, test.layouts); !got.Equal(test.want) {
+			t.Errorf("parseFeedDate(%q): expected %v, got %v", test.input, test.want, got)
+		}
+	}
+}
+
+func TestParseXMLFeed(t *testing.T) {
+	published := time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC)
+	updated := time.Date(2024, 3, 6, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		mediatype string
+		feed      string
+		isFeed    bool
+		title     string
+		entries   []FeedEntry
+	}{
+		{
+			name:      "atom published and updated",
+			mediatype: "application/atom+xml; charset=utf-8",
+			feed: `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title> Example Capsule </title>
+	<author><name>Alice</name></author>
+	<entry>
+		<title>Both dates</title>
+		<link rel="alternate" href="gemini://example.com/both.gmi"/>
+		<published>2024-03-05T14:30:00Z</published>
+		<updated>2024-03-06T09:00:00Z</updated>
+	</entry>
+	<entry>
+		<title>Only updated</title>
+		<id>gemini://example.com/updated.gmi</id>
+		<author><name>Bob</name></author>
+		<updated>2024-03-06T09:00:00Z</updated>
+	</entry>
+	<entry>
+		<title>Only published</title>
+		<link rel="enclosure" href="gemini://example.com/audio.mp3"/>
+		<link href="gemini://example.com/published.gmi"/>
+		<published>2024-03-05T14:30:00Z</published>
+	</entry>
+	<entry>
+		<title>No url</title>
+		<id>urn:uuid:1234</id>
+	</entry>
+</feed>`,
+			isFeed: true,
+			title:  "Example Capsule",
+			entries: []FeedEntry{
+				{"Both dates", "gemini://example.com/both.gmi", "Alice", published, updated},
+				{"Only updated", "gemini://example.com/updated.gmi", "Bob", updated, updated},
+				{"Only published", "gemini://example.com/published.gmi", "Alice", published, published},
+			},
+		},
+		{
+			name:      "rss 2.0",
+			mediatype: "application/rss+xml",
+			feed: `<?xml version="1.0"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+	<channel>
+		<title>Example Blog</title>
+		<item>
+			<title>RFC 822</title>
+			<link>gemini://example.com/1.gmi</link>
+			<author>alice@example.com</author>
+			<pubDate>Tue, 05 Mar 2024 14:30:00 +0000</pubDate>
+		</item>
+		<item>
+			<title>No day of the week</title>
+			<guid>gemini://example.com/2.gmi</guid>
+			<dc:creator>Bob</dc:creator>
+			<pubDate>5 Mar 2024 14:30:00 GMT</pubDate>
+		</item>
+		<item>
+			<title>RFC 3339</title>
+			<link>gemini://example.com/3.gmi</link>
+			<pubDate>2024-03-05T14:30:00Z</pubDate>
+		</item>
+		<item>
+			<title>No url</title>
+			<guid isPermaLink="false">1234</guid>
+		</item>
+	</channel>
+</rss>`,
+			isFeed: true,
+			title:  "Example Blog",
+			entries: []FeedEntry{
+				{"RFC 822", "gemini://example.com/1.gmi", "alice@example.com", published, published},
+				{"No day of the week", "gemini://example.com/2.gmi", "Bob", published, published},
+				{"RFC 3339", "gemini://example.com/3.gmi", "", published, published},
+			},
+		},
+		{
+			name:      "rss 1.0",
+			mediatype: "application/xml",
+			feed: `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+	<channel rdf:about="gemini://example.com/">
+		<title>Example RDF</title>
+	</channel>
+	<item rdf:about="gemini://example.com/1.gmi">
+		<title>First</title>
+		<link>gemini://example.com/1.gmi</link>
+		<dc:creator>Alice</dc:creator>
+		<dc:date>2024-03-05T14:30:00Z</dc:date>
+	</item>
+</rdf:RDF>`,
+			isFeed:  true,
+			title:   "Example RDF",
+			entries: []FeedEntry{{"First", "gemini://example.com/1.gmi", "Alice", published, published}},
+		},
+		{
+			name:      "not a feed",
+			mediatype: "text/xml",
+			feed:      `<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><title>Not a feed</title></svg>`,
+		},
+		{
+			name:      "not xml",
+			mediatype: "application/xml",
+			feed:      "# Gemtext\n",
+		},
+		{
+			name:      "not an xml mediatype",
+			mediatype: "text/gemini",
+			feed:      `<rss><channel><title>Ignored</title></channel></rss>`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			title, entries, isFeed := parseXMLFeed(test.mediatype, []byte(test.feed))
+			if isFeed != test.isFeed || title != test.title {
+				t.Fatalf("expected feed %v '%s', got %v '%s'", test.isFeed, test.title, isFeed, title)
+			}
+			checkFeedEntries(t, entries, test.entries)
+		})
+	}
+}
+
+func TestParseTwtxtFeed(t *testing.T) {
+	feedUrl := "gemini://example.com/twtxt.txt"
+	tests := []struct {
+		name    string
+		twtxt   string
+		nick    string
+		entries []FeedEntry
+	}{
+		{
+			name:  "entries and metadata",
+			twtxt: "# nick = alice\r\n# url = gemini://example.com/twtxt.txt\r\n2024-03-05T14:30:00Z\tHello world\r\n2024-03-05T16:30:00+02:00\t Same time \r\n",
+			nick:  "alice",
+			entries: []FeedEntry{
+				{"Hello world", feedUrl + "#2024-03-05T14:30:00Z", "alice", time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC), time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC)},
+				{"Same time", feedUrl + "#2024-03-05T16:30:00+02:00", "alice", time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC), time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:  "timestamps without seconds",
+			twtxt: "2024-03-05T14:30Z\tNo seconds\n",
+			entries: []FeedEntry{
+				{"No seconds", feedUrl + "#2024-03-05T14:30Z", "", time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC), time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC)},
+			},
+		},
+		{
+			name:  "lines that aren't entries",
+			twtxt: "Just some text\nyesterday\tNot a timestamp\n# nick = first\n# nick = second\n",
+			nick:  "first",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			nick, entries, err := parseTwtxtFeed([]byte(test.twtxt), feedUrl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nick != test.nick {
+				t.Errorf("expected nick %q, got %q", test.nick, nick)
+			}
+			checkFeedEntries(t, entries, test.entries)
+		})
+	}
+
+	// A line too long to scan is an error rather than a feed that silently stops there
+	long := "2024-03-05T14:30:00Z\tFirst\n2024-03-05T14:31:00Z\t" + strings.Repeat("a", bufio.MaxScanTokenSize) + "\n2024-03-05T14:32:00Z\tLast\n"
+	if _, entries, err := parseTwtxtFeed([]byte(long), feedUrl); err == nil {
+		t.Errorf("expected an error for a line over %d bytes, got %d entries", bufio.MaxScanTokenSize, len(entries))
+	}
+}
+
+func TestGemsubEntries(t *testing.T) {
+	day := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	links := []DocumentLink{
+		{"2024-03-05 - Dash separator", "gemini://example.com/1.gmi", false, false},
+		{"2024-03-05 — Em dash separator", "gemini://example.com/2.gmi", false, false},
+		{"  2024-03-05\tTab separator", "gemini://example.com/3.gmi", false, false},
+		{"2024-03-05T14:30:00Z Full timestamp", "gemini://example.com/4.gmi", false, false},
+		{"2024-03-05", "gemini://example.com/5.gmi", false, false},
+		{"2024-03-05 Search", "gemini://example.com/search", true, false},
+		{"2024-03-05 Picture", "gemini://example.com/pic.png", false, true},
+		{"2024-03-05: Date not followed by a space", "gemini://example.com/colon.gmi", false, false},
+		{"About 2024-03-05", "gemini://example.com/about.gmi", false, false},
+		{"March 5, 2024 Not a gemsub date", "gemini://example.com/6.gmi", false, false},
+	}
+	checkFeedEntries(t, gemsubEntries(links), []FeedEntry{
+		{"Dash separator", "gemini://example.com/1.gmi", "", day, day},
+		{"Em dash separator", "gemini://example.com/2.gmi", "", day, day},
+		{"Tab separator", "gemini://example.com/3.gmi", "", day, day},
+		{"Full timestamp", "gemini://example.com/4.gmi", "", time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC), time.Date(2024, 3, 5, 14, 30, 0, 0, time.UTC)},
+		{"", "gemini://example.com/5.gmi", "", day, day},
+	})
+}
+
+func checkFeedEntries(t *testing.T, entries []FeedEntry, want []FeedEntry) {
+	t.Helper()
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d entries, got %d: %+v", len(want), len(entries), entries)
+	}
+	for i, entry := range entries {
+		if entry.Title != want[i].Title || entry.Url != want[i].Url || entry.Author != want[i].Author || !entry.Published.Equal(want[i].Published) || !entry.Updated.Equal(want[i].Updated) {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], entry)
+		}
+	}
+}
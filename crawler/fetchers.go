@@ -0,0 +1,266 @@
+package crawler
+
+import (
+	"io"
+	"net"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/clseibold/go-gemini"
+	"gitlab.com/clseibold/gonex/nex_client"
+	spartan_client "gitlab.com/clseibold/profectus/spartan"
+	scroll "gitlab.com/clseibold/scroll-term/scroll_client"
+)
+
+// ProtocolFetcher fetches the urls of a scheme for the crawler, mapping the protocol's responses onto a Response with gemini status codes
+type ProtocolFetcher interface {
+	// Fetch requests the url. The caller must close the Body of the response.
+	Fetch(url string) (Response, error)
+
+	// FetchRobotsTxt gets the robots.txt of a host (with the scheme and a trailing slash). Returns an empty string if the host
+	// doesn't have one, and ErrSlowDown if the server asks to slow down.
+	FetchRobotsTxt(host string) (string, error)
+}
+
+var protocolFetchers = struct {
+	sync.RWMutex
+	fetchers map[string]ProtocolFetcher
+}{fetchers: make(map[string]ProtocolFetcher)}
+
+// RegisterProtocolFetcher makes the crawler fetch urls of the scheme with the fetcher, replacing the fetcher already registered for it
+func RegisterProtocolFetcher(scheme string, fetcher ProtocolFetcher) {
+	protocolFetchers.Lock()
+	defer protocolFetchers.Unlock()
+	protocolFetchers.fetchers[strings.ToLower(scheme)] = fetcher
+}
+
+func GetProtocolFetcher(scheme string) (ProtocolFetcher, bool) {
+	protocolFetchers.RLock()
+	defer protocolFetchers.RUnlock()
+	fetcher, ok := protocolFetchers.fetchers[strings.ToLower(scheme)]
+	return fetcher, ok
+}
+
+func init() {
+	RegisterProtocolFetcher("gemini", geminiFetcher{gemini.Client{NoTimeCheck: true, ReadTimeout: timeout, ConnectTimeout: 15 * time.Second}})
+	RegisterProtocolFetcher("nex", nexFetcher{nex_client.Client{ReadTimeout: timeout, ConnectTimeout: 15 * time.Second}})
+	RegisterProtocolFetcher("scroll", scrollFetcher{scroll.Client{ReadTimeout: timeout, ConnectTimeout: 15 * time.Second, NoTimeCheck: true}})
+	RegisterProtocolFetcher("spartan", spartanFetcher{spartan_client.Client{ConnectTimeout: 15 * time.Second, ReadTimeout: timeout}})
+	RegisterProtocolFetcher("gopher", gopherFetcher{gopherClient{ConnectTimeout: 15 * time.Second, ReadTimeout: timeout}})
+	RegisterProtocolFetcher("finger", fingerFetcher{fingerClient{ConnectTimeout: 15 * time.Second, ReadTimeout: timeout}})
+	RegisterProtocolFetcher("guppy", guppyFetcher{guppyClient{ConnectTimeout: 15 * time.Second, ReadTimeout: timeout}})
+}
+
+// Gemtext-based protocols don't always send a mediatype. Guesses it from the extension of the url, with "/" paths being the given index type.
+func guessGemtextMediatype(url string, indexMediatype string) string {
+	if beforeQuery, _, _ := strings.Cut(url, "?"); strings.HasSuffix(beforeQuery, ".scroll") {
+		return "text/scroll"
+	} else if strings.HasSuffix(beforeQuery, ".gmi") || strings.HasSuffix(beforeQuery, ".gemini") {
+		return "text/gemini"
+	} else if strings.HasSuffix(beforeQuery, "/") {
+		return indexMediatype
+	}
+	return ""
+}
+
+// Reads a robots.txt body, or returns an empty string if it couldn't be read
+func readRobotsTxt(body io.ReadCloser) string {
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+type geminiFetcher struct {
+	client gemini.Client
+}
+
+func (f geminiFetcher) Fetch(url string) (Response, error) {
+	var resp Response
+	g_resp, err := f.client.Fetch(url)
+	if err != nil {
+		return resp, err
+	}
+	resp.Status = g_resp.Status
+	resp.Description = g_resp.Meta
+	if resp.Description == "" && (resp.Status >= 20 && resp.Status <= 29) {
+		resp.Description = guessGemtextMediatype(url, "text/gemini")
+	}
+	resp.Body = g_resp.Body
+	resp.Cert = g_resp.Cert
+	return resp, nil
+}
+
+func (f geminiFetcher) FetchRobotsTxt(host string) (string, error) {
+	resp, err := f.client.Fetch(host + "robots.txt")
+	if err != nil || resp == nil {
+		return "", err
+	} else if resp.Status == 44 {
+		resp.Body.Close()
+		return "", ErrSlowDown
+	} else if resp.Status != gemini.StatusSuccess {
+		resp.Body.Close()
+		return "", nil
+	}
+	return readRobotsTxt(resp.Body), nil
+}
+
+type nexFetcher struct {
+	client nex_client.Client
+}
+
+func (f nexFetcher) Fetch(url string) (Response, error) {
+	var resp Response
+	conn, err := f.client.Request(url)
+	if err != nil {
+		return resp, err
+	}
+	resp.Status = 20
+	resp.Description = ""
+	if beforeQuery, _, _ := strings.Cut(url, "?"); strings.HasSuffix(beforeQuery, "/") {
+		// Nex Listings use a "/" at the end of the path.
+		resp.Description = "text/nex"
+	}
+	resp.Body = conn
+	resp.Cert = nil
+	return resp, nil
+}
+
+func (f nexFetcher) FetchRobotsTxt(host string) (string, error) {
+	conn, err := f.client.Request(host + "robots.txt")
+	if err != nil {
+		return "", err
+	}
+	return readRobotsTxt(conn), nil
+}
+
+type scrollFetcher struct {
+	client scroll.Client
+}
+
+func (f scrollFetcher) Fetch(url string) (Response, error) {
+	var resp Response
+	s_resp, err := f.client.Fetch(url, []string{}, false)
+	if err != nil {
+		return resp, err
+	}
+	resp.Status = s_resp.Status
+	resp.Description = s_resp.Description
+	if resp.Description == "" && (resp.Status >= 20 && resp.Status <= 29) {
+		resp.Description = guessGemtextMediatype(url, "text/scroll")
+	}
+	resp.Body = s_resp.Body
+	resp.Author = s_resp.Author
+	resp.PublishDate = s_resp.PublishDate
+	resp.ModificationDate = s_resp.ModificationDate
+	resp.Cert = s_resp.Cert
+	return resp, nil
+}
+
+func (f scrollFetcher) FetchRobotsTxt(host string) (string, error) {
+	resp, err := f.client.Fetch(host+"robots.txt", []string{"en"}, false)
+	if err != nil || resp == nil {
+		return "", err
+	} else if resp.Status == 44 {
+		resp.Body.Close()
+		return "", ErrSlowDown
+	} else if scroll.CleanStatus(resp.Status) != 20 {
+		resp.Body.Close()
+		return "", nil
+	}
+	return readRobotsTxt(resp.Body), nil
+}
+
+type spartanFetcher struct {
+	client spartan_client.Client
+}
+
+func (f spartanFetcher) Fetch(url string) (Response, error) {
+	var resp Response
+	s_resp, err := f.client.Request(url, []byte{})
+	if err != nil {
+		return resp, err
+	}
+	if s_resp.Status == spartan_client.StatusSuccess {
+		resp.Status = 20
+	} else if s_resp.Status == spartan_client.StatusRedirect {
+		resp.Status = gemini.StatusRedirect
+	} else if s_resp.Status == 4 { // Client Error
+		resp.Status = gemini.StatusBadRequest
+	} else if s_resp.Status == 5 { // Server Error
+		resp.Status = gemini.StatusTemporaryFailure
+	}
+	resp.Description = s_resp.Meta
+	if resp.Description == "" && (resp.Status >= 20 && resp.Status <= 29) {
+		resp.Description = guessGemtextMediatype(url, "text/gemini")
+	}
+	resp.Body = s_resp.Body
+	return resp, nil
+}
+
+func (f spartanFetcher) FetchRobotsTxt(host string) (string, error) {
+	resp, err := f.client.Request(host+"robots.txt", []byte{})
+	if err != nil || resp == nil {
+		return "", err
+	} else if resp.Status == 44 {
+		resp.Body.Close()
+		return "", ErrSlowDown
+	} else if resp.Status != spartan_client.StatusSuccess {
+		resp.Body.Close()
+		return "", nil
+	}
+	return readRobotsTxt(resp.Body), nil
+}
+
+type gopherFetcher struct {
+	client gopherClient
+}
+
+func (f gopherFetcher) Fetch(url string) (Response, error) {
+	var resp Response
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return resp, err
+	}
+	itemType, selector := gopherItemTypeAndSelector(u)
+	if itemType == '7' && !strings.Contains(selector, "\t") {
+		// Search server without a query, handled like an input prompt
+		resp.Status = gemini.StatusInput
+		resp.Description = "Search"
+		resp.Body = io.NopCloser(strings.NewReader(""))
+		return resp, nil
+	} else if itemType == '8' || itemType == 'T' || itemType == '2' || itemType == '+' {
+		return resp, ErrGopherItemNotSupported
+	}
+
+	var conn net.Conn
+	conn, _, err = f.client.Request(url)
+	if err != nil {
+		return resp, err
+	}
+	resp.Status = 20
+	resp.Body, resp.Description, err = readGopherItem(conn, itemType)
+	if err != nil {
+		return Response{}, err
+	}
+	resp.Cert = nil
+	return resp, nil
+}
+
+// Gopher servers serve robots.txt with the "robots.txt" selector
+func (f gopherFetcher) FetchRobotsTxt(host string) (string, error) {
+	conn, _, err := f.client.Request(host + "0robots.txt")
+	if err != nil {
+		return "", err
+	}
+	data := readRobotsTxt(conn)
+	if strings.HasPrefix(data, "3") {
+		// Servers without a robots.txt reply with an error gophermap
+		return "", nil
+	}
+	return data, nil
+}
@@ -0,0 +1,341 @@
+package crawler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fingerStandIn is a minimal local Finger server. The empty query lists the users.
+type fingerStandIn struct {
+	listener net.Listener
+	users    map[string]string // user -> plan
+}
+
+func newFingerStandIn(t *testing.T, users map[string]string) *fingerStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fingerStandIn{listener: listener, users: users}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *fingerStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	query := strings.TrimRight(line, "\r\n")
+	if query == "" {
+		for user := range server.users {
+			fmt.Fprintf(conn, "%s\r\n", user)
+		}
+	} else if plan, ok := server.users[query]; ok {
+		fmt.Fprintf(conn, "Login: %s\r\nPlan:\r\n%s", query, plan)
+	} else {
+		fmt.Fprintf(conn, "finger: %s: no such user\r\n", query)
+	}
+}
+
+func (server *fingerStandIn) url(path string) string {
+	return "finger://" + server.listener.Addr().String() + path
+}
+
+// guppyStandIn is a minimal local Guppy server. Successful responses are split into small packets that are sent in reverse order,
+// so the client has to reassemble them.
+type guppyStandIn struct {
+	conn      net.PacketConn
+	pages     map[string]string // path -> gemtext
+	redirects map[string]string // path -> redirect url
+	prompts   map[string]string // path -> input prompt. Any other path returns an error.
+	dropFirst bool              // Ignore the first request, as if it was lost
+
+	mutex    sync.Mutex
+	requests int
+	acks     map[int]bool
+}
+
+const guppyStandInChunkSize = 8
+const guppyStandInFirstSeq = 1000
+
+// newGuppyStandIn starts the server after setup has filled in its pages, so they're only read once it's serving
+func newGuppyStandIn(t *testing.T, setup func(server *guppyStandIn)) *guppyStandIn {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &guppyStandIn{conn: conn, pages: make(map[string]string), redirects: make(map[string]string), prompts: make(map[string]string), acks: make(map[int]bool)}
+	t.Cleanup(func() { conn.Close() })
+	setup(server)
+
+	go func() {
+		buffer := make([]byte, 4096)
+		for {
+			n, addr, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return
+			}
+			server.serve(strings.TrimRight(string(buffer[:n]), "\r\n"), addr)
+		}
+	}()
+	return server
+}
+
+func (server *guppyStandIn) serve(packet string, addr net.Addr) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	if seq, err := strconv.Atoi(packet); err == nil {
+		server.acks[seq] = true
+		return
+	}
+
+	server.requests++
+	if server.dropFirst && server.requests == 1 {
+		return
+	}
+	url, err := neturl.Parse(packet)
+	if err != nil {
+		server.conn.WriteTo([]byte("4 Bad request\r\n"), addr)
+		return
+	}
+
+	if body, ok := server.pages[url.Path]; ok {
+		var packets []string
+		seq := guppyStandInFirstSeq
+		packets = append(packets, fmt.Sprintf("%d text/gemini\r\n", seq))
+		for i := 0; i < len(body); i += guppyStandInChunkSize {
+			chunk := body[i:min(i+guppyStandInChunkSize, len(body))]
+			if i == 0 {
+				packets[0] += chunk
+				continue
+			}
+			seq++
+			packets = append(packets, fmt.Sprintf("%d\r\n%s", seq, chunk))
+		}
+		packets = append(packets, fmt.Sprintf("%d\r\n", seq+1))
+		for i := len(packets) - 1; i >= 0; i-- {
+			server.conn.WriteTo([]byte(packets[i]), addr)
+		}
+	} else if target, ok := server.redirects[url.Path]; ok {
+		server.conn.WriteTo([]byte("3 "+target+"\r\n"), addr)
+	} else if prompt, ok := server.prompts[url.Path]; ok {
+		server.conn.WriteTo([]byte("1 "+prompt+"\r\n"), addr)
+	} else {
+		server.conn.WriteTo([]byte("4 Not found\r\n"), addr)
+	}
+}
+
+func (server *guppyStandIn) url(path string) string {
+	return "guppy://" + server.conn.LocalAddr().String() + path
+}
+
+// Acknowledgements arrive after the client has its response, so waits a little for them
+func (server *guppyStandIn) acked(seq int) bool {
+	for range 100 {
+		server.mutex.Lock()
+		acked := server.acks[seq]
+		server.mutex.Unlock()
+		if acked {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func readBody(t *testing.T, resp Response) string {
+	t.Helper()
+
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// Gets the url, fetching again after the host's robots.txt, the way the url would be requeued during a crawl
+func getAfterRobotsTxt(ctx *CrawlContext, url string) (Response, error) {
+	resp, err := ctx.Get(url, 0, UrlToCrawlData{})
+	if errors.Is(err, ErrRobotsTxtFetched) {
+		return ctx.Get(url, 0, UrlToCrawlData{})
+	}
+	return resp, err
+}
+
+func TestFingerFetcher(t *testing.T) {
+	server := newFingerStandIn(t, map[string]string{"alice": "Writing a crawler.\r\n"})
+	fetcher, ok := GetProtocolFetcher("finger")
+	if !ok {
+		t.Fatal("no fetcher registered for finger")
+	}
+
+	resp, err := fetcher.Fetch(server.url("/alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != 20 || resp.Description != "text/plain" {
+		t.Fatalf("got status %d '%s', want 20 'text/plain'", resp.Status, resp.Description)
+	}
+	if body := readBody(t, resp); body != "Login: alice\r\nPlan:\r\nWriting a crawler.\r\n" {
+		t.Fatalf("unexpected body %q", body)
+	}
+
+	resp, err = fetcher.Fetch(server.url("/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, resp); body != "alice\r\n" {
+		t.Fatalf("root should list the users, got %q", body)
+	}
+}
+
+func TestGuppyFetcher(t *testing.T) {
+	page := "# Guppy capsule\n=> /about.gmi About\n"
+	server := newGuppyStandIn(t, func(server *guppyStandIn) {
+		server.pages["/"] = page
+		server.redirects["/old.gmi"] = "/"
+		server.prompts["/search"] = "Search query"
+	})
+	fetcher, ok := GetProtocolFetcher("guppy")
+	if !ok {
+		t.Fatal("no fetcher registered for guppy")
+	}
+
+	resp, err := fetcher.Fetch(server.url("/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != 20 || resp.Description != "text/gemini" {
+		t.Fatalf("got status %d '%s', want 20 'text/gemini'", resp.Status, resp.Description)
+	}
+	if body := readBody(t, resp); body != page {
+		t.Fatalf("packets reassembled out of order: %q", body)
+	}
+	lastSeq := guppyStandInFirstSeq + (len(page)+guppyStandInChunkSize-1)/guppyStandInChunkSize
+	for seq := guppyStandInFirstSeq; seq <= lastSeq; seq++ {
+		if !server.acked(seq) {
+			t.Errorf("packet %d was not acknowledged", seq)
+		}
+	}
+
+	tests := []struct {
+		path        string
+		status      int
+		description string
+	}{
+		{"/old.gmi", 30, "/"},
+		{"/search", 10, "Search query"},
+		{"/missing.gmi", 50, "Not found"},
+	}
+	for _, test := range tests {
+		resp, err := fetcher.Fetch(server.url(test.path))
+		if err != nil {
+			t.Fatalf("%s: %v", test.path, err)
+		}
+		if resp.Status != test.status || resp.Description != test.description {
+			t.Errorf("%s: got status %d '%s', want %d '%s'", test.path, resp.Status, resp.Description, test.status, test.description)
+		}
+		readBody(t, resp)
+	}
+}
+
+func TestGuppyFetcherResendsLostRequest(t *testing.T) {
+	previousInterval := guppyRetransmitInterval
+	guppyRetransmitInterval = 50 * time.Millisecond
+	t.Cleanup(func() { guppyRetransmitInterval = previousInterval })
+
+	server := newGuppyStandIn(t, func(server *guppyStandIn) {
+		server.pages["/"] = "# Lossy\n"
+		server.dropFirst = true
+	})
+	fetcher, _ := GetProtocolFetcher("guppy")
+
+	resp, err := fetcher.Fetch(server.url("/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, resp); body != "# Lossy\n" {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
+
+// stubFetcher serves one robots.txt and one page for any host
+type stubFetcher struct {
+	robots string
+}
+
+func (f stubFetcher) Fetch(url string) (Response, error) {
+	return Response{Status: 20, Description: "text/gemini", Body: io.NopCloser(strings.NewReader("# Stub\n"))}, nil
+}
+
+func (f stubFetcher) FetchRobotsTxt(host string) (string, error) {
+	return f.robots, nil
+}
+
+func TestGetDispatchesToRegisteredFetcher(t *testing.T) {
+	previousSlowDown := defaultSlowDown
+	defaultSlowDown = 0
+	t.Cleanup(func() { defaultSlowDown = previousSlowDown })
+
+	ctx := newCrawlContext(NewGlobalData(nil, false, true, 0))
+	if _, err := ctx.Get("stub://example.org/", 0, UrlToCrawlData{}); !errors.Is(err, ErrNotSupportedScheme) {
+		t.Fatalf("unregistered scheme should not be supported, got %v", err)
+	}
+
+	RegisterProtocolFetcher("stub", stubFetcher{"User-agent: *\nDisallow: /private/\n"})
+	t.Cleanup(func() {
+		protocolFetchers.Lock()
+		delete(protocolFetchers.fetchers, "stub")
+		protocolFetchers.Unlock()
+	})
+
+	resp, err := getAfterRobotsTxt(&ctx, "stub://example.org/page.gmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, resp); resp.Status != 20 || body != "# Stub\n" {
+		t.Fatalf("got status %d %q from the stub fetcher", resp.Status, body)
+	}
+	if _, err := ctx.Get("stub://example.org/private/page.gmi", 0, UrlToCrawlData{}); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("the fetcher's robots.txt should disallow the page, got %v", err)
+	}
+
+	// Finger goes through the same dispatch
+	server := newFingerStandIn(t, map[string]string{"bob": "Nothing planned.\r\n"})
+	resp, err = getAfterRobotsTxt(&ctx, server.url("/bob"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body := readBody(t, resp); !strings.Contains(body, "Nothing planned.") {
+		t.Fatalf("unexpected finger body %q", body)
+	}
+	if ctx.GetCurrentHostname() != server.url("/") {
+		t.Fatalf("current hostname %s, want %s", ctx.GetCurrentHostname(), server.url("/"))
+	}
+}
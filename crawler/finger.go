@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"net"
+	neturl "net/url"
+	"strings"
+	"time"
+)
+
+type fingerClient struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+}
+
+// The query of a finger url (RFC 1288, with the url form of RFC 742's user@host). The path without its leading slash is the user,
+// and the root of a server is the empty query, which lists the users that are logged in.
+func fingerQuery(u *neturl.URL) string {
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+// Request sends the finger query of the url to the server and returns the connection to read the response from
+func (c fingerClient) Request(url string) (net.Conn, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "79"
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), c.ConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(c.ReadTimeout))
+
+	if _, err := conn.Write([]byte(fingerQuery(u) + "\r\n")); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+type fingerFetcher struct {
+	client fingerClient
+}
+
+// Finger replies are always plain text, and the server closes the connection once it's sent
+func (f fingerFetcher) Fetch(url string) (Response, error) {
+	var resp Response
+	conn, err := f.client.Request(url)
+	if err != nil {
+		return resp, err
+	}
+	resp.Status = 20
+	resp.Description = "text/plain"
+	resp.Body = conn
+	resp.Cert = nil
+	return resp, nil
+}
+
+// Finger has no robots.txt, since every query is a user
+func (f fingerFetcher) FetchRobotsTxt(host string) (string, error) {
+	return "", nil
+}
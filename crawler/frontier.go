@@ -0,0 +1,187 @@
+package crawler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// How often a running crawl writes its frontier to the checkpoint file
+var checkpointInterval = time.Minute * 5
+
+// frontierCheckpoint is the on-disk form of a crawl's frontier. URLs that were in-flight when the checkpoint was taken are stored in ToCrawl so that they get fetched again on resume.
+type frontierCheckpoint struct {
+	CrawlStartTime time.Time
+	SavedAt        time.Time
+	ToCrawl        []frontierUrl
+	Crawled        []crawledUrl
+	Domains        []frontierDomain
+}
+
+type frontierUrl struct {
+	Url                   string
+	PageFromId            int
+	PageFrom_InternalLink bool
+	PageFrom_LinkText     string
+	Depth                 int
+}
+
+type crawledUrl struct {
+	Url    string
+	PageId int
+}
+
+type frontierDomain struct {
+	Host          string
+	SlowDown      float64
+	LastCrawlTime time.Time
+}
+
+// List of GlobalData that have a checkpoint file set, used to save every frontier on shutdown.
+var checkpointed = struct {
+	sync.Mutex
+	list []*GlobalData
+}{}
+
+// SetCheckpointFile sets the file the frontier gets checkpointed to. An empty path disables checkpointing.
+func (gd *GlobalData) SetCheckpointFile(path string) {
+	gd.checkpointPath = path
+
+	checkpointed.Lock()
+	defer checkpointed.Unlock()
+	for _, other := range checkpointed.list {
+		if other == gd {
+			return
+		}
+	}
+	checkpointed.list = append(checkpointed.list, gd)
+}
+
+// SaveCheckpoints saves the frontier of every crawl that is currently running. Should be called on shutdown.
+func SaveCheckpoints() {
+	checkpointed.Lock()
+	defer checkpointed.Unlock()
+	for _, gd := range checkpointed.list {
+		if !gd.IsCrawling() {
+			continue
+		}
+		if err := gd.SaveCheckpoint(); err != nil {
+			logger.Error().Str("path", gd.checkpointPath).Err(err).Msg("Couldn't save crawl checkpoint")
+		}
+	}
+}
+
+// SaveCheckpoint writes the frontier, the crawled urls, and the domain info to the checkpoint file.
+func (gd *GlobalData) SaveCheckpoint() error {
+	if gd.checkpointPath == "" {
+		return nil
+	}
+
+	gd.checkpointMutex.Lock()
+	defer gd.checkpointMutex.Unlock()
+
+	checkpoint := frontierCheckpoint{CrawlStartTime: gd.crawlStartTime, SavedAt: time.Now().UTC()}
+	checkpoint.ToCrawl = gd.urlsToCrawl.snapshot()
+	requeued := make(map[string]bool, len(checkpoint.ToCrawl))
+	for _, toCrawl := range checkpoint.ToCrawl {
+		requeued[toCrawl.Url] = true
+	}
+	for item := range gd.urlsCrawled.IterBuffered() {
+		if requeued[item.Key] {
+			continue
+		}
+		checkpoint.Crawled = append(checkpoint.Crawled, crawledUrl{item.Key, item.Val.(Page).Id})
+	}
+	for item := range gd.domainsCrawled.IterBuffered() {
+		domainInfo := item.Val.(DomainInfo)
+		checkpoint.Domains = append(checkpoint.Domains, frontierDomain{item.Key, domainInfo.slowDown, domainInfo.lastCrawlTime})
+	}
+
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so that a crash while writing doesn't destroy the previous checkpoint
+	tmpPath := gd.checkpointPath + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(gd.checkpointPath), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, gd.checkpointPath)
+}
+
+// LoadCheckpoint replaces the frontier with the one in the checkpoint file. Returns false if there is no checkpoint to resume from.
+func (gd *GlobalData) LoadCheckpoint() (bool, error) {
+	if gd.checkpointPath == "" {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(gd.checkpointPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	var checkpoint frontierCheckpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return false, fmt.Errorf("corrupt crawl checkpoint '%s': %w", gd.checkpointPath, err)
+	}
+	if len(checkpoint.ToCrawl) == 0 {
+		return false, nil
+	}
+
+	gd.Reset()
+	gd.crawlStartTime = checkpoint.CrawlStartTime
+	for _, domain := range checkpoint.Domains {
+		gd.domainsCrawled.Set(domain.Host, DomainInfo{domain.SlowDown, domain.LastCrawlTime})
+	}
+	for _, crawled := range checkpoint.Crawled {
+		gd.urlsCrawled.Set(crawled.Url, Page{Id: crawled.PageId})
+	}
+	for _, toCrawl := range checkpoint.ToCrawl {
+		gd.urlsToCrawl.Add(toCrawl.Url, UrlToCrawlData{toCrawl.PageFromId, toCrawl.PageFrom_InternalLink, toCrawl.PageFrom_LinkText, toCrawl.Depth})
+	}
+
+	return true, nil
+}
+
+// RemoveCheckpoint deletes the checkpoint file. Called once a crawl has finished, so the next start doesn't resume it.
+func (gd *GlobalData) RemoveCheckpoint() {
+	if gd.checkpointPath == "" {
+		return
+	}
+
+	gd.checkpointMutex.Lock()
+	defer gd.checkpointMutex.Unlock()
+	if err := os.Remove(gd.checkpointPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		logger.Error().Str("path", gd.checkpointPath).Err(err).Msg("Couldn't remove crawl checkpoint")
+	}
+}
+
+// Periodically saves the checkpoint until stop is closed.
+func (gd *GlobalData) checkpointLoop(interval time.Duration, stop chan struct{}) {
+	if gd.checkpointPath == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := gd.SaveCheckpoint(); err != nil {
+				logger.Error().Str("path", gd.checkpointPath).Err(err).Msg("Couldn't save crawl checkpoint")
+			}
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package crawler
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// geminiStandIn is a minimal local Gemini server used to test the crawler without touching the network.
+type geminiStandIn struct {
+	listener net.Listener
+	pages    map[string]string // path -> gemtext. Any other path returns 51.
+
+	mutex    sync.Mutex
+	requests map[string]int // path -> number of times requested
+}
+
+func newGeminiStandIn(t *testing.T, pages map[string]string) *geminiStandIn {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := tls.Certificate{Certificate: [][]byte{certDER}, PrivateKey: key}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &geminiStandIn{listener: listener, pages: pages, requests: make(map[string]int)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *geminiStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	url, err := neturl.Parse(strings.TrimSpace(line))
+	if err != nil {
+		fmt.Fprintf(conn, "59 Bad request\r\n")
+		return
+	}
+
+	server.mutex.Lock()
+	server.requests[url.Path]++
+	server.mutex.Unlock()
+
+	if body, ok := server.pages[url.Path]; ok {
+		fmt.Fprintf(conn, "20 text/gemini\r\n%s", body)
+	} else {
+		fmt.Fprintf(conn, "51 Not found\r\n")
+	}
+}
+
+func (server *geminiStandIn) url(path string) string {
+	return "gemini://" + server.listener.Addr().String() + path
+}
+
+func (server *geminiStandIn) requestCount(path string) int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.requests[path]
+}
+
+// Takes the next url off the frontier and fetches it, the way Crawl does, without writing to the DB. Returns "" when the frontier is empty.
+func fetchNext(t *testing.T, ctx *CrawlContext, pageId int, finish bool) string {
+	t.Helper()
+
+	url, crawlData, ok := ctx.globalData.urlsToCrawl.Next(time.Millisecond * 100)
+	if !ok {
+		return ""
+	}
+	ctx.globalData.urlsCrawled.Set(url, Page{})
+	resp, err := ctx.Get(url, 0, crawlData)
+	if errors.Is(err, ErrRobotsTxtFetched) {
+		// Requeued until the host's crawl delay has passed, like crawlUrl does
+		ctx.globalData.urlsCrawled.Remove(url)
+		ctx.addUrl(url, crawlData)
+		ctx.globalData.urlsToCrawl.Done(url)
+		return fetchNext(t, ctx, pageId, finish)
+	} else if err != nil {
+		t.Fatalf("Get '%s' failed: %v", url, err)
+	}
+	if resp.Status != 20 {
+		t.Fatalf("Get '%s' returned status %d", url, resp.Status)
+	}
+	io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if finish {
+		ctx.setUrlCrawledPageData(url, Page{Id: pageId})
+		ctx.globalData.urlsToCrawl.Done(url)
+	}
+	return url
+}
+
+func TestFrontierResume(t *testing.T) {
+	// No politeness delays against the local server
+	previousSlowDown := defaultSlowDown
+	defaultSlowDown = 0
+	t.Cleanup(func() { defaultSlowDown = previousSlowDown })
+
+	server := newGeminiStandIn(t, map[string]string{
+		"/":      "# Root\n=> /a.gmi A\n=> /b.gmi B\n=> /c.gmi C\n",
+		"/a.gmi": "# A\n",
+		"/b.gmi": "# B\n",
+		"/c.gmi": "# C\n",
+	})
+	checkpointFile := filepath.Join(t.TempDir(), "frontier.json")
+
+	// First run: crawl one page, get killed while fetching a second
+	gd := NewGlobalData(nil, false, true, 0)
+	gd.SetCheckpointFile(checkpointFile)
+	gd.AddUrl(server.url("/"), UrlToCrawlData{})
+	gd.AddUrl(server.url("/a.gmi"), UrlToCrawlData{1, true, "A", 1})
+	gd.AddUrl(server.url("/b.gmi"), UrlToCrawlData{1, true, "B", 1})
+	gd.AddUrl(server.url("/c.gmi"), UrlToCrawlData{1, true, "C", 1})
+
+	ctx := newCrawlContext(gd)
+	crawled := fetchNext(t, &ctx, 100, true)
+	inFlight := fetchNext(t, &ctx, 0, false)
+	inFlightData := gd.urlsToCrawl.inFlight[inFlight].crawlData
+
+	// Killed mid-crawl: the shutdown handler saves the checkpoints of every running crawl
+	SaveCheckpoints()
+	if _, err := os.Stat(checkpointFile); err != nil {
+		t.Fatalf("SaveCheckpoints didn't save the running crawl: %v", err)
+	}
+
+	// Second run: resume from the checkpoint
+	resumed := NewGlobalData(nil, false, true, 0)
+	resumed.SetCheckpointFile(checkpointFile)
+	ok, err := resumed.LoadCheckpoint()
+	if err != nil {
+		t.Fatalf("LoadCheckpoint failed: %v", err)
+	} else if !ok {
+		t.Fatal("LoadCheckpoint found nothing to resume")
+	}
+
+	t.Run("crawled urls are kept", func(t *testing.T) {
+		page, exists := resumed.urlsCrawled.Get(crawled)
+		if !exists {
+			t.Fatalf("'%s' should still be marked as crawled", crawled)
+		}
+		if page.(Page).Id != 100 {
+			t.Fatalf("expected page id 100 for '%s', got %d", crawled, page.(Page).Id)
+		}
+		if _, queued := resumed.urlsToCrawl.Get(crawled); queued {
+			t.Fatalf("'%s' should not be crawled again", crawled)
+		}
+	})
+	t.Run("in-flight urls are requeued", func(t *testing.T) {
+		crawlData, exists := resumed.urlsToCrawl.Get(inFlight)
+		if !exists {
+			t.Fatalf("in-flight url '%s' was lost", inFlight)
+		}
+		if crawlData != inFlightData {
+			t.Fatalf("crawl data for '%s' not preserved: expected %v, got %v", inFlight, inFlightData, crawlData)
+		}
+		if resumed.urlsCrawled.Has(inFlight) {
+			t.Fatalf("in-flight url '%s' should not be marked as crawled", inFlight)
+		}
+	})
+	t.Run("domains are kept", func(t *testing.T) {
+		host, _ := GetHostname(server.url("/"))
+		if !resumed.domainsCrawled.Has(host) {
+			t.Fatalf("domain info for '%s' was lost", host)
+		}
+	})
+
+	// Finish the crawl and check that every page was fetched to completion exactly once across both runs
+	resumedCtx := newCrawlContext(resumed)
+	for i := 0; i < 10; i++ {
+		if fetchNext(t, &resumedCtx, 200+i, true) == "" {
+			break
+		}
+	}
+	if resumed.IsCrawling() {
+		t.Fatalf("frontier not empty after resuming: %d left", resumed.ToCrawlCount())
+	}
+	for _, path := range []string{"/", "/a.gmi", "/b.gmi", "/c.gmi"} {
+		expected := 1
+		if server.url(path) == inFlight {
+			expected = 2 // Fetched once before the kill and once after resuming
+		}
+		if count := server.requestCount(path); count != expected {
+			t.Errorf("'%s' requested %d times, expected %d", path, count, expected)
+		}
+	}
+
+	t.Run("finished crawl removes checkpoint", func(t *testing.T) {
+		resumed.RemoveCheckpoint()
+		if ok, _ := resumed.LoadCheckpoint(); ok {
+			t.Fatal("checkpoint should be gone after the crawl finished")
+		}
+	})
+}
@@ -7,107 +7,85 @@ import (
 	"strings"
 )
 
-type GeminiLink struct {
-	name         string
-	url          string
-	spartanInput bool
-}
+// Parses gemtext, along with its spartan (=: input links) and scroll (level 4 headings and nested lists) extensions
+type gemtextParser struct{}
 
-func (ctx *CrawlContext) GetGeminiPageInfo2(dataReader *bytes.Reader, tagsMap *map[string]float64, mentionsMap *map[string]bool, links *[]GeminiLink, strippedTextBuilder *strings.Builder, update bool) (string, int, string, string, int, bool) {
-	var isFeed = 0
-	var spartanTitle = ""
-	var lastTitleLevel = 5
-	var linecount = 0
-	size := dataReader.Len()
+func (p gemtextParser) ParseDocument(data []byte) Document {
+	doc := newDocument(len(data))
+	title := newTitleTracker()
+	var strippedTextBuilder strings.Builder
 	var headingsBuilder strings.Builder
 	var preformattedTextBuilder strings.Builder
 
-	scanner := bufio.NewScanner(dataReader)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	inPreformat := false
 	for scanner.Scan() {
-		linecount += 1
+		doc.Linecount += 1
 		line := strings.TrimRight(scanner.Text(), "\r\n")
-		if spartanTitle == "" && strings.TrimSpace(line) != "" {
-			if ContainsLetterRunes(line) && len(line) < 250 {
-				// Assume for nex documents that the first non-blank line (that is under 250 bytes) is the title
-				spartanTitle = strings.TrimSpace(line)
-			}
-		}
+		title.line(line, 250)
 		if inPreformat {
 			if strings.HasPrefix(line, "```") {
 				inPreformat = false
 			}
-			fmt.Fprintf(strippedTextBuilder, "%s\n", line)
 			fmt.Fprintf(&preformattedTextBuilder, "%s\n", line)
 			continue
 		}
 
 		if strings.HasPrefix(line, "```") {
 			inPreformat = !inPreformat
-		} else if strings.HasPrefix(line, "####") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "####")))
-			if spartanTitle == "" || lastTitleLevel > 4 {
-				spartanTitle = strings.TrimSpace(strings.TrimPrefix(line, "####"))
-				lastTitleLevel = 4
-			}
-			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
-		} else if strings.HasPrefix(line, "###") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "###")))
-			if spartanTitle == "" || lastTitleLevel > 3 {
-				spartanTitle = strings.TrimSpace(strings.TrimPrefix(line, "###"))
-				lastTitleLevel = 3
-			}
-			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
-		} else if strings.HasPrefix(line, "##") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "##")))
-			if spartanTitle == "" || lastTitleLevel > 2 {
-				spartanTitle = strings.TrimSpace(strings.TrimPrefix(line, "##"))
-				lastTitleLevel = 2
-			}
-			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
-		} else if strings.HasPrefix(line, "#") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "#")))
-			if spartanTitle == "" || lastTitleLevel > 1 {
-				spartanTitle = strings.TrimSpace(strings.TrimPrefix(line, "#"))
-				lastTitleLevel = 1
-			}
+		} else if level := gemtextHeadingLevel(line); level != 0 {
+			text := strings.TrimSpace(line[level:])
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", text)
+			addTagsAndMentions(line[level:], 3, &doc.Tags, &doc.Mentions)
+			title.heading(text, level)
 			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
-		} else if strings.HasPrefix(line, "=:") {
-			// Input Link: Don't put in urls to crawl
-			line = strings.TrimSpace(strings.TrimPrefix(line, "=:"))
-			fmt.Fprintf(strippedTextBuilder, "%s\n", line)
-			link, title, _ := CutAny(line, " \t")
+		} else if strings.HasPrefix(line, "=:") || strings.HasPrefix(line, "=>") {
+			// Input links (=:) aren't crawled
+			input := strings.HasPrefix(line, "=:")
+			line = strings.TrimSpace(line[2:])
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", line)
+			link, linkTitle, _ := CutAny(line, " \t")
 
 			link_without_fragment, _, _ := strings.Cut(link, "#")
 			//link_without_query_and_fragment, _, _ = strings.Cut(link_without_query_and_fragment, "?")
-			*links = append(*links, GeminiLink{title, link_without_fragment, true})
-		} else if strings.HasPrefix(line, "=>") {
-			line = strings.TrimSpace(strings.TrimPrefix(line, "=>"))
-			fmt.Fprintf(strippedTextBuilder, "%s\n", line)
-			link, title, _ := CutAny(line, " \t")
-
-			link_without_fragment, _, _ := strings.Cut(link, "#")
-			//link_without_query_and_fragment, _, _ = strings.Cut(link_without_query_and_fragment, "?")
-			*links = append(*links, GeminiLink{title, link_without_fragment, false})
-
-			if isTimeDate(title) {
-				isFeed++
+			doc.Links = append(doc.Links, DocumentLink{linkTitle, link_without_fragment, input, false})
+			if !input {
+				addTagsAndMentions(linkTitle, 2, &doc.Tags, &doc.Mentions)
 			}
 		} else if strings.HasPrefix(line, ">") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimPrefix(line, ">"))
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", strings.TrimPrefix(line, ">"))
+			addTagsAndMentions(line, 1, &doc.Tags, &doc.Mentions)
 		} else if strings.HasPrefix(line, "**** ") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimPrefix(line, "**** "))
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", strings.TrimPrefix(line, "**** "))
+			addTagsAndMentions(line, 1, &doc.Tags, &doc.Mentions)
 		} else if strings.HasPrefix(line, "*** ") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimPrefix(line, "*** "))
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", strings.TrimPrefix(line, "*** "))
+			addTagsAndMentions(line, 1, &doc.Tags, &doc.Mentions)
 		} else if strings.HasPrefix(line, "** ") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimPrefix(line, "** "))
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", strings.TrimPrefix(line, "** "))
+			addTagsAndMentions(line, 1, &doc.Tags, &doc.Mentions)
 		} else if strings.HasPrefix(line, "* ") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimPrefix(line, "* "))
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", strings.TrimPrefix(line, "* "))
+			addTagsAndMentions(line, 1, &doc.Tags, &doc.Mentions)
 		} else {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", line)
-			continue
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", line)
+			addTagsAndMentions(line, 1, &doc.Tags, &doc.Mentions)
 		}
 	}
 
-	return spartanTitle, linecount, headingsBuilder.String(), preformattedTextBuilder.String(), size, isFeed > 1
+	doc.Title = title.title
+	doc.Headings = headingsBuilder.String()
+	doc.Preformatted = preformattedTextBuilder.String()
+	doc.StrippedText = strippedTextBuilder.String()
+	doc.IsFeed = documentIsFeed(doc.Links)
+	return doc
+}
+
+// The level of a gemtext heading line (up to the 4 levels of scroll), or 0 if the line isn't a heading
+func gemtextHeadingLevel(line string) int {
+	level := 0
+	for level < len(line) && line[level] == '#' && level < 4 {
+		level++
+	}
+	return level
 }
@@ -0,0 +1,244 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// Mediatype given to gophermaps (item type 1), since they have no registered one
+const GophermapMediatype = "text/gophermap"
+
+var ErrGopherItemNotSupported = errors.New("gopher item type not supported")
+
+type gopherClient struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+}
+
+// Splits a gopher url into its item type and selector (RFC 4266). The root of a server is a gophermap with an empty selector.
+// Search queries are appended to the selector after a tab.
+func gopherItemTypeAndSelector(u *neturl.URL) (byte, string) {
+	path := u.Path
+	if len(path) <= 1 {
+		return '1', ""
+	}
+	itemType := path[1]
+	selector := path[2:]
+	if u.RawQuery != "" {
+		query, err := neturl.QueryUnescape(u.RawQuery)
+		if err != nil {
+			query = u.RawQuery
+		}
+		selector += "\t" + query
+	}
+	return itemType, selector
+}
+
+// The path robots.txt rules are tested against. For gopher, this is the selector without the item type.
+func robotsPath(u *neturl.URL) string {
+	if u.Scheme == "gopher" {
+		_, selector := gopherItemTypeAndSelector(u)
+		selector, _, _ = strings.Cut(selector, "\t")
+		if !strings.HasPrefix(selector, "/") {
+			selector = "/" + selector
+		}
+		return selector
+	}
+	return u.Path
+}
+
+// Request sends the selector of the url to the gopher server and returns the connection to read the response from, along with the url's item type
+func (c gopherClient) Request(url string) (net.Conn, byte, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	itemType, selector := gopherItemTypeAndSelector(u)
+
+	port := u.Port()
+	if port == "" {
+		port = "70"
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(u.Hostname(), port), c.ConnectTimeout)
+	if err != nil {
+		return nil, 0, err
+	}
+	conn.SetDeadline(time.Now().Add(c.ReadTimeout))
+
+	if _, err := conn.Write([]byte(selector + "\r\n")); err != nil {
+		conn.Close()
+		return nil, 0, err
+	}
+	return conn, itemType, nil
+}
+
+// Mediatype of a gopher item type. Returns an empty string for types where the mediatype should be detected from the content.
+func gopherItemMediatype(itemType byte) string {
+	switch itemType {
+	case '0':
+		return "text/plain"
+	case '1', '7':
+		return GophermapMediatype
+	case '4':
+		return "application/mac-binhex40"
+	case '5', '9':
+		return "application/octet-stream" // Detected from the content by the crawler
+	case '6':
+		return "text/x-uuencode"
+	case 'c':
+		return "text/calendar"
+	case 'h':
+		return "text/html"
+	case 'g':
+		return "image/gif"
+	case 'p':
+		return "image/png"
+	case 'd':
+		return "application/pdf"
+	case 'M':
+		return "message/rfc822"
+	}
+	return ""
+}
+
+// Reads the content of a gopher item, detecting its mediatype if the item type doesn't give one, like for images (I), sounds (s),
+// and videos (;). Text files (0) have the "." line that ends them removed.
+func readGopherItem(conn net.Conn, itemType byte) (io.ReadCloser, string, error) {
+	mediatype := gopherItemMediatype(itemType)
+	if itemType == '0' {
+		defer conn.Close()
+		data, err := io.ReadAll(io.LimitReader(conn, maxBodySize))
+		if err != nil {
+			return nil, "", err
+		}
+		return io.NopCloser(bytes.NewReader(trimGopherTerminator(data))), mediatype, nil
+	} else if mediatype != "" {
+		return conn, mediatype, nil
+	}
+
+	reader := bufio.NewReaderSize(conn, 3072)
+	head, err := reader.Peek(3072)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		conn.Close()
+		return nil, "", err
+	}
+	return gopherItemReader{reader, conn}, mimetype.Detect(head).String(), nil
+}
+
+// The body of a gopher item that was peeked at to detect its mediatype
+type gopherItemReader struct {
+	*bufio.Reader
+	conn net.Conn
+}
+
+func (r gopherItemReader) Close() error {
+	return r.conn.Close()
+}
+
+// Removes the "." line that ends gopher text files (RFC 1436)
+func trimGopherTerminator(data []byte) []byte {
+	trimmed := bytes.TrimRight(data, "\r\n")
+	if !bytes.HasSuffix(trimmed, []byte(".")) {
+		return data
+	}
+	rest := trimmed[:len(trimmed)-1]
+	if len(rest) == 0 || rest[len(rest)-1] == '\n' {
+		return rest
+	}
+	return data
+}
+
+// Builds the gopher url of a gophermap entry
+func gopherUrl(itemType byte, selector string, host string, port string) string {
+	if port != "" && port != "70" {
+		host = net.JoinHostPort(host, port)
+	}
+	u := neturl.URL{Scheme: "gopher", Host: host, Path: "/" + string(itemType) + selector}
+	return u.String()
+}
+
+// Parses gophermaps. Info lines are the text of the page (or its preformatted text, when they're ascii art), and the first info line with
+// letters is the title. Entries that can be crawled are added to the links, with "URL:" selectors linking to other protocols.
+type gophermapParser struct{}
+
+func (p gophermapParser) ParseDocument(data []byte) Document {
+	doc := newDocument(len(data))
+	var strippedTextBuilder strings.Builder
+	var headingsBuilder strings.Builder
+	var preformattedTextBuilder strings.Builder
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		if line == "." {
+			break
+		} else if line == "" {
+			continue
+		}
+		doc.Linecount += 1
+
+		itemType := line[0]
+		fields := strings.Split(line[1:], "\t")
+		display := fields[0]
+		if itemType == 'i' || itemType == '3' || len(fields) < 3 {
+			// Info lines, errors, and lines that aren't valid entries (like in gophermaps that are only text)
+			if len(fields) == 1 {
+				display = line // Plain text, so the first character isn't an item type
+			}
+			if !ContainsLetterRunes(display) {
+				fmt.Fprintf(&preformattedTextBuilder, "%s\n", display)
+				continue
+			}
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", strings.TrimSpace(display))
+			addTagsAndMentions(display, 1, &doc.Tags, &doc.Mentions)
+			if doc.Title == "" && len(strings.TrimSpace(display)) < 250 {
+				doc.Title = strings.TrimSpace(display)
+			}
+			if strings.HasPrefix(strings.TrimSpace(display), "#") {
+				fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(display))
+			}
+			continue
+		}
+
+		fmt.Fprintf(&strippedTextBuilder, "%s\n", strings.TrimSpace(display))
+		addTagsAndMentions(display, 2, &doc.Tags, &doc.Mentions)
+		selector, host, port := fields[1], fields[2], ""
+		if len(fields) > 3 {
+			port = strings.TrimSpace(fields[3])
+			if _, err := strconv.Atoi(port); err != nil {
+				port = ""
+			}
+		}
+
+		switch itemType {
+		case '7', '8', 'T', '2', '+':
+			// Search servers need input, telnet and CSO aren't crawlable, and redundant servers mirror the ones already listed
+			continue
+		case 'h':
+			if after, found := strings.CutPrefix(selector, "URL:"); found {
+				doc.Links = append(doc.Links, DocumentLink{strings.TrimSpace(display), after, false, false})
+				continue
+			}
+		}
+		if host == "" {
+			continue
+		}
+		doc.Links = append(doc.Links, DocumentLink{strings.TrimSpace(display), gopherUrl(itemType, selector, host, port), false, itemType == 'g' || itemType == 'I'})
+	}
+
+	doc.Headings = headingsBuilder.String()
+	doc.Preformatted = preformattedTextBuilder.String()
+	doc.StrippedText = strippedTextBuilder.String()
+	doc.IsFeed = documentIsFeed(doc.Links)
+	return doc
+}
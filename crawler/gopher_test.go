@@ -0,0 +1,237 @@
+package crawler
+
+import (
+	"bufio"
+	"net"
+	neturl "net/url"
+	"strings"
+	"testing"
+)
+
+// gopherStandIn is a minimal local Gopher server that replies to each selector with the given content
+type gopherStandIn struct {
+	listener net.Listener
+	items    map[string]string // selector -> content
+}
+
+func newGopherStandIn(t *testing.T, items map[string]string) *gopherStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &gopherStandIn{listener: listener, items: items}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (server *gopherStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return
+	}
+	if content, ok := server.items[strings.TrimRight(line, "\r\n")]; ok {
+		conn.Write([]byte(content))
+	} else {
+		conn.Write([]byte("3Not found\t\terror.host\t1\r\n.\r\n"))
+	}
+}
+
+func (server *gopherStandIn) url(path string) string {
+	return "gopher://" + server.listener.Addr().String() + path
+}
+
+func TestGopherFetcher(t *testing.T) {
+	png := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89"
+	server := newGopherStandIn(t, map[string]string{
+		"":            "iHello\t\terror.host\t1\r\n0About\t/about.txt\texample.org\t70\r\n.\r\n",
+		"/about.txt":  "About this hole.\r\n..dots stay\r\n.\r\n",
+		"/notes.txt":  "No terminator\r\n",
+		"/pic":        png,
+		"/file.bin":   "\x00\x01\x02\x03",
+		"/song":       "ID3\x03\x00\x00\x00\x00\x00\x00",
+		"/search\tgo": "0Go\t/go.txt\texample.org\t70\r\n.\r\n",
+	})
+	fetcher, ok := GetProtocolFetcher("gopher")
+	if !ok {
+		t.Fatal("no fetcher registered for gopher")
+	}
+
+	tests := []struct {
+		path      string
+		mediatype string
+		body      string
+	}{
+		{"/", GophermapMediatype, "iHello\t\terror.host\t1\r\n0About\t/about.txt\texample.org\t70\r\n.\r\n"},
+		{"/0/about.txt", "text/plain", "About this hole.\r\n..dots stay\r\n"},
+		{"/0/notes.txt", "text/plain", "No terminator\r\n"},
+		{"/I/pic", "image/png", png},
+		{"/9/file.bin", "application/octet-stream", "\x00\x01\x02\x03"},
+		{"/s/song", "audio/mpeg", "ID3\x03\x00\x00\x00\x00\x00\x00"},
+		{"/7/search?go", GophermapMediatype, "0Go\t/go.txt\texample.org\t70\r\n.\r\n"},
+	}
+	for _, test := range tests {
+		resp, err := fetcher.Fetch(server.url(test.path))
+		if err != nil {
+			t.Fatalf("Fetch '%s' failed: %v", test.path, err)
+		}
+		if resp.Status != 20 || resp.Description != test.mediatype {
+			t.Errorf("'%s': got status %d '%s', want 20 '%s'", test.path, resp.Status, resp.Description, test.mediatype)
+		}
+		if body := readBody(t, resp); body != test.body {
+			t.Errorf("'%s': unexpected body %q", test.path, body)
+		}
+	}
+
+	// A search server without a query is an input prompt, and telnet isn't crawlable
+	if resp, err := fetcher.Fetch(server.url("/7/search")); err != nil || resp.Status != 10 {
+		t.Errorf("search without a query: expected an input prompt, got status %d, err %v", resp.Status, err)
+	}
+	if _, err := fetcher.Fetch(server.url("/8/")); err != ErrGopherItemNotSupported {
+		t.Errorf("telnet: expected ErrGopherItemNotSupported, got %v", err)
+	}
+}
+
+func TestTrimGopherTerminator(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"text\r\n.\r\n", "text\r\n"},
+		{"text\n.\n", "text\n"},
+		{"text\r\n.", "text\r\n"},
+		{".\r\n", ""},
+		{"text\r\n", "text\r\n"},
+		{"ends with a period.\r\n", "ends with a period.\r\n"},
+		{"ellipsis\r\n...\r\n", "ellipsis\r\n...\r\n"},
+		{"", ""},
+	}
+	for _, test := range tests {
+		if got := string(trimGopherTerminator([]byte(test.input))); got != test.want {
+			t.Errorf("trimGopherTerminator(%q): expected %q, got %q", test.input, test.want, got)
+		}
+	}
+}
+
+func TestGopherItemTypeAndSelector(t *testing.T) {
+	tests := []struct {
+		url      string
+		itemType byte
+		selector string
+		robots   string
+	}{
+		{"gopher://example.org", '1', "", "/"},
+		{"gopher://example.org/", '1', "", "/"},
+		{"gopher://example.org/1/phlog", '1', "/phlog", "/phlog"},
+		{"gopher://example.org/0about.txt", '0', "about.txt", "/about.txt"},
+		{"gopher://example.org/7/search?hello%20world", '7', "/search\thello world", "/search"},
+	}
+	for _, test := range tests {
+		u, err := neturl.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		itemType, selector := gopherItemTypeAndSelector(u)
+		if itemType != test.itemType || selector != test.selector {
+			t.Errorf("'%s': expected %c %q, got %c %q", test.url, test.itemType, test.selector, itemType, selector)
+		}
+		if path := robotsPath(u); path != test.robots {
+			t.Errorf("'%s': expected robots path %q, got %q", test.url, test.robots, path)
+		}
+	}
+}
+
+func TestGophermapParser(t *testing.T) {
+	tests := []struct {
+		name         string
+		gophermap    string
+		title        string
+		links        []DocumentLink
+		text         string
+		preformatted string
+	}{
+		{
+			name:      "entries",
+			gophermap: "1Phlog\t/phlog\texample.org\t70\r\n0Notes\t/notes.txt\tother.org\t7070\r\nIPicture\t/pic.png\texample.org\t70\r\n",
+			links: []DocumentLink{
+				{"Phlog", "gopher://example.org/1/phlog", false, false},
+				{"Notes", "gopher://other.org:7070/0/notes.txt", false, false},
+				{"Picture", "gopher://example.org/I/pic.png", false, true},
+			},
+			text: "Phlog\nNotes\nPicture\n",
+		},
+		{
+			name:      "url links to other protocols",
+			gophermap: "hGemini version\tURL:gemini://example.org/\texample.org\t70\r\nhWeb page\t/index.html\texample.org\t70\r\n",
+			links: []DocumentLink{
+				{"Gemini version", "gemini://example.org/", false, false},
+				{"Web page", "gopher://example.org/h/index.html", false, false},
+			},
+			text: "Gemini version\nWeb page\n",
+		},
+		{
+			name:      "uncrawlable entries are skipped",
+			gophermap: "7Search\t/search\texample.org\t70\r\n8Telnet\t\texample.org\t23\r\nTTN3270\t\texample.org\t23\r\n2CSO\t\texample.org\t105\r\n+Mirror\t/\tmirror.org\t70\r\n0No host\t/file.txt\t\t70\r\n",
+			text:      "Search\nTelnet\nTN3270\nCSO\nMirror\nNo host\n",
+		},
+		{
+			name:      "bad ports are dropped",
+			gophermap: "1Phlog\t/phlog\texample.org\tseventy\r\n",
+			links:     []DocumentLink{{"Phlog", "gopher://example.org/1/phlog", false, false}},
+			text:      "Phlog\n",
+		},
+		{
+			name:         "info lines are the title and text, ascii art is preformatted",
+			gophermap:    "i=====\t\terror.host\t1\r\niWelcome to the hole\t\terror.host\t1\r\ni#phlog\t\terror.host\t1\r\niSecond line\t\terror.host\t1\r\n",
+			title:        "Welcome to the hole",
+			text:         "Welcome to the hole\n#phlog\nSecond line\n",
+			preformatted: "=====\n",
+		},
+		{
+			name:      "text without tabs",
+			gophermap: "Just some text\nwith no entries\n",
+			title:     "Just some text",
+			text:      "Just some text\nwith no entries\n",
+		},
+		{
+			name:      "terminator ends the gophermap",
+			gophermap: "1Phlog\t/phlog\texample.org\t70\r\n.\r\n1After\t/after\texample.org\t70\r\n",
+			links:     []DocumentLink{{"Phlog", "gopher://example.org/1/phlog", false, false}},
+			text:      "Phlog\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			doc := gophermapParser{}.ParseDocument([]byte(test.gophermap))
+			if doc.Title != test.title {
+				t.Errorf("expected title %q, got %q", test.title, doc.Title)
+			}
+			if len(doc.Links) != len(test.links) {
+				t.Fatalf("expected links %v, got %v", test.links, doc.Links)
+			}
+			for i, link := range doc.Links {
+				if link != test.links[i] {
+					t.Errorf("link %d: expected %v, got %v", i, test.links[i], link)
+				}
+			}
+			if doc.StrippedText != test.text {
+				t.Errorf("expected text %q, got %q", test.text, doc.StrippedText)
+			}
+			if doc.Preformatted != test.preformatted {
+				t.Errorf("expected preformatted text %q, got %q", test.preformatted, doc.Preformatted)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package crawler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	neturl "net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/clseibold/go-gemini"
+)
+
+var ErrGuppyInvalidResponse = errors.New("invalid guppy response")
+var ErrGuppyResponseTooLarge = errors.New("guppy response too large")
+
+// How long to wait for the first packet before sending the request again, since UDP packets can be lost
+var guppyRetransmitInterval = 2 * time.Second
+
+const guppyMaxResponseSize = 1024 * 1024 * 200 // 200 MiB Max, same as the limit when reading other protocols
+
+type guppyClient struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+}
+
+type guppyResponse struct {
+	status int    // 1 for input, 3 for redirect, 4 for error, or the sequence number of the first packet for success
+	meta   string // Prompt, redirect url, error message, or the mediatype for success
+	data   []byte
+}
+
+// Request sends the url to the guppy server over UDP and reassembles the response (guppy v0.4). Success responses start with a
+// "seq mediatype\r\n" packet, followed by "seq\r\n" continuation packets with increasing sequence numbers, and end with a continuation
+// packet without data. Every one of these packets is acknowledged by sending its sequence number back. Other responses are a single packet.
+func (c guppyClient) Request(url string) (guppyResponse, error) {
+	u, err := neturl.Parse(url)
+	if err != nil {
+		return guppyResponse{}, err
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = "6775"
+	}
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(u.Hostname(), port), c.ConnectTimeout)
+	if err != nil {
+		return guppyResponse{}, err
+	}
+	defer conn.Close()
+	deadline := time.Now().Add(c.ReadTimeout)
+
+	request := []byte(url + "\r\n")
+	if _, err := conn.Write(request); err != nil {
+		return guppyResponse{}, err
+	}
+
+	chunks := make(map[int][]byte)
+	firstSeq, eofSeq := -1, -1
+	mediatype := ""
+	size := 0
+	buffer := make([]byte, 65536)
+	for {
+		if time.Now().After(deadline) {
+			return guppyResponse{}, os.ErrDeadlineExceeded
+		}
+		readDeadline := time.Now().Add(guppyRetransmitInterval)
+		if readDeadline.After(deadline) {
+			readDeadline = deadline
+		}
+		conn.SetReadDeadline(readDeadline)
+		n, err := conn.Read(buffer)
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			if firstSeq == -1 && len(chunks) == 0 {
+				conn.Write(request)
+			}
+			continue
+		} else if err != nil {
+			return guppyResponse{}, err
+		}
+
+		header, data, found := bytes.Cut(buffer[:n], []byte("\r\n"))
+		if !found {
+			return guppyResponse{}, ErrGuppyInvalidResponse
+		}
+		seqStr, meta, _ := strings.Cut(string(header), " ")
+		seq, err := strconv.Atoi(seqStr)
+		if err != nil || seq < 0 {
+			return guppyResponse{}, ErrGuppyInvalidResponse
+		} else if seq < 6 {
+			if len(chunks) > 0 {
+				continue
+			} else if seq != 1 && seq != 3 && seq != 4 {
+				return guppyResponse{}, ErrGuppyInvalidResponse
+			}
+			return guppyResponse{seq, meta, nil}, nil
+		}
+
+		// Acknowledge every packet, including duplicates, since the previous acknowledgement might have been lost
+		conn.Write([]byte(strconv.Itoa(seq) + "\r\n"))
+		if _, duplicate := chunks[seq]; duplicate {
+			continue
+		}
+		if meta != "" {
+			firstSeq = seq
+			mediatype = meta
+		} else if len(data) == 0 {
+			eofSeq = seq
+		}
+		chunks[seq] = bytes.Clone(data)
+		size += len(data)
+		if size > guppyMaxResponseSize {
+			return guppyResponse{}, ErrGuppyResponseTooLarge
+		}
+
+		if firstSeq != -1 && eofSeq != -1 {
+			complete := true
+			for i := firstSeq; i <= eofSeq; i++ {
+				if _, ok := chunks[i]; !ok {
+					complete = false
+					break
+				}
+			}
+			if complete {
+				break
+			}
+		}
+	}
+
+	var body bytes.Buffer
+	for i := firstSeq; i < eofSeq; i++ {
+		body.Write(chunks[i])
+	}
+	return guppyResponse{firstSeq, mediatype, body.Bytes()}, nil
+}
+
+type guppyFetcher struct {
+	client guppyClient
+}
+
+func (f guppyFetcher) Fetch(url string) (Response, error) {
+	var resp Response
+	g_resp, err := f.client.Request(url)
+	if err != nil {
+		return resp, err
+	}
+	switch g_resp.status {
+	case 1:
+		resp.Status = gemini.StatusInput
+	case 3:
+		resp.Status = gemini.StatusRedirect
+	case 4:
+		resp.Status = gemini.StatusPermanentFailure
+	default:
+		resp.Status = 20
+	}
+	resp.Description = g_resp.meta
+	resp.Body = io.NopCloser(bytes.NewReader(g_resp.data))
+	resp.Cert = nil
+	return resp, nil
+}
+
+func (f guppyFetcher) FetchRobotsTxt(host string) (string, error) {
+	g_resp, err := f.client.Request(host + "robots.txt")
+	if err != nil {
+		return "", err
+	} else if g_resp.status < 6 {
+		return "", nil
+	}
+	return string(g_resp.data), nil
+}
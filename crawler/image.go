@@ -0,0 +1,548 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Metadata of an image file, from its EXIF, XMP, and IPTC metadata, and the text chunks of PNGs. Metadata found in more than one
+// place is taken from the first one found, in that order.
+type ImageMetadata struct {
+	Width       int
+	Height      int
+	CameraMake  string
+	CameraModel string
+	CaptureDate time.Time
+	Title       string
+	Description string
+	AltText     string // Alt text embedded in the image. The text of the link the image was found through is preferred over this.
+	Creator     string
+	Copyright   string
+}
+
+// Text chunks of PNGs are uncompressed up to this size
+const imageMaxTextSize = 1024 * 1024
+
+// Descriptions some cameras write into every image
+var exifPlaceholderDescriptions = map[string]bool{
+	"OLYMPUS DIGITAL CAMERA": true,
+	"SONY DSC":               true,
+	"DIGITAL CAMERA":         true,
+	"DCIM":                   true,
+	"DEFAULT":                true,
+}
+
+// Layouts of the dates of EXIF, which have no time zone unless an offset tag goes with them, and of IPTC IIM
+const exifDateLayout = "2006:01:02 15:04:05"
+const iptcDateLayout = "20060102"
+
+func parseImageMetadata(mediatype string, data []byte) ImageMetadata {
+	var metadata ImageMetadata
+	if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		metadata.Width, metadata.Height = config.Width, config.Height
+	}
+
+	var xmpPacket []byte
+	switch mediatype {
+	case "image/jpeg", "image/jpg":
+		xmpPacket = metadata.readJPEGSegments(data)
+	case "image/png", "image/apng", "image/vnd.mozilla.apng":
+		xmpPacket = metadata.readPNGChunks(data)
+	case "image/webp":
+		xmpPacket = metadata.readWebPChunks(data)
+	case "image/tiff":
+		metadata.addEXIF(data)
+	case "image/bmp", "image/x-ms-bmp":
+		metadata.readBMPHeader(data)
+	case "image/svg+xml":
+		metadata.readSVG(data)
+	}
+
+	// XMP packets are uncompressed in most formats, so the file itself is searched for one when the format has no known place for it
+	if xmpPacket == nil {
+		xmpPacket = data
+	}
+	metadata.addXMPMetadata(parseXMP(xmpPacket))
+	return metadata
+}
+
+func setIfEmpty(field *string, value string) {
+	if *field == "" {
+		*field = strings.TrimSpace(value)
+	}
+}
+
+func setDateIfZero(field *time.Time, value time.Time) {
+	if field.IsZero() {
+		*field = value
+	}
+}
+
+// Fills in the metadata the image doesn't have already from its XMP metadata
+func (metadata *ImageMetadata) addXMPMetadata(xmp xmpMetadata) {
+	setIfEmpty(&metadata.Title, xmp.first("dc:title"))
+	setIfEmpty(&metadata.Title, xmp.first("photoshop:Headline"))
+	setIfEmpty(&metadata.Description, xmp.first("dc:description"))
+	setIfEmpty(&metadata.AltText, xmp.first("Iptc4xmpCore:AltTextAccessibility"))
+	setIfEmpty(&metadata.Creator, strings.Join(xmp["dc:creator"], ", "))
+	setIfEmpty(&metadata.Copyright, xmp.first("dc:rights"))
+	setIfEmpty(&metadata.CameraMake, xmp.first("tiff:Make"))
+	setIfEmpty(&metadata.CameraModel, xmp.first("tiff:Model"))
+	for _, property := range []string{"exif:DateTimeOriginal", "photoshop:DateCreated", "xmp:CreateDate"} {
+		setDateIfZero(&metadata.CaptureDate, parseFeedDate(xmp.first(property), xmpDateLayouts))
+	}
+	if metadata.Width == 0 || metadata.Height == 0 {
+		metadata.Width, _ = strconv.Atoi(xmp.first("exif:PixelXDimension"))
+		metadata.Height, _ = strconv.Atoi(xmp.first("exif:PixelYDimension"))
+	}
+}
+
+// Reads the EXIF (APP1), XMP (APP1), and IPTC (APP13) segments of a JPEG. Returns the XMP packet, if there is one.
+func (metadata *ImageMetadata) readJPEGSegments(data []byte) []byte {
+	var xmpPacket []byte
+	if !bytes.HasPrefix(data, []byte{0xFF, 0xD8}) {
+		return nil
+	}
+	for i := 2; i+4 <= len(data) && data[i] == 0xFF; {
+		marker := data[i+1]
+		if marker == 0xFF {
+			// Fill bytes before a marker
+			i++
+			continue
+		} else if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			// Markers without a segment
+			i += 2
+			continue
+		} else if marker == 0xDA || marker == 0xD9 {
+			// The image data starts at the start of scan, and the metadata comes before it
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		if length < 2 || i+2+length > len(data) {
+			break
+		}
+		segment := data[i+4 : i+2+length]
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00")):
+			metadata.addEXIF(segment[6:])
+		case marker == 0xE1 && bytes.HasPrefix(segment, []byte("http://ns.adobe.com/xap/1.0/\x00")):
+			xmpPacket = segment
+		case marker == 0xED && bytes.HasPrefix(segment, []byte("Photoshop 3.0\x00")):
+			metadata.readPhotoshopResources(segment[len("Photoshop 3.0\x00"):])
+		}
+		i += 2 + length
+	}
+	return xmpPacket
+}
+
+// An entry of a TIFF image file directory, with the bytes of its value
+type tiffEntry struct {
+	valueType uint16
+	value     []byte
+}
+
+// Sizes of the TIFF value types, indexed by type
+var tiffTypeSizes = [...]int{0, 1, 1, 2, 4, 8, 1, 1, 2, 4, 8, 4, 8}
+
+func readTIFFDirectory(data []byte, order binary.ByteOrder, offset uint32) map[uint16]tiffEntry {
+	entries := make(map[uint16]tiffEntry)
+	if int64(offset)+2 > int64(len(data)) {
+		return entries
+	}
+	count := int(order.Uint16(data[offset:]))
+	for n := 0; n < count; n++ {
+		start := int(offset) + 2 + n*12
+		if start+12 > len(data) {
+			break
+		}
+		entry := data[start : start+12]
+		tag := order.Uint16(entry[0:2])
+		valueType := order.Uint16(entry[2:4])
+		valueCount := order.Uint32(entry[4:8])
+		if int(valueType) >= len(tiffTypeSizes) || valueType == 0 {
+			continue
+		}
+		size := int64(tiffTypeSizes[valueType]) * int64(valueCount)
+		if size <= 4 {
+			// Small values are stored in place of their offset
+			entries[tag] = tiffEntry{valueType, entry[8 : 8+size]}
+		} else if valueOffset := int64(order.Uint32(entry[8:12])); valueOffset+size <= int64(len(data)) {
+			entries[tag] = tiffEntry{valueType, data[valueOffset : valueOffset+size]}
+		}
+	}
+	return entries
+}
+
+func (entry tiffEntry) string() string {
+	value, _, _ := bytes.Cut(entry.value, []byte{0})
+	return strings.TrimSpace(decodeLatin1OrUTF8(value))
+}
+
+func (entry tiffEntry) uint(order binary.ByteOrder) uint32 {
+	switch {
+	case entry.valueType == 3 && len(entry.value) >= 2:
+		return uint32(order.Uint16(entry.value))
+	case (entry.valueType == 4 || entry.valueType == 9) && len(entry.value) >= 4:
+		return order.Uint32(entry.value)
+	}
+	return 0
+}
+
+// Reads the EXIF metadata of a TIFF structure, which is what the EXIF segments of JPEGs and the eXIf chunks of PNGs contain
+func (metadata *ImageMetadata) addEXIF(data []byte) {
+	if len(data) < 8 {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(data[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return
+	}
+
+	ifd0 := readTIFFDirectory(data, order, order.Uint32(data[4:8]))
+	if description := ifd0[0x010E].string(); !exifPlaceholderDescriptions[strings.ToUpper(description)] {
+		setIfEmpty(&metadata.Description, description)
+	}
+	setIfEmpty(&metadata.CameraMake, ifd0[0x010F].string())
+	setIfEmpty(&metadata.CameraModel, ifd0[0x0110].string())
+	setIfEmpty(&metadata.Creator, ifd0[0x013B].string())
+	setIfEmpty(&metadata.Copyright, ifd0[0x8298].string())
+	setIfEmpty(&metadata.Title, decodeUTF16LE(ifd0[0x9C9B].value)) // XPTitle, written by Windows
+	if metadata.Width == 0 || metadata.Height == 0 {
+		metadata.Width, metadata.Height = int(ifd0[0x0100].uint(order)), int(ifd0[0x0101].uint(order))
+	}
+
+	if pointer, ok := ifd0[0x8769]; ok {
+		exif := readTIFFDirectory(data, order, pointer.uint(order))
+		setDateIfZero(&metadata.CaptureDate, parseEXIFDate(exif[0x9003].string(), exif[0x9011].string()))
+		setDateIfZero(&metadata.CaptureDate, parseEXIFDate(exif[0x9004].string(), exif[0x9012].string()))
+		if metadata.Width == 0 || metadata.Height == 0 {
+			metadata.Width, metadata.Height = int(exif[0xA002].uint(order)), int(exif[0xA003].uint(order))
+		}
+	}
+	setDateIfZero(&metadata.CaptureDate, parseEXIFDate(ifd0[0x0132].string(), ""))
+}
+
+// Parses an EXIF date, with the offset of its offset time tag, like "+02:00". Dates without an offset are taken to be in UTC.
+func parseEXIFDate(date string, offset string) time.Time {
+	if offset != "" {
+		if t, err := time.Parse(exifDateLayout+"-07:00", date+offset); err == nil {
+			return t.UTC()
+		}
+	}
+	t, err := time.Parse(exifDateLayout, date)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// Reads the image resources of Photoshop, of which the IPTC-NAA resource holds the IPTC IIM metadata
+func (metadata *ImageMetadata) readPhotoshopResources(data []byte) {
+	for len(data) >= 12 && bytes.HasPrefix(data, []byte("8BIM")) {
+		id := binary.BigEndian.Uint16(data[4:6])
+		// The resource name is a Pascal string padded to an even length
+		nameLength := int(data[6]) + 1
+		nameLength += nameLength % 2
+		if 6+nameLength+4 > len(data) {
+			return
+		}
+		size := int(binary.BigEndian.Uint32(data[6+nameLength:]))
+		start := 6 + nameLength + 4
+		if size < 0 || start+size > len(data) {
+			return
+		}
+		if id == 0x0404 {
+			metadata.addIPTC(data[start : start+size])
+		}
+		data = data[min(start+size+size%2, len(data)):]
+	}
+}
+
+// Reads the datasets of the application record of IPTC IIM metadata
+func (metadata *ImageMetadata) addIPTC(data []byte) {
+	var date, creators []string
+	for len(data) >= 5 && data[0] == 0x1C {
+		record, dataset := data[1], data[2]
+		size := int(binary.BigEndian.Uint16(data[3:5]))
+		if size&0x8000 != 0 || 5+size > len(data) {
+			// Extended datasets are only used for large binary data
+			return
+		}
+		value := strings.TrimSpace(decodeLatin1OrUTF8(data[5 : 5+size]))
+		data = data[5+size:]
+		if record != 2 {
+			continue
+		}
+
+		switch dataset {
+		case 5: // Object Name
+			setIfEmpty(&metadata.Title, value)
+		case 120: // Caption/Abstract
+			setIfEmpty(&metadata.Description, value)
+		case 80: // By-line
+			creators = append(creators, value)
+		case 116: // Copyright Notice
+			setIfEmpty(&metadata.Copyright, value)
+		case 55: // Date Created
+			date = append(date, value)
+		}
+	}
+	setIfEmpty(&metadata.Creator, strings.Join(creators, ", "))
+	if len(date) > 0 {
+		if t, err := time.Parse(iptcDateLayout, date[0]); err == nil {
+			setDateIfZero(&metadata.CaptureDate, t)
+		}
+	}
+}
+
+// Reads the text (tEXt, zTXt, iTXt) and EXIF (eXIf) chunks of a PNG. Returns the XMP packet of its iTXt chunk, if there is one.
+func (metadata *ImageMetadata) readPNGChunks(data []byte) []byte {
+	var xmpPacket []byte
+	if !bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")) {
+		return nil
+	}
+	for i := 8; i+8 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[i : i+4]))
+		chunkType := string(data[i+4 : i+8])
+		if length < 0 || i+8+length+4 > len(data) || chunkType == "IDAT" || chunkType == "IEND" {
+			// Text chunks that come after the image data are rare, and not worth reading all of the image data for
+			break
+		}
+		chunk := data[i+8 : i+8+length]
+		i += 8 + length + 4 // The chunk is followed by its CRC
+
+		keyword, text, found := bytes.Cut(chunk, []byte{0})
+		switch chunkType {
+		case "eXIf":
+			metadata.addEXIF(chunk)
+			continue
+		case "tEXt":
+			if found {
+				metadata.addPNGText(string(keyword), decodeLatin1OrUTF8(text))
+			}
+		case "zTXt":
+			// The compression method comes before the text, and is always zlib
+			if found && len(text) > 1 {
+				if uncompressed, ok := inflateImageText(text[1:]); ok {
+					metadata.addPNGText(string(keyword), decodeLatin1OrUTF8(uncompressed))
+				}
+			}
+		case "iTXt":
+			// The compression flag and method are followed by the language tag and translated keyword, each terminated by a null byte
+			if !found || len(text) < 2 {
+				continue
+			}
+			compressed := text[0] == 1
+			parts := bytes.SplitN(text[2:], []byte{0}, 3)
+			if len(parts) != 3 {
+				continue
+			}
+			value := parts[2]
+			if compressed {
+				var ok bool
+				if value, ok = inflateImageText(value); !ok {
+					continue
+				}
+			}
+			if string(keyword) == "XML:com.adobe.xmp" {
+				xmpPacket = value
+			} else {
+				metadata.addPNGText(string(keyword), string(value))
+			}
+		}
+	}
+	return xmpPacket
+}
+
+func inflateImageText(data []byte) ([]byte, bool) {
+	reader, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+	defer reader.Close()
+	uncompressed, err := io.ReadAll(io.LimitReader(reader, imageMaxTextSize))
+	return uncompressed, err == nil
+}
+
+// Uses the predefined keywords of PNG text chunks
+func (metadata *ImageMetadata) addPNGText(keyword string, text string) {
+	switch keyword {
+	case "Title":
+		setIfEmpty(&metadata.Title, text)
+	case "Description":
+		setIfEmpty(&metadata.Description, text)
+	case "Author":
+		setIfEmpty(&metadata.Creator, text)
+	case "Copyright":
+		setIfEmpty(&metadata.Copyright, text)
+	case "Source":
+		setIfEmpty(&metadata.CameraModel, text) // The device used to create the image
+	case "Creation Time":
+		setDateIfZero(&metadata.CaptureDate, parseFeedDate(text, []string{time.RFC1123Z, time.RFC1123, time.RFC3339, exifDateLayout, "2006-01-02"}))
+	}
+}
+
+// Reads the dimensions of a WebP from its VP8X, VP8, or VP8L chunk, along with its EXIF chunk. Returns its XMP chunk, if there is one.
+func (metadata *ImageMetadata) readWebPChunks(data []byte) []byte {
+	var xmpPacket []byte
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil
+	}
+	for i := 12; i+8 <= len(data); {
+		chunkType := string(data[i : i+4])
+		size := int(binary.LittleEndian.Uint32(data[i+4 : i+8]))
+		if size < 0 || i+8+size > len(data) {
+			break
+		}
+		chunk := data[i+8 : i+8+size]
+		i += 8 + size + size%2
+
+		switch chunkType {
+		case "VP8X":
+			if len(chunk) >= 10 {
+				metadata.Width = 1 + (int(chunk[4]) | int(chunk[5])<<8 | int(chunk[6])<<16)
+				metadata.Height = 1 + (int(chunk[7]) | int(chunk[8])<<8 | int(chunk[9])<<16)
+			}
+		case "VP8 ":
+			// The frame tag is followed by a start code and then the 14-bit width and height
+			if metadata.Width == 0 && len(chunk) >= 10 && bytes.Equal(chunk[3:6], []byte{0x9D, 0x01, 0x2A}) {
+				metadata.Width = int(binary.LittleEndian.Uint16(chunk[6:8]) & 0x3FFF)
+				metadata.Height = int(binary.LittleEndian.Uint16(chunk[8:10]) & 0x3FFF)
+			}
+		case "VP8L":
+			if metadata.Width == 0 && len(chunk) >= 5 && chunk[0] == 0x2F {
+				bits := binary.LittleEndian.Uint32(chunk[1:5])
+				metadata.Width = int(bits&0x3FFF) + 1
+				metadata.Height = int(bits>>14&0x3FFF) + 1
+			}
+		case "EXIF":
+			metadata.addEXIF(bytes.TrimPrefix(chunk, []byte("Exif\x00\x00")))
+		case "XMP ":
+			xmpPacket = chunk
+		}
+	}
+	return xmpPacket
+}
+
+func (metadata *ImageMetadata) readBMPHeader(data []byte) {
+	if len(data) < 26 || string(data[:2]) != "BM" {
+		return
+	}
+	if headerSize := binary.LittleEndian.Uint32(data[14:18]); headerSize == 12 {
+		// OS/2 bitmaps have 16-bit dimensions
+		metadata.Width = int(binary.LittleEndian.Uint16(data[18:20]))
+		metadata.Height = int(binary.LittleEndian.Uint16(data[20:22]))
+	} else {
+		// The height is negative for images stored top-down
+		metadata.Width = int(int32(binary.LittleEndian.Uint32(data[18:22])))
+		metadata.Height = int(int32(binary.LittleEndian.Uint32(data[22:26])))
+		if metadata.Height < 0 {
+			metadata.Height = -metadata.Height
+		}
+	}
+}
+
+// Reads the dimensions of an SVG from the width and height of its root element, or from its view box when they aren't absolute lengths,
+// along with its title and description.
+func (metadata *ImageMetadata) readSVG(data []byte) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	depth := 0
+	var text *string // The title or description being read
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 && token.Name.Local == "svg" {
+				metadata.readSVGDimensions(token.Attr)
+			} else if depth == 2 && token.Name.Local == "title" && metadata.Title == "" {
+				text = &metadata.Title
+			} else if depth == 2 && token.Name.Local == "desc" && metadata.Description == "" {
+				text = &metadata.Description
+			}
+		case xml.CharData:
+			if text != nil {
+				*text += string(token)
+			}
+		case xml.EndElement:
+			if text != nil {
+				*text = strings.Join(strings.Fields(*text), " ")
+				text = nil
+			}
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+}
+
+func (metadata *ImageMetadata) readSVGDimensions(attrs []xml.Attr) {
+	var width, height, viewBox string
+	for _, attr := range attrs {
+		switch attr.Name.Local {
+		case "width":
+			width = attr.Value
+		case "height":
+			height = attr.Value
+		case "viewBox":
+			viewBox = attr.Value
+		}
+	}
+	parseLength := func(length string) int {
+		value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(length), "px"), 64)
+		if err != nil {
+			return 0
+		}
+		return int(value)
+	}
+	metadata.Width, metadata.Height = parseLength(width), parseLength(height)
+	if fields := strings.FieldsFunc(viewBox, func(r rune) bool { return r == ' ' || r == ',' }); (metadata.Width == 0 || metadata.Height == 0) && len(fields) == 4 {
+		metadata.Width, metadata.Height = parseLength(fields[2]), parseLength(fields[3])
+	}
+}
+
+// Decodes text of metadata formats that predate UTF-8 and are often written in Latin-1 anyway
+func decodeLatin1OrUTF8(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+func decodeUTF16LE(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		unit := binary.LittleEndian.Uint16(data[i:])
+		if unit == 0 {
+			break
+		}
+		units = append(units, unit)
+	}
+	return string(utf16.Decode(units))
+}
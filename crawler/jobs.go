@@ -0,0 +1,330 @@
+package crawler
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type CrawlJobState int
+
+const (
+	CrawlJobQueued    CrawlJobState = iota // Waiting for the crawl before it to finish
+	CrawlJobRunning                        // Crawling
+	CrawlJobPaused                         // Workers wait before taking their next url until the job is resumed
+	CrawlJobCancelled                      // Stopped before its frontier ran out
+	CrawlJobDone                           // Its frontier ran out
+)
+
+func (state CrawlJobState) String() string {
+	switch state {
+	case CrawlJobQueued:
+		return "queued"
+	case CrawlJobRunning:
+		return "running"
+	case CrawlJobPaused:
+		return "paused"
+	case CrawlJobCancelled:
+		return "cancelled"
+	case CrawlJobDone:
+		return "done"
+	default:
+		return "unknown"
+	}
+}
+
+// The number of finished jobs that are kept for their progress. Older ones are forgotten.
+var maxFinishedCrawlJobs = 50
+
+// CrawlJob is one run of a crawl (scheduled, on-demand, or started by an admin), with its state and counters, so that it can be
+// watched, paused, and cancelled while it runs.
+type CrawlJob struct {
+	Id      int
+	Name    string
+	Created time.Time
+
+	globalData *GlobalData
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	mutex    sync.Mutex
+	state    CrawlJobState
+	started  time.Time
+	finished time.Time
+	resumed  chan struct{} // Closed and replaced when a paused job is resumed
+	failures map[int]int   // Number of failed fetches by status, 0 for fetches that got no response
+
+	fetched   atomic.Int64
+	bytes     atomic.Int64
+	slowDowns atomic.Int64
+}
+
+// CrawlJobProgress is a snapshot of the state and counters of a job
+type CrawlJobProgress struct {
+	State     CrawlJobState
+	Started   time.Time // Zero if still queued
+	Finished  time.Time // Zero if not cancelled or done
+	Fetched   int64     // Fetches that got a response, including failure responses
+	Bytes     int64     // Bytes read from the bodies of responses
+	SlowDowns int64
+	Failures  map[int]int // Number of failed fetches by status, 0 for fetches that got no response
+	ToCrawl   int
+	Crawled   int
+}
+
+// Runs an on-demand job at a time, so that crawls started by admins don't pile onto the same hosts
+var crawlJobSlot = make(chan struct{}, 1)
+
+var crawlJobs = struct {
+	sync.RWMutex
+	list   []*CrawlJob // Oldest first
+	nextId int
+}{nextId: 1}
+
+// Creates a queued job for a crawl of the global data, and adds it to the list of jobs
+func newCrawlJob(name string, globalData *GlobalData) *CrawlJob {
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &CrawlJob{Name: name, Created: time.Now(), globalData: globalData, ctx: ctx, cancel: cancel, resumed: make(chan struct{}), failures: make(map[int]int)}
+	globalData.job = job
+
+	crawlJobs.Lock()
+	defer crawlJobs.Unlock()
+	job.Id = crawlJobs.nextId
+	crawlJobs.nextId++
+	crawlJobs.list = append(crawlJobs.list, job)
+
+	// Forget the oldest finished jobs
+	finished := 0
+	for _, other := range crawlJobs.list {
+		if other.finishedJob() {
+			finished++
+		}
+	}
+	crawlJobs.list = slices.DeleteFunc(crawlJobs.list, func(other *CrawlJob) bool {
+		if finished > maxFinishedCrawlJobs && other.finishedJob() {
+			finished--
+			return true
+		}
+		return false
+	})
+	return job
+}
+
+// GetCrawlJobs returns the current jobs and the most recent finished ones, newest first
+func GetCrawlJobs() []*CrawlJob {
+	crawlJobs.RLock()
+	defer crawlJobs.RUnlock()
+	jobs := slices.Clone(crawlJobs.list)
+	slices.Reverse(jobs)
+	return jobs
+}
+
+func GetCrawlJob(id int) (*CrawlJob, bool) {
+	crawlJobs.RLock()
+	defer crawlJobs.RUnlock()
+	for _, job := range crawlJobs.list {
+		if job.Id == id {
+			return job, true
+		}
+	}
+	return nil, false
+}
+
+// StartCrawlJob queues an on-demand crawl of the seeds in the background. It runs once the on-demand crawl before it has finished.
+// The crawl shares the robots and domain info of the global data, like the other sub-crawls.
+func StartCrawlJob(globalData *GlobalData, name string, seeds []string, followExternalLinks bool, followInternalLinks bool, maxDepth int, threads int) *CrawlJob {
+	jobData := NewSubGlobalData(globalData, followExternalLinks, followInternalLinks, maxDepth)
+	job := newCrawlJob(name, jobData)
+	go func() {
+		select {
+		case crawlJobSlot <- struct{}{}:
+		case <-job.ctx.Done():
+			job.finish()
+			return
+		}
+		defer func() { <-crawlJobSlot }()
+
+		jobData.Reset()
+		for _, seed := range seeds {
+			jobData.AddUrl(seed, UrlToCrawlData{})
+		}
+		job.run(3000, max(threads, 1), 1)
+	}()
+	return job
+}
+
+// Crawls the job's frontier with the given number of threads, numbered from firstThread, until it runs out or the job is cancelled.
+// See Crawl for breakSeconds.
+func (job *CrawlJob) run(firstThread int, threads int, breakSeconds int) {
+	if !job.start() {
+		job.finish()
+		return
+	}
+	wg := &sync.WaitGroup{}
+	wg.Add(threads)
+	for i := range threads {
+		go Crawl(job.globalData, firstThread+i, wg, breakSeconds)
+	}
+	wg.Wait()
+	job.finish()
+}
+
+// Marks a queued job as running. Returns false if the job was cancelled before it started.
+func (job *CrawlJob) start() bool {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if job.state != CrawlJobQueued {
+		return false
+	}
+	job.state = CrawlJobRunning
+	job.started = time.Now()
+	return true
+}
+
+// Marks the job as done, unless it was cancelled
+func (job *CrawlJob) finish() {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if job.state != CrawlJobCancelled {
+		job.state = CrawlJobDone
+	}
+	job.finished = time.Now()
+	job.cancel()
+}
+
+// Whether the job was cancelled or is done, and its crawl has stopped
+func (job *CrawlJob) finishedJob() bool {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	return !job.finished.IsZero()
+}
+
+func (job *CrawlJob) State() CrawlJobState {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	return job.state
+}
+
+// Pause makes the workers of a running job wait before taking their next url. The urls they are crawling get finished first.
+func (job *CrawlJob) Pause() error {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if job.state != CrawlJobRunning {
+		return fmt.Errorf("can't pause a %s job", job.state)
+	}
+	job.state = CrawlJobPaused
+	return nil
+}
+
+func (job *CrawlJob) Resume() error {
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	if job.state != CrawlJobPaused {
+		return fmt.Errorf("can't resume a %s job", job.state)
+	}
+	job.state = CrawlJobRunning
+	close(job.resumed)
+	job.resumed = make(chan struct{})
+	return nil
+}
+
+// Cancel stops a job. Its workers stop after the urls they are crawling, and a queued job never starts.
+func (job *CrawlJob) Cancel() error {
+	job.mutex.Lock()
+	if job.state == CrawlJobCancelled || job.state == CrawlJobDone {
+		job.mutex.Unlock()
+		return fmt.Errorf("can't cancel a %s job", job.state)
+	}
+	job.state = CrawlJobCancelled
+	job.mutex.Unlock()
+
+	job.cancel()
+	job.globalData.urlsToCrawl.Stop()
+	return nil
+}
+
+// Progress returns a snapshot of the job's state and counters
+func (job *CrawlJob) Progress() CrawlJobProgress {
+	job.mutex.Lock()
+	progress := CrawlJobProgress{job.state, job.started, job.finished, job.fetched.Load(), job.bytes.Load(), job.slowDowns.Load(), maps.Clone(job.failures), 0, 0}
+	job.mutex.Unlock()
+
+	if progress.State == CrawlJobRunning || progress.State == CrawlJobPaused {
+		progress.ToCrawl = job.globalData.ToCrawlCount()
+		progress.Crawled = job.globalData.CrawledCount()
+	}
+	return progress
+}
+
+// Blocks while the job is paused. Returns false once the job is cancelled. Crawls without a job are never paused.
+func (job *CrawlJob) waitIfPaused() bool {
+	if job == nil {
+		return true
+	}
+	for {
+		job.mutex.Lock()
+		state, resumed := job.state, job.resumed
+		job.mutex.Unlock()
+		if state != CrawlJobPaused {
+			return state != CrawlJobCancelled
+		}
+
+		select {
+		case <-resumed:
+		case <-job.ctx.Done():
+			return false
+		}
+	}
+}
+
+// Counts a fetch that got a response with the status. Failure statuses are also counted by status.
+func (job *CrawlJob) countFetch(status int) {
+	if job == nil {
+		return
+	}
+	job.fetched.Add(1)
+	if status >= 40 && status != 44 {
+		job.countFailure(status)
+	}
+}
+
+// Counts a failed fetch, with a status of 0 when there was no response
+func (job *CrawlJob) countFailure(status int) {
+	if job == nil {
+		return
+	}
+	job.mutex.Lock()
+	defer job.mutex.Unlock()
+	job.failures[status]++
+}
+
+func (job *CrawlJob) countSlowDown() {
+	if job == nil {
+		return
+	}
+	job.slowDowns.Add(1)
+}
+
+// Wraps the body of a response so that the bytes read from it are counted
+func (job *CrawlJob) countBody(body io.ReadCloser) io.ReadCloser {
+	if job == nil || body == nil {
+		return body
+	}
+	return &countingBody{body, &job.bytes}
+}
+
+type countingBody struct {
+	io.ReadCloser
+	count *atomic.Int64
+}
+
+func (body *countingBody) Read(p []byte) (int, error) {
+	n, err := body.ReadCloser.Read(p)
+	body.count.Add(int64(n))
+	return n, err
+}
@@ -0,0 +1,109 @@
+package crawler
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCrawlJobControl(t *testing.T) {
+	gd := NewGlobalData(nil, false, true, 0)
+	gd.AddUrl("gemini://example.com/", UrlToCrawlData{})
+	gd.AddUrl("gemini://example.com/a.gmi", UrlToCrawlData{})
+	job := newCrawlJob("test", gd)
+	if job.State() != CrawlJobQueued {
+		t.Fatalf("new job should be queued, got %s", job.State())
+	}
+	if !job.start() {
+		t.Fatal("queued job should start")
+	}
+
+	t.Run("paused workers wait until resumed", func(t *testing.T) {
+		if err := job.Pause(); err != nil {
+			t.Fatal(err)
+		}
+		if err := job.Pause(); err == nil {
+			t.Fatal("pausing a paused job should fail")
+		}
+		resumed := make(chan bool)
+		go func() { resumed <- job.waitIfPaused() }()
+		select {
+		case <-resumed:
+			t.Fatal("worker didn't wait while the job was paused")
+		case <-time.After(50 * time.Millisecond):
+		}
+		if err := job.Resume(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case ok := <-resumed:
+			if !ok {
+				t.Fatal("resumed job shouldn't stop its workers")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("worker still waiting after the job was resumed")
+		}
+	})
+
+	t.Run("counters", func(t *testing.T) {
+		job.countFetch(20)
+		job.countFetch(51)
+		job.countFetch(44)
+		job.countFailure(0)
+		job.countSlowDown()
+		body := job.countBody(io.NopCloser(strings.NewReader("# Hello\n")))
+		io.ReadAll(body)
+
+		progress := job.Progress()
+		if progress.Fetched != 3 || progress.Bytes != 8 || progress.SlowDowns != 1 {
+			t.Fatalf("expected 3 fetched, 8 bytes, and 1 slow down, got %d, %d, and %d", progress.Fetched, progress.Bytes, progress.SlowDowns)
+		}
+		if len(progress.Failures) != 2 || progress.Failures[51] != 1 || progress.Failures[0] != 1 {
+			t.Fatalf("expected a 51 failure and a failure without a response, got %v", progress.Failures)
+		}
+		if progress.ToCrawl != 2 {
+			t.Fatalf("expected 2 urls left to crawl, got %d", progress.ToCrawl)
+		}
+	})
+
+	t.Run("cancel stops workers waiting for a url", func(t *testing.T) {
+		// Claim the only host, so that the next worker waits for it
+		url, _, ok := gd.urlsToCrawl.Next(time.Second)
+		if !ok {
+			t.Fatal("expected a url to crawl")
+		}
+		next := make(chan bool)
+		go func() {
+			_, _, ok := gd.urlsToCrawl.Next(time.Hour)
+			next <- ok
+		}()
+
+		if err := job.Cancel(); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case ok := <-next:
+			if ok {
+				t.Fatal("cancelled job handed out a url")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("worker still waiting for a url after the job was cancelled")
+		}
+		gd.urlsToCrawl.Done(url)
+
+		if job.waitIfPaused() {
+			t.Fatal("cancelled job should stop its workers")
+		}
+		if err := job.Resume(); err == nil {
+			t.Fatal("resuming a cancelled job should fail")
+		}
+		job.finish()
+		if state := job.State(); state != CrawlJobCancelled {
+			t.Fatalf("finished cancelled job should stay cancelled, got %s", state)
+		}
+		if found, ok := GetCrawlJob(job.Id); !ok || found != job {
+			t.Fatal("finished job should still be listed")
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package crawler
+
+import (
+	"strings"
+
+	"github.com/pemistahl/lingua-go"
+)
+
+// A language with its own full-text search indexes, whose analyzer stems the words of pages and queries by the rules of the language.
+// Each language's indexes cover all pages, so that a query can be searched with the stemmer of its language.
+type SearchLanguage struct {
+	Code     string // ISO 639-1 code, as stored in the language column of pages
+	Code3    string // ISO 639-2 code, which some pages give as their language instead
+	Name     string // Name of the language, in the language
+	Analyzer string // Analyzer of the language's FTS indexes
+}
+
+// The languages seen the most in geminispace that have an analyzer. English is first, as the default.
+var SearchLanguages = []SearchLanguage{
+	{"en", "eng", "English", "ENGLISH"},
+	{"de", "deu", "Deutsch", "GERMAN"},
+	{"fr", "fra", "Français", "FRENCH"},
+	{"es", "spa", "Español", "SPANISH"},
+	{"it", "ita", "Italiano", "ITALIAN"},
+	{"pt", "por", "Português", "PORTUGUESE"},
+	{"nl", "nld", "Nederlands", "DUTCH"},
+	{"ru", "rus", "Русский", "RUSSIAN"},
+}
+
+// Queries are only searched with the stemmer of the language detected for them when the detector is at least this confident
+const searchLanguageMinConfidence = 0.5
+
+// Gets the search language of an ISO 639-1 or 639-2 code, or of a language tag like "de-AT"
+func GetSearchLanguage(code string) (SearchLanguage, bool) {
+	code, _, _ = strings.Cut(strings.ToLower(strings.TrimSpace(code)), "-")
+	for _, language := range SearchLanguages {
+		if code == language.Code || code == language.Code3 {
+			return language, true
+		}
+	}
+	return SearchLanguage{}, false
+}
+
+// Index of the metadata of pages
+func (language SearchLanguage) PageIndex() string {
+	return "FTS_PAGE_ID_" + strings.ToUpper(language.Code)
+}
+
+// Index of the body text and preformatted text of pages
+func (language SearchLanguage) PageContentIndex() string {
+	return "FTS_PAGECONTENT_ID_" + strings.ToUpper(language.Code)
+}
+
+// Detects which of the search languages a query is written in. Queries are short, so they are often too ambiguous to detect.
+func DetectSearchLanguage(query string) (SearchLanguage, bool) {
+	confidences := langDetector.ComputeLanguageConfidenceValues(query)
+	if len(confidences) == 0 || confidences[0].Value() < searchLanguageMinConfidence || confidences[0].Language() == lingua.Unknown {
+		return SearchLanguage{}, false
+	}
+	return GetSearchLanguage(confidences[0].Language().IsoCode639_1().String())
+}
@@ -0,0 +1,51 @@
+package crawler
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gitlab.com/clseibold/auragem_sis/oops"
+)
+
+// The crawler's structured log. Entries are written to the console, and warnings and errors are also written to errors.log as JSON
+// lines, so they can be filtered by their fields (url, host, thread, status). Entries about a url have it in the url field, or in
+// the from and to fields for redirects.
+var logger = zerolog.New(zerolog.MultiLevelWriter(zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.DateTime}, &errorLogWriter{path: "errors.log"})).With().Timestamp().Str("component", "crawler").Logger()
+
+func init() {
+	zerolog.ErrorStackMarshaler = oops.ZerologStackMarshaler
+}
+
+// SetLogger replaces the crawler's log, e.g. to quiet it or to send it elsewhere
+func SetLogger(l zerolog.Logger) {
+	logger = l.With().Str("component", "crawler").Logger()
+}
+
+// errorLogWriter appends the warnings and errors of a log to a file, which is opened on the first one
+type errorLogWriter struct {
+	mutex sync.Mutex
+	path  string
+	file  *os.File
+}
+
+func (writer *errorLogWriter) Write(p []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if writer.file == nil {
+		file, err := os.OpenFile(writer.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return 0, err
+		}
+		writer.file = file
+	}
+	return writer.file.Write(p)
+}
+
+func (writer *errorLogWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	if level < zerolog.WarnLevel {
+		return len(p), nil
+	}
+	return writer.Write(p)
+}
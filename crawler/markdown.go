@@ -4,151 +4,428 @@ import (
 	"bufio"
 	"bytes"
 	"fmt"
+	"regexp"
 	"strings"
+	"time"
 )
 
-type MarkdownLink struct {
-	name string
-	url  string
-}
+// Parses markdown, following CommonMark for the blocks and links that matter to the crawler: ATX and setext headings, fenced and indented
+// code blocks, inline links and images, reference links, and autolinks. YAML (---) and TOML (+++) front matter give the title, author, and dates.
+type markdownParser struct{}
+
+// Layouts of the dates in front matter
+var frontMatterDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05 -0700", "2006-01-02 15:04:05", "2006-01-02"}
+
+// Link reference definitions, like `[label]: url "title"`
+var markdownReferenceDefinition = regexp.MustCompile(`^ {0,3}\[((?:[^\]\\]|\\.)+)\]:[ \t]*(<[^>]*>|\S+)(?:[ \t]+(?:"[^"]*"|'[^']*'|\([^)]*\)))?[ \t]*$`)
+
+var markdownAutolinkScheme = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.\-]{1,31}:[^\s<>]*$`)
 
-func (ctx *CrawlContext) GetMarkdownPageInfo(dataReader *bytes.Reader, tagsMap *map[string]float64, mentionsMap *map[string]bool, links *[]MarkdownLink, strippedTextBuilder *strings.Builder, update bool) (string, int, string, string, int, bool) {
-	var isFeed = 0
-	var mdTitle string = ""
-	var lastTitleLevel int = 5
-	var linecount = 0
-	size := dataReader.Len()
+var markdownListMarker = regexp.MustCompile(`^ {0,3}(?:[-+*]|[0-9]{1,9}[.)])(?:[ \t]+|$)`)
+
+var markdownThematicBreak = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+
+func (p markdownParser) ParseDocument(data []byte) Document {
+	doc := newDocument(len(data))
+	title := newTitleTracker()
+	var strippedTextBuilder strings.Builder
 	var headingsBuilder strings.Builder
 	var preformattedTextBuilder strings.Builder
 
-	scanner := bufio.NewScanner(dataReader)
-	inPreformat := false
-	inYamlMetadata := false
+	lines := make([]string, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	for scanner.Scan() {
-		linecount += 1
-		line := strings.TrimRight(scanner.Text(), "\r\n")
-		if mdTitle == "" && strings.TrimSpace(line) != "" {
-			if ContainsLetterRunes(line) {
-				// Assume for markdown documents that the first non-blank line is the title until we reach the first line with a #
-				mdTitle = strings.TrimSpace(line)
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r\n"))
+	}
+	doc.Linecount = len(lines)
+	references := collectMarkdownReferences(lines)
+
+	frontMatterDelimiter := ""
+	fence := ""
+	paragraph := "" // The last line of the current paragraph, which a setext underline makes a heading
+	inList := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if i == 0 && (trimmed == "---" || trimmed == "+++") {
+			frontMatterDelimiter = trimmed
+			continue
+		} else if frontMatterDelimiter != "" {
+			if trimmed == frontMatterDelimiter || (frontMatterDelimiter == "---" && trimmed == "...") {
+				frontMatterDelimiter = ""
+			} else {
+				doc.parseFrontMatterLine(trimmed, &title)
 			}
+			continue
+		}
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			} else {
+				fmt.Fprintf(&preformattedTextBuilder, "%s\n", line)
+			}
+			continue
 		}
-		if inPreformat {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", line)
+
+		if trimmed == "" {
+			fmt.Fprintf(&strippedTextBuilder, "\n")
+			paragraph = ""
+			continue
+		}
+
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent == 0 && paragraph == "" && !markdownListMarker.MatchString(line) {
+			// A block that isn't indented ends the list
+			inList = false
+		}
+		if indent <= 3 && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")) {
+			fenceChar := trimmed[:1]
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, fenceChar))]
+			paragraph = ""
+			continue
+		} else if paragraph == "" && !inList && (strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")) {
+			// Indented code blocks can't interrupt paragraphs, and indented lines in lists continue the list item
 			fmt.Fprintf(&preformattedTextBuilder, "%s\n", line)
 			continue
 		}
 
-		if strings.HasPrefix(line, "```") {
-			inPreformat = !inPreformat
-		} else if strings.HasPrefix(line, "####") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "####")))
-			if mdTitle == "" || lastTitleLevel > 4 {
-				mdTitle = string(strings.TrimSpace(strings.TrimPrefix(line, "####")))
-				lastTitleLevel = 4
-			}
-			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
-		} else if strings.HasPrefix(line, "###") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "###")))
-			if mdTitle == "" || lastTitleLevel > 3 {
-				mdTitle = string(strings.TrimSpace(strings.TrimPrefix(line, "###")))
-				lastTitleLevel = 3
+		if level, text := markdownATXHeading(line); level != 0 {
+			paragraph = ""
+			inList = false
+			if text == "" {
+				continue
 			}
-			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
-		} else if strings.HasPrefix(line, "##") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "##")))
-			if mdTitle == "" || lastTitleLevel > 2 {
-				mdTitle = string(strings.TrimSpace(strings.TrimPrefix(line, "##")))
-				lastTitleLevel = 2
+			text, links := references.parseInline(text)
+			doc.addLinks(links)
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", text)
+			addTagsAndMentions(text, 3, &doc.Tags, &doc.Mentions)
+			title.heading(text, level)
+			fmt.Fprintf(&headingsBuilder, "%s %s\n", strings.Repeat("#", level), text)
+			continue
+		} else if paragraph != "" && indent <= 3 && (strings.Trim(trimmed, "=") == "" || strings.Trim(trimmed, "-") == "") {
+			// Setext heading, where the underline makes the line above a heading
+			level := 1
+			if trimmed[0] == '-' {
+				level = 2
 			}
-			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
-		} else if strings.HasPrefix(line, "#") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "#")))
-			if mdTitle == "" || lastTitleLevel > 1 {
-				mdTitle = string(strings.TrimSpace(strings.TrimPrefix(line, "#")))
-				lastTitleLevel = 1
+			title.heading(paragraph, level)
+			fmt.Fprintf(&headingsBuilder, "%s %s\n", strings.Repeat("#", level), paragraph)
+			paragraph = ""
+			continue
+		} else if markdownThematicBreak.MatchString(line) {
+			paragraph = ""
+			continue
+		} else if match := markdownReferenceDefinition.FindStringSubmatch(line); match != nil && paragraph == "" {
+			if _, ok := references[normalizeMarkdownLabel(match[1])]; ok {
+				continue
 			}
-			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
-		} else if strings.HasPrefix(line, ">") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimPrefix(line, ">"))
-		} else if strings.HasPrefix(line, "---") && (linecount == 1 || inYamlMetadata) {
-			inYamlMetadata = !inYamlMetadata
-		} else if inYamlMetadata {
-			if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "title:") {
-				_, value, hasValue := strings.Cut(line, ":")
-				if hasValue && value != "" && lastTitleLevel > 1 {
-					mdTitle = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(value), "\""), "\"")
-					lastTitleLevel = 1
-				}
-			} /*else if strings.HasPrefix(line, "date:") {
-			}*/
+		}
+
+		// Blockquote and list markers aren't part of the text
+		content := strings.TrimLeft(line, " \t")
+		for strings.HasPrefix(content, ">") {
+			content = strings.TrimLeft(strings.TrimPrefix(content, ">"), " \t")
+		}
+		isListItem := false
+		if marker := markdownListMarker.FindString(content); marker != "" {
+			content = content[len(marker):]
+			isListItem = true
+			inList = true
+		}
+
+		text, links := references.parseInline(content)
+		doc.addLinks(links)
+		fmt.Fprintf(&strippedTextBuilder, "%s\n", strings.TrimSpace(text))
+		addTagsAndMentions(text, 1, &doc.Tags, &doc.Mentions)
+		for _, link := range links {
+			addTagsAndMentions(link.Name, 1, &doc.Tags, &doc.Mentions) // Link text is already ranked once as part of the text
+		}
+		// Assume for markdown documents that the first line of text is the title until we reach a heading
+		title.line(text, 0)
+		if isListItem || strings.HasPrefix(strings.TrimLeft(line, " \t"), ">") {
+			paragraph = ""
 		} else {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(line))
-
-			// Small paragraph parser for getting links
-			var currentLinkTitleBuilder strings.Builder
-			var currentLinkUrlBuilder strings.Builder
-
-			inBracket := false
-			expectingLinkUrlStart := false
-			inLinkUrl := false
-			escaped := false
-			for _, r := range line {
-				if r == '\\' {
-					escaped = true
-					continue
-				}
-				if inBracket {
-					if r == '[' && !escaped {
-						currentLinkTitleBuilder.Reset()
-					} else if r == ']' && !escaped {
-						inBracket = false
-						expectingLinkUrlStart = true
-					} else {
-						if escaped {
-							currentLinkTitleBuilder.WriteRune('\\')
-						}
-						// Add rune to current link title
-						currentLinkTitleBuilder.WriteRune(r)
-					}
-				} else if expectingLinkUrlStart {
-					if r == '(' && !escaped {
-						inLinkUrl = true
-						currentLinkUrlBuilder.Reset()
-					} else {
-						currentLinkTitleBuilder.Reset()
-					}
-					expectingLinkUrlStart = false
-				} else if inLinkUrl {
-					if r == ')' && !escaped {
-						// End of entire link - add it to links list
-						link_title := currentLinkTitleBuilder.String()
-						url_without_fragment, _, _ := strings.Cut(currentLinkUrlBuilder.String(), "#")
-						(*links) = append((*links), MarkdownLink{currentLinkTitleBuilder.String(), url_without_fragment})
-						if isTimeDate(link_title) {
-							isFeed++
-						}
-
-						inLinkUrl = false
-						currentLinkTitleBuilder.Reset()
-						currentLinkUrlBuilder.Reset()
-					} else {
-						if escaped {
-							currentLinkUrlBuilder.WriteRune('\\')
-						}
-						// Add rune to current line url
-						currentLinkUrlBuilder.WriteRune(r)
-					}
-				} else if r == '[' && !escaped {
-					inBracket = true
-					currentLinkTitleBuilder.Reset()
-				}
-				if escaped {
-					escaped = false
+			paragraph = strings.TrimSpace(text)
+		}
+	}
+
+	doc.Title = title.title
+	doc.Headings = headingsBuilder.String()
+	doc.Preformatted = preformattedTextBuilder.String()
+	doc.StrippedText = strippedTextBuilder.String()
+	doc.IsFeed = documentIsFeed(doc.Links)
+	return doc
+}
+
+// Adds the links found in a line, without their fragments. Links to other parts of the same document are skipped.
+func (doc *Document) addLinks(links []DocumentLink) {
+	for _, link := range links {
+		link.Url, _, _ = strings.Cut(link.Url, "#")
+		if link.Url == "" {
+			continue
+		}
+		doc.Links = append(doc.Links, link)
+	}
+}
+
+// Parses a "key: value" (YAML) or "key = value" (TOML) line of the front matter
+func (doc *Document) parseFrontMatterLine(line string, title *titleTracker) {
+	key, value, found := CutAny(line, ":=")
+	if !found {
+		return
+	}
+	key = strings.ToLower(strings.TrimSpace(key))
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	if value == "" {
+		return
+	}
+
+	switch key {
+	case "title":
+		title.heading(value, 1)
+	case "author":
+		doc.Author = value
+	case "date", "published", "pubdate":
+		doc.PublishDate = parseFeedDate(value, frontMatterDateLayouts)
+	case "updated", "lastmod", "modified":
+		doc.ModificationDate = parseFeedDate(value, frontMatterDateLayouts)
+	}
+}
+
+// The level and text of an ATX heading line ("# Heading #"), or 0 if the line isn't one
+func markdownATXHeading(line string) (int, string) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return 0, ""
+	}
+	level := 0
+	for level < len(trimmed) && trimmed[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(trimmed) && trimmed[level] != ' ' && trimmed[level] != '\t') {
+		return 0, ""
+	}
+
+	text := strings.TrimSpace(trimmed[level:])
+	// The closing sequence of #s is optional, and must be preceded by a space
+	if withoutClosing := strings.TrimRight(text, "#"); withoutClosing == "" {
+		text = ""
+	} else if len(withoutClosing) != len(text) && strings.HasSuffix(withoutClosing, " ") {
+		text = strings.TrimSpace(withoutClosing)
+	}
+	return level, text
+}
+
+// Link reference definitions of a document, by their normalized labels
+type markdownReferences map[string]string
+
+// Collects the link reference definitions of a document, which can be used before they are defined. The first definition of a label wins.
+func collectMarkdownReferences(lines []string) markdownReferences {
+	references := make(markdownReferences)
+	fence := ""
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		} else if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:len(trimmed)-len(strings.TrimLeft(trimmed, trimmed[:1]))]
+			continue
+		}
+
+		match := markdownReferenceDefinition.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		label := normalizeMarkdownLabel(match[1])
+		if _, exists := references[label]; !exists && label != "" {
+			references[label] = strings.TrimSuffix(strings.TrimPrefix(match[2], "<"), ">")
+		}
+	}
+	return references
+}
+
+// Labels match case-insensitively, with whitespace collapsed
+func normalizeMarkdownLabel(label string) string {
+	return strings.ToLower(strings.Join(strings.Fields(label), " "))
+}
+
+// Parses the inline markup of a line, returning its text without the markup and the links and images in it
+func (references markdownReferences) parseInline(s string) (string, []DocumentLink) {
+	var textBuilder strings.Builder
+	links := make([]DocumentLink, 0)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIIPunctuation(s[i+1]):
+			textBuilder.WriteByte(s[i+1])
+			i += 2
+			continue
+		case c == '`':
+			// Code spans end at a backtick string of the same length, and links aren't parsed inside them
+			run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			if end := strings.Index(s[i+run:], s[i:i+run]); end != -1 {
+				textBuilder.WriteString(strings.TrimSpace(s[i+run : i+run+end]))
+				i += run + end + run
+			} else {
+				textBuilder.WriteString(s[i : i+run])
+				i += run
+			}
+			continue
+		case c == '<':
+			if end := strings.IndexByte(s[i:], '>'); end != -1 && markdownAutolinkScheme.MatchString(s[i+1:i+end]) {
+				url := s[i+1 : i+end]
+				textBuilder.WriteString(url)
+				links = append(links, DocumentLink{url, url, false, false})
+				i += end + 1
+				continue
+			}
+		case c == '[' || (c == '!' && i+1 < len(s) && s[i+1] == '['):
+			image := c == '!'
+			start := i
+			if image {
+				start++
+			}
+			if text, link, end, ok := references.parseLink(s, start); ok {
+				innerText, innerLinks := references.parseInline(text)
+				textBuilder.WriteString(innerText)
+				link.Name = strings.TrimSpace(innerText)
+				link.Image = image
+				links = append(links, link)
+				links = append(links, innerLinks...)
+				i = end
+				continue
+			}
+		}
+		textBuilder.WriteByte(c)
+		i++
+	}
+	return textBuilder.String(), links
+}
+
+// Parses the link starting at the bracket at s[start]: an inline link ([text](url "title")), a full reference link ([text][label]),
+// a collapsed reference link ([label][]), or a shortcut reference link ([label]). Returns the raw link text and the index after the link.
+func (references markdownReferences) parseLink(s string, start int) (string, DocumentLink, int, bool) {
+	closing := matchingMarkdownBracket(s, start)
+	if closing == -1 {
+		return "", DocumentLink{}, 0, false
+	}
+	text := s[start+1 : closing]
+	rest := s[closing+1:]
+
+	if strings.HasPrefix(rest, "(") {
+		if url, length, ok := parseMarkdownDestination(rest); ok {
+			return text, DocumentLink{"", url, false, false}, closing + 1 + length, true
+		}
+	} else if strings.HasPrefix(rest, "[") {
+		if labelEnd := matchingMarkdownBracket(rest, 0); labelEnd != -1 {
+			label := rest[1:labelEnd]
+			if strings.TrimSpace(label) == "" {
+				label = text
+			}
+			if url, ok := references[normalizeMarkdownLabel(label)]; ok {
+				return text, DocumentLink{"", url, false, false}, closing + 1 + labelEnd + 1, true
+			}
+			return "", DocumentLink{}, 0, false
+		}
+	}
+	if url, ok := references[normalizeMarkdownLabel(text)]; ok {
+		return text, DocumentLink{"", url, false, false}, closing + 1, true
+	}
+	return "", DocumentLink{}, 0, false
+}
+
+// The index of the bracket closing the one at s[start], skipping escaped and nested brackets and code spans. Returns -1 if there's none.
+func matchingMarkdownBracket(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '`':
+			run := len(s[i:]) - len(strings.TrimLeft(s[i:], "`"))
+			if end := strings.Index(s[i+run:], s[i:i+run]); end != -1 {
+				i += run + end + run - 1
+			} else {
+				i += run - 1
+			}
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Parses the destination and optional title of an inline link, starting at its opening parenthesis. Returns the url and the length of the destination.
+func parseMarkdownDestination(s string) (string, int, bool) {
+	i := 1
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
+	}
+
+	var url string
+	if i < len(s) && s[i] == '<' {
+		end := strings.IndexByte(s[i:], '>')
+		if end == -1 {
+			return "", 0, false
+		}
+		url = s[i+1 : i+end]
+		i += end + 1
+	} else {
+		// Bare destinations can contain balanced parentheses
+		depth := 0
+		begin := i
+		for ; i < len(s); i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				continue
+			} else if s[i] == ' ' || s[i] == '\t' {
+				break
+			} else if s[i] == '(' {
+				depth++
+			} else if s[i] == ')' {
+				if depth == 0 {
+					break
 				}
+				depth--
 			}
 		}
+		url = s[begin:i]
+	}
+
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
 	}
+	if i < len(s) && (s[i] == '"' || s[i] == '\'' || s[i] == '(') {
+		closingQuote := s[i]
+		if closingQuote == '(' {
+			closingQuote = ')'
+		}
+		end := strings.IndexByte(s[i+1:], closingQuote)
+		if end == -1 {
+			return "", 0, false
+		}
+		i += end + 2
+		for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+			i++
+		}
+	}
+	if i >= len(s) || s[i] != ')' {
+		return "", 0, false
+	}
+	return url, i + 1, true
+}
 
-	return mdTitle, linecount, headingsBuilder.String(), preformattedTextBuilder.String(), size, isFeed > 1
+func isASCIIPunctuation(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) != -1
 }
@@ -0,0 +1,154 @@
+package crawler
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics of all crawls since the server started, served in the Prometheus text format by ServeMetrics. Unlike the counters of a
+// CrawlJob, these are never reset, as Prometheus expects of counters.
+var metrics = crawlerMetrics{fetches: make(map[fetchKey]int64), dbWrites: make(map[string]*latencyHistogram)}
+
+// Upper bounds (in seconds) of the buckets of the DB write latency histograms
+var dbWriteBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type fetchKey struct {
+	scheme string
+	status string // The status code, or "error" when there was no response
+}
+
+type crawlerMetrics struct {
+	mutex    sync.Mutex
+	fetches  map[fetchKey]int64
+	dbWrites map[string]*latencyHistogram // By the kind of row written
+
+	bytes     atomic.Int64
+	slowDowns atomic.Int64
+}
+
+type latencyHistogram struct {
+	buckets []int64 // Count of writes at or below each of dbWriteBuckets
+	count   int64
+	sum     float64
+}
+
+func (m *crawlerMetrics) countFetch(scheme string, status string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.fetches[fetchKey{scheme, status}]++
+}
+
+// Wraps the body of a response so that the bytes read from it are counted
+func (m *crawlerMetrics) countBody(body io.ReadCloser) io.ReadCloser {
+	if body == nil {
+		return body
+	}
+	return &countingBody{body, &m.bytes}
+}
+
+// Records how long a DB write took. Meant to be deferred at the start of the write: defer metrics.observeDBWrite("page", time.Now())
+func (m *crawlerMetrics) observeDBWrite(kind string, start time.Time) {
+	seconds := time.Since(start).Seconds()
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	histogram, exists := m.dbWrites[kind]
+	if !exists {
+		histogram = &latencyHistogram{buckets: make([]int64, len(dbWriteBuckets))}
+		m.dbWrites[kind] = histogram
+	}
+	for i, bound := range dbWriteBuckets {
+		if seconds <= bound {
+			histogram.buckets[i]++
+		}
+	}
+	histogram.count++
+	histogram.sum += seconds
+}
+
+// ServeMetrics serves the crawler's metrics in the Prometheus text format
+func ServeMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	WriteMetrics(w)
+}
+
+// WriteMetrics writes the crawler's metrics in the Prometheus text format
+func WriteMetrics(w io.Writer) {
+	metrics.mutex.Lock()
+	fetchKeys := make([]fetchKey, 0, len(metrics.fetches))
+	for key := range metrics.fetches {
+		fetchKeys = append(fetchKeys, key)
+	}
+	slices.SortFunc(fetchKeys, func(a, b fetchKey) int {
+		return strings.Compare(a.scheme+" "+a.status, b.scheme+" "+b.status)
+	})
+	fmt.Fprintf(w, "# HELP auragem_crawler_fetches_total Responses fetched by the crawler, by scheme and status.\n# TYPE auragem_crawler_fetches_total counter\n")
+	for _, key := range fetchKeys {
+		fmt.Fprintf(w, "auragem_crawler_fetches_total{scheme=%s,status=%s} %d\n", metricLabel(key.scheme), metricLabel(key.status), metrics.fetches[key])
+	}
+
+	kinds := make([]string, 0, len(metrics.dbWrites))
+	for kind := range metrics.dbWrites {
+		kinds = append(kinds, kind)
+	}
+	slices.Sort(kinds)
+	fmt.Fprintf(w, "# HELP auragem_crawler_db_write_seconds Time taken to write rows to the search DB, by the kind of row.\n# TYPE auragem_crawler_db_write_seconds histogram\n")
+	for _, kind := range kinds {
+		histogram := metrics.dbWrites[kind]
+		for i, bound := range dbWriteBuckets {
+			fmt.Fprintf(w, "auragem_crawler_db_write_seconds_bucket{kind=%s,le=\"%s\"} %d\n", metricLabel(kind), strconv.FormatFloat(bound, 'g', -1, 64), histogram.buckets[i])
+		}
+		fmt.Fprintf(w, "auragem_crawler_db_write_seconds_bucket{kind=%s,le=\"+Inf\"} %d\n", metricLabel(kind), histogram.count)
+		fmt.Fprintf(w, "auragem_crawler_db_write_seconds_sum{kind=%s} %g\n", metricLabel(kind), histogram.sum)
+		fmt.Fprintf(w, "auragem_crawler_db_write_seconds_count{kind=%s} %d\n", metricLabel(kind), histogram.count)
+	}
+	metrics.mutex.Unlock()
+
+	fmt.Fprintf(w, "# HELP auragem_crawler_downloaded_bytes_total Bytes of response bodies downloaded by the crawler.\n# TYPE auragem_crawler_downloaded_bytes_total counter\nauragem_crawler_downloaded_bytes_total %d\n", metrics.bytes.Load())
+	fmt.Fprintf(w, "# HELP auragem_crawler_slow_downs_total Slow Down (44) responses the crawler backed off from.\n# TYPE auragem_crawler_slow_downs_total counter\nauragem_crawler_slow_downs_total %d\n", metrics.slowDowns.Load())
+
+	// The frontier and host delays of the crawl jobs that are running
+	var running []*CrawlJob
+	for _, job := range GetCrawlJobs() {
+		if state := job.State(); state == CrawlJobRunning || state == CrawlJobPaused {
+			running = append(running, job)
+		}
+	}
+	fmt.Fprintf(w, "# HELP auragem_crawler_queue_depth Urls waiting to be crawled, by crawl job.\n# TYPE auragem_crawler_queue_depth gauge\n")
+	for _, job := range running {
+		fmt.Fprintf(w, "auragem_crawler_queue_depth{job=%s,id=\"%d\"} %d\n", metricLabel(job.Name), job.Id, job.globalData.ToCrawlCount())
+	}
+
+	// Hosts at the default delay are left out, since there's one for every host crawled
+	delays := make(map[string]float64)
+	for _, job := range running {
+		for item := range job.globalData.domainsCrawled.IterBuffered() {
+			if domainInfo, ok := item.Val.(DomainInfo); ok && domainInfo.slowDown > defaultSlowDown {
+				delays[item.Key] = domainInfo.slowDown
+			}
+		}
+	}
+	hosts := make([]string, 0, len(delays))
+	for host := range delays {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	fmt.Fprintf(w, "# HELP auragem_crawler_default_delay_seconds Delay between fetches from the same host, unless robots.txt or Slow Down responses ask for more.\n# TYPE auragem_crawler_default_delay_seconds gauge\nauragem_crawler_default_delay_seconds %g\n", defaultSlowDown)
+	fmt.Fprintf(w, "# HELP auragem_crawler_host_delay_seconds Delay between fetches from hosts with more than the default delay, from their robots.txt Crawl-Delay or Slow Down backoff.\n# TYPE auragem_crawler_host_delay_seconds gauge\n")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "auragem_crawler_host_delay_seconds{host=%s} %g\n", metricLabel(host), delays[host])
+	}
+}
+
+// Quotes a label value, escaping it as the Prometheus text format requires
+func metricLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+}
@@ -0,0 +1,36 @@
+package crawler
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMetrics(t *testing.T) {
+	metrics.countFetch("metricstest", "20")
+	metrics.countFetch("metricstest", "20")
+	metrics.countFetch("metricstest", "error")
+	io.ReadAll(metrics.countBody(io.NopCloser(strings.NewReader("# Hello\n"))))
+	metrics.observeDBWrite("test", time.Now().Add(-30*time.Millisecond))
+
+	var output strings.Builder
+	WriteMetrics(&output)
+	for _, expected := range []string{
+		`auragem_crawler_fetches_total{scheme="metricstest",status="20"} 2`,
+		`auragem_crawler_fetches_total{scheme="metricstest",status="error"} 1`,
+		`auragem_crawler_db_write_seconds_bucket{kind="test",le="0.025"} 0`,
+		`auragem_crawler_db_write_seconds_bucket{kind="test",le="0.05"} 1`,
+		`auragem_crawler_db_write_seconds_bucket{kind="test",le="+Inf"} 1`,
+		`auragem_crawler_db_write_seconds_count{kind="test"} 1`,
+		"# TYPE auragem_crawler_downloaded_bytes_total counter",
+	} {
+		if !strings.Contains(output.String(), expected+"\n") {
+			t.Errorf("expected %q in the metrics, got:\n%s", expected, output.String())
+		}
+	}
+
+	if label := metricLabel("a \"quoted\"\\name\n"); label != `"a \"quoted\"\\name\n"` {
+		t.Errorf("label not escaped: %s", label)
+	}
+}
@@ -4,7 +4,8 @@ package crawler
 
 import (
 	"errors"
-	"fmt"
+	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,12 +19,11 @@ var ErrNotSupportedScheme = errors.New("not a supported protocol")
 var ErrNotAllowed = errors.New("not allowed by robots.txt")
 var ErrSlowDown = errors.New("slowing down")
 var ErrAlreadyCrawled = errors.New("already crawled")
+var ErrRobotsTxtFetched = errors.New("fetched robots.txt first")
 var ISO8601Layout = "2006-01-02T15:04:05Z0700"
 
 var wg = &sync.WaitGroup{}
 
-var threadSleepDurationMiliSeconds = 21 // 61 // 31
-var threadSleepDurationString = "21ms"  // "61ms"  //"31ms"
 var timeWaitDelay, _ = time.ParseDuration("4m")
 
 /*func main() {
@@ -45,38 +45,47 @@ func RegularCrawler(globalData *GlobalData, wg *sync.WaitGroup) {
 		}
 	}()
 	ticker, _ := cronticker.NewTicker("@monthly") // Run on first day of every month
-	wg2 := &sync.WaitGroup{}
 	// globalData := NewGlobalData(false, true) // Follows internal links only
+	globalData.useRecrawlSchedule = true // Pages that rarely change are left for later crawls
 
-	for {
-		_, ok := <-ticker.C
-		if !ok {
-			break
-		}
+	// Resume an interrupted crawl right away instead of waiting for the next month
+	resume, err := globalData.LoadCheckpoint()
+	if err != nil {
+		logger.Error().Str("crawler", "search").Err(err).Msg("Couldn't resume crawl from checkpoint")
+	}
 
-		globalData.Reset()
-		fmt.Printf("[0-5] Starting Search Engine Crawler.\n")
-		seeds := GetSeeds(globalData)
-		globalData.AddUrl("scroll://scrollprotocol.us.to/", UrlToCrawlData{})
-		for _, seed := range seeds {
-			globalData.AddUrl(seed.Url, UrlToCrawlData{})
+	for {
+		jobName := "Search Engine Crawl"
+		if resume {
+			logger.Info().Str("crawler", "search").Int("toCrawl", globalData.ToCrawlCount()).Msg("Resuming crawler from checkpoint")
+			jobName += " (resumed)"
+			resume = false
+		} else {
+			_, ok := <-ticker.C
+			if !ok {
+				break
+			}
+
+			globalData.Reset()
+			logger.Info().Str("crawler", "search").Msg("Starting crawler")
+			seeds := GetSeeds(globalData)
+			globalData.AddUrl("scroll://scrollprotocol.us.to/", UrlToCrawlData{})
+			for _, seed := range seeds {
+				globalData.AddUrl(seed.Url, UrlToCrawlData{})
+			}
 		}
 
-		wg2.Add(4)
-		go Crawl(globalData, 0, wg2, 60)
-		go Crawl(globalData, 1, wg2, 60)
-		go Crawl(globalData, 2, wg2, 60)
-		go Crawl(globalData, 3, wg2, 60)
-		//go Crawl(globalData, 4, wg2, 60)
-		//go Crawl(globalData, 5, wg2, 60)
+		stopCheckpoints := make(chan struct{})
+		go globalData.checkpointLoop(checkpointInterval, stopCheckpoints)
 
-		wg2.Wait()
-		fmt.Printf("[0-4] Search Engine Crawler Finished.\n")
+		newCrawlJob(jobName, globalData).run(0, 4, 60) // Threads 0-3
+		close(stopCheckpoints)
+		globalData.RemoveCheckpoint()
+		logger.Info().Str("crawler", "search").Msg("Crawler finished")
 		globalData.Reset()
 
 		// Execute procedures to update FTS database
-		globalData.dbConn.Exec("EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_DOMAIN_ID');")
-		globalData.dbConn.Exec("EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGE_ID_EN');")
+		rebuildSearchIndexes(globalData.dbConn)
 
 		time.Sleep(time.Minute * 30)
 	}
@@ -99,53 +108,112 @@ func FeedCrawler(globalData *GlobalData, hourDuration int, wg *sync.WaitGroup, f
 		panic(err)
 	}
 	//ticker := time.NewTicker(time.Hour * time.Duration(hourDuration)) // Every 13 hours
-	wg2 := &sync.WaitGroup{}
 
 	feedData := NewSubGlobalData(globalData, false, true, 1)
-	for {
-		_, ok := <-ticker.C
-		if !ok {
-			break
-		}
+	feedData.feedEntriesOnly = true
+	if globalData.checkpointPath != "" {
+		feedData.SetCheckpointFile(feedCheckpointPath(globalData.checkpointPath))
+	}
 
-		feedData.Reset()
-		fmt.Printf("[6] Starting Feed Crawler.\n")
-		seeds := GetFeedsAsSeeds(feedData)
-		fmt.Printf("Getting %d feeds to crawl.\n", len(seeds))
-		for _, seed := range seeds {
-			/*if page, exists := feedData.urlsCrawled.Get(seed.Url); time.Now().Sub(page.(Page).LastSuccessfulVisit) >= time.Hour*time.Duration(hourDuration) && exists {
-			feedData.AddUrl(seed.Url, UrlToCrawlData{PageFrom_LinkText: seed.Title})
-			feedData.urlsCrawled.Remove(seed.Url)
-			} else {*/
-			feedData.AddUrl(seed.Url, UrlToCrawlData{PageFrom_LinkText: seed.Title})
-			//}
+	// Resume an interrupted feed crawl right away
+	resume, err := feedData.LoadCheckpoint()
+	if err != nil {
+		logger.Error().Str("crawler", "feed").Err(err).Msg("Couldn't resume crawl from checkpoint")
+	}
+
+	for {
+		jobName := "Feed Crawl"
+		if resume {
+			logger.Info().Str("crawler", "feed").Int("toCrawl", feedData.ToCrawlCount()).Msg("Resuming crawler from checkpoint")
+			jobName += " (resumed)"
+			resume = false
+		} else {
+			_, ok := <-ticker.C
+			if !ok {
+				break
+			}
+
+			feedData.Reset()
+			logger.Info().Str("crawler", "feed").Msg("Starting crawler")
+			seeds := GetFeedsAsSeeds(feedData)
+			logger.Info().Str("crawler", "feed").Int("feeds", len(seeds)).Msg("Got feeds to crawl")
+			for _, seed := range seeds {
+				/*if page, exists := feedData.urlsCrawled.Get(seed.Url); time.Now().Sub(page.(Page).LastSuccessfulVisit) >= time.Hour*time.Duration(hourDuration) && exists {
+				feedData.AddUrl(seed.Url, UrlToCrawlData{PageFrom_LinkText: seed.Title})
+				feedData.urlsCrawled.Remove(seed.Url)
+				} else {*/
+				feedData.AddUrl(seed.Url, UrlToCrawlData{PageFrom_LinkText: seed.Title})
+				//}
+			}
 		}
 
-		wg2.Add(4)
-		go Crawl(feedData, 6, wg2, 60)
-		go Crawl(feedData, 7, wg2, 60)
-		go Crawl(feedData, 8, wg2, 60)
-		go Crawl(feedData, 9, wg2, 60)
+		stopCheckpoints := make(chan struct{})
+		go feedData.checkpointLoop(checkpointInterval, stopCheckpoints)
 
-		wg2.Wait()
-		fmt.Printf("[6-9] Feed Crawler Finished.\n")
+		newCrawlJob(jobName, feedData).run(6, 4, 60) // Threads 6-9
+		close(stopCheckpoints)
+		feedData.RemoveCheckpoint()
+		logger.Info().Str("crawler", "feed").Msg("Crawler finished")
 		feedData.Reset()
 		finished()
 
 		// Execute procedures to update FTS database
-		globalData.dbConn.Exec("EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_DOMAIN_ID');")
-		globalData.dbConn.Exec("EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGE_ID_EN');")
+		rebuildSearchIndexes(globalData.dbConn)
 
 		time.Sleep(time.Minute * 5)
 	}
 }
 
+// Crawls the pages that change more often than the monthly crawl, once they're due, along with their new internal links
+func RecrawlCrawler(globalData *GlobalData, wg *sync.WaitGroup) {
+	time.Sleep(time.Second * 5)
+	defer func() {
+		if wg != nil {
+			wg.Done()
+		}
+	}()
+
+	ticker, err := cronticker.NewTicker("0 6 * * *") // Every day at 06:00
+	if err != nil {
+		panic(err)
+	}
+
+	recrawlData := NewSubGlobalData(globalData, false, true, 1)
+	for {
+		_, ok := <-ticker.C
+		if !ok {
+			break
+		}
+
+		recrawlData.Reset()
+		urls, err := getDueRecrawls(recrawlData)
+		if err != nil {
+			logger.Error().Str("crawler", "recrawl").Err(err).Msg("Couldn't get the urls due to be re-crawled")
+			continue
+		}
+		logger.Info().Str("crawler", "recrawl").Int("due", len(urls)).Msg("Starting crawler")
+		for _, url := range urls {
+			recrawlData.AddUrl(url, UrlToCrawlData{})
+		}
+
+		newCrawlJob("Re-Crawl", recrawlData).run(10, 2, 60) // Threads 10-11
+		logger.Info().Str("crawler", "recrawl").Msg("Crawler finished")
+		recrawlData.Reset()
+	}
+}
+
+// The feed crawler's checkpoint file sits next to the regular crawler's, e.g. "crawl.json" -> "crawl_feeds.json"
+func feedCheckpointPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_feeds" + ext
+}
+
 // Crawls a singular page
 func OnDemandPageCrawl(globalData *GlobalData, url, title string) {
 	pageCrawlData := NewSubGlobalData(globalData, false, false, 0) // Do not follow any links
 	pageCrawlData.Reset()
 	pageCrawlData.AddUrl(url, UrlToCrawlData{PageFrom_LinkText: title})
-	Crawl(pageCrawlData, 1000, nil, 1)
+	newCrawlJob("Page Crawl of "+url, pageCrawlData).run(1000, 1, 1)
 }
 
 // Crawls a root page and any internal links it leads to
@@ -153,5 +221,5 @@ func OnDemandCapsuleCrawl(globalData *GlobalData, rootUrl, title string) {
 	capsuleCrawlData := NewSubGlobalData(globalData, false, true, 0) // Follow all internal links
 	capsuleCrawlData.Reset()
 	capsuleCrawlData.AddUrl(rootUrl, UrlToCrawlData{PageFrom_LinkText: title})
-	Crawl(capsuleCrawlData, 2000, nil, 1)
+	newCrawlJob("Capsule Crawl of "+rootUrl, capsuleCrawlData).run(2000, 1, 1)
 }
@@ -7,79 +7,60 @@ import (
 	"strings"
 )
 
-type NexLink struct {
-	name string
-	url  string
-}
+// Parses nex listings, which are plain text with gemtext-like "=>" links, and which often use gemtext headings and preformatted blocks
+type nexParser struct{}
 
-func (ctx *CrawlContext) GetNexPageInfo(dataReader *bytes.Reader, tagsMap *map[string]float64, mentionsMap *map[string]bool, links *[]NexLink, strippedTextBuilder *strings.Builder, update bool) (string, int, string, string, int, bool) {
-	var isFeed = 0
-	var nexTitle string = ""
-	var lastTitleLevel int = 4
-	var linecount = 0
-	size := dataReader.Len()
+func (p nexParser) ParseDocument(data []byte) Document {
+	doc := newDocument(len(data))
+	title := newTitleTracker()
+	var strippedTextBuilder strings.Builder
 	var headingsBuilder strings.Builder
 	var preformattedTextBuilder strings.Builder
 
-	scanner := bufio.NewScanner(dataReader)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
 	inPreformat := false
 	for scanner.Scan() {
-		linecount += 1
+		doc.Linecount += 1
 		line := strings.TrimRight(scanner.Text(), "\r\n")
-		if nexTitle == "" && strings.TrimSpace(line) != "" {
-			if ContainsLetterRunes(line) {
-				// Assume for nex documents that the first non-blank line is the title
-				nexTitle = strings.TrimSpace(line)
-			}
-		}
+		// Assume for nex documents that the first non-blank line is the title
+		title.line(line, 0)
 		if inPreformat {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", line)
+			if strings.HasPrefix(line, "```") {
+				inPreformat = false
+			}
 			fmt.Fprintf(&preformattedTextBuilder, "%s\n", line)
 			continue
 		}
 
 		if strings.HasPrefix(line, "```") {
 			inPreformat = !inPreformat
-		} else if strings.HasPrefix(line, "###") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "###")))
-			if nexTitle == "" || lastTitleLevel > 3 {
-				nexTitle = string(strings.TrimSpace(strings.TrimPrefix(line, "###")))
-				lastTitleLevel = 3
-			}
-			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
-		} else if strings.HasPrefix(line, "##") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "##")))
-			if nexTitle == "" || lastTitleLevel > 2 {
-				nexTitle = string(strings.TrimSpace(strings.TrimPrefix(line, "##")))
-				lastTitleLevel = 2
-			}
-			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
-		} else if strings.HasPrefix(line, "#") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimSpace(strings.TrimPrefix(line, "#")))
-			if nexTitle == "" || lastTitleLevel > 1 {
-				nexTitle = string(strings.TrimSpace(strings.TrimPrefix(line, "#")))
-				lastTitleLevel = 1
-			}
+		} else if level := min(gemtextHeadingLevel(line), 3); level != 0 {
+			text := strings.TrimSpace(line[level:])
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", text)
+			addTagsAndMentions(line[level:], 3, &doc.Tags, &doc.Mentions)
+			title.heading(text, level)
 			fmt.Fprintf(&headingsBuilder, "%s\n", strings.TrimSpace(line))
 		} else if strings.HasPrefix(line, "=>") {
 			line = strings.TrimSpace(strings.TrimPrefix(line, "=>"))
-			fmt.Fprintf(strippedTextBuilder, "%s\n", line)
-			link, title, _ := CutAny(line, " \t")
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", line)
+			link, linkTitle, _ := CutAny(line, " \t")
 
 			link_without_fragment, _, _ := strings.Cut(link, "#")
-			//link_without_query_and_fragment, _, _ = strings.Cut(link_without_query_and_fragment, "?")
-			*links = append(*links, NexLink{title, link_without_fragment})
-
-			if isTimeDate(title) {
-				isFeed++
-			}
+			doc.Links = append(doc.Links, DocumentLink{linkTitle, link_without_fragment, false, false})
+			addTagsAndMentions(linkTitle, 2, &doc.Tags, &doc.Mentions)
 		} else if strings.HasPrefix(line, ">") {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", strings.TrimPrefix(line, ">"))
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", strings.TrimPrefix(line, ">"))
+			addTagsAndMentions(line, 1, &doc.Tags, &doc.Mentions)
 		} else {
-			fmt.Fprintf(strippedTextBuilder, "%s\n", line)
-			continue
+			fmt.Fprintf(&strippedTextBuilder, "%s\n", line)
+			addTagsAndMentions(line, 1, &doc.Tags, &doc.Mentions)
 		}
 	}
 
-	return nexTitle, linecount, headingsBuilder.String(), preformattedTextBuilder.String(), size, isFeed > 1
+	doc.Title = title.title
+	doc.Headings = headingsBuilder.String()
+	doc.Preformatted = preformattedTextBuilder.String()
+	doc.StrippedText = strippedTextBuilder.String()
+	doc.IsFeed = documentIsFeed(doc.Links)
+	return doc
 }
@@ -0,0 +1,891 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Parses PDF files, getting their metadata from the document information dictionary (or the XMP metadata), their page count, the
+// language of the catalog, the links of their URI annotations, and the text of their pages. Objects are found by scanning the file
+// rather than through the xref table, which also recovers files whose xref tables are broken. Encrypted files only give their page count.
+type pdfParser struct{}
+
+var ErrPDFUnsupportedFilter = errors.New("unsupported pdf stream filter")
+
+// Decoded streams larger than this are cut off, so that small compressed streams can't expand to gigabytes
+const pdfMaxDecodedStreamSize = 64 * 1024 * 1024
+
+// Extracted text beyond this size isn't indexed
+const maxExtractedTextSize = 4 * 1024 * 1024
+
+type pdfName string
+type pdfKeyword string
+type pdfDict map[pdfName]any
+
+type pdfRef struct {
+	num int
+	gen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	data []byte // Still encoded with the stream's filters
+}
+
+type pdfFile struct {
+	objects map[int]any
+	trailer pdfDict
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+
+func (p pdfParser) ParseDocument(data []byte) Document {
+	doc := newDocument(len(data))
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return doc
+	}
+	file := loadPDF(data)
+
+	catalog, _ := file.resolve(file.trailer["Root"]).(pdfDict)
+	if catalog == nil {
+		catalog = file.findCatalog()
+	}
+	_, encrypted := file.trailer["Encrypt"]
+	if !encrypted {
+		if info, ok := file.resolve(file.trailer["Info"]).(pdfDict); ok {
+			doc.Title = file.text(info["Title"])
+			doc.Author = file.text(info["Author"])
+			doc.PublishDate = parsePDFDate(file.text(info["CreationDate"]))
+			doc.ModificationDate = parsePDFDate(file.text(info["ModDate"]))
+		}
+		if catalog != nil {
+			doc.Language = file.text(catalog["Lang"])
+			if metadata, ok := file.resolve(catalog["Metadata"]).(pdfStream); ok {
+				if xmpData, err := file.decodeStream(metadata); err == nil {
+					doc.addXMPMetadata(parseXMP(xmpData))
+				}
+			}
+		}
+	}
+
+	var textBuilder strings.Builder
+	pages := file.pages(catalog)
+	doc.PageCount = len(pages)
+	for _, page := range pages {
+		if !encrypted && textBuilder.Len() < maxExtractedTextSize {
+			file.extractPageText(page, &textBuilder)
+			textBuilder.WriteString("\n")
+		}
+		doc.Links = append(doc.Links, file.pageLinks(page)...)
+	}
+	doc.StrippedText = cleanExtractedText(textBuilder.String())
+	doc.Linecount = strings.Count(doc.StrippedText, "\n")
+	addTagsAndMentions(doc.StrippedText, 1, &doc.Tags, &doc.Mentions)
+	return doc
+}
+
+// Finds the objects of the file. Objects of object streams only fill in the objects that weren't found directly in the file.
+func loadPDF(data []byte) *pdfFile {
+	file := &pdfFile{make(map[int]any), make(pdfDict)}
+	objectStreams := make([]pdfStream, 0)
+	for pos := 0; pos < len(data); {
+		loc := pdfObjectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		lexer := &pdfLexer{data, pos + loc[1]}
+		object, end := lexer.readIndirectObject()
+		file.objects[num] = object
+		if stream, ok := object.(pdfStream); ok {
+			switch stream.dict["Type"] {
+			case pdfName("ObjStm"):
+				objectStreams = append(objectStreams, stream)
+			case pdfName("XRef"):
+				file.addTrailer(stream.dict)
+			}
+		}
+		pos = max(end, pos+loc[1])
+	}
+
+	for _, stream := range objectStreams {
+		file.loadObjectStream(stream)
+	}
+
+	// The trailers of incremental updates come later in the file and override the earlier ones
+	for pos := 0; ; {
+		index := bytes.Index(data[pos:], []byte("trailer"))
+		if index == -1 {
+			break
+		}
+		lexer := &pdfLexer{data, pos + index + len("trailer")}
+		if trailer, ok := lexer.readObject().(pdfDict); ok {
+			file.addTrailer(trailer)
+		}
+		pos += index + len("trailer")
+	}
+	return file
+}
+
+func (file *pdfFile) addTrailer(trailer pdfDict) {
+	for _, key := range []pdfName{"Root", "Info", "Encrypt"} {
+		if value, ok := trailer[key]; ok {
+			file.trailer[key] = value
+		}
+	}
+}
+
+func (file *pdfFile) loadObjectStream(stream pdfStream) {
+	data, err := file.decodeStream(stream)
+	if err != nil {
+		return
+	}
+	count, _ := file.resolve(stream.dict["N"]).(int)
+	first, _ := file.resolve(stream.dict["First"]).(int)
+	if first <= 0 || first > len(data) {
+		return
+	}
+
+	header := &pdfLexer{data[:first], 0}
+	for range count {
+		num, ok1 := header.readObject().(int)
+		offset, ok2 := header.readObject().(int)
+		if !ok1 || !ok2 {
+			return
+		}
+		if _, exists := file.objects[num]; exists || first+offset >= len(data) {
+			continue
+		}
+		lexer := &pdfLexer{data, first + offset}
+		file.objects[num] = lexer.readObject()
+	}
+}
+
+// Follows references, with a limit so that reference cycles end
+func (file *pdfFile) resolve(object any) any {
+	for range 32 {
+		ref, ok := object.(pdfRef)
+		if !ok {
+			return object
+		}
+		object = file.objects[ref.num]
+	}
+	return nil
+}
+
+func (file *pdfFile) findCatalog() pdfDict {
+	for _, object := range file.objects {
+		if dict, ok := object.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			return dict
+		}
+	}
+	return nil
+}
+
+// The text of a string object, which is either UTF-16 with a byte order mark, UTF-8 with a byte order mark, or PDFDocEncoding (mostly Latin-1)
+func (file *pdfFile) text(object any) string {
+	s, ok := file.resolve(object).(string)
+	if !ok {
+		return ""
+	}
+	if strings.HasPrefix(s, "\xfe\xff") {
+		return strings.TrimSpace(decodeUTF16BE([]byte(s[2:])))
+	} else if strings.HasPrefix(s, "\xef\xbb\xbf") {
+		return strings.TrimSpace(strings.ToValidUTF8(s[3:], ""))
+	}
+	return strings.TrimSpace(latin1ToUTF8([]byte(s)))
+}
+
+func decodeUTF16BE(data []byte) string {
+	units := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+func latin1ToUTF8(data []byte) string {
+	runes := make([]rune, 0, len(data))
+	for _, b := range data {
+		runes = append(runes, rune(b))
+	}
+	return string(runes)
+}
+
+// Parses dates like "D:20240506101500+02'00'", where everything after the year is optional
+func parsePDFDate(s string) time.Time {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "D:")
+	digits := 0
+	for digits < len(s) && digits < 14 && s[digits] >= '0' && s[digits] <= '9' {
+		digits++
+	}
+	if digits < 4 || digits%2 != 0 {
+		return time.Time{}
+	}
+	// Fill in the missing parts with the first month, day, and time
+	value := s[:digits] + "0101000000"[digits-4:]
+	location := time.UTC
+	if zone := strings.ReplaceAll(s[digits:], "'", ""); len(zone) >= 3 && (zone[0] == '+' || zone[0] == '-') {
+		hours, _ := strconv.Atoi(zone[1:3])
+		minutes := 0
+		if len(zone) >= 5 {
+			minutes, _ = strconv.Atoi(zone[3:5])
+		}
+		offset := hours*3600 + minutes*60
+		if zone[0] == '-' {
+			offset = -offset
+		}
+		location = time.FixedZone("", offset)
+	}
+	t, err := time.ParseInLocation("20060102150405", value, location)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func (file *pdfFile) decodeStream(stream pdfStream) ([]byte, error) {
+	filters := make([]any, 0)
+	switch filter := file.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = append(filters, filter)
+	case []any:
+		filters = filter
+	}
+
+	data := stream.data
+	for i, filter := range filters {
+		if params, ok := file.resolve(stream.dict["DecodeParms"]).(pdfDict); ok && i == len(filters)-1 {
+			if predictor, _ := file.resolve(params["Predictor"]).(int); predictor > 1 {
+				return nil, ErrPDFUnsupportedFilter
+			}
+		}
+
+		var err error
+		switch file.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			var reader io.ReadCloser
+			reader, err = zlib.NewReader(bytes.NewReader(data))
+			if err == nil {
+				data, err = io.ReadAll(io.LimitReader(reader, pdfMaxDecodedStreamSize))
+				reader.Close()
+				if errors.Is(err, io.ErrUnexpectedEOF) && len(data) > 0 {
+					// Truncated streams are common, so use what could be decompressed
+					err = nil
+				}
+			}
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = decodePDFHex(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = decodePDFASCII85(data)
+		default:
+			err = ErrPDFUnsupportedFilter
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func decodePDFHex(data []byte) ([]byte, error) {
+	var digits []byte
+	for _, b := range data {
+		if b == '>' {
+			break
+		} else if isPDFWhitespace(b) {
+			continue
+		}
+		digits = append(digits, b)
+	}
+	if len(digits)%2 != 0 {
+		digits = append(digits, '0')
+	}
+	return hex.DecodeString(string(digits))
+}
+
+func decodePDFASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimSpace(data)
+	data = bytes.TrimPrefix(data, []byte("<~"))
+	if end := bytes.Index(data, []byte("~>")); end != -1 {
+		data = data[:end]
+	}
+	decoded := make([]byte, len(data))
+	n, _, err := ascii85.Decode(decoded, data, true)
+	return decoded[:n], err
+}
+
+// The pages of the page tree, in order, with the resources they inherit from their parents
+func (file *pdfFile) pages(catalog pdfDict) []pdfDict {
+	pages := make([]pdfDict, 0)
+	if catalog == nil {
+		return pages
+	}
+	visited := make(map[int]bool)
+	var walk func(node any, resources any, depth int)
+	walk = func(node any, resources any, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+		dict, ok := file.resolve(node).(pdfDict)
+		if !ok || depth > 64 {
+			return
+		}
+		if dictResources, ok := dict["Resources"]; ok {
+			resources = dictResources
+		}
+
+		if kids, ok := file.resolve(dict["Kids"]).([]any); ok && dict["Type"] != pdfName("Page") {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+		} else {
+			page := make(pdfDict, len(dict)+1)
+			for key, value := range dict {
+				page[key] = value
+			}
+			page["Resources"] = resources
+			pages = append(pages, page)
+		}
+	}
+	walk(catalog["Pages"], nil, 0)
+	return pages
+}
+
+func (file *pdfFile) pageLinks(page pdfDict) []DocumentLink {
+	links := make([]DocumentLink, 0)
+	annotations, _ := file.resolve(page["Annots"]).([]any)
+	for _, annotation := range annotations {
+		dict, ok := file.resolve(annotation).(pdfDict)
+		if !ok || dict["Subtype"] != pdfName("Link") {
+			continue
+		}
+		action, ok := file.resolve(dict["A"]).(pdfDict)
+		if !ok || action["S"] != pdfName("URI") {
+			continue
+		}
+		if uri := file.text(action["URI"]); uri != "" {
+			uri, _, _ = strings.Cut(uri, "#")
+			links = append(links, DocumentLink{"", uri, false, false})
+		}
+	}
+	return links
+}
+
+// Maps the character codes of a font to text, from its ToUnicode CMap
+type pdfCMap struct {
+	codeLength int // Bytes per character code
+	mapping    map[uint32]string
+}
+
+// Mappings a CMap is parsed into at most, counting the ones that replace earlier ones, since each bfrange can map 65536 codes
+const maxCMapMappings = 65536
+
+func (file *pdfFile) fontCMaps(resources any) map[pdfName]*pdfCMap {
+	cmaps := make(map[pdfName]*pdfCMap)
+	resourcesDict, _ := file.resolve(resources).(pdfDict)
+	fonts, _ := file.resolve(resourcesDict["Font"]).(pdfDict)
+	for name, font := range fonts {
+		fontDict, ok := file.resolve(font).(pdfDict)
+		if !ok {
+			continue
+		}
+		cmap := &pdfCMap{1, nil}
+		if fontDict["Subtype"] == pdfName("Type0") {
+			cmap.codeLength = 2
+		}
+		if toUnicode, ok := file.resolve(fontDict["ToUnicode"]).(pdfStream); ok {
+			if data, err := file.decodeStream(toUnicode); err == nil {
+				cmap.parse(data)
+			}
+		}
+		cmaps[name] = cmap
+	}
+	return cmaps
+}
+
+func (cmap *pdfCMap) parse(data []byte) {
+	cmap.mapping = make(map[uint32]string)
+	mapped := 0
+	setMapping := func(code uint32, s string) {
+		cmap.mapping[code] = s
+		mapped++
+	}
+	lexer := &pdfLexer{data, 0}
+	operands := make([]any, 0)
+	for {
+		object := lexer.readObject()
+		if (object == nil && lexer.pos >= len(data)) || mapped >= maxCMapMappings {
+			return
+		}
+		keyword, isKeyword := object.(pdfKeyword)
+		if !isKeyword {
+			operands = append(operands, object)
+			continue
+		}
+
+		switch keyword {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if low, ok := operands[0].(string); ok && len(low) > 0 {
+					cmap.codeLength = len(low)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				source, ok1 := operands[i].(string)
+				destination, ok2 := operands[i+1].(string)
+				if ok1 && ok2 {
+					setMapping(pdfCode(source), decodeUTF16BE([]byte(destination)))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].(string)
+				high, ok2 := operands[i+1].(string)
+				if !ok1 || !ok2 || pdfCode(high) < pdfCode(low) || pdfCode(high)-pdfCode(low) > 0xffff {
+					continue
+				}
+				switch destination := operands[i+2].(type) {
+				case string:
+					// The last character of the destination is incremented over the range
+					runes := []rune(decodeUTF16BE([]byte(destination)))
+					if len(runes) == 0 {
+						continue
+					}
+					last := runes[len(runes)-1]
+					for code := pdfCode(low); code <= pdfCode(high) && mapped < maxCMapMappings; code++ {
+						runes[len(runes)-1] = last + rune(code-pdfCode(low))
+						setMapping(code, string(runes))
+					}
+				case []any:
+					for j, item := range destination {
+						if s, ok := item.(string); ok && mapped < maxCMapMappings {
+							setMapping(pdfCode(low)+uint32(j), decodeUTF16BE([]byte(s)))
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+func pdfCode(s string) uint32 {
+	var code uint32
+	for i := 0; i < len(s) && i < 4; i++ {
+		code = code<<8 | uint32(s[i])
+	}
+	return code
+}
+
+// Decodes the string of a text showing operator with the font's CMap. Fonts without one are assumed to use a Latin-1 compatible encoding.
+func (cmap *pdfCMap) decode(s string) string {
+	if cmap == nil {
+		return latin1ToUTF8([]byte(s))
+	}
+	var builder strings.Builder
+	for i := 0; i+cmap.codeLength <= len(s); i += cmap.codeLength {
+		code := pdfCode(s[i : i+cmap.codeLength])
+		if text, ok := cmap.mapping[code]; ok {
+			builder.WriteString(text)
+		} else if cmap.codeLength == 1 && code >= 0x20 {
+			builder.WriteRune(rune(code))
+		}
+	}
+	return builder.String()
+}
+
+func (file *pdfFile) extractPageText(page pdfDict, builder *strings.Builder) {
+	var content bytes.Buffer
+	switch contents := file.resolve(page["Contents"]).(type) {
+	case pdfStream:
+		if data, err := file.decodeStream(contents); err == nil {
+			content.Write(data)
+		}
+	case []any:
+		for _, item := range contents {
+			if stream, ok := file.resolve(item).(pdfStream); ok {
+				if data, err := file.decodeStream(stream); err == nil {
+					content.Write(data)
+					content.WriteString("\n")
+				}
+			}
+		}
+	}
+	if content.Len() == 0 {
+		return
+	}
+
+	cmaps := file.fontCMaps(page["Resources"])
+	var font *pdfCMap
+	lastY := 0.0
+	lexer := &pdfLexer{content.Bytes(), 0}
+	operands := make([]any, 0)
+	for builder.Len() < maxExtractedTextSize {
+		object := lexer.readObject()
+		if object == nil && lexer.pos >= len(lexer.data) {
+			return
+		}
+		keyword, isKeyword := object.(pdfKeyword)
+		if !isKeyword {
+			operands = append(operands, object)
+			continue
+		}
+
+		switch keyword {
+		case "Tf":
+			if len(operands) >= 1 {
+				if name, ok := operands[0].(pdfName); ok {
+					font = cmaps[name]
+				}
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(string); ok {
+					builder.WriteString(font.decode(s))
+				}
+			}
+		case "'", "\"":
+			builder.WriteString("\n")
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(string); ok {
+					builder.WriteString(font.decode(s))
+				}
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				items, _ := operands[len(operands)-1].([]any)
+				for _, item := range items {
+					switch item := item.(type) {
+					case string:
+						builder.WriteString(font.decode(item))
+					case int:
+						// Large negative adjustments move the next glyph far enough to be a space
+						if item < -200 {
+							builder.WriteString(" ")
+						}
+					case float64:
+						if item < -200 {
+							builder.WriteString(" ")
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 && pdfNumber(operands[1]) != 0 {
+				builder.WriteString("\n")
+			} else {
+				builder.WriteString(" ")
+			}
+		case "Tm":
+			if len(operands) >= 6 {
+				if y := pdfNumber(operands[5]); y != lastY {
+					builder.WriteString("\n")
+					lastY = y
+				} else {
+					builder.WriteString(" ")
+				}
+			}
+		case "T*", "ET":
+			builder.WriteString("\n")
+		case "ID":
+			lexer.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+func pdfNumber(object any) float64 {
+	switch n := object.(type) {
+	case int:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
+
+// Collapses the runs of spaces and blank lines left by the text positioning of extracted text
+func cleanExtractedText(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	var builder strings.Builder
+	blank := false // Blank lines between lines of text are kept as one blank line
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			blank = true
+			continue
+		}
+		if blank && builder.Len() > 0 {
+			builder.WriteString("\n")
+		}
+		blank = false
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+	return builder.String()
+}
+
+// pdfLexer reads the objects of a PDF file or content stream. Operators of content streams are read as keywords.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+// The data after the current position, which is empty once the lexer is at the end
+func (lexer *pdfLexer) rest() []byte {
+	return lexer.data[min(lexer.pos, len(lexer.data)):]
+}
+
+func isPDFWhitespace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n' || b == '\f' || b == 0
+}
+
+func isPDFDelimiter(b byte) bool {
+	return strings.IndexByte("()<>[]{}/%", b) != -1
+}
+
+func (lexer *pdfLexer) skipSpace() {
+	for lexer.pos < len(lexer.data) {
+		b := lexer.data[lexer.pos]
+		if isPDFWhitespace(b) {
+			lexer.pos++
+		} else if b == '%' {
+			for lexer.pos < len(lexer.data) && lexer.data[lexer.pos] != '\n' && lexer.data[lexer.pos] != '\r' {
+				lexer.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+func (lexer *pdfLexer) readToken() string {
+	start := lexer.pos
+	for lexer.pos < len(lexer.data) && !isPDFWhitespace(lexer.data[lexer.pos]) && !isPDFDelimiter(lexer.data[lexer.pos]) {
+		lexer.pos++
+	}
+	return string(lexer.data[start:lexer.pos])
+}
+
+// Reads the object after "N G obj", along with its stream. Returns the object and the position after it.
+func (lexer *pdfLexer) readIndirectObject() (any, int) {
+	object := lexer.readObject()
+	dict, isDict := object.(pdfDict)
+	lexer.skipSpace()
+	if !isDict || !bytes.HasPrefix(lexer.rest(), []byte("stream")) {
+		return object, lexer.pos
+	}
+
+	start := lexer.pos + len("stream")
+	if start < len(lexer.data) && lexer.data[start] == '\r' {
+		start++
+	}
+	if start < len(lexer.data) && lexer.data[start] == '\n' {
+		start++
+	}
+	// Trust the length only when it's direct and ends where the stream does, since lengths are often wrong
+	if length, ok := dict["Length"].(int); ok && length >= 0 && start+length <= len(lexer.data) {
+		after := &pdfLexer{lexer.data, start + length}
+		after.skipSpace()
+		if bytes.HasPrefix(after.rest(), []byte("endstream")) {
+			return pdfStream{dict, lexer.data[start : start+length]}, after.pos + len("endstream")
+		}
+	}
+	end := bytes.Index(lexer.data[start:], []byte("endstream"))
+	if end == -1 {
+		return pdfStream{dict, lexer.data[start:]}, len(lexer.data)
+	}
+	data := bytes.TrimSuffix(lexer.data[start:start+end], []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	return pdfStream{dict, data}, start + end + len("endstream")
+}
+
+// Reads the next object. Returns nil at the end of the data.
+func (lexer *pdfLexer) readObject() any {
+	lexer.skipSpace()
+	if lexer.pos >= len(lexer.data) {
+		return nil
+	}
+
+	switch b := lexer.data[lexer.pos]; {
+	case b == '/':
+		lexer.pos++
+		return pdfName(decodePDFName(lexer.readToken()))
+	case b == '(':
+		return lexer.readLiteralString()
+	case b == '<' && lexer.pos+1 < len(lexer.data) && lexer.data[lexer.pos+1] == '<':
+		lexer.pos += 2
+		dict := make(pdfDict)
+		for {
+			lexer.skipSpace()
+			if lexer.pos >= len(lexer.data) {
+				return dict
+			} else if bytes.HasPrefix(lexer.rest(), []byte(">>")) {
+				lexer.pos += 2
+				return dict
+			}
+			key, ok := lexer.readObject().(pdfName)
+			if !ok {
+				continue
+			}
+			dict[key] = lexer.readObject()
+		}
+	case b == '<':
+		lexer.pos++
+		end := bytes.IndexByte(lexer.rest(), '>')
+		if end == -1 {
+			end = len(lexer.data) - lexer.pos
+		}
+		decoded, _ := decodePDFHex(lexer.data[lexer.pos : lexer.pos+end])
+		lexer.pos = min(lexer.pos+end+1, len(lexer.data)) // An unterminated string ends with the data
+		return string(decoded)
+	case b == '[':
+		lexer.pos++
+		array := make([]any, 0)
+		for {
+			lexer.skipSpace()
+			if lexer.pos >= len(lexer.data) {
+				return array
+			} else if lexer.data[lexer.pos] == ']' {
+				lexer.pos++
+				return array
+			}
+			array = append(array, lexer.readObject())
+		}
+	case b == ']' || b == '>' || b == ')' || b == '{' || b == '}':
+		lexer.pos++
+		return pdfKeyword(string(b))
+	}
+
+	token := lexer.readToken()
+	if token == "" {
+		lexer.pos++
+		return pdfKeyword("")
+	}
+	if n, err := strconv.Atoi(token); err == nil {
+		// Two integers followed by R are a reference
+		saved := lexer.pos
+		lexer.skipSpace()
+		gen := lexer.readToken()
+		lexer.skipSpace()
+		if g, err := strconv.Atoi(gen); err == nil && lexer.pos < len(lexer.data) && lexer.data[lexer.pos] == 'R' && (lexer.pos+1 >= len(lexer.data) || isPDFWhitespace(lexer.data[lexer.pos+1]) || isPDFDelimiter(lexer.data[lexer.pos+1])) {
+			lexer.pos++
+			return pdfRef{n, g}
+		}
+		lexer.pos = saved
+		return n
+	}
+	if f, err := strconv.ParseFloat(token, 64); err == nil {
+		return f
+	}
+	switch token {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	return pdfKeyword(token)
+}
+
+func (lexer *pdfLexer) readLiteralString() string {
+	lexer.pos++
+	var builder strings.Builder
+	depth := 1
+	for lexer.pos < len(lexer.data) {
+		b := lexer.data[lexer.pos]
+		lexer.pos++
+		switch b {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return builder.String()
+			}
+		case '\\':
+			if lexer.pos >= len(lexer.data) {
+				return builder.String()
+			}
+			escaped := lexer.data[lexer.pos]
+			lexer.pos++
+			switch escaped {
+			case 'n':
+				builder.WriteByte('\n')
+			case 'r':
+				builder.WriteByte('\r')
+			case 't':
+				builder.WriteByte('\t')
+			case 'b':
+				builder.WriteByte('\b')
+			case 'f':
+				builder.WriteByte('\f')
+			case '\r':
+				if lexer.pos < len(lexer.data) && lexer.data[lexer.pos] == '\n' {
+					lexer.pos++
+				}
+			case '\n':
+			default:
+				if escaped >= '0' && escaped <= '7' {
+					// Octal codes of up to three digits
+					code := int(escaped - '0')
+					for i := 0; i < 2 && lexer.pos < len(lexer.data) && lexer.data[lexer.pos] >= '0' && lexer.data[lexer.pos] <= '7'; i++ {
+						code = code*8 + int(lexer.data[lexer.pos]-'0')
+						lexer.pos++
+					}
+					builder.WriteByte(byte(code))
+				} else {
+					builder.WriteByte(escaped)
+				}
+			}
+			continue
+		}
+		builder.WriteByte(b)
+	}
+	return builder.String()
+}
+
+// Names can contain any byte as #xx
+func decodePDFName(name string) string {
+	if !strings.Contains(name, "#") {
+		return name
+	}
+	var builder strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) {
+			if b, err := strconv.ParseUint(name[i+1:i+3], 16, 8); err == nil {
+				builder.WriteByte(byte(b))
+				i += 2
+				continue
+			}
+		}
+		builder.WriteByte(name[i])
+	}
+	return builder.String()
+}
+
+// Skips the data of an inline image, which ends with EI
+func (lexer *pdfLexer) skipInlineImage() {
+	for i := lexer.pos; i+2 < len(lexer.data); i++ {
+		if isPDFWhitespace(lexer.data[i]) && lexer.data[i+1] == 'E' && lexer.data[i+2] == 'I' && (i+3 >= len(lexer.data) || isPDFWhitespace(lexer.data[i+3])) {
+			lexer.pos = i + 3
+			return
+		}
+	}
+	lexer.pos = len(lexer.data)
+}
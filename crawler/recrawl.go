@@ -0,0 +1,213 @@
+package crawler
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"time"
+)
+
+// Bounds of the adaptive re-crawl interval. Pages start at the regular (monthly) crawl interval, then move towards how often they've been seen to change.
+var minRecrawlInterval = time.Hour * 24
+var maxRecrawlInterval = time.Hour * 24 * 90
+var regularCrawlInterval = time.Hour * 24 * 30
+
+// Pages are scheduled this much (at most) before their interval is up, so that the regular crawl, which runs on the 1st of every
+// month and takes days to reach a page, doesn't find a page a few hours short of due and push it back another month.
+var maxRecrawlSlack = time.Hour * 24 * 5
+
+// Version of the parsers. Bump it when a change to the parsers, or to what's stored from them, should apply to pages that haven't
+// changed, so that the next crawl re-parses them instead of skipping them as unchanged.
+const parserVersion = 1
+
+// Hashes the raw body of a response, to tell whether a page changed since it was last crawled
+func hashContent(data []byte) string {
+	hasher := sha256.New()
+	hasher.Write(data)
+	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+}
+
+// Records the content hash of the url in the page_hashes history and updates its re-crawl schedule. Returns false if the hash is the same as
+// last crawl and the page was parsed by the current parserVersion, so it doesn't need to be parsed again.
+func recordContentHash(ctx CrawlContext, URL string, hash string) bool {
+	if ctx.globalData.dbConn == nil {
+		return true
+	}
+	var lastId int64
+	var lastHash string
+	var lastParserVersion int
+	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT FIRST 1 id, hash, parser_version FROM page_hashes WHERE url=? ORDER BY last_seen DESC", URL)
+	err := row.Scan(&lastId, &lastHash, &lastParserVersion)
+	if err != nil && err != sql.ErrNoRows {
+		logger.Error().Str("url", URL).Err(err).Msg("Couldn't get page hash history")
+		return true
+	}
+
+	changed := err == sql.ErrNoRows || lastHash != hash
+	if changed {
+		_, err = ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO page_hashes (url, hash, parser_version, first_seen, last_seen) VALUES (?, ?, ?, ?, ?)", URL, hash, parserVersion, time.Now().UTC(), time.Now().UTC())
+	} else {
+		_, err = ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE page_hashes SET parser_version=?, last_seen=? WHERE id=?", parserVersion, time.Now().UTC(), lastId)
+	}
+	if err != nil {
+		logger.Error().Str("url", URL).Err(err).Msg("Couldn't add page hash history")
+		return true
+	}
+
+	updateRecrawlSchedule(ctx, URL)
+	return changed || lastParserVersion != parserVersion
+}
+
+// Computes how often the url changes from its hash history, and sets when it should next be crawled
+func updateRecrawlSchedule(ctx CrawlContext, URL string) {
+	var versions int
+	var firstSeen sql.Null[time.Time]
+	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT COUNT(*), MIN(first_seen) FROM page_hashes WHERE url=?", URL)
+	if err := row.Scan(&versions, &firstSeen); err != nil || !firstSeen.Valid {
+		return
+	}
+
+	interval := recrawlInterval(versions, time.Since(firstSeen.V))
+	nextCrawl := time.Now().Add(interval - recrawlSlack(interval))
+	_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE OR INSERT INTO page_recrawl (url, versions, change_interval, next_crawl) VALUES (?, ?, ?, ?) MATCHING (url)", URL, versions, interval.Hours(), nextCrawl.UTC())
+	if err != nil {
+		logger.Error().Str("url", URL).Err(err).Msg("Couldn't update re-crawl schedule")
+	}
+}
+
+// A page that changed n-1 times over the observed duration is expected to change again after observed/(n-1).
+// Pages that haven't changed yet wait at least the regular crawl interval, growing the longer they stay the same.
+func recrawlInterval(versions int, observed time.Duration) time.Duration {
+	var interval time.Duration
+	if versions <= 1 {
+		interval = max(observed, regularCrawlInterval)
+	} else {
+		interval = observed / time.Duration(versions-1)
+	}
+	return min(max(interval, minRecrawlInterval), maxRecrawlInterval)
+}
+
+// How much earlier than its interval a page is scheduled, a quarter of the interval up to maxRecrawlSlack
+func recrawlSlack(interval time.Duration) time.Duration {
+	return min(interval/4, maxRecrawlSlack)
+}
+
+// Returns whether the url is due to be re-crawled. Urls without a schedule, and urls last parsed by an older parserVersion, are always due.
+func isRecrawlDue(ctx CrawlContext, URL string) bool {
+	if ctx.globalData.dbConn == nil {
+		return true
+	}
+	var nextCrawl time.Time
+	var lastParserVersion sql.Null[int]
+	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT r.next_crawl, (SELECT FIRST 1 h.parser_version FROM page_hashes h WHERE h.url=r.url ORDER BY h.last_seen DESC) FROM page_recrawl r WHERE r.url=?", URL)
+	if err := row.Scan(&nextCrawl, &lastParserVersion); err != nil {
+		return true
+	}
+	return !time.Now().Before(nextCrawl) || lastParserVersion.V != parserVersion
+}
+
+func getPageFromDb(ctx CrawlContext, URL string) (Page, bool) {
+	if ctx.globalData.dbConn == nil {
+		return Page{}, false
+	}
+	var result Page
+	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT FIRST 1 id, url, scheme, domainid, contenttype, charset, language, linecount, udc, title, prompt, headings, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlindex, date_added, last_successful_visit, hidden, has_duplicate_on_gemini FROM pages WHERE url=?", URL)
+	err := row.Scan(&result.Id, &result.Url, &result.Scheme, &result.DomainId, &result.Content_type, &result.Charset, &result.Language, &result.Linecount, &result.Udc, &result.Title, &result.Prompt, &result.Headings, &result.Size, &result.Hash, &result.Feed, &result.PublishDate, &result.Index_time, &result.Album, &result.Artist, &result.AlbumArtist, &result.Composer, &result.Track, &result.Disc, &result.Copyright, &result.CrawlIndex, &result.Date_added, &result.LastSuccessfulVisit, &result.Hidden, &result.HasDuplicateOnGemini)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			logger.Error().Str("url", URL).Err(err).Msg("Couldn't get page")
+		}
+		return Page{}, false
+	}
+	return result, true
+}
+
+// Handles a page that wasn't re-parsed, because it's unchanged or not due to be re-crawled: marks it crawled, adds the link from the
+// page it was found on, and follows the links stored from its last parse so the rest of the capsule is still reached.
+func handleUnchangedPage(ctx CrawlContext, page Page, crawlData UrlToCrawlData, visited bool) {
+	if visited {
+		_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE pages SET crawlIndex=?, last_successful_visit=? WHERE id=?", CrawlIndex, time.Now().UTC(), page.Id)
+		if err != nil {
+			logger.Error().Str("url", page.Url).Err(err).Msg("Couldn't update unchanged page")
+		}
+	}
+	ctx.setUrlCrawledPageData(page.Url, page)
+
+	// If this page was linked to from another page, add the link to the db here
+	if crawlData.PageFromId != 0 {
+		link, link_success := addLinkToDb(ctx, Link{0, crawlData.PageFromId, page.Id, crawlData.PageFrom_LinkText, !crawlData.PageFrom_InternalLink, CrawlIndex, time.Now().UTC()})
+		if !link_success {
+			logger.Error().Str("url", page.Url).Int("from", link.FromPageId).Int("to", link.ToPageId).Msg("Couldn't add link")
+		}
+	}
+
+	if page.Feed && ctx.globalData.feedEntriesOnly {
+		// An unchanged feed has no new entries to follow
+		return
+	}
+
+	rows, err := ctx.globalData.dbConn.QueryContext(context.Background(), "SELECT l.title, p.url FROM links l JOIN pages p ON p.id = l.pageid_to WHERE l.pageid_from=?", page.Id)
+	if err != nil {
+		logger.Error().Str("url", page.Url).Err(err).Msg("Couldn't get links of unchanged page")
+		return
+	}
+	type storedLink struct {
+		title string
+		url   string
+	}
+	var links []storedLink
+	for rows.Next() {
+		var link storedLink
+		if err := rows.Scan(&link.title, &link.url); err != nil {
+			logger.Error().Str("url", page.Url).Err(err).Msg("Couldn't get links of unchanged page")
+			break
+		}
+		links = append(links, link)
+	}
+	rows.Close()
+
+	rules := MatchCrawlRules(page.Url)
+	for _, link := range links {
+		ctx.handlePageLink(page, crawlData, rules, link.title, link.url)
+	}
+}
+
+// Skips fetching a url that isn't due to be re-crawled yet, following its stored links instead. Returns false if the url should be fetched,
+// and the error of setting it as the current url (like ErrRobotsTxtFetched), which should be handled like an error of fetching it.
+func skipNotDueUrl(ctx *CrawlContext, url string, crawlData UrlToCrawlData) (bool, error) {
+	if !ctx.globalData.useRecrawlSchedule || isRecrawlDue(*ctx, url) {
+		return false, nil
+	}
+	page, exists := getPageFromDb(*ctx, url)
+	if !exists || page.Hidden {
+		return false, nil
+	}
+	if err := ctx.setCurrentURL(url); err != nil {
+		return false, err
+	}
+
+	handleUnchangedPage(*ctx, page, crawlData, false)
+	return true, nil
+}
+
+// Returns the urls whose adaptive re-crawl time has passed and that change more often than the regular crawl visits them
+func getDueRecrawls(gd *GlobalData) ([]string, error) {
+	q := `SELECT FIRST 5000 url FROM page_recrawl WHERE next_crawl <= ? AND change_interval < ? ORDER BY next_crawl ASC`
+
+	rows, err := gd.dbConn.QueryContext(context.Background(), q, time.Now().UTC(), regularCrawlInterval.Hours())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
@@ -0,0 +1,48 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecrawlInterval(t *testing.T) {
+	day := time.Hour * 24
+	tests := []struct {
+		versions int
+		observed time.Duration
+		want     time.Duration
+	}{
+		{1, 0, regularCrawlInterval},
+		{1, day * 45, day * 45},
+		{1, day * 365, maxRecrawlInterval},
+		{2, day * 10, day * 10},
+		{5, day * 2, minRecrawlInterval},
+		{3, day * 60, day * 30},
+	}
+	for _, test := range tests {
+		if got := recrawlInterval(test.versions, test.observed); got != test.want {
+			t.Errorf("recrawlInterval(%d, %v): expected %v, got %v", test.versions, test.observed, test.want, got)
+		}
+	}
+}
+
+// An unchanged page crawled a few days into the monthly crawl has to be due by the time the next month's crawl reaches it
+func TestRecrawlSlackKeepsMonthlyCrawl(t *testing.T) {
+	for _, crawled := range []time.Time{
+		time.Date(2026, 1, 1, 6, 0, 0, 0, time.UTC),
+		time.Date(2026, 1, 4, 23, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 3, 12, 0, 0, 0, time.UTC), // The next crawl is only 28 days after the one of February
+	} {
+		interval := recrawlInterval(1, 0)
+		nextCrawl := crawled.Add(interval - recrawlSlack(interval))
+		nextMonthlyCrawl := time.Date(crawled.Year(), crawled.Month()+1, 1, 6, 0, 0, 0, time.UTC)
+		reached := nextMonthlyCrawl.Add(crawled.Sub(time.Date(crawled.Year(), crawled.Month(), 1, 6, 0, 0, 0, time.UTC)))
+		if nextCrawl.After(reached) {
+			t.Errorf("page crawled on %s is due on %s, after the next monthly crawl reaches it on %s", crawled, nextCrawl, reached)
+		}
+	}
+
+	if slack := recrawlSlack(minRecrawlInterval); slack != minRecrawlInterval/4 {
+		t.Errorf("expected short intervals to get a quarter of the interval as slack, got %v", slack)
+	}
+}
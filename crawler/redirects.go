@@ -0,0 +1,235 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Max number of permanent redirects followed when rewriting a link. Longer chains are fetched from where the rewriting stopped.
+var maxRedirectChain = 5
+
+// redirectMap holds the permanent (31) redirects, so that links can be rewritten to their final target before they're fetched.
+type redirectMap struct {
+	mutex    sync.RWMutex
+	to       map[string]string   // old url -> new url
+	from     map[string][]string // new url -> old urls
+	unmerged map[string]bool     // Old urls whose page hasn't been merged into the page they redirect to yet
+}
+
+func newRedirectMap() *redirectMap {
+	return &redirectMap{to: make(map[string]string), from: make(map[string][]string), unmerged: make(map[string]bool)}
+}
+
+// Loads the redirects table into the map
+func (m *redirectMap) load(dbConn *sql.DB) {
+	rows, err := dbConn.QueryContext(context.Background(), "SELECT url_from, url_to, merged FROM redirects")
+	if err != nil {
+		logger.Error().Err(err).Msg("Couldn't load redirects")
+		return
+	}
+	defer rows.Close()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for rows.Next() {
+		var fromUrl, toUrl string
+		var merged bool
+		if err := rows.Scan(&fromUrl, &toUrl, &merged); err != nil {
+			logger.Error().Err(err).Msg("Couldn't load redirects")
+			return
+		}
+		m.set(fromUrl, toUrl)
+		if merged {
+			delete(m.unmerged, fromUrl)
+		}
+	}
+}
+
+// Sets the target of a redirect, marking it as unmerged if it's new or its target changed. Must hold the mutex.
+func (m *redirectMap) set(fromUrl string, toUrl string) {
+	if previous, exists := m.to[fromUrl]; exists {
+		if previous == toUrl {
+			return
+		}
+		sources := m.from[previous]
+		for i, source := range sources {
+			if source == fromUrl {
+				m.from[previous] = append(sources[:i], sources[i+1:]...)
+				break
+			}
+		}
+	}
+	m.to[fromUrl] = toUrl
+	m.from[toUrl] = append(m.from[toUrl], fromUrl)
+	m.unmerged[fromUrl] = true
+}
+
+// Add records a permanent redirect. Returns false without adding it if it would create a redirect loop.
+func (m *redirectMap) Add(fromUrl string, toUrl string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// Follow the chain from the new target to make sure it doesn't lead back
+	current := toUrl
+	for i := 0; i < maxRedirectChain*2; i++ {
+		if current == fromUrl {
+			return false
+		}
+		next, exists := m.to[current]
+		if !exists {
+			break
+		}
+		current = next
+	}
+
+	m.set(fromUrl, toUrl)
+	return true
+}
+
+// Resolve follows the permanent redirects of a url, up to maxRedirectChain. Returns false if the url is part of a redirect loop.
+func (m *redirectMap) Resolve(url string) (string, bool) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	visited := make(map[string]bool)
+	current := url
+	for i := 0; i < maxRedirectChain; i++ {
+		visited[current] = true
+		next, exists := m.to[current]
+		if !exists {
+			return current, true
+		} else if visited[next] {
+			return "", false
+		}
+		current = next
+	}
+	return current, true
+}
+
+// Returns every url that redirects to the given url, directly or through a chain. Must hold the mutex.
+func (m *redirectMap) sources(url string) []string {
+	var sources []string
+	visited := map[string]bool{url: true}
+	queue := []string{url}
+	for len(queue) > 0 && len(sources) < 100 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, source := range m.from[current] {
+			if visited[source] {
+				continue
+			}
+			visited[source] = true
+			sources = append(sources, source)
+			queue = append(queue, source)
+		}
+	}
+	return sources
+}
+
+// TakeUnmerged returns the urls that redirect to the given url and haven't been merged into it yet, and marks them as merged
+func (m *redirectMap) TakeUnmerged(url string) []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if len(m.unmerged) == 0 {
+		return nil
+	}
+
+	var unmerged []string
+	for _, source := range m.sources(url) {
+		if m.unmerged[source] {
+			delete(m.unmerged, source)
+			unmerged = append(unmerged, source)
+		}
+	}
+	return unmerged
+}
+
+func addRedirectToDb(ctx CrawlContext, fromUrl string, toUrl string) bool {
+	if !utf8.ValidString(fromUrl) || !utf8.ValidString(toUrl) {
+		logger.Error().Str("from", fromUrl).Str("to", toUrl).Msg("Redirect url not valid utf8")
+		return false
+	}
+	if len(fromUrl) > 1020 || len(toUrl) > 1020 {
+		logger.Error().Str("from", fromUrl).Str("to", toUrl).Msg("Redirect url over 1020 bytes")
+		return false
+	}
+	if ctx.globalData.dbConn == nil {
+		return true
+	}
+
+	// Check if exists in db, then update or insert. A redirect to a new target has to be merged again.
+	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM redirects WHERE url_from=?", fromUrl)
+	count := 0
+	err := row.Scan(&count)
+	if err != sql.ErrNoRows && err != nil {
+		logger.Error().Str("from", fromUrl).Str("to", toUrl).Err(err).Msg("Couldn't write redirect")
+		return false
+	}
+	if err == sql.ErrNoRows || count <= 0 {
+		_, err = ctx.globalData.dbConn.ExecContext(context.Background(), "INSERT INTO redirects (url_from, url_to, merged, crawlIndex, date_added, last_seen) VALUES (?, ?, false, ?, ?, ?)", fromUrl, toUrl, CrawlIndex, time.Now().UTC(), time.Now().UTC())
+	} else {
+		_, err = ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE redirects SET merged=IIF(url_to=?, merged, false), url_to=?, crawlIndex=?, last_seen=? WHERE url_from=?", toUrl, toUrl, CrawlIndex, time.Now().UTC(), fromUrl)
+	}
+	if err != nil {
+		logger.Error().Str("from", fromUrl).Str("to", toUrl).Err(err).Msg("Couldn't write redirect")
+		return false
+	}
+	return true
+}
+
+// Moves the links and backlinks of the page at fromUrl over to the page it redirects to, then hides the old page.
+// Links that the new page already has are dropped instead of duplicated. This is done once per redirect, the first time the
+// page it redirects to is added after the redirect was recorded.
+func mergeRedirectedPage(ctx CrawlContext, fromUrl string, toPage Page) {
+	if ctx.globalData.dbConn == nil {
+		return
+	}
+	var fromPageId int
+	row := ctx.globalData.dbConn.QueryRowContext(context.Background(), "SELECT FIRST 1 id FROM pages WHERE url=?", fromUrl)
+	if err := row.Scan(&fromPageId); err == sql.ErrNoRows {
+		setRedirectMerged(ctx, fromUrl)
+		return
+	} else if err != nil {
+		logger.Error().Str("from", fromUrl).Str("to", toPage.Url).Err(err).Msg("Couldn't merge redirected page")
+		return
+	}
+	if fromPageId == toPage.Id {
+		setRedirectMerged(ctx, fromUrl)
+		return
+	}
+
+	queries := []struct {
+		q    string
+		args []any
+	}{
+		// Backlinks
+		{"DELETE FROM links WHERE pageid_to=? AND pageid_from IN (SELECT pageid_from FROM links WHERE pageid_to=?)", []any{fromPageId, toPage.Id}},
+		{"UPDATE links SET pageid_to=? WHERE pageid_to=?", []any{toPage.Id, fromPageId}},
+		// Links
+		{"DELETE FROM links WHERE pageid_from=? AND pageid_to IN (SELECT pageid_to FROM links WHERE pageid_from=?)", []any{fromPageId, toPage.Id}},
+		{"UPDATE links SET pageid_from=? WHERE pageid_from=?", []any{toPage.Id, fromPageId}},
+		// The old page may have linked to the new one
+		{"DELETE FROM links WHERE pageid_from=? AND pageid_to=?", []any{toPage.Id, toPage.Id}},
+	}
+	for _, query := range queries {
+		if _, err := ctx.globalData.dbConn.ExecContext(context.Background(), query.q, query.args...); err != nil {
+			logger.Error().Str("from", fromUrl).Str("to", toPage.Url).Err(err).Msg("Couldn't merge redirected page")
+			return
+		}
+	}
+
+	setPageToHidden(ctx, fromUrl)
+	setRedirectMerged(ctx, fromUrl)
+	logger.Info().Str("from", fromUrl).Str("to", toPage.Url).Msg("Merged redirected page")
+}
+
+// Marks a redirect as merged in the db, so that it isn't merged again after a restart
+func setRedirectMerged(ctx CrawlContext, fromUrl string) {
+	_, err := ctx.globalData.dbConn.ExecContext(context.Background(), "UPDATE redirects SET merged=true WHERE url_from=?", fromUrl)
+	if err != nil {
+		logger.Error().Str("from", fromUrl).Err(err).Msg("Couldn't mark redirect as merged")
+	}
+}
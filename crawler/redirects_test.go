@@ -0,0 +1,35 @@
+package crawler
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRedirectMapTakeUnmerged(t *testing.T) {
+	redirects := newRedirectMap()
+	redirects.Add("gemini://example.com/a", "gemini://example.com/b")
+	redirects.Add("gemini://example.com/b", "gemini://example.com/c")
+	redirects.Add("gemini://example.com/d", "gemini://example.com/e")
+
+	// Every page that redirects to c, directly or through b, is merged the first time c is added, and only then
+	unmerged := redirects.TakeUnmerged("gemini://example.com/c")
+	slices.Sort(unmerged)
+	if !slices.Equal(unmerged, []string{"gemini://example.com/a", "gemini://example.com/b"}) {
+		t.Fatalf("expected a and b to be merged into c, got %v", unmerged)
+	}
+	if unmerged := redirects.TakeUnmerged("gemini://example.com/c"); len(unmerged) != 0 {
+		t.Fatalf("expected nothing left to merge into c, got %v", unmerged)
+	}
+
+	// Seeing the same redirect again doesn't merge it again, but a new target does
+	redirects.Add("gemini://example.com/b", "gemini://example.com/c")
+	if unmerged := redirects.TakeUnmerged("gemini://example.com/c"); len(unmerged) != 0 {
+		t.Fatalf("expected a redirect seen again not to be merged again, got %v", unmerged)
+	}
+	redirects.Add("gemini://example.com/b", "gemini://example.com/e")
+	unmerged = redirects.TakeUnmerged("gemini://example.com/e")
+	slices.Sort(unmerged)
+	if !slices.Equal(unmerged, []string{"gemini://example.com/b", "gemini://example.com/d"}) {
+		t.Fatalf("expected b to be merged into its new target along with d, got %v", unmerged)
+	}
+}
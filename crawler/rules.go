@@ -0,0 +1,294 @@
+package crawler
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Crawl rule actions
+const (
+	RuleSkip          = "skip"           // Don't crawl the url
+	RuleNoFollow      = "no-follow"      // Crawl the url, but don't follow any of its links
+	RuleNoIndex       = "no-index"       // Crawl the url and follow its links, but hide it from search results
+	RuleOverrideTitle = "override-title" // Use the rule's value as the title of the page
+	RuleMaxDepth      = "max-depth"      // Don't follow internal links deeper than the rule's value
+)
+
+// Crawl rule match types
+const (
+	MatchHost   = "host"   // Pattern is a host with scheme and trailing slash (gemini://example.com/), or a bare hostname that matches all schemes and ports
+	MatchPrefix = "prefix" // Pattern is a url prefix
+	MatchRegex  = "regex"  // Pattern is a regular expression matched against the whole url
+	MatchGlob   = "glob"   // Pattern is matched against the whole url, where * matches any run of characters and ? matches one character
+)
+
+// The rules compiled into the crawler. Rules from the rules file and the crawl_rules table are added to these.
+//
+//go:embed default_rules.txt
+var defaultRules string
+
+type CrawlRule struct {
+	Action    string
+	MatchType string
+	Pattern   string
+	Value     string // Title for override-title, depth for max-depth
+
+	regex *regexp.Regexp // For regex and glob rules
+	depth int
+}
+
+// RuleMatch is the combined result of all the rules that match a url
+type RuleMatch struct {
+	Skip     bool
+	NoFollow bool
+	NoIndex  bool
+	Title    string // Empty if no override-title rule matched
+	MaxDepth int    // 0 if no max-depth rule matched
+}
+
+func NewCrawlRule(action string, matchType string, pattern string, value string) (CrawlRule, error) {
+	rule := CrawlRule{Action: action, MatchType: matchType, Pattern: pattern, Value: value}
+
+	switch action {
+	case RuleSkip, RuleNoFollow, RuleNoIndex:
+	case RuleOverrideTitle:
+		if value == "" {
+			return CrawlRule{}, errors.New("override-title rule needs a title")
+		}
+	case RuleMaxDepth:
+		depth, err := strconv.Atoi(value)
+		if err != nil || depth <= 0 {
+			return CrawlRule{}, fmt.Errorf("max-depth rule needs a depth above 0, got '%s'", value)
+		}
+		rule.depth = depth
+	default:
+		return CrawlRule{}, fmt.Errorf("unknown rule action '%s'", action)
+	}
+
+	switch matchType {
+	case MatchHost, MatchPrefix:
+	case MatchRegex:
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return CrawlRule{}, err
+		}
+		rule.regex = regex
+	case MatchGlob:
+		rule.regex = globToRegexp(pattern)
+	default:
+		return CrawlRule{}, fmt.Errorf("unknown rule match type '%s'", matchType)
+	}
+
+	return rule, nil
+}
+
+func globToRegexp(glob string) *regexp.Regexp {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			builder.WriteString(".*")
+		case '?':
+			builder.WriteString(".")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	builder.WriteString("$")
+	return regexp.MustCompile(builder.String())
+}
+
+func (rule CrawlRule) Matches(url string) bool {
+	switch rule.MatchType {
+	case MatchHost:
+		if strings.Contains(rule.Pattern, "://") {
+			host, err := GetHostname(url)
+			return err == nil && strings.EqualFold(host, rule.Pattern)
+		}
+		parsed, err := neturl.Parse(url)
+		return err == nil && strings.EqualFold(parsed.Hostname(), rule.Pattern)
+	case MatchPrefix:
+		return strings.HasPrefix(url, rule.Pattern)
+	case MatchRegex, MatchGlob:
+		return rule.regex.MatchString(url)
+	}
+	return false
+}
+
+// ParseCrawlRules parses the rules file format. Each line is "<action> <match type> <pattern> [value]", where the
+// value is the rest of the line. Blank lines and lines starting with "#" are ignored.
+func ParseCrawlRules(reader io.Reader) ([]CrawlRule, error) {
+	var rules []CrawlRule
+	scanner := bufio.NewScanner(reader)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		action, rest, _ := CutAny(line, " \t")
+		matchType, rest, _ := CutAny(rest, " \t")
+		pattern, value, _ := CutAny(rest, " \t")
+		if pattern == "" {
+			return nil, fmt.Errorf("line %d: expected '<action> <match type> <pattern> [value]'", lineNumber)
+		}
+
+		rule, err := NewCrawlRule(action, matchType, pattern, strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// crawlRules holds the current rules, reloaded by WatchCrawlRules
+var crawlRules = struct {
+	sync.RWMutex
+	rules       []CrawlRule
+	filePath    string
+	fileModTime time.Time
+	dbConn      *sql.DB
+}{}
+
+func init() {
+	rules, err := ParseCrawlRules(strings.NewReader(defaultRules))
+	if err != nil {
+		panic(fmt.Errorf("default_rules.txt: %w", err))
+	}
+	crawlRules.rules = rules
+}
+
+// LoadCrawlRules loads the default rules, the rules file at filePath (if it exists), and the crawl_rules table (if dbConn is non-nil).
+// If any of them fail to load, the previous rules are kept.
+func LoadCrawlRules(filePath string, dbConn *sql.DB) error {
+	crawlRules.Lock()
+	crawlRules.filePath = filePath
+	crawlRules.dbConn = dbConn
+	crawlRules.Unlock()
+
+	return reloadCrawlRules()
+}
+
+// WatchCrawlRules reloads the crawl rules every interval, so that edits to the rules file or the crawl_rules table apply without a restart.
+func WatchCrawlRules(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := reloadCrawlRules(); err != nil {
+			logger.Error().Err(err).Msg("Couldn't reload crawl rules")
+		}
+	}
+}
+
+func reloadCrawlRules() error {
+	crawlRules.RLock()
+	filePath := crawlRules.filePath
+	dbConn := crawlRules.dbConn
+	crawlRules.RUnlock()
+
+	rules, _ := ParseCrawlRules(strings.NewReader(defaultRules))
+
+	var modTime time.Time
+	if filePath != "" {
+		file, err := os.Open(filePath)
+		if err == nil {
+			defer file.Close()
+			info, err := file.Stat()
+			if err != nil {
+				return err
+			}
+			modTime = info.ModTime()
+			fileRules, err := ParseCrawlRules(file)
+			if err != nil {
+				return fmt.Errorf("%s: %w", filePath, err)
+			}
+			rules = append(rules, fileRules...)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	if dbConn != nil {
+		dbRules, err := getCrawlRulesFromDb(dbConn)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, dbRules...)
+	}
+
+	crawlRules.Lock()
+	if !modTime.Equal(crawlRules.fileModTime) {
+		logger.Info().Int("rules", len(rules)).Msg("Loaded crawl rules")
+	}
+	crawlRules.rules = rules
+	crawlRules.fileModTime = modTime
+	crawlRules.Unlock()
+	return nil
+}
+
+func getCrawlRulesFromDb(dbConn *sql.DB) ([]CrawlRule, error) {
+	rows, err := dbConn.QueryContext(context.Background(), "SELECT action, matchtype, pattern, rulevalue FROM crawl_rules")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []CrawlRule
+	for rows.Next() {
+		var action, matchType, pattern, value string
+		if err := rows.Scan(&action, &matchType, &pattern, &value); err != nil {
+			return nil, err
+		}
+		rule, err := NewCrawlRule(strings.TrimSpace(action), strings.TrimSpace(matchType), pattern, value)
+		if err != nil {
+			// Skip bad rows rather than dropping all of the rules
+			logger.Error().Str("action", action).Str("match", matchType).Str("pattern", pattern).Str("value", value).Err(err).Msg("Bad crawl rule in db")
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// MatchCrawlRules combines all rules that match the url. If multiple override-title or max-depth rules match, the last one wins.
+func MatchCrawlRules(url string) RuleMatch {
+	crawlRules.RLock()
+	defer crawlRules.RUnlock()
+
+	var result RuleMatch
+	for _, rule := range crawlRules.rules {
+		if !rule.Matches(url) {
+			continue
+		}
+		switch rule.Action {
+		case RuleSkip:
+			result.Skip = true
+		case RuleNoFollow:
+			result.NoFollow = true
+		case RuleNoIndex:
+			result.NoIndex = true
+		case RuleOverrideTitle:
+			result.Title = rule.Value
+		case RuleMaxDepth:
+			result.MaxDepth = rule.depth
+		}
+	}
+	return result
+}
@@ -0,0 +1,172 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseCrawlRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    []CrawlRule
+		wantErr string
+	}{
+		{"blank lines and comments", "\n# A comment\n   \n\t# Indented comment\n", nil, ""},
+		{"skip host", "skip host gemini://example.com/", []CrawlRule{{Action: RuleSkip, MatchType: MatchHost, Pattern: "gemini://example.com/"}}, ""},
+		{"tabs between fields", "no-follow\tprefix\tgemini://example.com/cgi-bin", []CrawlRule{{Action: RuleNoFollow, MatchType: MatchPrefix, Pattern: "gemini://example.com/cgi-bin"}}, ""},
+		{"title is the rest of the line", "override-title glob gemini://example.com/ An  Example Capsule ", []CrawlRule{{Action: RuleOverrideTitle, MatchType: MatchGlob, Pattern: "gemini://example.com/", Value: "An  Example Capsule"}}, ""},
+		{"max depth", "max-depth host example.com 3", []CrawlRule{{Action: RuleMaxDepth, MatchType: MatchHost, Pattern: "example.com", Value: "3", depth: 3}}, ""},
+		{"missing pattern", "skip host", nil, "line 1: expected"},
+		{"unknown action", "# Comment\nfollow host example.com", nil, "line 2: unknown rule action 'follow'"},
+		{"unknown match type", "skip suffix .mp3", nil, "line 1: unknown rule match type 'suffix'"},
+		{"title missing", "override-title host example.com", nil, "line 1: override-title rule needs a title"},
+		{"depth not a number", "max-depth host example.com deep", nil, "line 1: max-depth rule needs a depth above 0"},
+		{"depth zero", "max-depth host example.com 0", nil, "line 1: max-depth rule needs a depth above 0"},
+		{"bad regex", "skip regex gemini://example.com/(", nil, "line 1: error parsing regexp"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := ParseCrawlRules(strings.NewReader(test.input))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(rules) != len(test.want) {
+				t.Fatalf("expected %d rules, got %d: %+v", len(test.want), len(rules), rules)
+			}
+			for i, rule := range rules {
+				rule.regex = nil
+				if rule != test.want[i] {
+					t.Errorf("rule %d: expected %+v, got %+v", i, test.want[i], rule)
+				}
+			}
+		})
+	}
+}
+
+func TestCrawlRuleMatches(t *testing.T) {
+	tests := []struct {
+		matchType string
+		pattern   string
+		url       string
+		want      bool
+	}{
+		{MatchHost, "gemini://example.com/", "gemini://example.com/", true},
+		{MatchHost, "gemini://example.com/", "gemini://example.com/dir/page.gmi", true},
+		{MatchHost, "gemini://example.com/", "GEMINI://EXAMPLE.COM/page.gmi", true},
+		{MatchHost, "gemini://example.com/", "gemini://example.com:1966/page.gmi", false},
+		{MatchHost, "gemini://example.com/", "spartan://example.com/", false},
+		{MatchHost, "gemini://example.com/", "gemini://sub.example.com/", false},
+		{MatchHost, "example.com", "gemini://example.com/page.gmi", true},
+		{MatchHost, "example.com", "nex://example.com:1900/page", true},
+		{MatchHost, "example.com", "gemini://example.community/", false},
+		{MatchPrefix, "gemini://example.com/cgi-bin", "gemini://example.com/cgi-bin/search?q", true},
+		{MatchPrefix, "gemini://example.com/cgi-bin", "gemini://example.com/", false},
+		{MatchGlob, "gemini://example.com/", "gemini://example.com/", true},
+		{MatchGlob, "gemini://example.com/", "gemini://example.com/page.gmi", false},
+		{MatchGlob, "gemini://*/~*/feed.xml", "gemini://example.com/~user/feed.xml", true},
+		{MatchGlob, "gemini://*/~*/feed.xml", "gemini://example.com/feed.xml", false},
+		{MatchGlob, "gemini://example.com/page?.gmi", "gemini://example.com/page1.gmi", true},
+		{MatchGlob, "gemini://example.com/page?.gmi", "gemini://example.com/page10.gmi", false},
+		{MatchGlob, "gemini://example.com/a+b.gmi", "gemini://example.com/a+b.gmi", true},
+		{MatchGlob, "gemini://example.com/a+b.gmi", "gemini://example.com/aab.gmi", false},
+		{MatchRegex, `^gemini://example\.com/\d+$`, "gemini://example.com/42", true},
+		{MatchRegex, `^gemini://example\.com/\d+$`, "gemini://example.com/42/", false},
+		{MatchRegex, `/tags?/`, "gemini://example.com/tags/go", true},
+	}
+	for _, test := range tests {
+		rule, err := NewCrawlRule(RuleSkip, test.matchType, test.pattern, "")
+		if err != nil {
+			t.Fatalf("NewCrawlRule(%s %s): %v", test.matchType, test.pattern, err)
+		}
+		if got := rule.Matches(test.url); got != test.want {
+			t.Errorf("%s %s matching '%s': expected %v, got %v", test.matchType, test.pattern, test.url, test.want, got)
+		}
+	}
+}
+
+// The urls the crawler used to skip with its hardcoded skip maps and title overrides are still handled by the default rules
+func TestDefaultCrawlRules(t *testing.T) {
+	skipped := []string{
+		"gemini://gemini.bortzmeyer.org/",
+		"gemini://techrights.org/",
+		"gemini://gemini.techrights.org/page.gmi",
+		"gemini://selve.xyz/",
+		"gemini://kvazar.duckdns.org/",
+		"gemini://localhost/",
+		"gemini://192.168.4.26/",
+		"gemini://fumble-around.mediocregopher.com/",
+		"gemini://akewebdump.ddns.net/",
+		"gemini://illegaldrugs.net/",
+		"gemini://source.community/",
+		"gemini://singletona082.flounder.online/",
+		"gemini://godocs.io/",
+		"gemini://taz.de/",
+		"gemini://scrollprotocol.us.to/",
+
+		"gemini://eph.smol.pub/Alegreya.fontpack",
+		"gemini://tskaalgard.midnight.pub:1965/Autumn.jpg",
+		"gemini://gemini.conman.org/test/torture/",
+		"gemini://gemini.conman.org/test/torture",
+		"gemini://gemini.conman.org/test/torture/0001",
+		"gemini://gemi.dev/cgi-bin/witw.cgi/play",
+		"gemini://gemi.dev/cgi-bin",
+		"gemini://kennedy.gemi.dev/image-search",
+		"gemini://kennedy.gemi.dev/hashtags",
+		"gemini://kennedy.gemi.dev/hashtags/gemini",
+		"gemini://kennedy.gemi.dev/mentions",
+		"gemini://kennedy.gemi.dev/mentions/user",
+		"gemini://hashnix.club/cgi/radio.cgi",
+		"gemini://gemini.circumlunar.space/users/fgaz/calculator/",
+		"gemini://gemini.thegonz.net/gemsokoban",
+		"gemini://topotun.hldns.ru/music/%D0%AE%D1%80%D0%B8%D0%B9_%D0%A8%D0%B8%D0%BC%D0%B0%D0%BD%D0%BE%D0%B2%D1%81%D0%BA%D0%B8%D0%B9-%D0%9C%D0%B0%D0%B9%D0%B4%D0%B0%D0%BD.mp3",
+		"gemini://topotun.dynu.com/music/%D0%AE%D1%80%D0%B8%D0%B9_%D0%A8%D0%B8%D0%BC%D0%B0%D0%BD%D0%BE%D0%B2%D1%81%D0%BA%D0%B8%D0%B9-%D0%9C%D0%B0%D0%B9%D0%B4%D0%B0%D0%BD.mp3",
+		"gemini://asdfghasdfgh.de/media/1860-scott-au-clair-de-la-lune-05-09.ogg",
+		"gemini://gemini.ctrl-c.club/~singletona082/fiction/blue_shadows/nightwatch.gmi",
+		"gemini://singletona082.flounder.online/fiction/blue_shadows/nightwatch.gmi",
+		"gemini://source.community/invite/",
+		"spartan://gmi.noulin.net/stackoverflow/",
+		"nex://auragem.ddns.net/scrollprotocol/",
+	}
+	for _, url := range skipped {
+		if !MatchCrawlRules(url).Skip {
+			t.Errorf("'%s' should be skipped", url)
+		}
+	}
+
+	crawled := []string{
+		"gemini://diesenbacher.net/",
+		"gemini://gemini.circumlunar.space/",
+		"gemini://kennedy.gemi.dev/",
+		"gemini://hashnix.club/",
+		"gemini://gemi.dev/",
+		"spartan://gmi.noulin.net/",
+		"nex://auragem.ddns.net/",
+	}
+	for _, url := range crawled {
+		if MatchCrawlRules(url).Skip {
+			t.Errorf("'%s' should not be skipped", url)
+		}
+	}
+
+	titles := []struct {
+		url   string
+		title string
+	}{
+		{"gemini://station.martinrue.com/", "Station"},
+		{"gemini://hashnix.club/", "Hashnix Club"},
+		{"gemini://warmedal.se/~antenna-dev/", "Antenna Dev"},
+		{"gemini://station.martinrue.com/user", ""},
+		{"gemini://warmedal.se/~antenna-dev/feed.gmi", ""},
+	}
+	for _, test := range titles {
+		if title := MatchCrawlRules(test.url).Title; title != test.title {
+			t.Errorf("title of '%s': expected %q, got %q", test.url, test.title, title)
+		}
+	}
+}
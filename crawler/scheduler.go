@@ -0,0 +1,333 @@
+package crawler
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	cmap "github.com/orcaman/concurrent-map"
+)
+
+// Max slowdown (in seconds) a host can be backed off to after repeated 44 (Slow Down) responses
+var maxSlowDown float64 = 120
+
+// hostQueue holds the urls waiting to be crawled on one host
+type hostQueue struct {
+	host        string // With scheme and port and trailing slash, see GetHostname
+	urls        []string
+	nextAllowed time.Time
+	busy        bool // A worker is currently crawling a url of this host
+	heapIndex   int  // -1 when not in the ready heap
+}
+
+// hostHeap orders the hosts by when they are next allowed to be crawled
+type hostHeap []*hostQueue
+
+func (h hostHeap) Len() int           { return len(h) }
+func (h hostHeap) Less(i, j int) bool { return h[i].nextAllowed.Before(h[j].nextAllowed) }
+func (h hostHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+func (h *hostHeap) Push(x any) {
+	q := x.(*hostQueue)
+	q.heapIndex = len(*h)
+	*h = append(*h, q)
+}
+func (h *hostHeap) Pop() any {
+	old := *h
+	q := old[len(old)-1]
+	old[len(old)-1] = nil
+	q.heapIndex = -1
+	*h = old[:len(old)-1]
+	return q
+}
+
+type inFlightUrl struct {
+	host      string
+	crawlData UrlToCrawlData
+}
+
+// crawlScheduler is the crawl frontier. Urls are queued per host, and a host is only handed to a worker once its
+// crawl delay (robots.txt Crawl-Delay, defaultSlowDown, or a 44 backoff) has passed, with one worker per host at a time.
+type crawlScheduler struct {
+	mutex    sync.Mutex
+	changed  chan struct{} // Closed and replaced whenever a url is added or a host is released
+	hosts    map[string]*hostQueue
+	ready    hostHeap // Hosts that have urls queued and aren't busy
+	queued   map[string]UrlToCrawlData
+	inFlight map[string]inFlightUrl
+	stopped  bool // Next returns false right away, see Stop
+
+	// Per-host slowdown and last crawl time. Shared with sub-crawls so that they don't crawl the same host at the same time.
+	domains   cmap.ConcurrentMap // DomainInfo
+	isCrawled func(url string) bool
+}
+
+func newCrawlScheduler(domains cmap.ConcurrentMap, isCrawled func(url string) bool) *crawlScheduler {
+	return &crawlScheduler{
+		changed:   make(chan struct{}),
+		hosts:     make(map[string]*hostQueue),
+		queued:    make(map[string]UrlToCrawlData),
+		inFlight:  make(map[string]inFlightUrl),
+		domains:   domains,
+		isCrawled: isCrawled,
+	}
+}
+
+// Wakes up all workers waiting in Next. Must hold the mutex.
+func (s *crawlScheduler) signal() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Add queues a url, unless it has already been crawled. If the url is already queued, its crawl data is replaced.
+func (s *crawlScheduler) Add(url string, crawlData UrlToCrawlData) {
+	if s.isCrawled(url) {
+		return
+	}
+	host, _ := GetHostname(url)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if _, exists := s.queued[url]; exists {
+		s.queued[url] = crawlData
+		return
+	}
+	s.queued[url] = crawlData
+
+	q, exists := s.hosts[host]
+	if !exists {
+		q = &hostQueue{host: host, nextAllowed: s.nextAllowedTime(host), heapIndex: -1}
+		s.hosts[host] = q
+	}
+	q.urls = append(q.urls, url)
+	if !q.busy && q.heapIndex == -1 {
+		heap.Push(&s.ready, q)
+	}
+	s.signal()
+}
+
+// Next blocks until there is a url whose host is ready to be crawled and claims that host. Returns false once
+// nothing has been queued or in-flight for the given idle duration. Done must be called with the url once crawled.
+func (s *crawlScheduler) Next(idle time.Duration) (string, UrlToCrawlData, bool) {
+	s.mutex.Lock()
+	idleDeadline := time.Now().Add(idle)
+	for {
+		if s.stopped {
+			s.mutex.Unlock()
+			return "", UrlToCrawlData{}, false
+		}
+		now := time.Now()
+		var wait time.Duration = -1 // Negative waits until something changes
+
+		if len(s.ready) > 0 {
+			q := s.ready[0]
+
+			// Drop urls that were crawled since they were queued
+			for len(q.urls) > 0 && s.isCrawled(q.urls[0]) {
+				delete(s.queued, q.urls[0])
+				q.urls = q.urls[1:]
+			}
+			if len(q.urls) == 0 {
+				heap.Pop(&s.ready)
+				delete(s.hosts, q.host)
+				continue
+			}
+
+			if !now.Before(q.nextAllowed) {
+				if delay := s.claimHost(q.host, now); delay > 0 {
+					// Another crawl has used this host since it was queued
+					q.nextAllowed = now.Add(delay)
+					heap.Fix(&s.ready, 0)
+					continue
+				}
+
+				heap.Pop(&s.ready)
+				url := q.urls[0]
+				q.urls = q.urls[1:]
+				q.busy = true
+				crawlData := s.queued[url]
+				delete(s.queued, url)
+				s.inFlight[url] = inFlightUrl{q.host, crawlData}
+				s.mutex.Unlock()
+				return url, crawlData, true
+			}
+			wait = q.nextAllowed.Sub(now)
+		} else if len(s.queued) == 0 && len(s.inFlight) == 0 {
+			if !now.Before(idleDeadline) {
+				s.mutex.Unlock()
+				return "", UrlToCrawlData{}, false
+			}
+			wait = idleDeadline.Sub(now)
+		}
+
+		if len(s.queued) > 0 || len(s.inFlight) > 0 {
+			idleDeadline = now.Add(idle)
+		}
+
+		changed := s.changed
+		s.mutex.Unlock()
+		if wait < 0 {
+			<-changed
+		} else {
+			timer := time.NewTimer(wait)
+			select {
+			case <-changed:
+			case <-timer.C:
+			}
+			timer.Stop()
+		}
+		s.mutex.Lock()
+	}
+}
+
+// Done releases the host of a url returned by Next, so the next url of that host can be scheduled after its crawl delay.
+func (s *crawlScheduler) Done(url string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	f, exists := s.inFlight[url]
+	if !exists {
+		return
+	}
+	delete(s.inFlight, url)
+
+	// The crawl delay counts from the end of the request
+	s.domains.Upsert(f.host, nil, func(exists bool, valueInMap any, newValue any) any {
+		if !exists {
+			return DomainInfo{defaultSlowDown, time.Now().UTC()}
+		}
+		domainInfo := valueInMap.(DomainInfo)
+		domainInfo.lastCrawlTime = time.Now().UTC()
+		return domainInfo
+	})
+
+	if q, exists := s.hosts[f.host]; exists {
+		q.busy = false
+		if len(q.urls) > 0 {
+			q.nextAllowed = s.nextAllowedTime(q.host)
+			heap.Push(&s.ready, q)
+		} else {
+			delete(s.hosts, q.host)
+		}
+	}
+	s.signal()
+}
+
+// Sets the lastCrawlTime of the host if its slowdown has passed. Otherwise, returns how long until it has.
+func (s *crawlScheduler) claimHost(host string, now time.Time) time.Duration {
+	var wait time.Duration
+	s.domains.Upsert(host, nil, func(exists bool, valueInMap any, newValue any) any {
+		domainInfo := DomainInfo{defaultSlowDown, time.Time{}}
+		if exists {
+			domainInfo = valueInMap.(DomainInfo)
+		}
+		allowed := domainInfo.lastCrawlTime.Add(secondsToDuration(domainInfo.slowDown))
+		if now.Before(allowed) {
+			wait = allowed.Sub(now)
+			return domainInfo
+		}
+		domainInfo.lastCrawlTime = now.UTC()
+		return domainInfo
+	})
+	return wait
+}
+
+func (s *crawlScheduler) nextAllowedTime(host string) time.Time {
+	if r, ok := s.domains.Get(host); ok {
+		domainInfo := r.(DomainInfo)
+		return domainInfo.lastCrawlTime.Add(secondsToDuration(domainInfo.slowDown))
+	}
+	return time.Time{}
+}
+
+// SetCrawlDelay sets the slowdown of a host from its robots.txt Crawl-Delay, never going below defaultSlowDown.
+func (s *crawlScheduler) SetCrawlDelay(host string, crawlDelay time.Duration) {
+	s.domains.Upsert(host, nil, func(exists bool, valueInMap any, newValue any) any {
+		domainInfo := DomainInfo{defaultSlowDown, time.Now().UTC()}
+		if exists {
+			domainInfo = valueInMap.(DomainInfo)
+		}
+		domainInfo.slowDown = max(defaultSlowDown, crawlDelay.Seconds())
+		return domainInfo
+	})
+}
+
+// Backoff doubles the slowdown of a host (up to maxSlowDown) after a 44 (Slow Down) response. Returns the new slowdown in seconds.
+func (s *crawlScheduler) Backoff(host string) float64 {
+	var slowDown float64
+	s.domains.Upsert(host, nil, func(exists bool, valueInMap any, newValue any) any {
+		domainInfo := DomainInfo{defaultSlowDown, time.Now().UTC()}
+		if exists {
+			domainInfo = valueInMap.(DomainInfo)
+		}
+		domainInfo.slowDown = min(max(domainInfo.slowDown*2, defaultSlowDown*2), maxSlowDown)
+		domainInfo.lastCrawlTime = time.Now().UTC()
+		slowDown = domainInfo.slowDown
+		return domainInfo
+	})
+	return slowDown
+}
+
+// Len returns the number of queued urls, not including in-flight urls
+func (s *crawlScheduler) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.queued)
+}
+
+// Returns true if there are urls queued or in-flight
+func (s *crawlScheduler) Active() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.queued) > 0 || len(s.inFlight) > 0
+}
+
+func (s *crawlScheduler) Get(url string) (UrlToCrawlData, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	crawlData, exists := s.queued[url]
+	return crawlData, exists
+}
+
+// Clear removes all queued urls. In-flight urls are forgotten, so calling Done on them does nothing. A stopped scheduler hands out urls again.
+func (s *crawlScheduler) Clear() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.hosts = make(map[string]*hostQueue)
+	s.ready = nil
+	s.queued = make(map[string]UrlToCrawlData)
+	s.inFlight = make(map[string]inFlightUrl)
+	s.stopped = false
+	s.signal()
+}
+
+// Stop makes all workers waiting in Next, and any that call it later, get no url until the scheduler is cleared. Queued urls are kept.
+func (s *crawlScheduler) Stop() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stopped = true
+	s.signal()
+}
+
+// Returns the queued and in-flight urls, for checkpointing
+func (s *crawlScheduler) snapshot() []frontierUrl {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	urls := make([]frontierUrl, 0, len(s.queued)+len(s.inFlight))
+	for url, crawlData := range s.queued {
+		urls = append(urls, frontierUrl{url, crawlData.PageFromId, crawlData.PageFrom_InternalLink, crawlData.PageFrom_LinkText, crawlData.currentDepth})
+	}
+	for url, f := range s.inFlight {
+		if _, exists := s.queued[url]; exists {
+			continue
+		}
+		urls = append(urls, frontierUrl{url, f.crawlData.PageFromId, f.crawlData.PageFrom_InternalLink, f.crawlData.PageFrom_LinkText, f.crawlData.currentDepth})
+	}
+	return urls
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
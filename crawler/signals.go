@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Ranking signals of pages from the link graph, computed offline by ComputeLinkSignals into the link_signals table, which the search
+// blends with the FTS score. Only links from other capsules are counted, since a capsule's own navigation says little about a page.
+// The anchor text is the text of those links, so that a page can match the words other capsules describe it with, and the inbound
+// hosts are how many capsules link to the page, so that one capsule linking to it many times counts once.
+
+const linkSignalsIndex = "FTS_LINKSIGNAL_ID_EN"
+const maxAnchorTexts = 64            // Distinct anchor texts kept per page
+const maxAnchorTextLength = 8 * 1024 // Bytes of anchor text kept per page
+
+type linkSignal struct {
+	pageId       int64
+	inboundLinks int
+	hosts        map[int64]bool // Domain ids of the capsules that link to the page
+	anchors      []string
+	anchorLength int
+	seenAnchors  map[string]bool
+}
+
+func newLinkSignal(pageId int64) *linkSignal {
+	return &linkSignal{pageId: pageId, hosts: make(map[int64]bool), seenAnchors: make(map[string]bool)}
+}
+
+// Adds a link to the page from a capsule. Link texts that repeat (in any case), are empty, or are just the URL aren't added to
+// the anchor text.
+func (signal *linkSignal) addLink(fromDomainId int64, text string) {
+	signal.inboundLinks++
+	signal.hosts[fromDomainId] = true
+
+	text = strings.Join(strings.Fields(text), " ")
+	key := strings.ToLower(text)
+	if text == "" || strings.Contains(text, "://") || signal.seenAnchors[key] || len(signal.anchors) >= maxAnchorTexts || signal.anchorLength+len(text) > maxAnchorTextLength {
+		return
+	}
+	signal.seenAnchors[key] = true
+	signal.anchors = append(signal.anchors, text)
+	signal.anchorLength += len(text) + 1
+}
+
+func (signal *linkSignal) anchorText() string {
+	return strings.Join(signal.anchors, "\n")
+}
+
+// ComputeLinkSignals computes the link signals of every page that other capsules link to, replacing the ones computed before, and
+// then rebuilds the FTS index of their anchor text. Returns the number of pages with signals.
+func ComputeLinkSignals(conn *sql.DB) (int, error) {
+	computedAt := time.Now().UTC()
+	rows, err := conn.QueryContext(context.Background(), "SELECT L.PAGEID_TO, PF.DOMAINID, COALESCE(L.TITLE, '') FROM LINKS L JOIN PAGES PF ON PF.ID = L.PAGEID_FROM WHERE L.CROSSHOST = true ORDER BY L.PAGEID_TO")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	var signal *linkSignal
+	for rows.Next() {
+		var pageId, fromDomainId int64
+		var text string
+		if err := rows.Scan(&pageId, &fromDomainId, &text); err != nil {
+			return count, err
+		}
+		if signal != nil && signal.pageId != pageId {
+			if err := saveLinkSignal(conn, signal, computedAt); err != nil {
+				return count, err
+			}
+			count++
+			signal = nil
+		}
+		if signal == nil {
+			signal = newLinkSignal(pageId)
+		}
+		signal.addLink(fromDomainId, text)
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	if signal != nil {
+		if err := saveLinkSignal(conn, signal, computedAt); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	// Pages that no longer have links from other capsules
+	if _, err := conn.ExecContext(context.Background(), "DELETE FROM link_signals WHERE computed_at < ?", computedAt); err != nil {
+		return count, err
+	}
+	if _, err := conn.ExecContext(context.Background(), "EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX(?);", linkSignalsIndex); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+func saveLinkSignal(conn *sql.DB, signal *linkSignal, computedAt time.Time) error {
+	defer metrics.observeDBWrite("link_signal", time.Now())
+	_, err := conn.ExecContext(context.Background(), "UPDATE OR INSERT INTO link_signals (pageid, inbound_links, inbound_hosts, anchor_text, computed_at) VALUES (?, ?, ?, ?, ?) MATCHING (pageid)", signal.pageId, signal.inboundLinks, len(signal.hosts), signal.anchorText(), computedAt)
+	return err
+}
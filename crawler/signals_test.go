@@ -0,0 +1,29 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLinkSignalAddLink(t *testing.T) {
+	signal := newLinkSignal(1)
+	signal.addLink(10, "Gemini  Protocol")
+	signal.addLink(10, "gemini protocol")
+	signal.addLink(11, "")
+	signal.addLink(12, "gemini://example.org/")
+	signal.addLink(12, "The Gemini\nSpecification")
+
+	if signal.inboundLinks != 5 || len(signal.hosts) != 3 {
+		t.Errorf("expected 5 links from 3 hosts, got %d links from %d hosts", signal.inboundLinks, len(signal.hosts))
+	}
+	if anchorText := signal.anchorText(); anchorText != "Gemini Protocol\nThe Gemini Specification" {
+		t.Errorf("expected the distinct link texts, got %q", anchorText)
+	}
+
+	for i := 0; i < maxAnchorTexts*2; i++ {
+		signal.addLink(13, strings.Repeat("x", i+1))
+	}
+	if len(signal.anchors) > maxAnchorTexts || len(signal.anchorText()) > maxAnchorTextLength {
+		t.Errorf("expected the anchor text to be limited, got %d texts and %d bytes", len(signal.anchors), len(signal.anchorText()))
+	}
+}
@@ -0,0 +1,134 @@
+package crawler
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PageSink receives the domains, pages, and links of a crawl that isn't written to the search DB, see SetPageSink. The crawler's
+// other DB features (page contents, tags, feed entries, failures, redirects, and re-crawl schedules) are skipped for such crawls.
+type PageSink interface {
+	AddDomain(domain Domain) Domain // Returns the domain with its id set
+	AddPage(page Page) Page         // Returns the page with its id set. Pages that are crawled again keep their id.
+	AddLink(link Link)
+}
+
+// SetPageSink sets where the pages of a crawl without a DB connection go. By default, they are dropped.
+func (gd *GlobalData) SetPageSink(sink PageSink) {
+	gd.pageSink = sink
+}
+
+// JSONLSink writes each page and link of a crawl as a line of JSON. A page that is crawled again (after a redirect, or as a feed
+// entry) gets written again with the same id, so readers should keep the last line of each id.
+type JSONLSink struct {
+	mutex   sync.Mutex
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	err     error // The first write error
+
+	domainIds map[string]int
+	pageIds   map[string]int
+	pageUrls  map[int]string
+}
+
+type jsonlPage struct {
+	Type        string     `json:"type"` // "page"
+	Id          int        `json:"id"`
+	Url         string     `json:"url"`
+	Scheme      string     `json:"scheme"`
+	Domain      string     `json:"domain"`
+	ContentType string     `json:"contentType"`
+	Charset     string     `json:"charset,omitempty"`
+	Language    string     `json:"language,omitempty"`
+	Linecount   int        `json:"linecount"`
+	PageCount   int        `json:"pageCount,omitempty"`
+	Udc         string     `json:"udc"`
+	Title       string     `json:"title,omitempty"`
+	Prompt      string     `json:"prompt,omitempty"`
+	Headings    string     `json:"headings,omitempty"`
+	Size        int        `json:"size"`
+	Hash        string     `json:"hash"`
+	Feed        bool       `json:"feed,omitempty"`
+	PublishDate *time.Time `json:"publishDate,omitempty"`
+	Artist      string     `json:"artist,omitempty"`
+	Hidden      bool       `json:"hidden,omitempty"`
+}
+
+type jsonlLink struct {
+	Type      string `json:"type"` // "link"
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Title     string `json:"title,omitempty"`
+	CrossHost bool   `json:"crossHost"`
+}
+
+func NewJSONLSink(w io.Writer) *JSONLSink {
+	writer := bufio.NewWriter(w)
+	return &JSONLSink{writer: writer, encoder: json.NewEncoder(writer), domainIds: make(map[string]int), pageIds: make(map[string]int), pageUrls: make(map[int]string)}
+}
+
+func (sink *JSONLSink) AddDomain(domain Domain) Domain {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	key := domain.Domain + ":" + strconv.Itoa(domain.Port)
+	id, exists := sink.domainIds[key]
+	if !exists {
+		id = len(sink.domainIds) + 1
+		sink.domainIds[key] = id
+	}
+	domain.Id = id
+	return domain
+}
+
+func (sink *JSONLSink) AddPage(page Page) Page {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	id, exists := sink.pageIds[page.Url]
+	if !exists {
+		id = len(sink.pageIds) + 1
+		sink.pageIds[page.Url] = id
+		sink.pageUrls[id] = page.Url
+	}
+	page.Id = id
+
+	var publishDate *time.Time
+	if !page.PublishDate.IsZero() {
+		publishDate = &page.PublishDate
+	}
+	domain, _ := GetHostname(page.Url)
+	sink.write(jsonlPage{"page", page.Id, page.Url, page.Scheme, domain, page.Content_type, page.Charset, page.Language, page.Linecount, page.PageCount, page.Udc, page.Title, page.Prompt, page.Headings, page.Size, page.Hash, page.Feed, publishDate, page.Artist, page.Hidden})
+	return page
+}
+
+func (sink *JSONLSink) AddLink(link Link) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	from, fromExists := sink.pageUrls[link.FromPageId]
+	to, toExists := sink.pageUrls[link.ToPageId]
+	if !fromExists || !toExists {
+		return
+	}
+	sink.write(jsonlLink{"link", from, to, link.Title, link.Cross_host})
+}
+
+// Must hold the mutex
+func (sink *JSONLSink) write(record any) {
+	if sink.err != nil {
+		return
+	}
+	sink.err = sink.encoder.Encode(record)
+}
+
+// Flush writes out the buffered lines. Returns the first error from writing any of the lines.
+func (sink *JSONLSink) Flush() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	if sink.err != nil {
+		return sink.err
+	}
+	return sink.writer.Flush()
+}
@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONLSinkCrawl(t *testing.T) {
+	// No politeness delays against the local server
+	previousSlowDown := defaultSlowDown
+	defaultSlowDown = 0
+	t.Cleanup(func() { defaultSlowDown = previousSlowDown })
+
+	server := newGeminiStandIn(t, map[string]string{
+		"/":      "# Root\n=> /a.gmi Page A\n=> /missing.gmi Missing\n",
+		"/a.gmi": "# A\nSome text on page A.\n=> / Back\n",
+	})
+
+	var output bytes.Buffer
+	sink := NewJSONLSink(&output)
+	gd := NewGlobalData(nil, false, true, 0)
+	gd.SetPageSink(sink)
+	gd.AddUrl(server.url("/"), UrlToCrawlData{})
+	job := newCrawlJob("test", gd)
+	job.run(0, 2, 1)
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := make(map[string]jsonlPage)
+	links := make(map[string]jsonlLink)
+	for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+		var record struct{ Type string }
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("bad line %q: %v", line, err)
+		}
+		switch record.Type {
+		case "page":
+			var page jsonlPage
+			json.Unmarshal([]byte(line), &page)
+			pages[page.Url] = page
+		case "link":
+			var link jsonlLink
+			json.Unmarshal([]byte(line), &link)
+			links[link.From+" -> "+link.To] = link
+		default:
+			t.Fatalf("unknown record type in %q", line)
+		}
+	}
+
+	if len(pages) != 2 {
+		t.Fatalf("expected the 2 pages that exist, got %v", pages)
+	}
+	if page := pages[server.url("/a.gmi")]; page.Title != "A" || page.ContentType != "text/gemini" || page.Id == 0 {
+		t.Fatalf("page A not written correctly: %+v", page)
+	}
+	link, exists := links[server.url("/")+" -> "+server.url("/a.gmi")]
+	if !exists || link.Title != "Page A" || link.CrossHost {
+		t.Fatalf("link from the root to page A not written correctly: %v", links)
+	}
+	if progress := job.Progress(); progress.State != CrawlJobDone || progress.Failures[51] != 1 {
+		t.Fatalf("expected a done job with the missing page failed, got %+v", progress)
+	}
+}
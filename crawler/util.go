@@ -39,28 +39,14 @@ func filter(ss []string, test func(string) bool) (ret []string) {
 	return
 }
 
-func isTimeDate(s string) bool {
-	name := strings.TrimSpace(s)
-	parts := strings.Fields(name)
-	if len(parts) == 0 {
-		return false
-	}
-
-	_, timeParseErr := time.Parse(ISO8601Layout, parts[0])
-	if timeParseErr == nil {
-		return true
-	}
-	_, timeParseErr = time.Parse(time.RFC3339, parts[0])
-	if timeParseErr == nil {
-		return true
-	}
-	_, timeParseErr = time.Parse("2006-01-02", parts[0])
-	return timeParseErr == nil
-	/*if timeParseErr == nil {
-		return true
+// Whether the string is only made of digits, like issue numbers (#123), which aren't useful as tags
+func isNumber(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
 	}
-
-	return false*/
+	return s != ""
 }
 
 // NOTE: Must be utf-8 string
@@ -170,6 +156,27 @@ func GetMentionsFromText(s string) []string {
 	})
 }
 
+// Adds the hashtags and mentions of the text to the maps, if they're not nil. Each occurrence of a tag adds the weight to its rank,
+// so tags in headings, or that are repeated throughout a page, rank higher.
+func addTagsAndMentions(text string, weight float64, tagsMap *map[string]float64, mentionsMap *map[string]bool) {
+	if tagsMap != nil {
+		for _, tag := range GetTagsFromText(text) {
+			tag = strings.TrimRight(strings.TrimLeft(tag, "#"), "*+-=_:'")
+			if tag != "" {
+				(*tagsMap)[tag] += weight
+			}
+		}
+	}
+	if mentionsMap != nil {
+		for _, mention := range GetMentionsFromText(text) {
+			mention = strings.TrimRight(mention, "*+-=_:")
+			if mention != "@" && mention != "~" {
+				(*mentionsMap)[mention] = true
+			}
+		}
+	}
+}
+
 // If the string contains any runes of the unicode L (Letter) category, excluding spaces
 func ContainsLetterRunes(s string) bool {
 	for _, r := range s {
@@ -0,0 +1,129 @@
+package crawler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"time"
+)
+
+// XMP metadata, as the values of each property keyed by the property's prefixed name (like "dc:title"). Language alternatives, bags,
+// and sequences give one value per item.
+type xmpMetadata map[string][]string
+
+// Prefixes of the XMP namespaces, which documents can bind to any prefix
+var xmpNamespacePrefixes = map[string]string{
+	"http://purl.org/dc/elements/1.1/":            "dc",
+	"http://ns.adobe.com/xap/1.0/":                "xmp",
+	"http://ns.adobe.com/xap/1.0/rights/":         "xmpRights",
+	"http://ns.adobe.com/pdf/1.3/":                "pdf",
+	"http://ns.adobe.com/photoshop/1.0/":          "photoshop",
+	"http://iptc.org/std/Iptc4xmpCore/1.0/xmlns/": "Iptc4xmpCore",
+	"http://iptc.org/std/Iptc4xmpExt/2008-02-29/": "Iptc4xmpExt",
+	"http://ns.adobe.com/exif/1.0/":               "exif",
+	"http://ns.adobe.com/tiff/1.0/":               "tiff",
+}
+
+const rdfNamespace = "http://www.w3.org/1999/02/22-rdf-syntax-ns#"
+
+// Layouts of XMP dates, which are ISO 8601 with everything after the year optional
+var xmpDateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04Z07:00", "2006-01-02T15:04", "2006-01-02", "2006-01", "2006"}
+
+// Finds the XMP packet in data, which is often embedded in other formats, and parses its properties
+func parseXMP(data []byte) xmpMetadata {
+	metadata := make(xmpMetadata)
+	start := bytes.Index(data, []byte("<x:xmpmeta"))
+	if start == -1 {
+		start = bytes.Index(data, []byte("<rdf:RDF"))
+	}
+	if start == -1 {
+		return metadata
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(data[start:]))
+	decoder.Strict = false
+	property := "" // The property whose value is being read, with any rdf:Alt, rdf:Bag, or rdf:Seq in between
+	depth := 0
+	propertyDepth := 0
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return metadata
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+			if token.Name.Space == rdfNamespace && token.Name.Local == "Description" {
+				// Simple properties can be attributes of the description
+				for _, attr := range token.Attr {
+					if name := xmpPropertyName(attr.Name); name != "" {
+						metadata[name] = append(metadata[name], strings.TrimSpace(attr.Value))
+					}
+				}
+			} else if property == "" {
+				if name := xmpPropertyName(token.Name); name != "" {
+					property = name
+					propertyDepth = depth
+					text.Reset()
+				}
+			} else if token.Name.Space == rdfNamespace && token.Name.Local == "li" {
+				text.Reset()
+			}
+		case xml.CharData:
+			if property != "" {
+				text.Write(token)
+			}
+		case xml.EndElement:
+			if property != "" && ((token.Name.Space == rdfNamespace && token.Name.Local == "li") || depth == propertyDepth) {
+				if value := strings.TrimSpace(text.String()); value != "" {
+					metadata[property] = append(metadata[property], value)
+				}
+				text.Reset()
+			}
+			if depth == propertyDepth {
+				property = ""
+			}
+			depth--
+		}
+	}
+}
+
+func xmpPropertyName(name xml.Name) string {
+	if name.Space == rdfNamespace || name.Space == "xmlns" || name.Space == "http://www.w3.org/XML/1998/namespace" || name.Space == "" || name.Space == "adobe:ns:meta/" {
+		return ""
+	}
+	prefix, ok := xmpNamespacePrefixes[name.Space]
+	if !ok {
+		prefix = name.Space
+	}
+	return prefix + ":" + name.Local
+}
+
+// The first value of the property, or an empty string
+func (metadata xmpMetadata) first(property string) string {
+	if values := metadata[property]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// Fills in the metadata the document doesn't have already from its XMP metadata
+func (doc *Document) addXMPMetadata(metadata xmpMetadata) {
+	if doc.Title == "" {
+		doc.Title = metadata.first("dc:title")
+	}
+	if doc.Author == "" {
+		doc.Author = strings.Join(metadata["dc:creator"], ", ")
+	}
+	if doc.Language == "" {
+		doc.Language = metadata.first("dc:language")
+	}
+	if doc.PublishDate.IsZero() {
+		doc.PublishDate = parseFeedDate(metadata.first("xmp:CreateDate"), xmpDateLayouts)
+	}
+	if doc.ModificationDate.IsZero() {
+		doc.ModificationDate = parseFeedDate(metadata.first("xmp:ModifyDate"), xmpDateLayouts)
+	}
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchCrawlRulesTable{})
+}
+
+type SearchCrawlRulesTable struct{}
+
+func (m SearchCrawlRulesTable) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC))
+}
+
+func (m SearchCrawlRulesTable) Name() string {
+	return "SearchCrawlRulesTable"
+}
+
+func (m SearchCrawlRulesTable) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchCrawlRulesTable) Description() string {
+	return "Search Engine crawl rules (skip, no-follow, no-index, override-title, max-depth) that are reloaded while the crawler runs"
+}
+
+func (m SearchCrawlRulesTable) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE crawl_rules (
+		id bigint generated by default as identity primary key,
+		action character varying(50) NOT NULL,
+		matchtype character varying(50) NOT NULL,
+		pattern character varying(1020) NOT NULL COLLATE UNICODE_CI,
+		rulevalue character varying(250) DEFAULT '' NOT NULL COLLATE UNICODE_CI,
+		date_added timestamp with time zone NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchCrawlRulesTable) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
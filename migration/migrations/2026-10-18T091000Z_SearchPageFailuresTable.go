@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchPageFailuresTable{})
+}
+
+type SearchPageFailuresTable struct{}
+
+func (m SearchPageFailuresTable) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 9, 10, 0, 0, time.UTC))
+}
+
+func (m SearchPageFailuresTable) Name() string {
+	return "SearchPageFailuresTable"
+}
+
+func (m SearchPageFailuresTable) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchPageFailuresTable) Description() string {
+	return "Search Engine failure history of pages, used to retry temporary failures and only hide pages that keep failing across crawls"
+}
+
+func (m SearchPageFailuresTable) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE page_failures (
+		id bigint generated by default as identity primary key,
+		url character varying(1020) NOT NULL COLLATE UNICODE_CI,
+		domain character varying(1020) NOT NULL COLLATE UNICODE_CI,
+		status integer NOT NULL,
+		meta character varying(1024) DEFAULT '' NOT NULL COLLATE UNICODE_CI,
+		permanent boolean NOT NULL,
+		consecutive_failures integer NOT NULL,
+		permanent_failures integer DEFAULT 0 NOT NULL,
+		total_failures integer NOT NULL,
+		first_failure timestamp with time zone NOT NULL,
+		last_failure timestamp with time zone NOT NULL,
+		last_success timestamp with time zone
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context.Background(), `CREATE UNIQUE INDEX IDX_PAGE_FAILURES_URL ON page_failures (url);`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchPageFailuresTable) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
@@ -0,0 +1,56 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchRedirectsTable{})
+}
+
+type SearchRedirectsTable struct{}
+
+func (m SearchRedirectsTable) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 9, 20, 0, 0, time.UTC))
+}
+
+func (m SearchRedirectsTable) Name() string {
+	return "SearchRedirectsTable"
+}
+
+func (m SearchRedirectsTable) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchRedirectsTable) Description() string {
+	return "Search Engine permanent redirects, used to rewrite links to their final target and merge the old page into the new one"
+}
+
+func (m SearchRedirectsTable) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE redirects (
+		id bigint generated by default as identity primary key,
+		url_from character varying(1020) NOT NULL COLLATE UNICODE_CI,
+		url_to character varying(1020) NOT NULL COLLATE UNICODE_CI,
+		merged boolean DEFAULT false NOT NULL,
+		crawlIndex integer NOT NULL,
+		date_added timestamp with time zone NOT NULL,
+		last_seen timestamp with time zone NOT NULL,
+		CONSTRAINT UQ_REDIRECTS_URL_FROM UNIQUE (url_from) USING INDEX IDX_REDIRECTS_URL_FROM
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchRedirectsTable) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
@@ -0,0 +1,78 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchPageHistoryTables{})
+}
+
+type SearchPageHistoryTables struct{}
+
+func (m SearchPageHistoryTables) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 9, 30, 0, 0, time.UTC))
+}
+
+func (m SearchPageHistoryTables) Name() string {
+	return "SearchPageHistoryTables"
+}
+
+func (m SearchPageHistoryTables) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchPageHistoryTables) Description() string {
+	return "Search Engine content hash history of pages (with the version of the parsers that last parsed them), and the adaptive re-crawl schedule computed from it (change_interval is in hours)"
+}
+
+func (m SearchPageHistoryTables) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE page_hashes (
+		id bigint generated by default as identity primary key,
+		url character varying(1020) NOT NULL COLLATE UNICODE_CI,
+		hash character varying(250) NOT NULL,
+		parser_version integer DEFAULT 0 NOT NULL,
+		first_seen timestamp with time zone NOT NULL,
+		last_seen timestamp with time zone NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context.Background(), `
+	CREATE TABLE page_recrawl (
+		id bigint generated by default as identity primary key,
+		url character varying(1020) NOT NULL COLLATE UNICODE_CI,
+		versions integer NOT NULL,
+		change_interval double precision NOT NULL,
+		next_crawl timestamp with time zone NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	// page_hashes keeps every version of a page, so its url isn't unique
+	_, err = tx.ExecContext(context.Background(), `CREATE INDEX IDX_PAGE_HASHES_URL ON page_hashes (url, last_seen);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context.Background(), `CREATE UNIQUE INDEX IDX_PAGE_RECRAWL_URL ON page_recrawl (url);`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchPageHistoryTables) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
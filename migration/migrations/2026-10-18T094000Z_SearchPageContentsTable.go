@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchPageContentsTable{})
+}
+
+type SearchPageContentsTable struct{}
+
+func (m SearchPageContentsTable) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 9, 40, 0, 0, time.UTC))
+}
+
+func (m SearchPageContentsTable) Name() string {
+	return "SearchPageContentsTable"
+}
+
+func (m SearchPageContentsTable) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchPageContentsTable) Description() string {
+	return "Search Engine stripped body text and preformatted text of pages, indexed by FTS_PAGECONTENT_ID_EN"
+}
+
+func (m SearchPageContentsTable) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE page_contents (
+		id bigint generated by default as identity primary key,
+		pageid bigint NOT NULL UNIQUE references pages,
+		content BLOB SUB_TYPE TEXT CHARACTER SET UTF8 COLLATE UNICODE_CI,
+		preformatted BLOB SUB_TYPE TEXT CHARACTER SET UTF8 COLLATE UNICODE_CI,
+		date_added timestamp with time zone NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchPageContentsTable) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
@@ -0,0 +1,77 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchTagsAndMentionsTables{})
+}
+
+type SearchTagsAndMentionsTables struct{}
+
+func (m SearchTagsAndMentionsTables) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 9, 50, 0, 0, time.UTC))
+}
+
+func (m SearchTagsAndMentionsTables) Name() string {
+	return "SearchTagsAndMentionsTables"
+}
+
+func (m SearchTagsAndMentionsTables) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchTagsAndMentionsTables) Description() string {
+	return "Search Engine hashtags (with their rank on the page) and mentions extracted from pages. The tags table of the initial migration was commented out, so it is created here."
+}
+
+func (m SearchTagsAndMentionsTables) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE tags (
+		id bigint generated by default as identity primary key,
+		pageid bigint references pages,
+		name character varying(250) NOT NULL COLLATE UNICODE_CI,
+		rank float,
+		crawlIndex integer,
+		date_added timestamp with time zone NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context.Background(), `
+	CREATE TABLE mentions (
+		id bigint generated by default as identity primary key,
+		pageid bigint references pages,
+		name character varying(250) NOT NULL COLLATE UNICODE_CI,
+		crawlIndex integer,
+		date_added timestamp with time zone NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context.Background(), `CREATE INDEX IDX_TAGS_NAME ON tags (name);`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context.Background(), `CREATE INDEX IDX_MENTIONS_NAME ON mentions (name);`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchTagsAndMentionsTables) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
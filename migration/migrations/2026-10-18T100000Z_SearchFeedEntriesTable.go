@@ -0,0 +1,62 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchFeedEntriesTable{})
+}
+
+type SearchFeedEntriesTable struct{}
+
+func (m SearchFeedEntriesTable) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC))
+}
+
+func (m SearchFeedEntriesTable) Name() string {
+	return "SearchFeedEntriesTable"
+}
+
+func (m SearchFeedEntriesTable) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchFeedEntriesTable) Description() string {
+	return "Search Engine entries of Atom, RSS, gemsub, and twtxt feeds, with the publication dates and authors the feeds give them."
+}
+
+func (m SearchFeedEntriesTable) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE feed_entries (
+		id bigint generated by default as identity primary key,
+		feedid bigint NOT NULL references pages,
+		url character varying(1020) NOT NULL COLLATE UNICODE_CI,
+		title character varying(1020) COLLATE UNICODE_CI,
+		author character varying(250) COLLATE UNICODE_CI,
+		published timestamp with time zone,
+		updated timestamp with time zone,
+		crawlIndex integer,
+		date_added timestamp with time zone NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context.Background(), `CREATE INDEX IDX_FEED_ENTRIES_URL ON feed_entries (url);`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchFeedEntriesTable) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
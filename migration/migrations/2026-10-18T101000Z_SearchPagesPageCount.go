@@ -0,0 +1,45 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchPagesPageCount{})
+}
+
+type SearchPagesPageCount struct{}
+
+func (m SearchPagesPageCount) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 10, 10, 0, 0, time.UTC))
+}
+
+func (m SearchPagesPageCount) Name() string {
+	return "SearchPagesPageCount"
+}
+
+func (m SearchPagesPageCount) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchPagesPageCount) Description() string {
+	return "Search Engine page counts of PDF, EPUB, and DjVu documents, whose metadata and text are now extracted while crawling."
+}
+
+func (m SearchPagesPageCount) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `ALTER TABLE pages ADD pagecount integer DEFAULT 0;`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchPagesPageCount) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
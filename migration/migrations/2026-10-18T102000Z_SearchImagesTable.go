@@ -0,0 +1,65 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchImagesTable{})
+}
+
+type SearchImagesTable struct{}
+
+func (m SearchImagesTable) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 10, 20, 0, 0, time.UTC))
+}
+
+func (m SearchImagesTable) Name() string {
+	return "SearchImagesTable"
+}
+
+func (m SearchImagesTable) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchImagesTable) Description() string {
+	return "Search Engine metadata of image files from their EXIF, XMP, and IPTC metadata, with the alt text of the links to them, indexed by FTS_IMAGE_ID_EN"
+}
+
+func (m SearchImagesTable) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE images (
+		id bigint generated by default as identity primary key,
+		pageid bigint NOT NULL UNIQUE references pages,
+		width integer DEFAULT 0,
+		height integer DEFAULT 0,
+		cameramake character varying(250) COLLATE UNICODE_CI,
+		cameramodel character varying(250) COLLATE UNICODE_CI,
+		capturedate timestamp with time zone,
+		title character varying(1020) COLLATE UNICODE_CI,
+		description BLOB SUB_TYPE TEXT CHARACTER SET UTF8 COLLATE UNICODE_CI,
+		alttext character varying(1020) COLLATE UNICODE_CI,
+		crawlIndex integer,
+		date_added timestamp with time zone NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context.Background(), `CREATE INDEX IDX_IMAGES_CAPTUREDATE ON images (capturedate);`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchImagesTable) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
@@ -0,0 +1,66 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchCertsTable{})
+}
+
+type SearchCertsTable struct{}
+
+func (m SearchCertsTable) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 10, 30, 0, 0, time.UTC))
+}
+
+func (m SearchCertsTable) Name() string {
+	return "SearchCertsTable"
+}
+
+func (m SearchCertsTable) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchCertsTable) Description() string {
+	return "Search Engine history of the TLS certificates capsules were seen with, so that TOFU pins can be checked against what the crawler observed"
+}
+
+func (m SearchCertsTable) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE certs (
+		id bigint generated by default as identity primary key,
+		domain character varying(255) NOT NULL COLLATE UNICODE_CI,
+		port integer NOT NULL,
+		fingerprint character(64) NOT NULL,
+		subject character varying(1020) DEFAULT '' NOT NULL,
+		issuer character varying(1020) DEFAULT '' NOT NULL,
+		not_before timestamp with time zone NOT NULL,
+		not_after timestamp with time zone NOT NULL,
+		previous_fingerprint character(64),
+		first_seen timestamp with time zone NOT NULL,
+		last_seen timestamp with time zone NOT NULL,
+		crawlIndex integer,
+		UNIQUE (domain, port, fingerprint)
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(context.Background(), `CREATE INDEX IDX_CERTS_FIRST_SEEN ON certs (first_seen);`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchCertsTable) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchLinkSignalsTable{})
+}
+
+type SearchLinkSignalsTable struct{}
+
+func (m SearchLinkSignalsTable) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 10, 40, 0, 0, time.UTC))
+}
+
+func (m SearchLinkSignalsTable) Name() string {
+	return "SearchLinkSignalsTable"
+}
+
+func (m SearchLinkSignalsTable) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchLinkSignalsTable) Description() string {
+	return "Search Engine ranking signals of pages computed from the links to them from other capsules, with their anchor text indexed by FTS_LINKSIGNAL_ID_EN"
+}
+
+func (m SearchLinkSignalsTable) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE link_signals (
+		id bigint generated by default as identity primary key,
+		pageid bigint NOT NULL UNIQUE references pages,
+		inbound_links integer NOT NULL,
+		inbound_hosts integer NOT NULL,
+		anchor_text BLOB SUB_TYPE TEXT CHARACTER SET UTF8 COLLATE UNICODE_CI,
+		computed_at timestamp with time zone NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchLinkSignalsTable) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
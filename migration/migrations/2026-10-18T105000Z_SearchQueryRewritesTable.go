@@ -0,0 +1,53 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/db"
+	"gitlab.com/clseibold/auragem_sis/migration/types"
+)
+
+func init() {
+	registerMigration(SearchQueryRewritesTable{})
+}
+
+type SearchQueryRewritesTable struct{}
+
+func (m SearchQueryRewritesTable) Version() types.MigrationVersion {
+	return types.MigrationVersion(time.Date(2026, 10, 18, 10, 50, 0, 0, time.UTC))
+}
+
+func (m SearchQueryRewritesTable) Name() string {
+	return "SearchQueryRewritesTable"
+}
+
+func (m SearchQueryRewritesTable) DB() db.DBType {
+	return db.SearchDB
+}
+
+func (m SearchQueryRewritesTable) Description() string {
+	return "Search Engine query rewrite rules (phrase, synonym, boost, bang) that are applied to search queries before they're searched"
+}
+
+func (m SearchQueryRewritesTable) Up(tx *sql.Tx) error {
+	_, err := tx.ExecContext(context.Background(), `
+	CREATE TABLE query_rewrites (
+		id bigint generated by default as identity primary key,
+		ruletype character varying(50) NOT NULL,
+		pattern character varying(250) NOT NULL COLLATE UNICODE_CI,
+		rulevalue character varying(1020) DEFAULT '' NOT NULL,
+		date_added timestamp with time zone NOT NULL
+	);
+	`)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m SearchQueryRewritesTable) Down(tx *sql.Tx) error {
+	panic("Implement me")
+}
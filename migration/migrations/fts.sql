@@ -40,6 +40,132 @@ COMMIT;
 EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGE_ID_RU');
 COMMIT;
 
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGE_ID_DE', 'PAGES', 'GERMAN');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'TITLE', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'PROMPT', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'ALBUM', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'ALBUMARTIST', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'ARTIST', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'COMPOSER', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'COPYRIGHT', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'URL', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'PUBLISHDATE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'HEADINGS', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'HIDDEN', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'CONTENTTYPE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'SCHEME', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'LANGUAGE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_DE', 'FEED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGE_ID_DE');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGE_ID_FR', 'PAGES', 'FRENCH');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'TITLE', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'PROMPT', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'ALBUM', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'ALBUMARTIST', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'ARTIST', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'COMPOSER', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'COPYRIGHT', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'URL', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'PUBLISHDATE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'HEADINGS', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'HIDDEN', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'CONTENTTYPE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'SCHEME', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'LANGUAGE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_FR', 'FEED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGE_ID_FR');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGE_ID_ES', 'PAGES', 'SPANISH');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'TITLE', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'PROMPT', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'ALBUM', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'ALBUMARTIST', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'ARTIST', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'COMPOSER', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'COPYRIGHT', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'URL', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'PUBLISHDATE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'HEADINGS', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'HIDDEN', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'CONTENTTYPE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'SCHEME', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'LANGUAGE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_ES', 'FEED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGE_ID_ES');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGE_ID_IT', 'PAGES', 'ITALIAN');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'TITLE', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'PROMPT', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'ALBUM', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'ALBUMARTIST', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'ARTIST', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'COMPOSER', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'COPYRIGHT', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'URL', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'PUBLISHDATE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'HEADINGS', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'HIDDEN', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'CONTENTTYPE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'SCHEME', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'LANGUAGE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_IT', 'FEED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGE_ID_IT');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGE_ID_PT', 'PAGES', 'PORTUGUESE');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'TITLE', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'PROMPT', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'ALBUM', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'ALBUMARTIST', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'ARTIST', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'COMPOSER', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'COPYRIGHT', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'URL', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'PUBLISHDATE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'HEADINGS', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'HIDDEN', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'CONTENTTYPE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'SCHEME', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'LANGUAGE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_PT', 'FEED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGE_ID_PT');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGE_ID_NL', 'PAGES', 'DUTCH');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'TITLE', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'PROMPT', 5);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'ALBUM', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'ALBUMARTIST', 4);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'ARTIST', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'COMPOSER', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'COPYRIGHT', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'URL', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'PUBLISHDATE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'HEADINGS', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'HIDDEN', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'CONTENTTYPE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'SCHEME', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'LANGUAGE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGE_ID_NL', 'FEED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGE_ID_NL');
+COMMIT;
+
 EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_AUDIOTRANSCRIPT_ID_EN', 'AUDIOTRANSCRIPTS', 'ENGLISH');
 COMMIT;
 EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_AUDIOTRANSCRIPT_ID_EN', 'TEXT', 1);
@@ -47,6 +173,70 @@ COMMIT;
 EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_AUDIOTRANSCRIPT_ID_EN');
 COMMIT;
 
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGECONTENT_ID_EN', 'PAGE_CONTENTS', 'ENGLISH');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_EN', 'CONTENT', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_EN', 'PREFORMATTED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGECONTENT_ID_EN');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGECONTENT_ID_RU', 'PAGE_CONTENTS', 'RUSSIAN');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_RU', 'CONTENT', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_RU', 'PREFORMATTED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGECONTENT_ID_RU');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGECONTENT_ID_DE', 'PAGE_CONTENTS', 'GERMAN');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_DE', 'CONTENT', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_DE', 'PREFORMATTED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGECONTENT_ID_DE');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGECONTENT_ID_FR', 'PAGE_CONTENTS', 'FRENCH');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_FR', 'CONTENT', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_FR', 'PREFORMATTED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGECONTENT_ID_FR');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGECONTENT_ID_ES', 'PAGE_CONTENTS', 'SPANISH');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_ES', 'CONTENT', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_ES', 'PREFORMATTED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGECONTENT_ID_ES');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGECONTENT_ID_IT', 'PAGE_CONTENTS', 'ITALIAN');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_IT', 'CONTENT', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_IT', 'PREFORMATTED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGECONTENT_ID_IT');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGECONTENT_ID_PT', 'PAGE_CONTENTS', 'PORTUGUESE');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_PT', 'CONTENT', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_PT', 'PREFORMATTED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGECONTENT_ID_PT');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_PAGECONTENT_ID_NL', 'PAGE_CONTENTS', 'DUTCH');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_NL', 'CONTENT', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_PAGECONTENT_ID_NL', 'PREFORMATTED', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_PAGECONTENT_ID_NL');
+COMMIT;
+
 EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_DOMAIN_ID_EN', 'DOMAINS', 'ENGLISH');
 COMMIT;
 EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_DOMAIN_ID_EN', 'DOMAIN', 2);
@@ -63,3 +253,21 @@ EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_DOMAIN_ID', 'TITLE', 2
 COMMIT;
 EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_DOMAIN_ID');
 COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_IMAGE_ID_EN', 'IMAGES', 'ENGLISH');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_IMAGE_ID_EN', 'TITLE', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_IMAGE_ID_EN', 'ALTTEXT', 3);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_IMAGE_ID_EN', 'DESCRIPTION', 2);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_IMAGE_ID_EN', 'CAMERAMAKE', 1);
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_IMAGE_ID_EN', 'CAMERAMODEL', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_IMAGE_ID_EN');
+COMMIT;
+
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$CREATE_INDEX('FTS_LINKSIGNAL_ID_EN', 'LINK_SIGNALS', 'ENGLISH');
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$ADD_INDEX_FIELD('FTS_LINKSIGNAL_ID_EN', 'ANCHOR_TEXT', 1);
+COMMIT;
+EXECUTE PROCEDURE FTS$MANAGEMENT.FTS$REBUILD_INDEX('FTS_LINKSIGNAL_ID_EN');
+COMMIT;
@@ -3,13 +3,19 @@ package main
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
 	"runtime"
 	"runtime/pprof"
+	"slices"
+	"syscall"
 
 	"github.com/spf13/cobra"
+	"gitlab.com/clseibold/auragem_sis/config"
+	"gitlab.com/clseibold/auragem_sis/crawler"
 	"gitlab.com/clseibold/auragem_sis/migration"
 	_ "gitlab.com/clseibold/auragem_sis/migration"
 	"gitlab.com/clseibold/auragem_sis/server/ask"
@@ -36,6 +42,7 @@ var Command = &cobra.Command{
 
 func init() {
 	migration.InitMigrationCommands(Command)
+	crawler.InitCrawlCommands(Command)
 }
 
 func main() {
@@ -114,9 +121,22 @@ func RunServer(cmd *cobra.Command, args []string) {
 	setupScrollProtocol(context)
 	setupNewsfin(context)
 
+	go handleShutdown(context)
 	context.Start()
 }
 
+// Saves the crawler frontiers before shutting down so that interrupted crawls can be resumed. SIS is shut down rather than exiting
+// here, so that Start returns and main's deferred calls (like stopping the CPU profile) run.
+func handleShutdown(context *sis.SISContext) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	signal.Stop(signals)
+	fmt.Printf("Shutting down. Saving crawler checkpoints.\n")
+	crawler.SaveCheckpoints()
+	context.ShutdownSIS()
+}
+
 var OnionId string = ""
 
 func setupTor() {
@@ -166,6 +186,16 @@ func setupWebServer(aurarepoContext *aurarepo.AuraRepoContext, bintreeContext *a
 	bintreeContext.AttachHTTPSmart(bintreeMuxer)
 	httpMuxer.Handle("/~bintree/", http.StripPrefix("/~bintree", bintreeMuxer))
 
+	// Crawler metrics for Prometheus. Not public, since they list the hosts being crawled.
+	httpMuxer.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		if !slices.Contains(config.MetricsAllowedAddresses, host) {
+			http.NotFound(w, r)
+			return
+		}
+		crawler.ServeMetrics(w, r)
+	})
+
 	go func() {
 		err := http.ListenAndServe("0.0.0.0:80", httpMuxer)
 		if err != nil {
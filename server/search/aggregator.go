@@ -9,26 +9,46 @@ import (
 	"strings"
 	"time"
 
+	"gitlab.com/clseibold/auragem_sis/crawler"
 	"golang.org/x/text/language"
 )
 
-// Aggregator tool queries the database to construct pages for the aggregator.
+// Aggregator tool queries the database to construct pages for the aggregator. English posts are put in destRoot, and the posts of
+// the other search languages in the directory of destRoot named by their language code.
 func Aggregate(destRoot string, conn *sql.DB) {
-	page := 1
-	for {
-		hasNext := getPage(destRoot, page, conn)
-		if !hasNext {
-			break
+	for _, language := range crawler.SearchLanguages {
+		root := destRoot
+		if language != crawler.SearchLanguages[0] {
+			root = filepath.Join(destRoot, language.Code)
+			if err := os.MkdirAll(root, 0700); err != nil {
+				panic(err)
+			}
+		}
+
+		page := 1
+		for {
+			hasNext := getPage(root, page, conn, language)
+			if !hasNext {
+				break
+			}
+			page++
 		}
-		page++
 	}
 }
 
-func getPage(root string, page int, conn *sql.DB) bool {
+// The url of the aggregator's posts of the language
+func aggregatorUrl(language crawler.SearchLanguage) string {
+	if language == crawler.SearchLanguages[0] {
+		return "/search/yearposts/"
+	}
+	return "/search/yearposts/" + language.Code + "/"
+}
+
+func getPage(root string, page int, conn *sql.DB, language crawler.SearchLanguage) bool {
 	results := 40
 	skip := (page - 1) * results
 
-	pages, totalResultsCount := _getPagesWithPublishDateFromLastYear(conn, results, skip)
+	pages, totalResultsCount := _getPagesWithPublishDateFromLastYear(conn, results, skip, language.Code)
 
 	resultsStart := skip + 1
 	resultsEnd := Min(totalResultsCount, skip+results) // + 1 - 1
@@ -38,28 +58,38 @@ func getPage(root string, page int, conn *sql.DB) bool {
 	var builder strings.Builder
 	_buildPageResults(&builder, pages, false, false)
 
+	url := aggregatorUrl(language)
 	if hasPrevPage {
 		if page-1 <= 1 {
-			fmt.Fprintf(&builder, "\n=> /search/yearposts/ Previous Page\n")
+			fmt.Fprintf(&builder, "\n=> %s Previous Page\n", url)
 		} else {
-			fmt.Fprintf(&builder, "\n=> /search/yearposts/%d.gmi Previous Page\n", page-1)
+			fmt.Fprintf(&builder, "\n=> %s%d.gmi Previous Page\n", url, page-1)
 		}
 	}
 	if hasNextPage && !hasPrevPage {
-		fmt.Fprintf(&builder, "\n=> /search/yearposts/%d.gmi Next Page\n", page+1)
+		fmt.Fprintf(&builder, "\n=> %s%d.gmi Next Page\n", url, page+1)
 	} else if hasNextPage && hasPrevPage {
-		fmt.Fprintf(&builder, "=> /search/yearposts/%d.gmi Next Page\n", page+1)
+		fmt.Fprintf(&builder, "=> %s%d.gmi Next Page\n", url, page+1)
+	}
+
+	// Links to the posts of the other languages
+	var languagesBuilder strings.Builder
+	for _, other := range crawler.SearchLanguages {
+		if other != language {
+			fmt.Fprintf(&languagesBuilder, "=> %s %s\n", aggregatorUrl(other), other.Name)
+		}
 	}
 
-	doc := fmt.Sprintf(`# Recent Publications
+	doc := fmt.Sprintf(`# Recent Publications (%s)
 
 => /search/ Home
 => /search/s/ Search
 
-Note: Currently lists only English posts.
-
+## Other Languages
+%s
+## Posts
 %s
-`, builder.String())
+`, language.Name, languagesBuilder.String(), builder.String())
 
 	filename := filepath.Join(root, "index.gmi")
 	if page > 1 {
@@ -73,11 +103,11 @@ Note: Currently lists only English posts.
 	return hasNextPage
 }
 
-// TODO: Allow for different languages
 // NOTE: Blank language fields are considered English
-func _getPagesWithPublishDateFromLastYear(conn *sql.DB, results int, skip int) ([]Page, int) {
-	query := fmt.Sprintf("SELECT FIRST %d SKIP %d COUNT(*) OVER () totalCount, id, url, scheme, domainid, contenttype, charset, language, linecount, title, prompt, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlindex, date_added, last_successful_visit, hidden FROM pages WHERE publishdate > dateadd(-1 year to ?) AND publishdate < dateadd(2 day to ?) AND (language = '' OR language LIKE 'en%%' OR language LIKE 'EN%%' OR language LIKE 'eng%%' OR language LIKE 'ENG%%') AND has_duplicate_on_gemini=false AND hidden = false AND domainid <> 9 ORDER BY publishdate DESC", results, skip)
-	rows, rows_err := conn.QueryContext(context.Background(), query, time.Now().UTC(), time.Now().UTC())
+func _getPagesWithPublishDateFromLastYear(conn *sql.DB, results int, skip int, languageCode string) ([]Page, int) {
+	condition, languageArgs := languageCondition("language", languageCode)
+	query := fmt.Sprintf("SELECT FIRST %d SKIP %d COUNT(*) OVER () totalCount, id, url, scheme, domainid, contenttype, charset, language, linecount, title, prompt, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlindex, date_added, last_successful_visit, hidden FROM pages WHERE publishdate > dateadd(-1 year to ?) AND publishdate < dateadd(2 day to ?) AND %s AND has_duplicate_on_gemini=false AND hidden = false AND domainid <> 9 ORDER BY publishdate DESC", results, skip, condition)
+	rows, rows_err := conn.QueryContext(context.Background(), query, append([]any{time.Now().UTC(), time.Now().UTC()}, languageArgs...)...)
 
 	var pages []Page = make([]Page, 0, results)
 	var totalCount int
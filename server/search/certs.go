@@ -0,0 +1,138 @@
+package search
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	sis "gitlab.com/sis-suite/smallnetinformationservices"
+)
+
+// Pages showing the TLS certificates the crawler has seen capsules with, so that users can check their TOFU pins against them
+func handleCerts(s sis.VirtualServerHandle, conn *sql.DB, publishDate time.Time, updateDate time.Time) {
+	s.AddRoute("/search/certs", func(request *sis.Request) {
+		request.Redirect("/search/certs/")
+	})
+	s.AddRoute("/search/certs/", func(request *sis.Request) {
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - Certificate History\n"})
+		if request.ScrollMetadataRequested() {
+			request.SendAbstract("")
+			return
+		}
+
+		var builder strings.Builder
+		for _, cert := range getRecentCertChanges(conn) {
+			fmt.Fprintf(&builder, "=> %s %s:%d changed on %s\n", certHistoryLink(cert.Domain, cert.Port), cert.Domain, cert.Port, cert.FirstSeen.Format("2006-01-02"))
+		}
+
+		request.Gemini(fmt.Sprintf(`# Certificate History
+
+=> /search/ Home
+=> /search/certs/capsule Look Up a Capsule
+
+Gemini and Scroll clients trust a capsule's certificate the first time they see it (TOFU), and warn when it changes. When your client warns about a changed certificate, you can check whether AuraGem Search's crawler saw the same change. A certificate that changed long before the old one expired is worth a closer look.
+
+## Recent Changes
+%s
+`, builder.String()))
+	})
+
+	s.AddRoute("/search/certs/capsule", func(request *sis.Request) {
+		query, err := request.Query()
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		} else if query == "" {
+			request.RequestInput("Capsule (host, host:port, or URL):")
+			return
+		}
+
+		domain, port, ok := parseCertCapsule(query)
+		if !ok {
+			request.Redirect("/search/certs/capsule")
+			return
+		}
+
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: fmt.Sprintf("# AuraGem Search - Certificate History of %s:%d\n", domain, port)})
+		if request.ScrollMetadataRequested() {
+			request.SendAbstract("")
+			return
+		}
+
+		certs := getCertHistory(conn, domain, port)
+		var builder strings.Builder
+		if len(certs) == 0 {
+			fmt.Fprintf(&builder, "The crawler hasn't seen a certificate for this capsule.\n")
+		}
+		for i, cert := range certs {
+			if i == 0 {
+				fmt.Fprintf(&builder, "## Since %s (Current)\n", cert.FirstSeen.Format("2006-01-02"))
+			} else {
+				fmt.Fprintf(&builder, "## %s to %s\n", cert.FirstSeen.Format("2006-01-02"), cert.LastSeen.Format("2006-01-02"))
+			}
+			fmt.Fprintf(&builder, "* SHA-256 Fingerprint: %s\n", cert.Fingerprint)
+			fmt.Fprintf(&builder, "* Subject: %s\n", cert.Subject)
+			if cert.Issuer == cert.Subject {
+				fmt.Fprintf(&builder, "* Issuer: Self-signed\n")
+			} else {
+				fmt.Fprintf(&builder, "* Issuer: %s\n", cert.Issuer)
+			}
+			expired := ""
+			if cert.NotAfter.Before(time.Now()) {
+				expired = " (Expired)"
+			}
+			fmt.Fprintf(&builder, "* Valid: %s to %s%s\n", cert.NotBefore.Format("2006-01-02"), cert.NotAfter.Format("2006-01-02"), expired)
+			fmt.Fprintf(&builder, "* Last Seen: %s\n", cert.LastSeen.Format(time.DateTime))
+
+			// The history is most recent first, so the certificate this one replaced comes next
+			if i+1 < len(certs) && cert.PreviousFingerprint.Valid && certs[i+1].Fingerprint == cert.PreviousFingerprint.V {
+				previous := certs[i+1]
+				if previous.NotAfter.After(cert.FirstSeen) {
+					fmt.Fprintf(&builder, "* Replaced the previous certificate %d days before it expired\n", int(previous.NotAfter.Sub(cert.FirstSeen).Hours()/24))
+				} else {
+					fmt.Fprintf(&builder, "* Replaced the previous certificate after it expired\n")
+				}
+			}
+			fmt.Fprintf(&builder, "\n")
+		}
+
+		request.Gemini(fmt.Sprintf(`# Certificate History of %s:%d
+
+=> /search/certs/ Certificate History
+=> /search/certs/capsule Look Up Another Capsule
+
+%s`, domain, port, builder.String()))
+	})
+}
+
+func certHistoryLink(domain string, port int) string {
+	return "/search/certs/capsule?" + url.QueryEscape(domain+":"+strconv.Itoa(port))
+}
+
+// Gets the domain and port of a capsule from a host, host:port, or a gemini or scroll URL. Hosts without a port default to gemini's.
+func parseCertCapsule(query string) (string, int, bool) {
+	if !strings.Contains(query, "://") {
+		query = "gemini://" + query
+	}
+	capsuleUrl, err := url.Parse(strings.TrimSpace(query))
+	if err != nil || capsuleUrl.Hostname() == "" {
+		return "", 0, false
+	}
+
+	port := 1965
+	if capsuleUrl.Scheme == "scroll" {
+		port = 5699
+	} else if capsuleUrl.Scheme != "gemini" {
+		return "", 0, false
+	}
+	if capsuleUrl.Port() != "" {
+		port, err = strconv.Atoi(capsuleUrl.Port())
+		if err != nil {
+			return "", 0, false
+		}
+	}
+	return strings.ToLower(capsuleUrl.Hostname()), port, true
+}
@@ -0,0 +1,201 @@
+package search
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/crawler"
+	sis "gitlab.com/sis-suite/smallnetinformationservices"
+)
+
+// Admin pages to watch the progress of crawl jobs, start capsule crawls, and pause or cancel them
+func handleCrawlJobs(s sis.VirtualServerHandle, globalData *crawler.GlobalData) {
+	s.AddRoute("/search/admin/crawls", func(request *sis.Request) {
+		request.Redirect("/search/admin/crawls/")
+	})
+	s.AddRoute("/search/admin/crawls/", func(request *sis.Request) {
+		if !checkAdminCert(request) {
+			return
+		}
+
+		var current strings.Builder
+		var finished strings.Builder
+		for _, job := range crawler.GetCrawlJobs() {
+			progress := job.Progress()
+			if progress.Finished.IsZero() {
+				fmt.Fprintf(&current, "=> /search/admin/crawls/%d/ #%d %s (%s, %d fetched, %d left)\n", job.Id, job.Id, job.Name, progress.State, progress.Fetched, progress.ToCrawl)
+			} else {
+				fmt.Fprintf(&finished, "=> /search/admin/crawls/%d/ #%d %s (%s on %s, %d fetched)\n", job.Id, job.Id, job.Name, progress.State, progress.Finished.Format(time.DateTime), progress.Fetched)
+			}
+		}
+
+		request.Gemini(fmt.Sprintf(`# Crawl Jobs
+
+=> /search/ Home
+=> /search/admin/crawls/start Start a Capsule Crawl
+=> /search/admin/crawls/start_page Crawl a Single Page
+=> /search/admin/failures Page Failures
+=> /search/admin/rewrites/ Query Rewrite Rules
+
+## Current
+%s
+## Finished
+%s`, current.String(), finished.String()))
+	})
+
+	s.AddRoute("/search/admin/crawls/start", func(request *sis.Request) {
+		startCrawlJob(request, globalData, true)
+	})
+	s.AddRoute("/search/admin/crawls/start_page", func(request *sis.Request) {
+		startCrawlJob(request, globalData, false)
+	})
+
+	s.AddRoute("/search/admin/crawls/:id", func(request *sis.Request) {
+		request.Redirect("/search/admin/crawls/%s/", request.GetParam("id"))
+	})
+	s.AddRoute("/search/admin/crawls/:id/", func(request *sis.Request) {
+		job, ok := getAdminCrawlJob(request)
+		if !ok {
+			return
+		}
+
+		progress := job.Progress()
+		var builder strings.Builder
+		fmt.Fprintf(&builder, "State: %s\n", progress.State)
+		fmt.Fprintf(&builder, "Created: %s\n", job.Created.Format(time.DateTime))
+		if !progress.Started.IsZero() {
+			end := time.Now()
+			if !progress.Finished.IsZero() {
+				end = progress.Finished
+			}
+			minutes := end.Sub(progress.Started).Minutes()
+			fmt.Fprintf(&builder, "Started: %s (%.0f minutes)\n", progress.Started.Format(time.DateTime), minutes)
+			if !progress.Finished.IsZero() {
+				fmt.Fprintf(&builder, "Finished: %s\n", progress.Finished.Format(time.DateTime))
+			}
+			fmt.Fprintf(&builder, "\nFetched: %d (%.1f/min)\n", progress.Fetched, float64(progress.Fetched)/max(minutes, 1))
+			fmt.Fprintf(&builder, "Downloaded: %.2f MB\n", float64(progress.Bytes)/1024/1024)
+			fmt.Fprintf(&builder, "Slow Downs: %d\n", progress.SlowDowns)
+		}
+		if progress.State == crawler.CrawlJobRunning || progress.State == crawler.CrawlJobPaused {
+			fmt.Fprintf(&builder, "Crawled: %d\nLeft to Crawl: %d\n", progress.Crawled, progress.ToCrawl)
+		}
+
+		if len(progress.Failures) > 0 {
+			fmt.Fprintf(&builder, "\n## Failures\n")
+			statuses := make([]int, 0, len(progress.Failures))
+			for status := range progress.Failures {
+				statuses = append(statuses, status)
+			}
+			slices.Sort(statuses)
+			for _, status := range statuses {
+				if status == 0 {
+					fmt.Fprintf(&builder, "* No Response: %d\n", progress.Failures[status])
+				} else {
+					fmt.Fprintf(&builder, "* %d: %d\n", status, progress.Failures[status])
+				}
+			}
+		}
+
+		fmt.Fprintf(&builder, "\n")
+		switch progress.State {
+		case crawler.CrawlJobRunning:
+			fmt.Fprintf(&builder, "=> /search/admin/crawls/%d/pause Pause\n", job.Id)
+			fmt.Fprintf(&builder, "=> /search/admin/crawls/%d/cancel Cancel\n", job.Id)
+		case crawler.CrawlJobPaused:
+			fmt.Fprintf(&builder, "=> /search/admin/crawls/%d/resume Resume\n", job.Id)
+			fmt.Fprintf(&builder, "=> /search/admin/crawls/%d/cancel Cancel\n", job.Id)
+		case crawler.CrawlJobQueued:
+			fmt.Fprintf(&builder, "=> /search/admin/crawls/%d/cancel Cancel\n", job.Id)
+		}
+
+		request.Gemini(fmt.Sprintf(`# Crawl Job #%d: %s
+
+=> /search/admin/crawls/ All Crawl Jobs
+=> /search/admin/crawls/%d/ Refresh
+
+%s`, job.Id, job.Name, job.Id, builder.String()))
+	})
+
+	s.AddRoute("/search/admin/crawls/:id/pause", func(request *sis.Request) {
+		controlCrawlJob(request, (*crawler.CrawlJob).Pause)
+	})
+	s.AddRoute("/search/admin/crawls/:id/resume", func(request *sis.Request) {
+		controlCrawlJob(request, (*crawler.CrawlJob).Resume)
+	})
+	s.AddRoute("/search/admin/crawls/:id/cancel", func(request *sis.Request) {
+		controlCrawlJob(request, (*crawler.CrawlJob).Cancel)
+	})
+}
+
+// Starts a crawl job of the url in the query, following the internal links of the capsule or none at all
+func startCrawlJob(request *sis.Request, globalData *crawler.GlobalData, capsule bool) {
+	if !checkAdminCert(request) {
+		return
+	}
+
+	query, err := request.Query()
+	if err != nil {
+		request.TemporaryFailure("%s", err.Error())
+		return
+	} else if query == "" {
+		request.RequestInput("URL to crawl:")
+		return
+	}
+
+	queryUrl, err := url.Parse(query)
+	if err != nil || !queryUrl.IsAbs() {
+		request.TemporaryFailure("Unable to parse URL.")
+		return
+	} else if _, ok := crawler.GetProtocolFetcher(queryUrl.Scheme); !ok {
+		request.TemporaryFailure("The crawler doesn't support %s URLs.", queryUrl.Scheme)
+		return
+	}
+	queryUrl.Fragment = "" // Strip the fragment
+	if queryUrl.Path == "" {
+		queryUrl.Path = "/"
+	}
+
+	var job *crawler.CrawlJob
+	if capsule {
+		job = crawler.StartCrawlJob(globalData, "Capsule Crawl of "+queryUrl.String(), []string{queryUrl.String()}, false, true, 0, 2)
+	} else {
+		job = crawler.StartCrawlJob(globalData, "Page Crawl of "+queryUrl.String(), []string{queryUrl.String()}, false, false, 0, 1)
+	}
+	request.Redirect("/search/admin/crawls/%d/", job.Id)
+}
+
+// Runs a control function (pause, resume, or cancel) on the job of the id param and redirects back to its page
+func controlCrawlJob(request *sis.Request, control func(*crawler.CrawlJob) error) {
+	job, ok := getAdminCrawlJob(request)
+	if !ok {
+		return
+	}
+	if err := control(job); err != nil {
+		request.TemporaryFailure("%s", err.Error())
+		return
+	}
+	request.Redirect("/search/admin/crawls/%d/", job.Id)
+}
+
+// Gets the job of the id param. Sends the admin certificate check or a not found response and returns false if there's no such job.
+func getAdminCrawlJob(request *sis.Request) (*crawler.CrawlJob, bool) {
+	if !checkAdminCert(request) {
+		return nil, false
+	}
+	id, err := strconv.Atoi(request.GetParam("id"))
+	if err != nil {
+		request.NotFound("Crawl job not found.")
+		return nil, false
+	}
+	job, ok := crawler.GetCrawlJob(id)
+	if !ok {
+		request.NotFound("Crawl job not found. Only the most recent finished jobs are kept.")
+		return nil, false
+	}
+	return job, true
+}
@@ -176,6 +176,86 @@ func getMimetypes(conn *sql.DB) []MimetypeListItem {
 	return mimetypes
 }
 
+type TagListItem struct {
+	name  string
+	count int
+}
+
+// Returns the most used hashtags, by the number of (non-hidden) pages they're on
+func getTags(conn *sql.DB) []TagListItem {
+	return queryTagList(conn, "SELECT FIRST 500 t.name, COUNT(DISTINCT t.pageid) FROM tags t JOIN pages p ON p.id = t.pageid WHERE p.hidden = false GROUP BY t.name ORDER BY COUNT(DISTINCT t.pageid) DESC, t.name ASC")
+}
+
+// Returns the most used mentions, by the number of (non-hidden) pages they're on
+func getMentions(conn *sql.DB) []TagListItem {
+	return queryTagList(conn, "SELECT FIRST 500 m.name, COUNT(DISTINCT m.pageid) FROM mentions m JOIN pages p ON p.id = m.pageid WHERE p.hidden = false GROUP BY m.name ORDER BY COUNT(DISTINCT m.pageid) DESC, m.name ASC")
+}
+
+func queryTagList(conn *sql.DB, q string) []TagListItem {
+	var items []TagListItem = make([]TagListItem, 0, 500)
+	rows, rows_err := conn.QueryContext(context.Background(), q)
+	if rows_err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var item TagListItem
+			scan_err := rows.Scan(&item.name, &item.count)
+			if scan_err == nil {
+				items = append(items, item)
+			} else {
+				panic(scan_err)
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			panic(err)
+		}
+	}
+
+	return items
+}
+
+// Returns the pages with the hashtag, ordered by the tag's rank on the page (set as the page's Score), or by publication date for feeds
+func getPagesWithTag(conn *sql.DB, tag string, byDate bool) []Page {
+	order := "t.rank DESC, p.publishdate DESC"
+	if byDate {
+		order = "p.publishdate DESC, p.date_added DESC"
+	}
+	return queryTaggedPages(conn, "SELECT FIRST 100 t.rank, p.id, p.url, p.scheme, p.domainid, p.contenttype, p.charset, p.language, p.linecount, p.udc, p.title, p.prompt, p.size, p.hash, p.feed, p.publishdate, p.indextime, p.album, p.artist, p.albumartist, p.composer, p.track, p.disc, p.copyright, p.crawlindex, p.date_added, p.last_successful_visit, p.hidden FROM tags t JOIN pages p ON p.id = t.pageid WHERE t.name = ? AND p.hidden = false ORDER BY "+order, tag)
+}
+
+// Returns the pages with the mention, ordered by publication date
+func getPagesWithMention(conn *sql.DB, mention string) []Page {
+	return queryTaggedPages(conn, "SELECT FIRST 100 CAST(1 AS float), p.id, p.url, p.scheme, p.domainid, p.contenttype, p.charset, p.language, p.linecount, p.udc, p.title, p.prompt, p.size, p.hash, p.feed, p.publishdate, p.indextime, p.album, p.artist, p.albumartist, p.composer, p.track, p.disc, p.copyright, p.crawlindex, p.date_added, p.last_successful_visit, p.hidden FROM mentions m JOIN pages p ON p.id = m.pageid WHERE m.name = ? AND p.hidden = false ORDER BY p.publishdate DESC, p.date_added DESC", mention)
+}
+
+func queryTaggedPages(conn *sql.DB, q string, args ...any) []Page {
+	rows, rows_err := conn.QueryContext(context.Background(), q, args...)
+
+	var pages []Page = make([]Page, 0, 100)
+	if rows_err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var page Page
+			scan_err := rows.Scan(&page.Score, &page.Id, &page.Url, &page.Scheme, &page.DomainId, &page.Content_type, &page.Charset, &page.Language, &page.Linecount, &page.Udc, &page.Title, &page.Prompt, &page.Size, &page.Hash, &page.Feed, &page.PublishDate, &page.Index_time, &page.Album, &page.Artist, &page.AlbumArtist, &page.Composer, &page.Track, &page.Disc, &page.Copyright, &page.CrawlIndex, &page.Date_added, &page.LastSuccessfulVisit, &page.Hidden)
+			if scan_err == nil {
+				pages = append(pages, page)
+			} else {
+				prevPage := Page{}
+				if len(pages) > 0 {
+					prevPage = pages[len(pages)-1]
+				}
+				panic(fmt.Errorf("scan error after page %v; %s", prevPage, scan_err.Error()))
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			panic(err)
+		}
+	}
+
+	return pages
+}
+
 func getFeeds(conn *sql.DB) []Page {
 	rows, rows_err := conn.QueryContext(context.Background(), "SELECT COUNT(*) OVER () as total, id, url, scheme, domainid, contenttype, charset, language, linecount, udc, title, prompt, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlindex, date_added, last_successful_visit, hidden FROM pages WHERE feed = true AND hidden = false")
 
@@ -306,27 +386,86 @@ func getAudioFiles(conn *sql.DB, page int64) ([]Page, int64, bool) {
 	return pages, totalCount, skip+results < totalCount
 }
 
-// Returns []Page, totalResultsCount, and whether there's a next page
-func getImageFiles(conn *sql.DB, page int64) ([]Page, int64, bool) {
+// Content types listed as image files
+const imageContentTypes = `'image/jpeg', 'image/jpg', 'image/png', 'image/gif', 'image/bmp', 'image/webp', 'image/svg+xml', 'image/vnd.mozilla.apng', 'image/tiff'`
+
+// Filters of the image file listing, written in its urls as a comma-separated list, like "large,2024"
+type imageFilter struct {
+	Size string // "small", "medium", or "large", by the largest dimension of the image
+	Year int    // The year the image was taken
+}
+
+// The conditions of each size, on the largest dimension of images
+var imageSizeConditions = map[string]string{
+	"small":  "MAXVALUE(i.width, i.height) BETWEEN 1 AND 639",
+	"medium": "MAXVALUE(i.width, i.height) BETWEEN 640 AND 1919",
+	"large":  "MAXVALUE(i.width, i.height) >= 1920",
+}
+
+func parseImageFilter(s string) (imageFilter, bool) {
+	var filter imageFilter
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		if _, isSize := imageSizeConditions[part]; isSize {
+			filter.Size = part
+		} else if year, err := strconv.Atoi(part); err == nil && len(part) == 4 {
+			filter.Year = year
+		} else if part != "" {
+			return imageFilter{}, false
+		}
+	}
+	return filter, true
+}
+
+func (filter imageFilter) String() string {
+	parts := make([]string, 0, 2)
+	if filter.Size != "" {
+		parts = append(parts, filter.Size)
+	}
+	if filter.Year != 0 {
+		parts = append(parts, strconv.Itoa(filter.Year))
+	}
+	return strings.Join(parts, ",")
+}
+
+// The url of the listing of the filtered images
+func (filter imageFilter) Url() string {
+	if filter == (imageFilter{}) {
+		return "/search/images/"
+	}
+	return "/search/images/f/" + filter.String() + "/"
+}
+
+// Returns []ImagePage, totalResultsCount, and whether there's a next page
+func getImageFiles(conn *sql.DB, page int64, filter imageFilter) ([]ImagePage, int64, bool) {
 	var results int64 = 30
 	skip := (page - 1) * results
-	q := fmt.Sprintf(`SELECT FIRST %d SKIP %d COUNT(*) OVER () totalCount, id, url, scheme, domainid, contenttype, charset, language, udc, title, prompt, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlindex, date_added, last_successful_visit, hidden FROM pages WHERE contenttype IN ('image/jpeg', 'image/jpg', 'image/png', 'image/gif', 'image/bmp', 'image/webp', 'image/svg+xml', 'image/vnd.mozilla.apng') AND hidden = false`, results, skip)
+	conditions := ""
+	args := make([]any, 0, 1)
+	if filter.Size != "" {
+		conditions += " AND " + imageSizeConditions[filter.Size]
+	}
+	if filter.Year != 0 {
+		conditions += " AND EXTRACT(YEAR FROM i.capturedate) = ?"
+		args = append(args, filter.Year)
+	}
+	q := fmt.Sprintf(`SELECT FIRST %d SKIP %d COUNT(*) OVER () totalCount, p.id, p.url, p.scheme, p.domainid, p.contenttype, p.charset, p.language, p.udc, p.title, p.prompt, p.size, p.hash, p.feed, p.publishdate, p.indextime, p.album, p.artist, p.albumartist, p.composer, p.track, p.disc, p.copyright, p.crawlindex, p.date_added, p.last_successful_visit, p.hidden, COALESCE(i.width, 0), COALESCE(i.height, 0), COALESCE(i.cameramake, ''), COALESCE(i.cameramodel, ''), i.capturedate, COALESCE(i.description, ''), COALESCE(i.alttext, '') FROM pages p LEFT JOIN images i ON i.pageid = p.id WHERE p.contenttype IN (%s) AND p.hidden = false%s ORDER BY p.date_added DESC`, results, skip, imageContentTypes, conditions)
 
-	rows, rows_err := conn.QueryContext(context.Background(), q)
+	rows, rows_err := conn.QueryContext(context.Background(), q, args...)
 
-	var pages []Page = make([]Page, 0, results)
+	var images []ImagePage = make([]ImagePage, 0, results)
 	var totalCount int64
 	if rows_err == nil {
 		defer rows.Close()
 		for rows.Next() {
-			var page Page
-			scan_err := rows.Scan(&totalCount, &page.Id, &page.Url, &page.Scheme, &page.DomainId, &page.Content_type, &page.Charset, &page.Language, &page.Udc, &page.Title, &page.Prompt, &page.Size, &page.Hash, &page.Feed, &page.PublishDate, &page.Index_time, &page.Album, &page.Artist, &page.AlbumArtist, &page.Composer, &page.Track, &page.Disc, &page.Copyright, &page.CrawlIndex, &page.Date_added, &page.LastSuccessfulVisit, &page.Hidden)
+			var image ImagePage
+			p := &image.Page
+			scan_err := rows.Scan(&totalCount, &p.Id, &p.Url, &p.Scheme, &p.DomainId, &p.Content_type, &p.Charset, &p.Language, &p.Udc, &p.Title, &p.Prompt, &p.Size, &p.Hash, &p.Feed, &p.PublishDate, &p.Index_time, &p.Album, &p.Artist, &p.AlbumArtist, &p.Composer, &p.Track, &p.Disc, &p.Copyright, &p.CrawlIndex, &p.Date_added, &p.LastSuccessfulVisit, &p.Hidden, &image.Width, &image.Height, &image.CameraMake, &image.CameraModel, &image.CaptureDate, &image.Description, &image.AltText)
 			if scan_err == nil {
-				pages = append(pages, page)
+				images = append(images, image)
 			} else {
 				prevPage := Page{}
-				if len(pages) > 0 {
-					prevPage = pages[len(pages)-1]
+				if len(images) > 0 {
+					prevPage = images[len(images)-1].Page
 				}
 				panic(fmt.Errorf("scan error after page %v; %s", prevPage, scan_err.Error()))
 			}
@@ -337,7 +476,36 @@ func getImageFiles(conn *sql.DB, page int64) ([]Page, int64, bool) {
 		}
 	}
 
-	return pages, totalCount, skip+results < totalCount
+	return images, totalCount, skip+results < totalCount
+}
+
+type ImageYearListItem struct {
+	year  int
+	count int
+}
+
+// Returns the years images were taken in, with the number of (non-hidden) images taken in each, most recent first
+func getImageYears(conn *sql.DB) []ImageYearListItem {
+	var years []ImageYearListItem = make([]ImageYearListItem, 0, 50)
+	rows, rows_err := conn.QueryContext(context.Background(), "SELECT FIRST 50 EXTRACT(YEAR FROM i.capturedate), COUNT(*) FROM images i JOIN pages p ON p.id = i.pageid WHERE i.capturedate IS NOT NULL AND p.hidden = false GROUP BY 1 ORDER BY 1 DESC")
+	if rows_err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var item ImageYearListItem
+			scan_err := rows.Scan(&item.year, &item.count)
+			if scan_err == nil {
+				years = append(years, item)
+			} else {
+				panic(scan_err)
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			panic(err)
+		}
+	}
+
+	return years
 }
 
 func getTwtxtFiles(conn *sql.DB) []Page {
@@ -409,6 +577,92 @@ func getSecurityTxtFiles(conn *sql.DB) []PageWithDomain {
 	return pages
 }
 
+// Returns pages that have failed permanently in at least minConsecutive consecutive crawls, most recent first
+func getGonePages(conn *sql.DB, minConsecutive int) ([]PageFailure, error) {
+	q := `SELECT FIRST 100 id, url, domain, status, meta, permanent, consecutive_failures, permanent_failures, total_failures, first_failure, last_failure, last_success FROM page_failures WHERE permanent = true AND permanent_failures >= ? ORDER BY last_failure DESC`
+	return queryPageFailures(conn, q, minConsecutive)
+}
+
+// Returns pages that have failed before but were fetched successfully since, with the most failures first
+func getFlakyPages(conn *sql.DB) ([]PageFailure, error) {
+	q := `SELECT FIRST 100 id, url, domain, status, meta, permanent, consecutive_failures, permanent_failures, total_failures, first_failure, last_failure, last_success FROM page_failures WHERE last_success IS NOT NULL ORDER BY total_failures DESC`
+	return queryPageFailures(conn, q)
+}
+
+func queryPageFailures(conn *sql.DB, q string, args ...any) ([]PageFailure, error) {
+	rows, err := conn.QueryContext(context.Background(), q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []PageFailure = make([]PageFailure, 0, 100)
+	for rows.Next() {
+		var failure PageFailure
+		if err := rows.Scan(&failure.Id, &failure.Url, &failure.Domain, &failure.Status, &failure.Meta, &failure.Permanent, &failure.ConsecutiveFailures, &failure.PermanentFailures, &failure.TotalFailures, &failure.FirstFailure, &failure.LastFailure, &failure.LastSuccess); err != nil {
+			return nil, err
+		}
+		failures = append(failures, failure)
+	}
+	return failures, rows.Err()
+}
+
+// Returns the capsules with the most page failures
+func getCapsuleFailures(conn *sql.DB) ([]CapsuleFailures, error) {
+	q := `SELECT FIRST 50 domain, SUM(CASE WHEN consecutive_failures > 0 THEN 1 ELSE 0 END) failing, SUM(CASE WHEN last_success IS NOT NULL THEN 1 ELSE 0 END) recovered, SUM(total_failures) total FROM page_failures GROUP BY domain ORDER BY 4 DESC`
+	rows, err := conn.QueryContext(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var capsules []CapsuleFailures = make([]CapsuleFailures, 0, 50)
+	for rows.Next() {
+		var capsule CapsuleFailures
+		if err := rows.Scan(&capsule.Domain, &capsule.FailingPages, &capsule.RecoveredPages, &capsule.TotalFailures); err != nil {
+			return nil, err
+		}
+		capsules = append(capsules, capsule)
+	}
+	return capsules, rows.Err()
+}
+
+// Returns the certificates a capsule has been seen with, most recent first
+func getCertHistory(conn *sql.DB, domain string, port int) []CertRecord {
+	q := `SELECT id, domain, port, fingerprint, subject, issuer, not_before, not_after, previous_fingerprint, first_seen, last_seen FROM certs WHERE domain=? AND port=? ORDER BY first_seen DESC`
+	return queryCerts(conn, q, domain, port)
+}
+
+// Returns the most recent times a capsule was seen with a different certificate than before
+func getRecentCertChanges(conn *sql.DB) []CertRecord {
+	q := `SELECT FIRST 50 id, domain, port, fingerprint, subject, issuer, not_before, not_after, previous_fingerprint, first_seen, last_seen FROM certs WHERE previous_fingerprint IS NOT NULL ORDER BY first_seen DESC`
+	return queryCerts(conn, q)
+}
+
+func queryCerts(conn *sql.DB, q string, args ...any) []CertRecord {
+	rows, rows_err := conn.QueryContext(context.Background(), q, args...)
+
+	var certs []CertRecord = make([]CertRecord, 0, 50)
+	if rows_err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var cert CertRecord
+			scan_err := rows.Scan(&cert.Id, &cert.Domain, &cert.Port, &cert.Fingerprint, &cert.Subject, &cert.Issuer, &cert.NotBefore, &cert.NotAfter, &cert.PreviousFingerprint, &cert.FirstSeen, &cert.LastSeen)
+			if scan_err == nil {
+				certs = append(certs, cert)
+			} else {
+				panic(scan_err)
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			panic(err)
+		}
+	}
+
+	return certs
+}
+
 var InvalidURLString = errors.New("URL is not a valid UTF-8 string.")
 var URLTooLong = errors.New("URL exceeds 1024 bytes.")
 var InvalidURL = errors.New("URL is not valid.")
@@ -425,7 +679,7 @@ func addSeedToDb(conn *sql.DB, seed Seed) (Seed, error) {
 		return Seed{}, URLTooLong
 	}
 	// Make sure URL has gemini:// scheme
-	if !strings.HasPrefix(seed.Url, "gemini://") && !strings.HasPrefix(seed.Url, "scroll://") && !strings.HasPrefix(seed.Url, "spartan://") && !strings.HasPrefix(seed.Url, "nex://") && !strings.Contains(seed.Url, "://") && !strings.HasPrefix(seed.Url, ".") && !strings.HasPrefix(seed.Url, "/") {
+	if !strings.HasPrefix(seed.Url, "gemini://") && !strings.HasPrefix(seed.Url, "scroll://") && !strings.HasPrefix(seed.Url, "spartan://") && !strings.HasPrefix(seed.Url, "nex://") && !strings.HasPrefix(seed.Url, "gopher://") && !strings.Contains(seed.Url, "://") && !strings.HasPrefix(seed.Url, ".") && !strings.HasPrefix(seed.Url, "/") {
 		seed.Url = "gemini://" + seed.Url
 	}
 
@@ -437,7 +691,7 @@ func addSeedToDb(conn *sql.DB, seed Seed) (Seed, error) {
 	if !u.IsAbs() { // Check if Absolute URL
 		return Seed{}, URLRelative
 	}
-	if u.Scheme != "gemini" && u.Scheme != "nex" && u.Scheme != "spartan" && u.Scheme != "scroll" { // Make sure scheme is gemini, nex, spartan, or scroll
+	if u.Scheme != "gemini" && u.Scheme != "nex" && u.Scheme != "spartan" && u.Scheme != "scroll" && u.Scheme != "gopher" { // Make sure scheme is gemini, nex, spartan, scroll, or gopher
 		return Seed{}, URLNotGemini
 	}
 	seed.Url = _getHostname(u)
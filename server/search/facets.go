@@ -0,0 +1,286 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/config"
+	"gitlab.com/clseibold/auragem_sis/crawler"
+)
+
+// Search results can be narrowed down by their facets: protocol, content type, language, UDC class, capsule, and publication year.
+// The first page of results counts the results by each facet, and links to the search with a filter of each of the most common
+// values added. Filters are operators in the query, like the lang: operator for languages, so that they're kept in the URLs of the
+// other pages of results. Facet links always write them after the rest of the query in the same order, so that the same filters
+// make the same URL.
+
+// The operators of the facet filters, in the order they're written in the query
+var facetOperators = []string{"protocol", "type", "udc", "site", "year"}
+
+// Matches a facet operator, like "type:text/gemini" or "year:2024"
+var facetOperatorRegex = regexp.MustCompile(`(?i)(^|\s)(protocol|type|udc|site|year):(\S+)`)
+
+// The facets, in the order they're shown under the search results, and their titles. Languages are filtered with the lang: operator.
+var facetTitles = []struct {
+	Operator string
+	Title    string
+}{
+	{"protocol", "Protocol"}, {"type", "Content Type"}, {"lang", "Language"}, {"udc", "Subject"}, {"site", "Capsule"}, {"year", "Year"},
+}
+
+// The facet filters of a query, from operator to value
+type searchFacets map[string]string
+
+// Removes the facet operators from the query, returning the rest of the query and the filters. Operators with values that can't be
+// filtered on (like year:soon) are left in the query and searched as text.
+func parseQueryFacets(query string) (string, searchFacets) {
+	facets := make(searchFacets)
+	var rest strings.Builder
+	last := 0
+	for _, match := range facetOperatorRegex.FindAllStringSubmatchIndex(query, -1) {
+		operator := strings.ToLower(query[match[4]:match[5]])
+		value, ok := normalizeFacet(operator, query[match[6]:match[7]])
+		if !ok {
+			continue
+		}
+		facets[operator] = value
+		rest.WriteString(query[last:match[0]] + " ")
+		last = match[1]
+	}
+	rest.WriteString(query[last:])
+	return strings.Join(strings.Fields(rest.String()), " "), facets
+}
+
+// Normalizes the value of a facet, for filters and for counting results. Returns false if results can't be filtered by it.
+func normalizeFacet(operator string, value string) (string, bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch operator {
+	case "protocol", "site", "udc":
+		return value, value != "" && !strings.ContainsAny(value, "/:")
+	case "type":
+		value, _, _ = strings.Cut(value, ";")
+		value = strings.TrimSpace(value)
+		return value, strings.Contains(value, "/")
+	case "year":
+		year, err := strconv.Atoi(value)
+		return strconv.Itoa(year), err == nil && year >= 1800 && year <= 9999
+	case "lang":
+		if language, ok := crawler.GetSearchLanguage(value); ok {
+			return language.Code, true
+		} else if value == "" {
+			return "en", true // Pages without a language are counted as English, like the lang: operator does
+		}
+		value, _, _ = strings.Cut(value, "-")
+		return value, len(value) >= 2 && len(value) <= 3
+	}
+	return "", false
+}
+
+// The filters written as operators, in the same order every time
+func (facets searchFacets) String() string {
+	operators := make([]string, 0, len(facets))
+	for _, operator := range facetOperators {
+		if value, ok := facets[operator]; ok {
+			operators = append(operators, operator+":"+value)
+		}
+	}
+	return strings.Join(operators, " ")
+}
+
+// A copy of the filters with the operator set to value, or removed if value is empty
+func (facets searchFacets) with(operator string, value string) searchFacets {
+	result := make(searchFacets, len(facets)+1)
+	for o, v := range facets {
+		result[o] = v
+	}
+	if value == "" {
+		delete(result, operator)
+	} else {
+		result[operator] = value
+	}
+	return result
+}
+
+// The query with the filters written after it
+func facetQuery(query string, facets searchFacets) string {
+	return strings.TrimSpace(query + " " + facets.String())
+}
+
+// The conditions that limit search results to the language of the lang: operator and to the facet filters, and their parameters
+func searchFilters(queryLang queryLanguage, facets searchFacets) (string, []any) {
+	var builder strings.Builder
+	var args []any
+	if queryLang.Filter != "" {
+		condition, languageArgs := languageCondition("P.LANGUAGE", queryLang.Filter)
+		builder.WriteString(" AND " + condition)
+		args = append(args, languageArgs...)
+	}
+	for _, operator := range facetOperators {
+		value, ok := facets[operator]
+		if !ok {
+			continue
+		}
+		switch operator {
+		case "protocol":
+			builder.WriteString(" AND LOWER(P.SCHEME) = ?")
+			args = append(args, value)
+		case "type":
+			builder.WriteString(" AND LOWER(P.CONTENTTYPE) = ?")
+			args = append(args, value)
+		case "udc":
+			builder.WriteString(" AND P.UDC = ?")
+			args = append(args, value)
+		case "site":
+			builder.WriteString(" AND P.DOMAINID IN (SELECT D.ID FROM DOMAINS D WHERE D.DOMAIN = ?)")
+			args = append(args, value)
+		case "year":
+			year, _ := strconv.Atoi(value)
+			builder.WriteString(" AND P.PUBLISHDATE >= ? AND P.PUBLISHDATE < ?")
+			args = append(args, time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(year+1, 1, 1, 0, 0, 0, 0, time.UTC))
+		}
+	}
+	return builder.String(), args
+}
+
+// Builds the SQL that counts the pages matching a search by their facets, and its parameters. Pages are matched the same way as
+// by pageSearchSQL.
+func facetSearchSQL(query *booleanQuery, queryLang queryLanguage, protocol string, facets searchFacets) (string, []any) {
+	luceneQuery, pageQuery := pageSearchQueries(query, protocol)
+	args := []any{queryLang.Language.PageIndex(), pageQuery, queryLang.Language.PageContentIndex(), luceneQuery}
+	condition := "P.HAS_DUPLICATE_ON_GEMINI=false"
+	if protocol != "" {
+		condition = "P.SCHEME=?"
+		args = append(args, protocol)
+	}
+	filters, filterArgs := searchFilters(queryLang, facets)
+	return strings.Replace(fts_facetQuery, `%%filters%%`, condition+filters, 1), append(args, filterArgs...)
+}
+
+// The number of search results with each value of each facet, by operator and then by value
+type facetCounts map[string]map[string]int
+
+func (counts facetCounts) add(operator string, value string, count int) {
+	value, ok := normalizeFacet(operator, value)
+	if !ok {
+		return
+	}
+	if counts[operator] == nil {
+		counts[operator] = make(map[string]int)
+	}
+	counts[operator][value] += count
+}
+
+func getFacetCounts(conn *sql.DB, query string, args []any) (facetCounts, error) {
+	rows, err := conn.QueryContext(context.Background(), query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(facetCounts)
+	for rows.Next() {
+		var scheme, contentType, language, udc, domain string
+		var year, count int
+		if err := rows.Scan(&scheme, &contentType, &language, &udc, &domain, &year, &count); err != nil {
+			return nil, err
+		}
+		counts.add("protocol", scheme, count)
+		counts.add("type", contentType, count)
+		counts.add("lang", language, count)
+		counts.add("udc", udc, count)
+		counts.add("site", domain, count)
+		counts.add("year", strconv.Itoa(year), count)
+	}
+	return counts, rows.Err()
+}
+
+type facetValue struct {
+	Value string
+	Count int
+}
+
+// The most common values of a facet, most common first. A facet with only one value can't narrow down the results, so it has none.
+func (counts facetCounts) top(operator string, limit int) []facetValue {
+	if len(counts[operator]) < 2 {
+		return nil
+	}
+	values := make([]facetValue, 0, len(counts[operator]))
+	for value, count := range counts[operator] {
+		values = append(values, facetValue{value, count})
+	}
+	slices.SortFunc(values, func(a, b facetValue) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Value, b.Value)
+	})
+	return values[:min(limit, len(values))]
+}
+
+// The name a value of a facet is shown with
+func facetValueName(operator string, value string) string {
+	switch operator {
+	case "lang":
+		if language, ok := crawler.GetSearchLanguage(value); ok {
+			return language.Name
+		}
+		return strings.ToUpper(value)
+	case "udc":
+		if title := UdcClassStringToShortTitle(value); title != "Unknown" {
+			return value + ". " + title
+		}
+	}
+	return value
+}
+
+// Writes links that remove each of the filters of the search, to the search results at path. query is the query without its
+// filters, and with its lang: operator.
+func buildFacetFilters(builder *strings.Builder, path string, query string, facets searchFacets) {
+	for _, operator := range facetOperators {
+		if value, ok := facets[operator]; ok {
+			fmt.Fprintf(builder, "=> %s?%s Remove Filter %s:%s\n", path, url.QueryEscape(facetQuery(query, facets.with(operator, ""))), operator, value)
+		}
+	}
+}
+
+// Writes the links that add a filter of each of the most common values of the facets that aren't filtered yet. query is the query
+// without its filters, and with its lang: operator, and searchText is the query without the lang: operator either.
+func buildFacetLinks(builder *strings.Builder, path string, query string, searchText string, queryLang queryLanguage, facets searchFacets, counts facetCounts) {
+	for _, facet := range facetTitles {
+		if _, filtered := facets[facet.Operator]; filtered || (facet.Operator == "lang" && queryLang.Filter != "") {
+			continue
+		}
+		values := counts.top(facet.Operator, config.SearchFacetValues)
+		if len(values) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(builder, "\n### %s\n", facet.Title)
+		for _, value := range values {
+			var linkQuery string
+			if facet.Operator == "lang" {
+				linkQuery = facetQuery("lang:"+value.Value+" "+searchText, facets)
+			} else {
+				linkQuery = facetQuery(query, facets.with(facet.Operator, value.Value))
+			}
+			fmt.Fprintf(builder, "=> %s?%s %s (%d)\n", path, url.QueryEscape(linkQuery), facetValueName(facet.Operator, value.Value), value.Count)
+		}
+	}
+}
+
+// The path of the search results of a protocol, or of the debug search that shows the scores
+func searchPath(protocol string, showScores bool) string {
+	if showScores {
+		return "/search/debug_s/"
+	} else if protocol != "" {
+		return "/search/" + protocol + "/"
+	}
+	return "/search/s/"
+}
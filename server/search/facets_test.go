@@ -0,0 +1,89 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"gitlab.com/clseibold/auragem_sis/config"
+	"gitlab.com/clseibold/auragem_sis/crawler"
+)
+
+func TestParseQueryFacets(t *testing.T) {
+	tests := []struct {
+		query    string
+		rest     string
+		expected string
+	}{
+		{"gemini capsule", "gemini capsule", ""},
+		{"year:2024 gemini TYPE:Text/Gemini;charset=utf-8 capsule", "gemini capsule", "type:text/gemini year:2024"},
+		{"gemini site:Example.org protocol:gemini udc:8 lang:de", "gemini lang:de", "protocol:gemini udc:8 site:example.org"},
+		{"gemini year:soon type:gemini site:", "gemini year:soon type:gemini site:", ""},
+		{"gemini year:2023 year:2024", "gemini", "year:2024"},
+		{"gemini://example.org/ prototype:x", "gemini://example.org/ prototype:x", ""},
+	}
+	for _, test := range tests {
+		rest, facets := parseQueryFacets(test.query)
+		if rest != test.rest || facets.String() != test.expected {
+			t.Errorf("%q: expected %q and %q, got %q and %q", test.query, test.rest, test.expected, rest, facets.String())
+		}
+	}
+
+	// Facet links write the filters in the same order, whatever order they were added in
+	_, facets := parseQueryFacets("year:2024 protocol:gemini")
+	if query := facetQuery("gemini", facets.with("type", "text/gemini").with("year", "")); query != "gemini protocol:gemini type:text/gemini" {
+		t.Errorf("unexpected query %q", query)
+	}
+	if facets.String() != "protocol:gemini year:2024" {
+		t.Errorf("expected with to copy the filters, got %q", facets.String())
+	}
+}
+
+func TestFacetSearchSQL(t *testing.T) {
+	query, err := parseSearchQuery("gemini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	language, _ := crawler.GetSearchLanguage("en")
+	facets := searchFacets{"site": "example.org", "year": "2024", "udc": "8"}
+	actualQuery, args := facetSearchSQL(query, queryLanguage{Language: language, Filter: "en"}, "gopher", facets)
+	if strings.Contains(actualQuery, "%%") || strings.Contains(actualQuery, "example.org") || strings.Count(actualQuery, "?") != len(args) {
+		t.Fatalf("expected a parameter for each placeholder, and the filters to only be parameters:\n%s\n%v", actualQuery, args)
+	}
+	if args[1] != "(gemini) AND HIDDEN:false AND SCHEME:gopher" || args[4] != "gopher" || args[len(args)-3] != "example.org" || args[len(args)-4] != "8" {
+		t.Errorf("unexpected parameters: %v", args)
+	}
+	if from, ok := args[len(args)-2].(time.Time); !ok || from.Year() != 2024 {
+		t.Errorf("expected the year to be a range of timestamps, got %v", args[len(args)-2:])
+	}
+}
+
+func TestFacetCounts(t *testing.T) {
+	defer func(values int) { config.SearchFacetValues = values }(config.SearchFacetValues)
+	config.SearchFacetValues = 2
+
+	counts := make(facetCounts)
+	counts.add("lang", "en-US", 3)
+	counts.add("lang", "", 2)
+	counts.add("lang", "deu", 4)
+	counts.add("lang", "tok", 1)
+	counts.add("type", "TEXT/GEMINI", 5)
+	counts.add("year", "0", 5)
+	counts.add("year", "2024", 5)
+	counts.add("udc", "", 5)
+
+	if values := counts.top("lang", 5); len(values) != 3 || values[0] != (facetValue{"en", 5}) || values[1] != (facetValue{"de", 4}) || values[2] != (facetValue{"tok", 1}) {
+		t.Errorf("unexpected language counts %v", values)
+	}
+	if values := counts.top("type", 5); values != nil {
+		t.Errorf("expected no values for a facet that every result has, got %v", values)
+	}
+
+	var builder strings.Builder
+	_, facets := parseQueryFacets("protocol:gemini")
+	buildFacetLinks(&builder, "/search/gemini/", "lang:any capsule", "capsule", queryLanguage{}, facets, counts)
+	expected := "\n### Language\n=> /search/gemini/?lang%3Aen+capsule+protocol%3Agemini English (5)\n=> /search/gemini/?lang%3Ade+capsule+protocol%3Agemini Deutsch (4)\n"
+	if builder.String() != expected {
+		t.Errorf("expected links:\n%s\ngot:\n%s", expected, builder.String())
+	}
+}
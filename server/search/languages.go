@@ -0,0 +1,72 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gitlab.com/clseibold/auragem_sis/crawler"
+)
+
+// The language a query is searched in
+type queryLanguage struct {
+	Language crawler.SearchLanguage // Whose FTS indexes and analyzer the query is searched with
+	Filter   string                 // The language code results are limited to with the lang: operator, or empty for all languages
+	Detected bool                   // Whether the language was detected from the query rather than given with the lang: operator
+}
+
+// Matches the lang: operator, like "lang:de", "lang:pt-BR", or "lang:any"
+var langOperatorRegex = regexp.MustCompile(`(?i)(^|\s)lang:([a-z]{2,3}(-[a-z0-9]+)?|any|all)(\s|$)`)
+
+// Removes the lang: operator from the query, returning the rest of the query and the language to search it in. Languages without
+// their own FTS indexes can still be filtered to, and are searched with the English indexes. Without the operator, the language is
+// detected from the query, and results aren't limited to it.
+func parseQueryLanguage(query string) (string, queryLanguage) {
+	defaultLanguage := crawler.SearchLanguages[0]
+	match := langOperatorRegex.FindStringSubmatchIndex(query)
+	if match == nil {
+		if language, ok := crawler.DetectSearchLanguage(query); ok && language != defaultLanguage {
+			return query, queryLanguage{language, "", true}
+		}
+		return query, queryLanguage{defaultLanguage, "", false}
+	}
+
+	code := strings.ToLower(query[match[4]:match[5]])
+	rest := strings.TrimSpace(query[:match[0]] + " " + query[match[1]:])
+	if code == "any" || code == "all" {
+		return rest, queryLanguage{defaultLanguage, "", false}
+	}
+	code, _, _ = strings.Cut(code, "-")
+	if language, ok := crawler.GetSearchLanguage(code); ok {
+		return rest, queryLanguage{language, language.Code, false}
+	}
+	return rest, queryLanguage{defaultLanguage, code, false}
+}
+
+// The name of the language the results are limited to, or of the language the query was searched in
+func (language queryLanguage) Name() string {
+	if language.Filter != "" && language.Filter != language.Language.Code {
+		return strings.ToUpper(language.Filter)
+	}
+	return language.Language.Name
+}
+
+// The condition on the language column of pages that limits them to the language, and its parameters. The column has ISO 639-1
+// codes in either case, language tags like "en-US", and sometimes ISO 639-2 codes. Pages without a language are counted as English.
+func languageCondition(column string, code string) (string, []any) {
+	codes := []string{strings.ToUpper(code)}
+	if language, ok := crawler.GetSearchLanguage(code); ok {
+		codes = append(codes, strings.ToUpper(language.Code3))
+	}
+
+	conditions := make([]string, 0, 2*len(codes)+1)
+	args := make([]any, 0, 2*len(codes))
+	for _, c := range codes {
+		conditions = append(conditions, fmt.Sprintf("UPPER(%s) = ?", column), fmt.Sprintf("UPPER(%s) STARTING WITH ?", column))
+		args = append(args, c, c+"-")
+	}
+	if code == "en" {
+		conditions = append(conditions, fmt.Sprintf("%s = ''", column))
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", args
+}
@@ -0,0 +1,58 @@
+package search
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseQueryLanguage(t *testing.T) {
+	tests := []struct {
+		query    string
+		rest     string
+		language string // Code of the language whose indexes are searched
+		filter   string
+		detected bool
+		name     string
+	}{
+		{"gemini capsule", "gemini capsule", "en", "", false, "English"},
+		{"gemini lang:de capsule", "gemini capsule", "de", "de", false, "Deutsch"},
+		{"LANG:FR gemini", "gemini", "fr", "fr", false, "Français"},
+		{"gemini lang:pt-BR", "gemini", "pt", "pt", false, "Português"},
+		{"gemini lang:deu", "gemini", "de", "de", false, "Deutsch"},
+		{"gemini lang:ja-JP", "gemini", "en", "ja", false, "JA"},
+		{"gemini lang:eo", "gemini", "en", "eo", false, "EO"},
+		{"lang:any gemini", "gemini", "en", "", false, "English"},
+		{"gemini lang:all", "gemini", "en", "", false, "English"},
+		{"gemini lang:x", "gemini lang:x", "en", "", false, "English"},
+		{"gemini golang:de", "gemini golang:de", "en", "", false, "English"},
+		{"wie funktioniert das Internet heute eigentlich", "wie funktioniert das Internet heute eigentlich", "de", "", true, "Deutsch"},
+	}
+	for _, test := range tests {
+		rest, language := parseQueryLanguage(test.query)
+		if rest != test.rest || language.Language.Code != test.language || language.Filter != test.filter || language.Detected != test.detected {
+			t.Errorf("%q: expected %q searched in %s, filtered to %q (detected %v), got %q in %s, filtered to %q (detected %v)", test.query, test.rest, test.language, test.filter, test.detected, rest, language.Language.Code, language.Filter, language.Detected)
+		}
+		if name := language.Name(); name != test.name {
+			t.Errorf("%q: expected the language name %q, got %q", test.query, test.name, name)
+		}
+	}
+}
+
+func TestLanguageCondition(t *testing.T) {
+	tests := []struct {
+		code      string
+		condition string
+		args      []any
+	}{
+		{"de", "(UPPER(language) = ? OR UPPER(language) STARTING WITH ? OR UPPER(language) = ? OR UPPER(language) STARTING WITH ?)", []any{"DE", "DE-", "DEU", "DEU-"}},
+		{"pt", "(UPPER(language) = ? OR UPPER(language) STARTING WITH ? OR UPPER(language) = ? OR UPPER(language) STARTING WITH ?)", []any{"PT", "PT-", "POR", "POR-"}},
+		{"en", "(UPPER(language) = ? OR UPPER(language) STARTING WITH ? OR UPPER(language) = ? OR UPPER(language) STARTING WITH ? OR language = '')", []any{"EN", "EN-", "ENG", "ENG-"}},
+		{"ja", "(UPPER(language) = ? OR UPPER(language) STARTING WITH ?)", []any{"JA", "JA-"}},
+	}
+	for _, test := range tests {
+		condition, args := languageCondition("language", test.code)
+		if condition != test.condition || !slices.Equal(args, test.args) {
+			t.Errorf("%s: expected %s %v, got %s %v", test.code, test.condition, test.args, condition, args)
+		}
+	}
+}
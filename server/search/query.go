@@ -0,0 +1,663 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gitlab.com/clseibold/auragem_sis/config"
+)
+
+// Search queries are parsed into a tree of clauses before they're searched, so that they can be checked and then rendered as a
+// Lucene query that's passed to the FTS procedures as a bound parameter, rather than spliced into the SQL. The syntax is Lucene's
+// classic query syntax: terms, "phrases", FIELD:filters, [ranges TO them], (groups), the AND, OR, and NOT operators, + and -, and the
+// ~ and ^ suffixes. Lucene's special characters that the syntax doesn't use (like the ! in "hello!" or the / in a URL) are searched
+// as text rather than being errors.
+
+// The fields of the FTS indexes that can be searched with FIELD:term. Words followed by a colon that aren't one of these are
+// searched as text, so "gemini://" or "note:" don't need escaping.
+var queryFields = []string{
+	"TITLE", "PROMPT", "HEADINGS", "URL", "SCHEME", "CONTENTTYPE", "LANGUAGE", "PUBLISHDATE", "FEED", "HIDDEN",
+	"ALBUM", "ARTIST", "ALBUMARTIST", "COMPOSER", "COPYRIGHT",
+	"CONTENT", "PREFORMATTED",
+	"DESCRIPTION", "ALTTEXT", "CAMERAMAKE", "CAMERAMODEL", "TEXT",
+}
+
+const maxQueryClauses = 32 // Terms, phrases, and ranges in a query
+const maxQueryDepth = 8    // Groups within groups
+
+// QueryError is a problem with a search query that's shown to the user. Position is the byte offset in the query where the
+// problem was found.
+type QueryError struct {
+	Position int
+	Message  string
+}
+
+func (err *QueryError) Error() string {
+	return fmt.Sprintf("%s (at character %d)", err.Message, err.Position+1)
+}
+
+// How a clause of a boolean query must match. AND, OR, NOT, +, and - are all parsed into these, the same way Lucene's parser does.
+type occur int
+
+const (
+	occurShould  occur = iota // May match, and ranks higher when it does
+	occurMust                 // Must match (+term, or either side of AND)
+	occurMustNot              // Must not match (-term, or NOT term)
+)
+
+type queryNode interface {
+	render(builder *strings.Builder)
+}
+
+type queryClause struct {
+	Occur occur
+	Query queryNode
+}
+
+// A list of clauses. The top of a parsed query is one, and so is each group within it.
+type booleanQuery struct {
+	Clauses []queryClause
+	Boost   string
+}
+
+type termQuery struct {
+	Field    string
+	Text     string
+	Wildcard bool   // When true, each * and ? in Text is a wildcard
+	Fuzzy    string // "~", or "~" and the maximum edit distance or minimum similarity
+	Boost    string
+}
+
+type phraseQuery struct {
+	Field string
+	Text  string
+	Slop  string // The words can be up to this many positions apart
+	Boost string
+}
+
+type rangeQuery struct {
+	Field       string
+	From        string // "*" for an open range
+	To          string
+	IncludeFrom bool // [ rather than {
+	IncludeTo   bool // ] rather than }
+	Boost       string
+}
+
+// Renders the query in Lucene's syntax, escaping its text so that it's searched exactly as it was parsed
+func (query *booleanQuery) String() string {
+	var builder strings.Builder
+	query.renderClauses(&builder)
+	return builder.String()
+}
+
+func (query *booleanQuery) renderClauses(builder *strings.Builder) {
+	for i, clause := range query.Clauses {
+		if i > 0 {
+			builder.WriteByte(' ')
+		}
+		switch clause.Occur {
+		case occurMust:
+			builder.WriteByte('+')
+		case occurMustNot:
+			builder.WriteByte('-')
+		}
+		clause.Query.render(builder)
+	}
+}
+
+func (query *booleanQuery) render(builder *strings.Builder) {
+	builder.WriteByte('(')
+	query.renderClauses(builder)
+	builder.WriteByte(')')
+	renderBoost(builder, query.Boost)
+}
+
+func (query *termQuery) render(builder *strings.Builder) {
+	renderField(builder, query.Field)
+	if query.Text == "AND" || query.Text == "OR" || query.Text == "NOT" {
+		builder.WriteByte('\\')
+	}
+	for _, r := range query.Text {
+		if query.Wildcard && (r == '*' || r == '?') {
+			builder.WriteRune(r)
+			continue
+		}
+		if strings.ContainsRune(`+-&|!(){}[]^"~*?:\/`, r) || unicode.IsSpace(r) {
+			builder.WriteByte('\\')
+		}
+		builder.WriteRune(r)
+	}
+	builder.WriteString(query.Fuzzy)
+	renderBoost(builder, query.Boost)
+}
+
+func (query *phraseQuery) render(builder *strings.Builder) {
+	renderField(builder, query.Field)
+	renderQuoted(builder, query.Text)
+	if query.Slop != "" {
+		builder.WriteString("~" + query.Slop)
+	}
+	renderBoost(builder, query.Boost)
+}
+
+func (query *rangeQuery) render(builder *strings.Builder) {
+	renderField(builder, query.Field)
+	if query.IncludeFrom {
+		builder.WriteByte('[')
+	} else {
+		builder.WriteByte('{')
+	}
+	renderRangeBound(builder, query.From)
+	builder.WriteString(" TO ")
+	renderRangeBound(builder, query.To)
+	if query.IncludeTo {
+		builder.WriteByte(']')
+	} else {
+		builder.WriteByte('}')
+	}
+	renderBoost(builder, query.Boost)
+}
+
+func renderField(builder *strings.Builder, field string) {
+	if field != "" {
+		builder.WriteString(field + ":")
+	}
+}
+
+func renderBoost(builder *strings.Builder, boost string) {
+	if boost != "" {
+		builder.WriteString("^" + boost)
+	}
+}
+
+func renderQuoted(builder *strings.Builder, text string) {
+	builder.WriteByte('"')
+	for _, r := range text {
+		if r == '"' || r == '\\' {
+			builder.WriteByte('\\')
+		}
+		builder.WriteRune(r)
+	}
+	builder.WriteByte('"')
+}
+
+func renderRangeBound(builder *strings.Builder, bound string) {
+	if bound == "*" {
+		builder.WriteByte('*')
+	} else {
+		renderQuoted(builder, bound)
+	}
+}
+
+// Parses and checks a search query, returning a *QueryError when it can't be searched
+func parseSearchQuery(query string) (*booleanQuery, error) {
+	parser := &queryParser{input: query}
+	result, err := parser.parseClauses("", 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Clauses) == 0 {
+		return nil, &QueryError{0, "The query is empty"}
+	}
+	if err := validateSearchQuery(result, true); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type queryParser struct {
+	input   string
+	pos     int
+	clauses int
+}
+
+func (parser *queryParser) errorf(position int, format string, a ...interface{}) error {
+	return &QueryError{position, fmt.Sprintf(format, a...)}
+}
+
+func (parser *queryParser) peek() rune {
+	r, _ := utf8.DecodeRuneInString(parser.input[parser.pos:])
+	return r
+}
+
+func (parser *queryParser) atEnd() bool {
+	return parser.pos >= len(parser.input)
+}
+
+func (parser *queryParser) skipSpaces() {
+	for !parser.atEnd() {
+		r, size := utf8.DecodeRuneInString(parser.input[parser.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		parser.pos += size
+	}
+}
+
+// Whether the operator is next, followed by a space, a group, a phrase, or the end of the query
+func (parser *queryParser) nextIsOperator(operator string) bool {
+	if !strings.HasPrefix(parser.input[parser.pos:], operator) {
+		return false
+	}
+	after, _ := utf8.DecodeRuneInString(parser.input[parser.pos+len(operator):])
+	return parser.pos+len(operator) == len(parser.input) || unicode.IsSpace(after) || after == '(' || after == '"'
+}
+
+// Parses clauses until the end of the query, or until the ) of the group that started at groupStart. Clauses are given the field
+// unless they have their own, so that TITLE:(a b) searches both a and b in titles.
+func (parser *queryParser) parseClauses(field string, depth int, groupStart int) (*booleanQuery, error) {
+	result := &booleanQuery{}
+	for {
+		parser.skipSpaces()
+		if parser.atEnd() {
+			if groupStart >= 0 {
+				return nil, parser.errorf(groupStart, "This ( is never closed")
+			}
+			return result, nil
+		}
+		if parser.peek() == ')' {
+			if groupStart < 0 {
+				return nil, parser.errorf(parser.pos, "This ) has no ( before it")
+			}
+			parser.pos++
+			return result, nil
+		}
+
+		// The conjunction with the previous clause
+		conjunction := ""
+		conjunctionStart := parser.pos
+		for _, operators := range [][2]string{{"AND", "AND"}, {"&&", "AND"}, {"OR", "OR"}, {"||", "OR"}} {
+			if parser.nextIsOperator(operators[0]) {
+				conjunction = operators[1]
+				parser.pos += len(operators[0])
+				break
+			}
+		}
+		if conjunction != "" {
+			if len(result.Clauses) == 0 {
+				return nil, parser.errorf(conjunctionStart, "%s needs something to search before it", conjunction)
+			}
+			parser.skipSpaces()
+			if parser.atEnd() || parser.peek() == ')' {
+				return nil, parser.errorf(conjunctionStart, "%s needs something to search after it", conjunction)
+			}
+		}
+
+		// Modifiers. A lone + or - (like the one in "Gemini - Protocol") is ignored rather than applying to the next word.
+		modifier := occurShould
+		modifierStart := parser.pos
+		switch {
+		case parser.peek() == '+':
+			modifier = occurMust
+			parser.pos++
+		case parser.peek() == '-':
+			modifier = occurMustNot
+			parser.pos++
+		case parser.peek() == '!':
+			modifier = occurMustNot
+			parser.pos++
+		case parser.nextIsOperator("NOT"):
+			modifier = occurMustNot
+			parser.pos += len("NOT")
+			parser.skipSpaces()
+		}
+		if modifier != occurShould && (parser.atEnd() || unicode.IsSpace(parser.peek()) || parser.peek() == ')') {
+			if operator := parser.input[modifierStart]; operator != '+' && operator != '-' {
+				return nil, parser.errorf(modifierStart, "%s needs something to search after it", strings.TrimSpace(parser.input[modifierStart:parser.pos]))
+			}
+			modifier = occurShould
+			parser.skipSpaces()
+			if parser.atEnd() || parser.peek() == ')' {
+				if conjunction != "" {
+					return nil, parser.errorf(conjunctionStart, "%s needs something to search after it", conjunction)
+				}
+				continue
+			}
+		}
+
+		query, err := parser.parseClause(field, depth)
+		if err != nil {
+			return nil, err
+		}
+		result.addClause(conjunction, modifier, query)
+	}
+}
+
+// Adds a clause the way Lucene's parser does: AND makes the clauses on both sides of it required (unless they're excluded), and
+// + and - (or NOT) make a clause required or excluded.
+func (query *booleanQuery) addClause(conjunction string, modifier occur, clause queryNode) {
+	if conjunction == "AND" && len(query.Clauses) > 0 {
+		previous := &query.Clauses[len(query.Clauses)-1]
+		if previous.Occur != occurMustNot {
+			previous.Occur = occurMust
+		}
+	}
+	if conjunction == "AND" && modifier == occurShould {
+		modifier = occurMust
+	}
+	query.Clauses = append(query.Clauses, queryClause{modifier, clause})
+}
+
+// Parses a group, phrase, range, or term, along with its field and its suffixes
+func (parser *queryParser) parseClause(field string, depth int) (queryNode, error) {
+	start := parser.pos
+
+	// FIELD: is only a field when it's one of the fields of the indexes. Otherwise, the colon is part of the term.
+	word := parser.input[parser.pos:]
+	word = word[:strings.IndexFunc(word+" ", func(r rune) bool { return !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') })]
+	if word != "" && strings.HasPrefix(parser.input[parser.pos+len(word):], ":") && isQueryField(word) {
+		field = strings.ToUpper(word)
+		parser.pos += len(word) + 1
+		parser.skipSpaces()
+		if parser.atEnd() || parser.peek() == ')' {
+			return nil, parser.errorf(start, "%s: needs something to search after it", field)
+		}
+	}
+
+	switch parser.peek() {
+	case '(':
+		if depth+1 > maxQueryDepth {
+			return nil, parser.errorf(parser.pos, "Groups can't be more than %d deep", maxQueryDepth)
+		}
+		groupStart := parser.pos
+		parser.pos++
+		group, err := parser.parseClauses(field, depth+1, groupStart)
+		if err != nil {
+			return nil, err
+		}
+		if len(group.Clauses) == 0 {
+			return nil, parser.errorf(groupStart, "This group is empty")
+		}
+		group.Boost, err = parser.parseSuffix('^', groupStart)
+		return group, err
+	case '"':
+		return parser.parsePhrase(field)
+	case '[', '{':
+		return parser.parseRange(field)
+	}
+	return parser.parseTerm(field)
+}
+
+func isQueryField(word string) bool {
+	for _, field := range queryFields {
+		if strings.EqualFold(word, field) {
+			return true
+		}
+	}
+	return false
+}
+
+func (parser *queryParser) countClause(start int) error {
+	parser.clauses++
+	if parser.clauses > maxQueryClauses {
+		return parser.errorf(start, "Queries can't have more than %d terms", maxQueryClauses)
+	}
+	return nil
+}
+
+// Whether the character ends a term
+func endsTerm(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune(`()[]{}"^~`, r)
+}
+
+func (parser *queryParser) parseTerm(field string) (queryNode, error) {
+	start := parser.pos
+	var text strings.Builder
+	wildcard, escapedWildcard := false, false
+	for !parser.atEnd() {
+		r, size := utf8.DecodeRuneInString(parser.input[parser.pos:])
+		if endsTerm(r) {
+			break
+		}
+		parser.pos += size
+		if r == '\\' {
+			if parser.atEnd() {
+				return nil, parser.errorf(parser.pos-1, "The \\ at the end of the query doesn't escape anything")
+			}
+			r, size = utf8.DecodeRuneInString(parser.input[parser.pos:])
+			parser.pos += size
+			escapedWildcard = escapedWildcard || r == '*' || r == '?'
+		} else if r == '*' || r == '?' {
+			if text.Len() == 0 {
+				return nil, parser.errorf(start, "Terms can't start with a wildcard (* or ?)")
+			}
+			wildcard = true
+		}
+		text.WriteRune(r)
+	}
+	if text.Len() == 0 {
+		return nil, parser.errorf(start, "Unexpected %q", parser.peek())
+	} else if wildcard && escapedWildcard {
+		return nil, parser.errorf(start, "Terms with wildcards can't also have an escaped * or ?")
+	}
+	if err := parser.countClause(start); err != nil {
+		return nil, err
+	}
+
+	term := &termQuery{Field: field, Text: text.String(), Wildcard: wildcard}
+	if parser.peek() == '~' {
+		if wildcard {
+			return nil, parser.errorf(parser.pos, "Wildcard terms can't be fuzzy")
+		}
+		parser.pos++
+		term.Fuzzy = "~"
+		if number := parser.readNumber(); number != "" {
+			value, err := strconv.ParseFloat(number, 64)
+			if err != nil {
+				return nil, parser.errorf(start, "The fuzziness after ~ must be a number")
+			}
+			term.Fuzzy += strconv.FormatFloat(value, 'f', -1, 64)
+		}
+	}
+	var err error
+	term.Boost, err = parser.parseSuffix('^', start)
+	return term, err
+}
+
+func (parser *queryParser) parsePhrase(field string) (queryNode, error) {
+	start := parser.pos
+	text, err := parser.readQuoted()
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, parser.errorf(start, "This phrase is empty")
+	}
+	if err := parser.countClause(start); err != nil {
+		return nil, err
+	}
+
+	phrase := &phraseQuery{Field: field, Text: text}
+	if parser.peek() == '~' {
+		parser.pos++
+		slop, err := strconv.ParseUint(parser.readNumber(), 10, 16)
+		if err != nil {
+			return nil, parser.errorf(start, "The distance after the ~ of a phrase must be a whole number")
+		}
+		phrase.Slop = strconv.FormatUint(slop, 10)
+	}
+	phrase.Boost, err = parser.parseSuffix('^', start)
+	return phrase, err
+}
+
+// Reads the text between quotes, starting at the opening quote
+func (parser *queryParser) readQuoted() (string, error) {
+	start := parser.pos
+	parser.pos++
+	var text strings.Builder
+	for !parser.atEnd() {
+		r, size := utf8.DecodeRuneInString(parser.input[parser.pos:])
+		parser.pos += size
+		if r == '"' {
+			return text.String(), nil
+		} else if r == '\\' && !parser.atEnd() {
+			r, size = utf8.DecodeRuneInString(parser.input[parser.pos:])
+			parser.pos += size
+		}
+		text.WriteRune(r)
+	}
+	return "", parser.errorf(start, "This quote is never closed")
+}
+
+func (parser *queryParser) parseRange(field string) (queryNode, error) {
+	start := parser.pos
+	result := &rangeQuery{Field: field, IncludeFrom: parser.peek() == '['}
+	parser.pos++
+
+	var err error
+	if result.From, err = parser.readRangeBound(start); err != nil {
+		return nil, err
+	}
+	parser.skipSpaces()
+	if len(parser.input)-parser.pos < 2 || !strings.EqualFold(parser.input[parser.pos:parser.pos+2], "TO") {
+		return nil, parser.errorf(start, "Ranges need TO between their bounds, like [20220101 TO 20231201]")
+	}
+	parser.pos += len("TO")
+	if result.To, err = parser.readRangeBound(start); err != nil {
+		return nil, err
+	}
+	parser.skipSpaces()
+	switch parser.peek() {
+	case ']':
+		result.IncludeTo = true
+	case '}':
+	default:
+		return nil, parser.errorf(start, "This range is never closed with ] or }")
+	}
+	parser.pos++
+	if err := parser.countClause(start); err != nil {
+		return nil, err
+	}
+	result.Boost, err = parser.parseSuffix('^', start)
+	return result, err
+}
+
+func (parser *queryParser) readRangeBound(rangeStart int) (string, error) {
+	parser.skipSpaces()
+	if parser.peek() == '"' {
+		return parser.readQuoted()
+	}
+	start := parser.pos
+	for !parser.atEnd() {
+		r, size := utf8.DecodeRuneInString(parser.input[parser.pos:])
+		if unicode.IsSpace(r) || r == ']' || r == '}' {
+			break
+		}
+		parser.pos += size
+	}
+	if parser.pos == start {
+		return "", parser.errorf(rangeStart, "Ranges need a bound on both sides of TO, or * for no bound")
+	}
+	return parser.input[start:parser.pos], nil
+}
+
+// Parses a ^ boost, if there is one
+func (parser *queryParser) parseSuffix(suffix rune, clauseStart int) (string, error) {
+	if parser.peek() != suffix {
+		return "", nil
+	}
+	parser.pos++
+	value, err := strconv.ParseFloat(parser.readNumber(), 64)
+	if err != nil || value <= 0 {
+		return "", parser.errorf(clauseStart, "The boost after ^ must be a number above 0")
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64), nil
+}
+
+func (parser *queryParser) readNumber() string {
+	start := parser.pos
+	for !parser.atEnd() && (parser.input[parser.pos] >= '0' && parser.input[parser.pos] <= '9' || parser.input[parser.pos] == '.') {
+		parser.pos++
+	}
+	return parser.input[start:parser.pos]
+}
+
+// Checks that every list of clauses in the query has a clause that can match. Lucene matches nothing for a query that only
+// excludes terms, so it's better to tell the user why.
+func validateSearchQuery(query *booleanQuery, top bool) error {
+	matchable := false
+	for _, clause := range query.Clauses {
+		if clause.Occur != occurMustNot {
+			matchable = true
+		}
+		if group, isGroup := clause.Query.(*booleanQuery); isGroup {
+			if err := validateSearchQuery(group, false); err != nil {
+				return err
+			}
+		}
+	}
+	if !matchable && top {
+		return &QueryError{0, "The query only excludes terms. Add a term to search for."}
+	} else if !matchable {
+		return &QueryError{0, "A group in the query only excludes terms. Add a term to search for to it."}
+	}
+	return nil
+}
+
+// Gets the term of a clause that's an optional or required term without a field, wildcard, fuzziness, or boost
+func plainTerm(clause queryClause) (*termQuery, bool) {
+	term, isTerm := clause.Query.(*termQuery)
+	if !isTerm || clause.Occur == occurMustNot || term.Field != "" || term.Wildcard || term.Fuzzy != "" || term.Boost != "" {
+		return nil, false
+	}
+	return term, true
+}
+
+// Gets the phrase of a clause that's an optional or required phrase without a field, slop, or boost
+func plainPhrase(clause queryClause) (*phraseQuery, bool) {
+	phrase, isPhrase := clause.Query.(*phraseQuery)
+	if !isPhrase || clause.Occur == occurMustNot || phrase.Field != "" || phrase.Slop != "" || phrase.Boost != "" {
+		return nil, false
+	}
+	return phrase, true
+}
+
+// Gets the Lucene query, and the Lucene query of the page index, which only matches visible pages of the protocol (scheme) if one
+// is given
+func pageSearchQueries(query *booleanQuery, protocol string) (string, string) {
+	luceneQuery := query.String()
+	pageQuery := "(" + luceneQuery + ") AND HIDDEN:false"
+	if protocol != "" {
+		var builder strings.Builder
+		(&termQuery{Field: "SCHEME", Text: protocol}).render(&builder)
+		pageQuery += " AND " + builder.String()
+	}
+	return luceneQuery, pageQuery
+}
+
+// Builds the SQL of a search of pages with the query and its parameters, searching pages from all protocols, or only from the given
+// protocol (scheme). Only the conditions of the language and facet filters are put into the SQL, and their values are parameters too.
+func pageSearchSQL(query *booleanQuery, queryLang queryLanguage, protocol string, facets searchFacets, first int, skip int) (string, []any) {
+	luceneQuery, pageQuery := pageSearchQueries(query, protocol)
+	actualQuery := fts_searchQuery
+	if protocol != "" {
+		actualQuery = fts_searchQuery_protocol
+	}
+
+	args := []any{first, skip, config.SearchFTSWeight, config.SearchAnchorTextWeight, config.SearchInboundHostsWeight}
+	for _, fragmentSize := range []int{config.SearchSnippetLength, maxTitleFragment, config.SearchSnippetLength} {
+		args = append(args, luceneQuery, queryLang.Language.Analyzer, fragmentSize, highlightStart, highlightEnd)
+	}
+	args = append(args, queryLang.Language.PageIndex(), pageQuery, queryLang.Language.PageContentIndex(), luceneQuery)
+	if config.SearchAnchorTextWeight != 0 {
+		actualQuery = strings.Replace(actualQuery, `%%anchorsearch%%`, ftsAnchorTextSearch, 1)
+		args = append(args, luceneQuery)
+	} else {
+		actualQuery = strings.Replace(actualQuery, `%%anchorsearch%%`, "", 1)
+	}
+	if protocol != "" {
+		args = append(args, protocol)
+	}
+	filters, filterArgs := searchFilters(queryLang, facets)
+	return strings.Replace(actualQuery, `%%filters%%`, filters, 1), append(args, filterArgs...)
+}
+
+// The parts of the score of a search result from each signal, weighted the same way as in fts_searchQuery
+func (signals ScoreSignals) Contributions() (float64, float64, float64) {
+	return signals.FTS * config.SearchFTSWeight, signals.AnchorText * config.SearchAnchorTextWeight, math.Log(1+float64(signals.InboundHosts)) * config.SearchInboundHostsWeight
+}
@@ -0,0 +1,145 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gitlab.com/clseibold/auragem_sis/config"
+	"gitlab.com/clseibold/auragem_sis/crawler"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"gemini capsule", "gemini capsule"},
+		{"gemini AND capsule", "+gemini +capsule"},
+		{"gemini && capsule || gopher", "+gemini +capsule gopher"},
+		{"gemini OR capsule", "gemini capsule"},
+		{"gemini NOT capsule", "gemini -capsule"},
+		{"gemini AND NOT capsule", "+gemini -capsule"},
+		{"+gemini -gopher !spartan", "+gemini -gopher -spartan"},
+		{"Gemini - Protocol", "Gemini Protocol"},
+		{`"project gemini"~3^2 specification`, `"project gemini"~3^2 specification`},
+		{"TITLE:gemini URL: capsule", "TITLE:gemini URL:capsule"},
+		{"title:(gemini capsule) -URL:gopher", "(TITLE:gemini TITLE:capsule) -URL:gopher"},
+		{"TITLE:(gemini URL:capsule)^1.50", "(TITLE:gemini URL:capsule)^1.5"},
+		{"PUBLISHDATE:[20220101 to 20231201]", `PUBLISHDATE:["20220101" TO "20231201"]`},
+		{"PUBLISHDATE:{* TO 20231201]", `PUBLISHDATE:{* TO "20231201"]`},
+		{"gem* capsu?e colour~ colour~1 colour~0.8", "gem* capsu?e colour~ colour~1 colour~0.8"},
+		{`gemini://example.org/ hello! c++ a:b`, `gemini\:\/\/example.org\/ hello\! c\+\+ a\:b`},
+		{`\AND \(x\) don't`, `\AND \(x\) don't`},
+		{`'; DROP TABLE pages; --`, `'; DROP TABLE pages; -\-`},
+		{`CONTENTTYPE:("application/pdf")`, `(CONTENTTYPE:"application/pdf")`},
+		{"ANDROID ORCHID NOTES", "ANDROID ORCHID NOTES"},
+	}
+	for _, test := range tests {
+		query, err := parseSearchQuery(test.query)
+		if err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+		if query.String() != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.query, test.expected, query.String())
+		}
+	}
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+	}{
+		{"", 0},
+		{"   ", 0},
+		{"gemini (capsule", 7},
+		{"gemini capsule)", 14},
+		{`gemini "capsule`, 7},
+		{"AND gemini", 0},
+		{"gemini OR", 7},
+		{"gemini NOT", 7},
+		{"-gemini", 0},
+		{"gemini (-capsule)", 0},
+		{"gemini ()", 7},
+		{"TITLE:", 0},
+		{"*mini", 0},
+		{"gemini^", 0},
+		{"gemini^0", 0},
+		{`"gemini capsule"~x`, 0},
+		{"PUBLISHDATE:[2022", 12},
+		{"PUBLISHDATE:[2022 TO 2023", 12},
+		{"PUBLISHDATE:[ TO 2023]", 12},
+		{`gemini\`, 6},
+		{"((((((((((gemini))))))))))", 8},
+		{strings.Repeat("gemini ", maxQueryClauses+1), 7 * maxQueryClauses},
+	}
+	for _, test := range tests {
+		_, err := parseSearchQuery(test.query)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) {
+			t.Errorf("%q: expected a QueryError, got %v", test.query, err)
+		} else if queryErr.Position != test.position {
+			t.Errorf("%q: expected the error at %d, got %d (%s)", test.query, test.position, queryErr.Position, queryErr.Message)
+		}
+	}
+}
+
+func TestPageSearchSQL(t *testing.T) {
+	query, err := parseSearchQuery("gemini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	language, _ := crawler.GetSearchLanguage("de")
+	actualQuery, args := pageSearchSQL(query, queryLanguage{Language: language, Filter: "de"}, "gemini", searchFacets{"type": "text/gemini"}, 30, 60)
+	if strings.Contains(actualQuery, "%%") || strings.Contains(actualQuery, "gemini") {
+		t.Errorf("expected the query and protocol to only be parameters:\n%s", actualQuery)
+	}
+	if placeholders := strings.Count(actualQuery, "?"); placeholders != len(args) {
+		t.Fatalf("%d placeholders, but %d parameters", placeholders, len(args))
+	}
+	if args[0] != 30 || args[1] != 60 || args[5] != "gemini" || args[21] != "(gemini) AND HIDDEN:false AND SCHEME:gemini" || args[24] != "gemini" || args[25] != "gemini" || args[26] != "DE" || args[len(args)-1] != "text/gemini" {
+		t.Errorf("unexpected parameters: %v", args)
+	}
+
+	// Without the anchor text signal, its search is left out
+	defer func(weight float64) { config.SearchAnchorTextWeight = weight }(config.SearchAnchorTextWeight)
+	config.SearchAnchorTextWeight = 0
+	actualQuery, args = pageSearchSQL(query, queryLanguage{Language: language}, "", nil, 30, 0)
+	if strings.Contains(actualQuery, "LINKSIGNAL") || strings.Count(actualQuery, "?") != len(args) {
+		t.Errorf("expected no anchor text search, and a parameter for each placeholder:\n%s\n%v", actualQuery, args)
+	}
+}
+
+// Any query either fails with a QueryError or renders a Lucene query that parses back into the same query
+func FuzzParseSearchQuery(f *testing.F) {
+	for _, seed := range []string{
+		"gemini capsule", `"project gemini"~3^2`, "TITLE:(gemini URL:capsule)^1.5 -gopher", "PUBLISHDATE:{* TO 2023]",
+		"gem* colour~0.8 AND NOT spartan", `\AND \\ \" a:b gemini://x/`, "((a) OR (b AND c))", "a && || !b", "[\"a\" TO \"b\"]",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		query, err := parseSearchQuery(input)
+		if err != nil {
+			var queryErr *QueryError
+			if !errors.As(err, &queryErr) {
+				t.Fatalf("%q: expected a QueryError, got %v", input, err)
+			}
+			if queryErr.Position < 0 || queryErr.Position > len(input) {
+				t.Fatalf("%q: error position %d is outside of the query", input, queryErr.Position)
+			}
+			return
+		}
+
+		rendered := query.String()
+		reparsed, err := parseSearchQuery(rendered)
+		if err != nil {
+			t.Fatalf("%q rendered as %q, which doesn't parse: %v", input, rendered, err)
+		}
+		if reparsed.String() != rendered {
+			t.Fatalf("%q rendered as %q, which renders as %q", input, rendered, reparsed.String())
+		}
+	})
+}
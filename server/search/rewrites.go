@@ -0,0 +1,491 @@
+package search
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sis "gitlab.com/sis-suite/smallnetinformationservices"
+)
+
+// Query rewrite rules make common searches work better without users having to know the query syntax. They're kept in the
+// query_rewrites table, along with the built-in rules below, and are managed from /search/admin/rewrites/. Patterns match the words
+// of a query case-insensitively, and only words without a field, wildcard, fuzziness, or boost, so that a query written in the
+// query syntax is searched the way it was written. Excluded words aren't rewritten.
+
+// Rewrite rule types
+const (
+	rewritePhrase  = "phrase"  // The pattern's words are searched as a phrase when they're in the query one after another
+	rewriteSynonym = "synonym" // The value's alternatives (separated by commas) are also searched for the pattern's words
+	rewriteBoost   = "boost"   // The pattern's words rank higher by the value's boost
+	rewriteBang    = "bang"    // A query with the pattern (like !w) as its first or last word redirects to the value's URL, where %s is replaced by the rest of the query
+)
+
+// The rules that are always applied, written the same way as rules are added on the admin page
+var defaultRewriteRules = []string{
+	"phrase project gemini",
+	"synonym wikipedia = gemipedia", // Gemipedia is Wikipedia's gemini proxy
+	"boost gemipedia = 2",
+}
+
+type rewriteRule struct {
+	Id      int64 // 0 for built-in rules
+	Type    string
+	Pattern string
+	Value   string // Alternatives for synonym, boost for boost, URL for bang
+
+	words        []string
+	alternatives [][]string // The words of each of a synonym's alternatives
+	boost        string
+	err          error // Why a rule from the table is ignored
+}
+
+func newRewriteRule(ruleType string, pattern string, value string) (rewriteRule, error) {
+	words := strings.Fields(pattern)
+	rule := rewriteRule{Type: ruleType, Pattern: strings.Join(words, " "), Value: strings.TrimSpace(value), words: words}
+	if len(words) == 0 {
+		return rewriteRule{}, errors.New("rewrite rule needs a pattern")
+	}
+
+	switch ruleType {
+	case rewritePhrase:
+		if len(words) < 2 {
+			return rewriteRule{}, fmt.Errorf("phrase rule needs two or more words, got '%s'", rule.Pattern)
+		}
+	case rewriteSynonym:
+		for _, alternative := range strings.Split(rule.Value, ",") {
+			if alternativeWords := strings.Fields(alternative); len(alternativeWords) > 0 {
+				rule.alternatives = append(rule.alternatives, alternativeWords)
+			}
+		}
+		if len(rule.alternatives) == 0 {
+			return rewriteRule{}, errors.New("synonym rule needs one or more alternatives")
+		}
+	case rewriteBoost:
+		boost, err := strconv.ParseFloat(rule.Value, 64)
+		if err != nil || !(boost > 0) || math.IsInf(boost, 1) {
+			return rewriteRule{}, fmt.Errorf("boost rule needs a boost above 0, got '%s'", rule.Value)
+		}
+		rule.boost = strconv.FormatFloat(boost, 'f', -1, 64)
+	case rewriteBang:
+		if len(words) != 1 || len(rule.Pattern) < 2 || !strings.HasPrefix(rule.Pattern, "!") {
+			return rewriteRule{}, fmt.Errorf("bang rule needs one word starting with !, got '%s'", rule.Pattern)
+		}
+		target, err := url.Parse(strings.ReplaceAll(rule.Value, "%s", ""))
+		if err != nil || !target.IsAbs() || !strings.Contains(rule.Value, "%s") {
+			return rewriteRule{}, fmt.Errorf("bang rule needs an absolute URL with %%s where the query goes, got '%s'", rule.Value)
+		}
+	default:
+		return rewriteRule{}, fmt.Errorf("unknown rewrite rule type '%s'", ruleType)
+	}
+
+	return rule, nil
+}
+
+// Parses a rule written as its type, its pattern, and then = and its value if the type has one, like "synonym wikipedia = gemipedia"
+func parseRewriteRule(line string) (rewriteRule, error) {
+	ruleType, rest, _ := strings.Cut(strings.TrimSpace(line), " ")
+	pattern, value, _ := strings.Cut(rest, "=")
+	return newRewriteRule(strings.ToLower(ruleType), pattern, value)
+}
+
+// The rule written the way parseRewriteRule reads it
+func (rule rewriteRule) String() string {
+	if rule.Value == "" {
+		return rule.Type + " " + rule.Pattern
+	}
+	return rule.Type + " " + rule.Pattern + " = " + rule.Value
+}
+
+// The rules, split up by type. A set isn't changed once it's made, so it can be used without holding a lock.
+type rewriteRuleSet struct {
+	phrases  []rewriteRule
+	synonyms []rewriteRule
+	boosts   []rewriteRule
+	bangs    []rewriteRule
+}
+
+// Makes a set of the rules, leaving out the ones that aren't valid
+func newRewriteRuleSet(rules []rewriteRule) *rewriteRuleSet {
+	set := &rewriteRuleSet{}
+	for _, rule := range rules {
+		if rule.err != nil {
+			continue
+		}
+		switch rule.Type {
+		case rewritePhrase:
+			set.phrases = append(set.phrases, rule)
+		case rewriteSynonym:
+			set.synonyms = append(set.synonyms, rule)
+		case rewriteBoost:
+			set.boosts = append(set.boosts, rule)
+		case rewriteBang:
+			set.bangs = append(set.bangs, rule)
+		}
+	}
+	return set
+}
+
+var builtInRewriteRules []rewriteRule
+
+// rewriteRules holds the current rules, reloaded by loadRewriteRules
+var rewriteRules = struct {
+	sync.RWMutex
+	set *rewriteRuleSet
+}{}
+
+func init() {
+	for _, line := range defaultRewriteRules {
+		rule, err := parseRewriteRule(line)
+		if err != nil {
+			panic(fmt.Errorf("default rewrite rule '%s': %w", line, err))
+		}
+		builtInRewriteRules = append(builtInRewriteRules, rule)
+	}
+	rewriteRules.set = newRewriteRuleSet(builtInRewriteRules)
+}
+
+func currentRewriteRules() *rewriteRuleSet {
+	rewriteRules.RLock()
+	defer rewriteRules.RUnlock()
+	return rewriteRules.set
+}
+
+// Loads the built-in rules and the rules in the query_rewrites table. Rules in the table that aren't valid are left out. If the
+// table can't be read, the previous rules are kept.
+func loadRewriteRules(conn *sql.DB) error {
+	dbRules, err := getRewriteRules(conn)
+	if err != nil {
+		return err
+	}
+	for _, rule := range dbRules {
+		if rule.err != nil {
+			fmt.Printf("Ignoring rewrite rule #%d: %s\n", rule.Id, rule.err.Error())
+		}
+	}
+
+	set := newRewriteRuleSet(slices.Concat(builtInRewriteRules, dbRules))
+	rewriteRules.Lock()
+	rewriteRules.set = set
+	rewriteRules.Unlock()
+	return nil
+}
+
+// Gets the rules in the query_rewrites table. Rules that aren't valid are included with the reason they're ignored.
+func getRewriteRules(conn *sql.DB) ([]rewriteRule, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT id, ruletype, pattern, rulevalue FROM query_rewrites ORDER BY ruletype, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []rewriteRule
+	for rows.Next() {
+		var id int64
+		var ruleType, pattern, value string
+		if err := rows.Scan(&id, &ruleType, &pattern, &value); err != nil {
+			return nil, err
+		}
+		rule, err := newRewriteRule(strings.TrimSpace(ruleType), pattern, value)
+		if err != nil {
+			rule = rewriteRule{Type: strings.TrimSpace(ruleType), Pattern: pattern, Value: value, err: err}
+		}
+		rule.Id = id
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func addRewriteRule(conn *sql.DB, rule rewriteRule) error {
+	_, err := conn.ExecContext(context.Background(), "INSERT INTO query_rewrites (ruletype, pattern, rulevalue, date_added) VALUES (?, ?, ?, ?)", rule.Type, rule.Pattern, rule.Value, time.Now().UTC())
+	return err
+}
+
+func deleteRewriteRule(conn *sql.DB, id int64) error {
+	_, err := conn.ExecContext(context.Background(), "DELETE FROM query_rewrites WHERE id = ?", id)
+	return err
+}
+
+// Rewrites the query with the rules. Words are joined into phrases first, then synonyms are added, and then boosts are set, so that
+// a synonym rule can match a phrase that a phrase rule made, and a boost rule can boost an alternative that a synonym rule added.
+func (set *rewriteRuleSet) rewrite(query *booleanQuery) {
+	rewriteClauses(query, set.joinPhrases)
+	rewriteClauses(query, set.addSynonyms)
+	rewriteClauses(query, set.setBoosts)
+}
+
+// Rewrites the clauses of the query and of each group within it
+func rewriteClauses(query *booleanQuery, rewrite func([]queryClause) []queryClause) {
+	for _, clause := range query.Clauses {
+		if group, isGroup := clause.Query.(*booleanQuery); isGroup {
+			rewriteClauses(group, rewrite)
+		}
+	}
+	query.Clauses = rewrite(query.Clauses)
+}
+
+func (set *rewriteRuleSet) joinPhrases(clauses []queryClause) []queryClause {
+	result := make([]queryClause, 0, len(clauses))
+	for i := 0; i < len(clauses); {
+		_, matched := matchRewriteRule(set.phrases, clauses[i:], matchTerms)
+		if matched == 0 {
+			result = append(result, clauses[i])
+			i++
+			continue
+		}
+
+		// The phrase keeps the words as they were written
+		words := make([]string, matched)
+		for j, clause := range clauses[i : i+matched] {
+			words[j] = clause.Query.(*termQuery).Text
+		}
+		result = append(result, queryClause{clauses[i].Occur, &phraseQuery{Text: strings.Join(words, " ")}})
+		i += matched
+	}
+	return result
+}
+
+func (set *rewriteRuleSet) addSynonyms(clauses []queryClause) []queryClause {
+	result := make([]queryClause, 0, len(clauses))
+	for i := 0; i < len(clauses); {
+		rule, matched := matchRewriteRule(set.synonyms, clauses[i:], matchWords)
+		if matched == 0 {
+			result = append(result, clauses[i])
+			i++
+			continue
+		}
+
+		alternatives := make([]queryClause, len(rule.alternatives))
+		for j, words := range rule.alternatives {
+			if len(words) == 1 {
+				alternatives[j] = queryClause{occurShould, &termQuery{Text: words[0]}}
+			} else {
+				alternatives[j] = queryClause{occurShould, &phraseQuery{Text: strings.Join(words, " ")}}
+			}
+		}
+
+		if clauses[i].Occur == occurShould {
+			result = append(result, clauses[i:i+matched]...)
+			result = append(result, alternatives...)
+		} else {
+			// Required words are grouped with their alternatives, so that any one of them is required
+			original := queryClause{occurShould, clauses[i].Query}
+			if matched > 1 {
+				original = queryClause{occurShould, &booleanQuery{Clauses: slices.Clone(clauses[i : i+matched])}}
+			}
+			result = append(result, queryClause{occurMust, &booleanQuery{Clauses: append([]queryClause{original}, alternatives...)}})
+		}
+		i += matched
+	}
+	return result
+}
+
+func (set *rewriteRuleSet) setBoosts(clauses []queryClause) []queryClause {
+	for i := 0; i < len(clauses); {
+		rule, matched := matchRewriteRule(set.boosts, clauses[i:], matchWords)
+		for _, clause := range clauses[i : i+matched] {
+			switch query := clause.Query.(type) {
+			case *termQuery:
+				query.Boost = rule.boost
+			case *phraseQuery:
+				query.Boost = rule.boost
+			}
+		}
+		i += max(matched, 1)
+	}
+	return clauses
+}
+
+// Finds the first of the rules whose words match the start of the clauses. Returns the rule and the number of clauses it matched,
+// or 0 if none of them match.
+func matchRewriteRule(rules []rewriteRule, clauses []queryClause, match func([]queryClause, []string) int) (rewriteRule, int) {
+	for _, rule := range rules {
+		if matched := match(clauses, rule.words); matched > 0 {
+			return rule, matched
+		}
+	}
+	return rewriteRule{}, 0
+}
+
+// Matches the words against the terms at the start of the clauses, case-insensitively. The terms must all be optional, or all be
+// required. Returns the number of clauses matched, or 0.
+func matchTerms(clauses []queryClause, words []string) int {
+	if len(clauses) < len(words) {
+		return 0
+	}
+	for i, word := range words {
+		term, isPlainTerm := plainTerm(clauses[i])
+		if !isPlainTerm || clauses[i].Occur != clauses[0].Occur || !strings.EqualFold(term.Text, word) {
+			return 0
+		}
+	}
+	return len(words)
+}
+
+// Like matchTerms, but also matches a phrase of the same words
+func matchWords(clauses []queryClause, words []string) int {
+	if phrase, isPlainPhrase := plainPhrase(clauses[0]); isPlainPhrase {
+		if slices.EqualFunc(strings.Fields(phrase.Text), words, strings.EqualFold) {
+			return 1
+		}
+		return 0
+	}
+	return matchTerms(clauses, words)
+}
+
+// Gets the URL the query redirects to when its first or last word is the pattern of a bang rule
+func (set *rewriteRuleSet) bang(query string) (string, bool) {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return "", false
+	}
+	for _, rule := range set.bangs {
+		var rest []string
+		if strings.EqualFold(words[0], rule.Pattern) {
+			rest = words[1:]
+		} else if strings.EqualFold(words[len(words)-1], rule.Pattern) {
+			rest = words[:len(words)-1]
+		} else {
+			continue
+		}
+		// Gemini servers don't read + as a space in queries
+		escaped := strings.ReplaceAll(url.QueryEscape(strings.Join(rest, " ")), "+", "%20")
+		return strings.ReplaceAll(rule.Value, "%s", escaped), true
+	}
+	return "", false
+}
+
+// Admin pages to manage the query rewrite rules and to try them on queries
+func handleRewriteRules(s sis.VirtualServerHandle, conn *sql.DB) {
+	s.AddRoute("/search/admin/rewrites", func(request *sis.Request) {
+		request.Redirect("/search/admin/rewrites/")
+	})
+	s.AddRoute("/search/admin/rewrites/", func(request *sis.Request) {
+		if !checkAdminCert(request) {
+			return
+		}
+		rules, err := getRewriteRules(conn)
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		}
+
+		var builder strings.Builder
+		for _, rule := range rules {
+			if rule.err != nil {
+				fmt.Fprintf(&builder, "* #%d %s (ignored: %s)\n", rule.Id, rule.String(), rule.err.Error())
+			} else {
+				fmt.Fprintf(&builder, "* #%d %s\n", rule.Id, rule.String())
+			}
+			fmt.Fprintf(&builder, "=> /search/admin/rewrites/%d/delete Delete #%d\n", rule.Id, rule.Id)
+		}
+		fmt.Fprintf(&builder, "\n## Built-in\n")
+		for _, rule := range builtInRewriteRules {
+			fmt.Fprintf(&builder, "* %s\n", rule.String())
+		}
+
+		request.Gemini(fmt.Sprintf(`# Query Rewrite Rules
+
+=> /search/ Home
+=> /search/admin/crawls/ Crawl Jobs
+=> /search/admin/rewrites/add Add a Rule
+=> /search/admin/rewrites/test Test a Query
+
+Rules are written as their type, their pattern, and then = and their value if the type has one:
+* phrase project gemini: the words are searched as a phrase when they're in the query one after another
+* synonym wikipedia = gemipedia, wiki: the alternatives are also searched for the words
+* boost gemipedia = 2: the words rank higher by the boost
+* bang !w = gemini://example.org/search?%%s: a query that starts or ends with the bang redirects to the URL, with %%s replaced by the rest of the query
+
+Patterns match words in any case, and only words without a field, wildcard, fuzziness, or boost. Excluded words aren't rewritten.
+
+## Rules
+%s`, builder.String()))
+	})
+
+	s.AddRoute("/search/admin/rewrites/add", func(request *sis.Request) {
+		if !checkAdminCert(request) {
+			return
+		}
+		query, err := request.Query()
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		} else if query == "" {
+			request.RequestInput("Rule (type pattern = value):")
+			return
+		}
+
+		rule, err := parseRewriteRule(query)
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		}
+		if err := addRewriteRule(conn, rule); err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		}
+		reloadRewriteRules(request, conn)
+	})
+
+	s.AddRoute("/search/admin/rewrites/test", func(request *sis.Request) {
+		if !checkAdminCert(request) {
+			return
+		}
+		query, err := request.Query()
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		} else if query == "" {
+			request.RequestInput("Query:")
+			return
+		}
+
+		rules := currentRewriteRules()
+		query, _ = parseQueryLanguage(query)
+		var result string
+		if target, isBang := rules.bang(query); isBang {
+			result = "Redirects to " + target
+		} else if searchQuery, err := parseSearchQuery(query); err != nil {
+			result = err.Error()
+		} else {
+			rules.rewrite(searchQuery)
+			result = searchQuery.String()
+		}
+
+		request.Gemini(fmt.Sprintf("# Rewritten Query\n\n=> /search/admin/rewrites/ Query Rewrite Rules\n=> /search/admin/rewrites/test Test Another Query\n\n```\n%s\n```\n", result))
+	})
+
+	s.AddRoute("/search/admin/rewrites/:id/delete", func(request *sis.Request) {
+		if !checkAdminCert(request) {
+			return
+		}
+		id, err := strconv.ParseInt(request.GetParam("id"), 10, 64)
+		if err != nil {
+			request.NotFound("Rewrite rule not found.")
+			return
+		}
+		if err := deleteRewriteRule(conn, id); err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		}
+		reloadRewriteRules(request, conn)
+	})
+}
+
+// Reloads the rules after they've been changed and redirects back to the admin page
+func reloadRewriteRules(request *sis.Request, conn *sql.DB) {
+	if err := loadRewriteRules(conn); err != nil {
+		request.TemporaryFailure("%s", err.Error())
+		return
+	}
+	request.Redirect("/search/admin/rewrites/")
+}
@@ -0,0 +1,119 @@
+package search
+
+import (
+	"testing"
+)
+
+// Parses the rules and rewrites each query with them, comparing the rewritten queries with the expected ones
+func testRewriteRules(t *testing.T, lines []string, tests [][2]string) {
+	t.Helper()
+	var rules []rewriteRule
+	for _, line := range lines {
+		rule, err := parseRewriteRule(line)
+		if err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+		rules = append(rules, rule)
+	}
+	set := newRewriteRuleSet(rules)
+	for _, test := range tests {
+		query, err := parseSearchQuery(test[0])
+		if err != nil {
+			t.Fatalf("%q: %v", test[0], err)
+		}
+		set.rewrite(query)
+		if query.String() != test[1] {
+			t.Errorf("%q: expected %s, got %s", test[0], test[1], query.String())
+		}
+		if _, err := parseSearchQuery(query.String()); err != nil {
+			t.Errorf("%q: rewritten query %s doesn't parse: %v", test[0], query.String(), err)
+		}
+	}
+}
+
+func TestParseRewriteRule(t *testing.T) {
+	rule, err := parseRewriteRule("  Synonym  Wikipedia =  gemipedia,  wiki pedia ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.String() != "synonym Wikipedia = gemipedia,  wiki pedia ," || len(rule.alternatives) != 2 || len(rule.alternatives[1]) != 2 {
+		t.Errorf("unexpected rule %s with alternatives %q", rule.String(), rule.alternatives)
+	}
+
+	for _, line := range []string{
+		"", "phrase", "phrase gemini", "synonym wikipedia", "synonym wikipedia = ,", "boost gemini = 0", "boost gemini = x",
+		"bang w = gemini://example.org/?%s", "bang !w = gemini://example.org/", "bang !w = /search?%s", "bang !w x = gemini://example.org/?%s", "rename a = b",
+	} {
+		if _, err := parseRewriteRule(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestRewritePhrase(t *testing.T) {
+	testRewriteRules(t, []string{"phrase project gemini"}, [][2]string{
+		{"Project GEMINI spec", `"Project GEMINI" spec`},
+		{"+project +gemini", `+"project gemini"`},
+		{"project AND gemini OR capsule", `+"project gemini" capsule`},
+		{"(the project gemini)", `(the "project gemini")`},
+		{"project +gemini", "project +gemini"},
+		{"spec -project -gemini", "spec -project -gemini"},
+		{"TITLE:project gemini", "TITLE:project gemini"},
+		{"project gemini~ project^2 gemini", "project gemini~ project^2 gemini"},
+		{"gemini project", "gemini project"},
+	})
+}
+
+func TestRewriteSynonym(t *testing.T) {
+	testRewriteRules(t, []string{"synonym WikiPedia = gemipedia, free encyclopedia", "phrase project gemini", "synonym project gemini = geminiprotocol"}, [][2]string{
+		{"wikipedia cats", `wikipedia gemipedia "free encyclopedia" cats`},
+		{`"Wikipedia"`, `"Wikipedia" gemipedia "free encyclopedia"`},
+		{"+wikipedia cats", `+(wikipedia gemipedia "free encyclopedia") cats`},
+		{"-wikipedia cats", "-wikipedia cats"},
+		{"project gemini", `"project gemini" geminiprotocol`},
+		{`+"project gemini"`, `+("project gemini" geminiprotocol)`},
+		{"wikipedia~ URL:wikipedia", "wikipedia~ URL:wikipedia"},
+	})
+}
+
+func TestRewriteBoost(t *testing.T) {
+	testRewriteRules(t, []string{"synonym wikipedia = gemipedia", "boost gemipedia = 2.50", "boost project gemini = 3"}, [][2]string{
+		{"wikipedia", "wikipedia gemipedia^2.5"},
+		{"+wikipedia", "+(wikipedia gemipedia^2.5)"},
+		{"Gemipedia gemipedia^4", "Gemipedia^2.5 gemipedia^4"},
+		{"project gemini", "project^3 gemini^3"},
+		{`"Project Gemini" capsule`, `"Project Gemini"^3 capsule`},
+	})
+}
+
+func TestDefaultRewriteRules(t *testing.T) {
+	testRewriteRules(t, defaultRewriteRules, [][2]string{
+		{"Project Gemini wikipedia TITLE:project gemini", `"Project Gemini" wikipedia gemipedia^2 TITLE:project gemini`},
+	})
+}
+
+func TestRewriteBang(t *testing.T) {
+	rule, err := parseRewriteRule("bang !w = gemini://gemi.dev/cgi-bin/wp.cgi/search?%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := newRewriteRuleSet([]rewriteRule{rule})
+	tests := []struct {
+		query  string
+		target string
+	}{
+		{"!w project gemini", "gemini://gemi.dev/cgi-bin/wp.cgi/search?project%20gemini"},
+		{"c++ & go  !W", "gemini://gemi.dev/cgi-bin/wp.cgi/search?c%2B%2B%20%26%20go"},
+		{"!w", "gemini://gemi.dev/cgi-bin/wp.cgi/search?"},
+	}
+	for _, test := range tests {
+		if target, isBang := set.bang(test.query); !isBang || target != test.target {
+			t.Errorf("%q: expected a redirect to %s, got %s", test.query, test.target, target)
+		}
+	}
+	for _, query := range []string{"project !w gemini", "!wiki gemini", "w gemini", ""} {
+		if target, isBang := set.bang(query); isBang {
+			t.Errorf("%q: expected no redirect, got %s", query, target)
+		}
+	}
+}
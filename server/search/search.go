@@ -8,45 +8,104 @@ import (
 	"database/sql"
 	"fmt"
 	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	wiki "github.com/trietmn/go-wiki"
+	"gitlab.com/clseibold/auragem_sis/config"
 	"gitlab.com/clseibold/auragem_sis/crawler"
 	"gitlab.com/clseibold/auragem_sis/db"
 	sis "gitlab.com/sis-suite/smallnetinformationservices"
 	"golang.org/x/text/language"
 )
 
-// %%query%% replaced with the exact query the user entered, escaped and put in quotes
-// %%matches%% replaced with something like `t.NAME = 'term1' OR t.NAME = 'term2'`
+// The parameters of the search queries are bound in the order they appear, and are built by pageSearchSQL from the parsed query:
+// the FIRST and SKIP of the page of results, the weights of the FTS score and the link signals, the query, analyzer, fragment size,
+// and marks for the highlighter of the body text, title, and headings, the page index and its query, the content index and its
+// query, the anchor text query, the protocol, and then the parameters of the filters.
+// %%anchorsearch%% replaced with ftsAnchorTextSearch, or with nothing when the anchor text signal is turned off
+// %%filters%% replaced with the conditions limiting results to pages of a language and to the facet filters, or with nothing
 // Search query will rank domain root pages higher if they match the query
 
 // Search from all protocols
+// Matches on the page metadata and on the page body text are summed per page, and blended with the link signals of the page. Matches on
+// the anchor text only raise the score of pages that matched otherwise. The highlights are the best fragments of the body text, title, and headings, or empty where nothing matched, and are made into snippets by pageSnippets.
 var fts_searchQuery string = `
-select FIRST %%first%% SKIP %%skip%% COUNT(*) OVER () totalCount, (FTS.FTS$SCORE) as GROUPED_SCORE, P.ID, P.URL, P.SCHEME, P.DOMAINID, P.CONTENTTYPE, P.CHARSET, P.LANGUAGE, P.LINECOUNT, P.UDC, P.TITLE, P.PROMPT, P.SIZE, P.HASH, P.FEED, CASE WHEN EXTRACT(YEAR FROM P.PUBLISHDATE) < 1800 THEN TIMESTAMP '01.01.9999 00:00:00.000' ELSE P.PUBLISHDATE END AS PUBLISHDATE, P.INDEXTIME, P.ALBUM, P.ARTIST, P.ALBUMARTIST, P.COMPOSER, P.TRACK, P.DISC, P.COPYRIGHT, P.CRAWLINDEX, P.DATE_ADDED, P.LAST_SUCCESSFUL_VISIT, P.HIDDEN
-    FROM FTS$SEARCH('FTS_PAGE_ID_EN', '(%%query%%) AND HIDDEN:false') FTS
-    JOIN PAGES P ON P.ID = FTS.FTS$ID
-    WHERE P.HAS_DUPLICATE_ON_GEMINI=false
+select FIRST ? SKIP ? COUNT(*) OVER () totalCount, (S.SCORE * ? + S.ANCHOR_SCORE * ? + COALESCE(LN(1 + LS.INBOUND_HOSTS), 0) * ?) as GROUPED_SCORE, S.SCORE, S.ANCHOR_SCORE, COALESCE(LS.INBOUND_HOSTS, 0), COALESCE(FTS$HIGHLIGHTER.FTS$BEST_FRAGMENT(C.CONTENT, ?, ?, 'CONTENT', ?, ?, ?), '') AS HIGHLIGHT, COALESCE(FTS$HIGHLIGHTER.FTS$BEST_FRAGMENT(P.TITLE, ?, ?, 'TITLE', ?, ?, ?), '') AS TITLE_HIGHLIGHT, COALESCE(FTS$HIGHLIGHTER.FTS$BEST_FRAGMENT(P.HEADINGS, ?, ?, 'HEADINGS', ?, ?, ?), '') AS HEADINGS_HIGHLIGHT, P.ID, P.URL, P.SCHEME, P.DOMAINID, P.CONTENTTYPE, P.CHARSET, P.LANGUAGE, P.LINECOUNT, P.UDC, P.TITLE, P.PROMPT, P.SIZE, P.HASH, P.FEED, CASE WHEN EXTRACT(YEAR FROM P.PUBLISHDATE) < 1800 THEN TIMESTAMP '01.01.9999 00:00:00.000' ELSE P.PUBLISHDATE END AS PUBLISHDATE, P.INDEXTIME, P.ALBUM, P.ARTIST, P.ALBUMARTIST, P.COMPOSER, P.TRACK, P.DISC, P.COPYRIGHT, P.CRAWLINDEX, P.DATE_ADDED, P.LAST_SUCCESSFUL_VISIT, P.HIDDEN
+    FROM (SELECT M.PAGEID, SUM(M.SCORE) AS SCORE, SUM(M.ANCHOR_SCORE) AS ANCHOR_SCORE FROM (
+            SELECT FTS.FTS$ID AS PAGEID, FTS.FTS$SCORE AS SCORE, CAST(0 AS DOUBLE PRECISION) AS ANCHOR_SCORE FROM FTS$SEARCH(?, ?) FTS
+            UNION ALL
+            SELECT PC.PAGEID, FTS.FTS$SCORE AS SCORE, CAST(0 AS DOUBLE PRECISION) AS ANCHOR_SCORE FROM FTS$SEARCH(?, ?) FTS JOIN PAGE_CONTENTS PC ON PC.ID = FTS.FTS$ID%%anchorsearch%%
+        ) M GROUP BY M.PAGEID HAVING SUM(M.SCORE) > 0) S
+    JOIN PAGES P ON P.ID = S.PAGEID
+    LEFT JOIN PAGE_CONTENTS C ON C.PAGEID = P.ID
+    LEFT JOIN LINK_SIGNALS LS ON LS.PAGEID = P.ID
+    WHERE P.HIDDEN=false AND P.HAS_DUPLICATE_ON_GEMINI=false%%filters%%
 	ORDER BY GROUPED_SCORE DESC, CHAR_LENGTH(P.URL) ASC, PUBLISHDATE DESC
 `
 
+// Matches on the text of links to pages from other capsules, for the anchor text signal
+var ftsAnchorTextSearch = `
+            UNION ALL
+            SELECT LS.PAGEID, CAST(0 AS DOUBLE PRECISION) AS SCORE, FTS.FTS$SCORE AS ANCHOR_SCORE FROM FTS$SEARCH('FTS_LINKSIGNAL_ID_EN', ?) FTS JOIN LINK_SIGNALS LS ON LS.ID = FTS.FTS$ID`
+
 // Search from a specific protocol
 var fts_searchQuery_protocol string = `
-select FIRST %%first%% SKIP %%skip%% COUNT(*) OVER () totalCount, (FTS.FTS$SCORE) as GROUPED_SCORE, P.ID, P.URL, P.SCHEME, P.DOMAINID, P.CONTENTTYPE, P.CHARSET, P.LANGUAGE, P.LINECOUNT, P.UDC, P.TITLE, P.PROMPT, P.SIZE, P.HASH, P.FEED, CASE WHEN EXTRACT(YEAR FROM P.PUBLISHDATE) < 1800 THEN TIMESTAMP '01.01.9999 00:00:00.000' ELSE P.PUBLISHDATE END AS PUBLISHDATE, P.INDEXTIME, P.ALBUM, P.ARTIST, P.ALBUMARTIST, P.COMPOSER, P.TRACK, P.DISC, P.COPYRIGHT, P.CRAWLINDEX, P.DATE_ADDED, P.LAST_SUCCESSFUL_VISIT, P.HIDDEN
-    FROM FTS$SEARCH('FTS_PAGE_ID_EN', '(%%query%%) AND HIDDEN:false AND SCHEME:%%protocol%%') FTS
-    JOIN PAGES P ON P.ID = FTS.FTS$ID
+select FIRST ? SKIP ? COUNT(*) OVER () totalCount, (S.SCORE * ? + S.ANCHOR_SCORE * ? + COALESCE(LN(1 + LS.INBOUND_HOSTS), 0) * ?) as GROUPED_SCORE, S.SCORE, S.ANCHOR_SCORE, COALESCE(LS.INBOUND_HOSTS, 0), COALESCE(FTS$HIGHLIGHTER.FTS$BEST_FRAGMENT(C.CONTENT, ?, ?, 'CONTENT', ?, ?, ?), '') AS HIGHLIGHT, COALESCE(FTS$HIGHLIGHTER.FTS$BEST_FRAGMENT(P.TITLE, ?, ?, 'TITLE', ?, ?, ?), '') AS TITLE_HIGHLIGHT, COALESCE(FTS$HIGHLIGHTER.FTS$BEST_FRAGMENT(P.HEADINGS, ?, ?, 'HEADINGS', ?, ?, ?), '') AS HEADINGS_HIGHLIGHT, P.ID, P.URL, P.SCHEME, P.DOMAINID, P.CONTENTTYPE, P.CHARSET, P.LANGUAGE, P.LINECOUNT, P.UDC, P.TITLE, P.PROMPT, P.SIZE, P.HASH, P.FEED, CASE WHEN EXTRACT(YEAR FROM P.PUBLISHDATE) < 1800 THEN TIMESTAMP '01.01.9999 00:00:00.000' ELSE P.PUBLISHDATE END AS PUBLISHDATE, P.INDEXTIME, P.ALBUM, P.ARTIST, P.ALBUMARTIST, P.COMPOSER, P.TRACK, P.DISC, P.COPYRIGHT, P.CRAWLINDEX, P.DATE_ADDED, P.LAST_SUCCESSFUL_VISIT, P.HIDDEN
+    FROM (SELECT M.PAGEID, SUM(M.SCORE) AS SCORE, SUM(M.ANCHOR_SCORE) AS ANCHOR_SCORE FROM (
+            SELECT FTS.FTS$ID AS PAGEID, FTS.FTS$SCORE AS SCORE, CAST(0 AS DOUBLE PRECISION) AS ANCHOR_SCORE FROM FTS$SEARCH(?, ?) FTS
+            UNION ALL
+            SELECT PC.PAGEID, FTS.FTS$SCORE AS SCORE, CAST(0 AS DOUBLE PRECISION) AS ANCHOR_SCORE FROM FTS$SEARCH(?, ?) FTS JOIN PAGE_CONTENTS PC ON PC.ID = FTS.FTS$ID%%anchorsearch%%
+        ) M GROUP BY M.PAGEID HAVING SUM(M.SCORE) > 0) S
+    JOIN PAGES P ON P.ID = S.PAGEID
+    LEFT JOIN PAGE_CONTENTS C ON C.PAGEID = P.ID
+    LEFT JOIN LINK_SIGNALS LS ON LS.PAGEID = P.ID
+    WHERE P.HIDDEN=false AND P.SCHEME=?%%filters%%
 	ORDER BY GROUPED_SCORE DESC, CHAR_LENGTH(P.URL) ASC, PUBLISHDATE DESC
 `
 
+// Counts the pages matching a search by their facets, in every combination of the facets that they have. Pages are matched the same
+// way as by fts_searchQuery. %%filters%% is replaced with the condition on duplicates or on the protocol, and with the conditions of
+// the filters.
+var fts_facetQuery string = `
+SELECT F.SCHEME, F.CONTENTTYPE, F.LANGUAGE, F.UDC, F.HOST, F.PUBLISHYEAR, COUNT(*)
+FROM (SELECT COALESCE(P.SCHEME, '') AS SCHEME, COALESCE(P.CONTENTTYPE, '') AS CONTENTTYPE, COALESCE(P.LANGUAGE, '') AS LANGUAGE, COALESCE(P.UDC, '') AS UDC, COALESCE(D.DOMAIN, '') AS HOST, COALESCE(EXTRACT(YEAR FROM P.PUBLISHDATE), 0) AS PUBLISHYEAR
+    FROM (SELECT M.PAGEID FROM (
+            SELECT FTS.FTS$ID AS PAGEID, FTS.FTS$SCORE AS SCORE FROM FTS$SEARCH(?, ?) FTS
+            UNION ALL
+            SELECT PC.PAGEID, FTS.FTS$SCORE AS SCORE FROM FTS$SEARCH(?, ?) FTS JOIN PAGE_CONTENTS PC ON PC.ID = FTS.FTS$ID
+        ) M GROUP BY M.PAGEID HAVING SUM(M.SCORE) > 0) S
+    JOIN PAGES P ON P.ID = S.PAGEID
+    LEFT JOIN DOMAINS D ON D.ID = P.DOMAINID
+    WHERE P.HIDDEN=false AND %%filters%%
+    ) F
+GROUP BY F.SCHEME, F.CONTENTTYPE, F.LANGUAGE, F.UDC, F.HOST, F.PUBLISHYEAR
+`
+
+// Parameters: FIRST, SKIP, and the Lucene query for the highlighter and the search
+var fts_imageSearchQuery string = `
+SELECT FIRST ? SKIP ? COUNT(*) OVER () totalCount, FTS.FTS$SCORE AS SCORE,
+    COALESCE(FTS$HIGHLIGHTER.FTS$BEST_FRAGMENT(I.DESCRIPTION, ?, 'ENGLISH', 'DESCRIPTION', 70, '[', ']'), '') AS HIGHLIGHT,
+    P.ID, P.URL, P.SCHEME, P.DOMAINID, P.CONTENTTYPE, P.CHARSET, P.LANGUAGE, P.UDC, P.TITLE, P.PROMPT, P.SIZE, P.HASH, P.FEED, P.PUBLISHDATE, P.INDEXTIME, P.ALBUM, P.ARTIST, P.ALBUMARTIST, P.COMPOSER, P.TRACK, P.DISC, P.COPYRIGHT, P.CRAWLINDEX, P.DATE_ADDED, P.LAST_SUCCESSFUL_VISIT, P.HIDDEN,
+    COALESCE(I.WIDTH, 0), COALESCE(I.HEIGHT, 0), COALESCE(I.CAMERAMAKE, ''), COALESCE(I.CAMERAMODEL, ''), I.CAPTUREDATE, COALESCE(I.DESCRIPTION, ''), COALESCE(I.ALTTEXT, '')
+FROM FTS$SEARCH('FTS_IMAGE_ID_EN', ?) FTS
+JOIN IMAGES I ON I.ID = FTS.FTS$ID
+JOIN PAGES P ON P.ID = I.PAGEID
+WHERE P.HIDDEN = false
+ORDER BY FTS.FTS$SCORE DESC
+`
+
+// Parameters: FIRST, SKIP, and the Lucene query for the highlighter and the search
 var fts_audioSearchQuery string = `
-select FIRST %%first%% SKIP %%skip%% COUNT(*) OVER () totalCount, SUM(s.SCORE) as GROUPED_SCORE, s.HIGHLIGHT, s.ID, s.URL, s.SCHEME, s.DOMAINID, s.CONTENTTYPE, s.CHARSET, s.LANGUAGE, s.LINECOUNT, s.UDC, s.TITLE, s.PROMPT, s.SIZE, s.HASH, s.FEED, s.PUBLISHDATE, s.INDEXTIME, s.ALBUM, s.ARTIST, s.ALBUMARTIST, s.COMPOSER, s.TRACK, s.DISC, s.COPYRIGHT, s.CRAWLINDEX, s.DATE_ADDED, s.LAST_SUCCESSFUL_VISIT, s.HIDDEN
+select FIRST ? SKIP ? COUNT(*) OVER () totalCount, SUM(s.SCORE) as GROUPED_SCORE, s.HIGHLIGHT, s.ID, s.URL, s.SCHEME, s.DOMAINID, s.CONTENTTYPE, s.CHARSET, s.LANGUAGE, s.LINECOUNT, s.UDC, s.TITLE, s.PROMPT, s.SIZE, s.HASH, s.FEED, s.PUBLISHDATE, s.INDEXTIME, s.ALBUM, s.ARTIST, s.ALBUMARTIST, s.COMPOSER, s.TRACK, s.DISC, s.COPYRIGHT, s.CRAWLINDEX, s.DATE_ADDED, s.LAST_SUCCESSFUL_VISIT, s.HIDDEN
 FROM (select FTS.FTS$ID as fts_id, FTS.FTS$SCORE as SCORE,
-        FTS$HIGHLIGHTER.FTS$BEST_FRAGMENT(A.TEXT, '%%query%%', 'ENGLISH', 'TEXT', 70, '[', ']') AS HIGHLIGHT,
+        FTS$HIGHLIGHTER.FTS$BEST_FRAGMENT(A.TEXT, ?, 'ENGLISH', 'TEXT', 70, '[', ']') AS HIGHLIGHT,
         P.*
-    FROM FTS$SEARCH('FTS_AUDIOTRANSCRIPT_ID_EN', '%%query%%') FTS
+    FROM FTS$SEARCH('FTS_AUDIOTRANSCRIPT_ID_EN', ?) FTS
     JOIN AUDIOTRANSCRIPTS A ON A.ID = FTS.FTS$ID
     JOIN PAGES P ON A.PAGEID = P.ID
 	) s
@@ -134,11 +193,28 @@ func HandleSearchEngine(s sis.VirtualServerHandle) {
 	conn.SetMaxIdleConns(8 + 10)
 	conn.SetConnMaxLifetime(0)
 
-	// Crawler - full crawl every month, feed crawl every 13 hours, and on-demand capsule crawling
+	// Crawler - full crawl every month, feed crawl every 13 hours, daily re-crawl of frequently changing pages, and on-demand capsule crawling
 	lastFeedCrawl := time.Now()
 	feedCrawlHours := float64(0)
 	globalData := crawler.NewGlobalData(conn, true, true, 0) // Follows all links
+	globalData.SetCheckpointFile("crawl_frontier.json")      // Lets an interrupted crawl resume after a restart
+	globalData.SetFailurePolicy(crawler.FailurePolicy{TemporaryRetries: config.SearchFailureRetries, HideAfter: config.SearchFailureHideAfter})
+	if config.SearchArchiveDirectory != "" {
+		if archive, err := crawler.NewArchiveWriter(config.SearchArchiveDirectory, "crawl"); err != nil {
+			fmt.Printf("Couldn't open crawl archive directory: %s\n", err.Error())
+		} else {
+			globalData.SetArchive(archive)
+		}
+	}
+	if err := crawler.LoadCrawlRules("crawl_rules.txt", conn); err != nil {
+		fmt.Printf("Couldn't load crawl rules: %s\n", err.Error())
+	}
+	go crawler.WatchCrawlRules(time.Minute)
+	if err := loadRewriteRules(conn); err != nil {
+		fmt.Printf("Couldn't load query rewrite rules: %s\n", err.Error())
+	}
 	go crawler.RegularCrawler(globalData, nil)
+	go crawler.RecrawlCrawler(globalData, nil)
 	go crawler.FeedCrawler(globalData, 13, nil, func() {
 		// After each feed crawl, run the aggregator
 		Aggregate("/home/clseibold/ServerData/auragem_sis/SIS/auragem_gemini/search/yearposts/", conn)
@@ -230,7 +306,6 @@ func HandleSearchEngine(s sis.VirtualServerHandle) {
 	s.AddRoute("/search", func(request *sis.Request) {
 		request.Redirect("/search/")
 	})
-	// TODO: Removed Tag Index (=> /search/tags 🏷️ Tag Index)
 	publishDate, _ := time.ParseInLocation(time.RFC3339, "2021-07-01T00:00:00", time.Local)
 	updateDate, _ := time.ParseInLocation(time.RFC3339, "2024-03-13T00:00:00", time.Local)
 	s.AddRoute("/search/", func(request *sis.Request) {
@@ -245,6 +320,11 @@ func HandleSearchEngine(s sis.VirtualServerHandle) {
 		request.PromptLine("/search/gemini/", "🔍 Search Geminispace")
 		request.PromptLine("/search/scroll/", "🔍 Search Scrollspace")
 		request.PromptLine("/search/spartan/", "🔍 Search Spartanspace")
+		request.PromptLine("/search/gopher/", "🔍 Search Gopherspace")
+		request.Gemini("\n")
+		for _, language := range crawler.SearchLanguages {
+			request.PromptLine("/search/lang/"+language.Code+"/", "🌐 Search in "+language.Name)
+		}
 		request.Gemini(`
 => /search/scrollspace Scrollspace Index
 => /search/random/ 🎲 Goto Random Capsule
@@ -254,6 +334,8 @@ func HandleSearchEngine(s sis.VirtualServerHandle) {
 => /search/recent/ 50 Most Recently Indexed
 => /search/capsules/ 🪐 Recently Discovered Capsules
 => /search/mimetype/ Mimetypes
+=> /search/tags/ 🏷️ Tag Index
+=> /search/mentions/ Mentions Index
 
 => /search/features/ About and Features
 => /search/stats/ 📈 Statistics
@@ -264,6 +346,7 @@ func HandleSearchEngine(s sis.VirtualServerHandle) {
 => /search/images/ 🖼️ Indexed Image Files
 => /search/twtxt/ 📝 Indexed Twtxt Files
 => /search/security/ 📃 Indexed Security.txt Files
+=> /search/certs/ 🔏 Certificate History of Capsules
 
 => /search/configure_default/ Configure Default Search Engine in Lagrange
 
@@ -319,8 +402,8 @@ Note that AuraGem Search does not ensure or rank based on the popularity or accu
 				return
 			}
 			queryUrl.Fragment = "" // Strip the fragment
-			if (queryUrl.Scheme != "gemini" && queryUrl.Scheme != "nex" && queryUrl.Scheme != "spartan" && queryUrl.Scheme != "scroll") || !queryUrl.IsAbs() {
-				request.TemporaryFailure("Please enter only a Gemini, Nex, Spartan, or Scroll URL.")
+			if (queryUrl.Scheme != "gemini" && queryUrl.Scheme != "nex" && queryUrl.Scheme != "spartan" && queryUrl.Scheme != "scroll" && queryUrl.Scheme != "gopher") || !queryUrl.IsAbs() {
+				request.TemporaryFailure("Please enter only a Gemini, Nex, Spartan, Scroll, or Gopher URL.")
 				return
 			}
 			if queryUrl.Path == "" {
@@ -391,27 +474,33 @@ Note that AuraGem Search does not ensure or rank based on the popularity or accu
 * Full Text Search of page and file metadata, with Stemming, because apparently other search engines think it's important and unique to advertise one of the most common features in searching systems, lol.
 * Complex search queries using AND, OR, and NOT operators, as well as grouping using parentheses and quotes for multiword search terms. By default, if you do not use any of these operators, search terms are combined using OR, much like you would expect from web search engines. However, searches that have all the terms provided will still be ranked higher than searches with just one or a portion of the terms provided.
 * + and - operators. + is for a required term, - is for a search term that must not be matched.
+* Pages are indexed with the stemmers of English, German, French, Spanish, Italian, Portuguese, Dutch, and Russian. The language of a query is detected to search it with the stemmer of its language, and the lang: operator limits results to pages of a language, like "lang:de", or turns off the detection with "lang:any". Languages can also be picked from the search home page.
 
 * Title extraction using first apparent heading, regardless of its level.
 * Can detect gemsub feeds.
 * Line Counts of text files, and publication dates indexed based on dates in filenames.
 * File size information
 * Mp3, Ogg, and Flac file metadata (ID3, MP4, and Ogg/Flac) is indexed.
+* PDF and EPUB files have their title, author, page count, language, and text indexed, and DjVu files their metadata. Search them with CONTENTTYPE:("application/pdf") or CONTENTTYPE:("application/epub+zip"), and search their authors with the ARTIST filter.
+* Image files have their dimensions, camera, capture date, title, and description indexed from their EXIF, XMP, and IPTC metadata, along with the text of the links to them as their alt text. The image listing can be filtered by size and by the year images were taken, and image titles, descriptions, and alt text can be searched.
+* Full contents of gemtext, nex, markdown, and plain text files are indexed, with preformatted text indexed separately. Results show snippets of the body text and headings that matched, with the matched terms marked like **this**, and matched terms are also marked in titles.
 * A feed of Posts from Past Year organized based on publication date, from most recent to least recent.
 
-* Filters include "TITLE", "URL", "ALBUM", "ARTIST", "ALBUMARTIST", "COPYRIGHT", "CONTENTTYPE", "LANGUAGE", and "PUBLISHDATE", as well as others that are untested. The syntax is "field: term". You can also use groups for filters. Field names must be in all capital letters.
+* Filters include "TITLE", "URL", "ALBUM", "ARTIST", "ALBUMARTIST", "COPYRIGHT", "CONTENTTYPE", "LANGUAGE", and "PUBLISHDATE", as well as others that are untested. The syntax is "field: term". You can also use groups for filters, like TITLE:(gemini capsule).
 * Wildcards * and ?
 * Fuzzy Searching by placing ~ after a search term
 * Proximity Searching: if you want to search for two words that are within a distance of 10 words of each other, then query with "term_one term_two"~10
-* Range Searching: For searching in ranges of numbers or dates. Can be used with filters, like the PUBLISHDATE filter. An example of filtering based on a publication date range would be, PUBLISHDATE:[20220101 to 20231201]
+* Range Searching: For searching in ranges of numbers or dates. Can be used with filters, like the PUBLISHDATE filter. An example of filtering based on a publication date range would be, PUBLISHDATE:[20220101 TO 20231201]
+* Facets: The first page of results counts them by protocol, content type, language, subject (UDC class), capsule, and year, with links that narrow the results down to each. These filters can also be written in the query, like protocol:gemini, type:text/gemini, udc:8, site:example.org, or year:2024, and are kept when moving between pages of results.
+* Query Rewrites: Some common searches are rewritten to work better, like searching "project gemini" as a phrase, and also searching Gemipedia when searching for Wikipedia. Bangs like !wiki jump straight to another capsule, and some bangs search another capsule for the rest of the query instead.
 
 * Crawler: Robots.txt is followed, including "Allow", "Disallow", and "Crawl-Delay" directives. The Slow Down gemini status code is also followed.
 * Crawler: 2 second delay between crawling of pages on the same domain.
+* Ranking: Results are ranked by how well they match the query. The text of links to a page from other capsules, and how many capsules link to it, raise its rank a little, but only for pages that match the query themselves.
+* Crawler: Gopherspace is crawled too. Gophermaps are parsed for their links and info text, and can be searched on their own with the Gopherspace search.
+* Crawler: The TLS certificates of Gemini and Scroll capsules are recorded, along with when they changed, so that TOFU pins can be checked against the Certificate History.
 
 ## Features Coming Soon
-* PDF and Djvu file metadata indexed
-* Image file metadata indexed
-* Plain text file full contents indexed
 * Backlinks and searching of link text
 * Page Metadata Lookup
 * Full Markdown, Tinylog, and Twtxt parsing to get links, titles, and heading information.
@@ -424,7 +513,7 @@ AuraGem was a search engine that I started about 2 years ago under its original
 
 Note that some of the information in the above posts have been recently updated to match the current URL and Ip Address of the crawler and gemini capsule.
 
-One of the first priorities with AuraGem Search was to have extraction of file metadata for as many files as possible. Audio files were one of the first to get this feature. PDFs and Djvu files were supposed to be next, and support was added for them on 2022-07-19, but the feature was buggy and never worked, unfortunately. As you can see in the below post, I chose to go with Keyword Extraction (which was later removed and replaced with simple mentions and tags extraction) instead of Full Text Searching on page contents. Part of this was to save space, and part of it was to respect copyright. However, I am rethinking this approach now that the Stats page can determine how large the text-only portion of geminispace is (no more than 5GB total).
+One of the first priorities with AuraGem Search was to have extraction of file metadata for as many files as possible. Audio files were one of the first to get this feature. PDFs and Djvu files were supposed to be next, and support was added for them on 2022-07-19, but the feature was buggy and never worked, unfortunately. It has since been rewritten, and PDF, EPUB, and DjVu files now have their metadata and text extracted while crawling. As you can see in the below post, I chose to go with Keyword Extraction (which was later removed and replaced with simple mentions and tags extraction) instead of Full Text Searching on page contents. Part of this was to save space, and part of it was to respect copyright. However, I am rethinking this approach now that the Stats page can determine how large the text-only portion of geminispace is (no more than 5GB total).
 => /devlog/20220719.gmi 2022-07-19 AuraGem Search Engine Update
 => /search/stats/ Stats Page
 
@@ -533,6 +622,54 @@ When I type "Station", I want an exact match for Station itself. However, when I
 	var totalSizeTextCache float64 = -1
 	var lastCacheTime time.Time
 
+	// Admin page listing pages that keep failing (gone) and pages that failed before but came back (flaky)
+	s.AddRoute("/search/admin/failures", func(request *sis.Request) {
+		if !checkAdminCert(request) {
+			return
+		}
+
+		policy := globalData.FailurePolicy()
+		capsules, err := getCapsuleFailures(conn)
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		}
+		gone, err := getGonePages(conn, policy.HideAfter)
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		}
+		flaky, err := getFlakyPages(conn)
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		}
+
+		var builder strings.Builder
+		fmt.Fprintf(&builder, "## Capsules\n\n")
+		for _, capsule := range capsules {
+			fmt.Fprintf(&builder, "* %s: %d failing, %d recovered, %d failures total\n", capsule.Domain, capsule.FailingPages, capsule.RecoveredPages, capsule.TotalFailures)
+		}
+
+		fmt.Fprintf(&builder, "\n## Gone\nPages that failed permanently in %d or more consecutive crawls, and are hidden.\n\n", policy.HideAfter)
+		for _, failure := range gone {
+			fmt.Fprintf(&builder, "=> %s %d %s (%d crawls, since %s)\n", failure.Url, failure.Status, failure.Meta, failure.PermanentFailures, failure.FirstFailure.Format("2006-01-02"))
+		}
+
+		fmt.Fprintf(&builder, "\n## Flaky\nPages that failed before, but were fetched successfully since.\n\n")
+		for _, failure := range flaky {
+			fmt.Fprintf(&builder, "=> %s %d %s (%d failures, last on %s)\n", failure.Url, failure.Status, failure.Meta, failure.TotalFailures, failure.LastFailure.Format("2006-01-02"))
+		}
+
+		request.Gemini(fmt.Sprintf(`# Page Failures
+
+=> /search/ Home
+Temporary failures are retried %d times per crawl.
+
+%s
+`, policy.TemporaryRetries, builder.String()))
+	})
+
 	s.AddRoute("/search/stats", func(request *sis.Request) {
 		currentTime := time.Now()
 		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: currentTime, Abstract: "# AuraGem Search Stats\n"})
@@ -613,6 +750,9 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 	})
 
 	handleSearchFeedback(s)
+	handleCrawlJobs(s, globalData)
+	handleCerts(s, conn, publishDate, updateDate)
+	handleRewriteRules(s, conn)
 
 	s.AddRoute("/search/add_capsule", func(request *sis.Request) {
 		query, err := request.Query()
@@ -635,7 +775,7 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 				return
 			}
 			queryUrl.Fragment = "" // Strip the fragment
-			if (queryUrl.Scheme != "gemini" && queryUrl.Scheme != "nex" && queryUrl.Scheme != "spartan" && queryUrl.Scheme != "scroll") || !queryUrl.IsAbs() {
+			if (queryUrl.Scheme != "gemini" && queryUrl.Scheme != "nex" && queryUrl.Scheme != "spartan" && queryUrl.Scheme != "scroll" && queryUrl.Scheme != "gopher") || !queryUrl.IsAbs() {
 				request.Redirect("/search/add_capsule")
 				return
 			}
@@ -706,10 +846,9 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 				return
 			}
 
-			// AuraGem Search Keywords!
+			// AuraGem Search Keywords! Other bangs are handled by the bang rules in handleSearch.
 			if strings.HasPrefix(strings.TrimSpace(query), "!") {
-				query = strings.TrimSpace(strings.ToLower(query))
-				switch query {
+				switch strings.TrimSpace(strings.ToLower(query)) {
 				case "!kennedy":
 					request.Redirect("gemini://kennedy.gemi.dev/")
 				case "!auragem":
@@ -762,12 +901,14 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 					request.Redirect("gemini://tilde.team/~smokey/cgi-bin/search-engine-inputs.gmi")
 				case "!tldr", "!man":
 					request.Redirect("gemini://freeshell.de/tldr/")
+				default:
+					handleSearch(request, conn, query, 1, false, "")
 				}
 				return
 			}
 
 			// Page 1
-			handleSearch(request, conn, query, 1, false, false, false, false)
+			handleSearch(request, conn, query, 1, false, "")
 			return
 		}
 	})
@@ -794,12 +935,30 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 				return
 			}
 
-			handleSearch(request, conn, query, page, false, false, false, false)
+			handleSearch(request, conn, query, page, false, "")
 			return
 		}
 	})
 
 	// Geminispace search
+	// Searches pages of one language, with the stemmer of the language, by searching with the lang: operator
+	s.AddRoute("/search/lang/:lang", func(request *sis.Request) {
+		language, ok := crawler.GetSearchLanguage(request.GetParam("lang"))
+		if !ok {
+			request.NotFound("Language not found. Use the lang: operator in the query to search other languages.")
+			return
+		}
+		query, err := request.Query()
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		} else if query == "" {
+			request.RequestInput("Search Query (%s):", language.Name)
+			return
+		}
+		request.Redirect("/search/s/?%s", url.QueryEscape("lang:"+language.Code+" "+query))
+	})
+
 	s.AddRoute("/search/gemini", func(request *sis.Request) {
 		query, err := request.Query()
 		if err != nil {
@@ -816,7 +975,7 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 			}
 
 			// Page 1
-			handleSearch(request, conn, query, 1, false, true, false, false)
+			handleSearch(request, conn, query, 1, false, "gemini")
 			return
 		}
 	})
@@ -843,7 +1002,7 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 				return
 			}
 
-			handleSearch(request, conn, query, page, false, true, false, false)
+			handleSearch(request, conn, query, page, false, "gemini")
 			return
 		}
 	})
@@ -865,7 +1024,7 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 			}
 
 			// Page 1
-			handleSearch(request, conn, query, 1, false, false, true, false)
+			handleSearch(request, conn, query, 1, false, "scroll")
 			return
 		}
 	})
@@ -892,7 +1051,7 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 				return
 			}
 
-			handleSearch(request, conn, query, page, false, false, true, false)
+			handleSearch(request, conn, query, page, false, "scroll")
 			return
 		}
 	})
@@ -914,7 +1073,7 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 			}
 
 			// Page 1
-			handleSearch(request, conn, query, 1, false, false, false, true)
+			handleSearch(request, conn, query, 1, false, "spartan")
 			return
 		}
 	})
@@ -941,7 +1100,56 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 				return
 			}
 
-			handleSearch(request, conn, query, page, false, false, false, true)
+			handleSearch(request, conn, query, page, false, "spartan")
+			return
+		}
+	})
+
+	// Gopherspace search
+	s.AddRoute("/search/gopher", func(request *sis.Request) {
+		query, err := request.Query()
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		} else if query == "" {
+			request.RequestInput("Search Query:")
+			return
+		} else {
+			request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - '" + query + "'\n"})
+			if request.ScrollMetadataRequested() {
+				request.SendAbstract("")
+				return
+			}
+
+			// Page 1
+			handleSearch(request, conn, query, 1, false, "gopher")
+			return
+		}
+	})
+
+	s.AddRoute("/search/gopher/:page", func(request *sis.Request) {
+		pageStr := request.GetParam("page")
+		page, err := strconv.Atoi(pageStr)
+		if err != nil {
+			request.BadRequest("Couldn't parse int.")
+			return
+		}
+
+		query, err := request.Query()
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		} else if query == "" {
+			request.RequestInput("Search Query:")
+			return
+		} else {
+			request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - '" + query + "' Page " + pageStr + "\n"})
+			if request.ScrollMetadataRequested() {
+				request.SendAbstract("")
+				return
+			}
+
+			handleSearch(request, conn, query, page, false, "gopher")
 			return
 		}
 	})
@@ -957,7 +1165,7 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 			return
 		} else {
 			// Page 1
-			handleSearch(request, conn, query, 1, true, false, false, false)
+			handleSearch(request, conn, query, 1, true, "")
 			return
 		}
 	})
@@ -978,7 +1186,7 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 			request.RequestInput("Search Query:")
 			return
 		} else {
-			handleSearch(request, conn, query, page, true, false, false, false)
+			handleSearch(request, conn, query, page, true, "")
 			return
 		}
 	})
@@ -1022,6 +1230,8 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 				scheme = "spartan"
 			} else if capsule.Port == 1900 {
 				scheme = "nex"
+			} else if capsule.Port == 70 {
+				scheme = "gopher"
 			}
 			if capsule.Title == "" {
 				fmt.Fprintf(&builder, "=> %s://%s %s\n", scheme, capsule.Domain, capsule.Domain)
@@ -1060,6 +1270,162 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 `, builder.String()))
 	})
 
+	s.AddRoute("/search/tags", func(request *sis.Request) {
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - Tag Index\n"})
+		if request.ScrollMetadataRequested() {
+			request.SendAbstract("")
+			return
+		}
+
+		tagsList := getTags(conn)
+		var tags strings.Builder
+		for _, item := range tagsList {
+			fmt.Fprintf(&tags, "=> /search/tags/%s/ #%s (%d)\n", url.PathEscape(item.name), item.name, item.count)
+		}
+
+		request.Gemini(fmt.Sprintf(`# 🏷️ Tag Index
+
+=> /search/ Home
+=> /search/mentions/ Mentions Index
+
+%s
+`, tags.String()))
+	})
+
+	s.AddRoute("/search/tags/:tag", func(request *sis.Request) {
+		tag, err := url.PathUnescape(request.GetParam("tag"))
+		if err != nil {
+			request.BadRequest("Couldn't parse tag.")
+			return
+		}
+		tag = strings.ToLower(strings.TrimLeft(tag, "#"))
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - Pages Tagged #" + tag + "\n"})
+		if request.ScrollMetadataRequested() {
+			request.SendAbstract("")
+			return
+		}
+
+		pages := getPagesWithTag(conn, tag, false)
+		if len(pages) == 0 {
+			request.NotFound("Tag not found.")
+			return
+		}
+
+		var builder strings.Builder
+		buildPageResults(&builder, pages, false, false)
+
+		request.Gemini(fmt.Sprintf(`# Pages Tagged #%s
+
+=> /search/ Home
+=> /search/tags/ Tag Index
+=> /search/tags/%s/feed Subscribe to #%s
+
+%s
+`, tag, url.PathEscape(tag), tag, builder.String()))
+	})
+
+	s.AddRoute("/search/tags/:tag/feed", func(request *sis.Request) {
+		tag, err := url.PathUnescape(request.GetParam("tag"))
+		if err != nil {
+			request.BadRequest("Couldn't parse tag.")
+			return
+		}
+		tag = strings.ToLower(strings.TrimLeft(tag, "#"))
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - Feed of #" + tag + "\n"})
+		if request.ScrollMetadataRequested() {
+			request.SendAbstract("")
+			return
+		}
+
+		pages := getPagesWithTag(conn, tag, true)
+		if len(pages) == 0 {
+			request.NotFound("Tag not found.")
+			return
+		}
+
+		var builder strings.Builder
+		buildGemsubFeed(&builder, pages)
+		request.Gemini(fmt.Sprintf("# #%s - AuraGem Search\n\n%s", tag, builder.String()))
+	})
+
+	s.AddRoute("/search/mentions", func(request *sis.Request) {
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - Mentions Index\n"})
+		if request.ScrollMetadataRequested() {
+			request.SendAbstract("")
+			return
+		}
+
+		mentionsList := getMentions(conn)
+		var mentions strings.Builder
+		for _, item := range mentionsList {
+			fmt.Fprintf(&mentions, "=> /search/mentions/%s/ %s (%d)\n", url.PathEscape(item.name), item.name, item.count)
+		}
+
+		request.Gemini(fmt.Sprintf(`# Mentions Index
+
+=> /search/ Home
+=> /search/tags/ Tag Index
+
+%s
+`, mentions.String()))
+	})
+
+	s.AddRoute("/search/mentions/:mention", func(request *sis.Request) {
+		mention, err := url.PathUnescape(request.GetParam("mention"))
+		if err != nil {
+			request.BadRequest("Couldn't parse mention.")
+			return
+		}
+		mention = strings.ToLower(mention)
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - Pages Mentioning " + mention + "\n"})
+		if request.ScrollMetadataRequested() {
+			request.SendAbstract("")
+			return
+		}
+
+		pages := getPagesWithMention(conn, mention)
+		if len(pages) == 0 {
+			request.NotFound("Mention not found.")
+			return
+		}
+
+		var builder strings.Builder
+		buildPageResults(&builder, pages, false, false)
+
+		request.Gemini(fmt.Sprintf(`# Pages Mentioning %s
+
+=> /search/ Home
+=> /search/mentions/ Mentions Index
+=> /search/mentions/%s/feed Subscribe to %s
+
+%s
+`, mention, url.PathEscape(mention), mention, builder.String()))
+	})
+
+	s.AddRoute("/search/mentions/:mention/feed", func(request *sis.Request) {
+		mention, err := url.PathUnescape(request.GetParam("mention"))
+		if err != nil {
+			request.BadRequest("Couldn't parse mention.")
+			return
+		}
+		mention = strings.ToLower(mention)
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - Feed of " + mention + "\n"})
+		if request.ScrollMetadataRequested() {
+			request.SendAbstract("")
+			return
+		}
+
+		pages := getPagesWithMention(conn, mention)
+		if len(pages) == 0 {
+			request.NotFound("Mention not found.")
+			return
+		}
+
+		var builder strings.Builder
+		buildGemsubFeed(&builder, pages)
+		request.Gemini(fmt.Sprintf("# %s - AuraGem Search\n\n%s", mention, builder.String()))
+	})
+
 	/*
 			s.AddRoute("/search/yearposts", func(request *sis.Request) {
 				request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - Posts From The Past Year\n"})
@@ -1257,39 +1623,12 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 	})
 
 	s.AddRoute("/search/images", func(request *sis.Request) {
-		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - Indexed Image Files\n"})
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - " + imageListingTitle(imageFilter{}) + "\n"})
 		if request.ScrollMetadataRequested() {
 			request.SendAbstract("")
 			return
 		}
-
-		pages, _, _ := getImageFiles(conn, 1)
-
-		var builder strings.Builder
-		buildPageResults(&builder, pages, false, false)
-		/*for _, page := range pages {
-			artist := ""
-			if page.AlbumArtist != "" {
-				artist = "(" + page.AlbumArtist + ")"
-			} else if page.Artist != "" {
-				artist = "(" + page.Artist + ")"
-			}
-			if page.Title == "" {
-				fmt.Fprintf(&builder, "=> %s %s %s\n", page.Url, page.Url, artist)
-			} else {
-				fmt.Fprintf(&builder, "=> %s %s %s\n", page.Url, page.Title, artist)
-			}
-		}*/
-
-		request.Gemini(fmt.Sprintf(`# Indexed Image Files
-
-=> /search/ Home
-=> /search/s/ Search
-
-%s
-
-=> /search/images/2/ Next Page
-`, builder.String()))
+		handleImageListing(request, conn, imageFilter{}, 1)
 	})
 
 	s.AddRoute("/search/images/:page", func(request *sis.Request) {
@@ -1299,37 +1638,81 @@ Last Feed Crawl Time: %s (%.2f hours taken)
 			request.BadRequest("Page Number Error")
 			return
 		}
-		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - Indexed Image Files, Page " + pageStr + "\n"})
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - " + imageListingTitle(imageFilter{}) + ", Page " + pageStr + "\n"})
 		if request.ScrollMetadataRequested() {
 			request.SendAbstract("")
 			return
 		}
+		handleImageListing(request, conn, imageFilter{}, page_int)
+	})
 
-		pages, _, hasNextPage := getImageFiles(conn, page_int)
-		if len(pages) == 0 {
-			request.NotFound("Page not found.")
+	s.AddRoute("/search/images/f/:filter", func(request *sis.Request) {
+		filter, ok := parseImageFilter(request.GetParam("filter"))
+		if !ok {
+			request.BadRequest("Unknown image filter. Filter by size (small, medium, or large) and by year, like 'large,2024'.")
 			return
 		}
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - " + imageListingTitle(filter) + "\n"})
+		if request.ScrollMetadataRequested() {
+			request.SendAbstract("")
+			return
+		}
+		handleImageListing(request, conn, filter, 1)
+	})
 
-		var builder strings.Builder
-		buildPageResults(&builder, pages, false, false)
-
-		// Handle pagination
-		fmt.Fprintf(&builder, "\n")
-		if page_int > 1 {
-			fmt.Fprintf(&builder, "=> /search/images/%d/ Prev Page\n", page_int-1)
+	s.AddRoute("/search/images/f/:filter/:page", func(request *sis.Request) {
+		filter, ok := parseImageFilter(request.GetParam("filter"))
+		if !ok {
+			request.BadRequest("Unknown image filter. Filter by size (small, medium, or large) and by year, like 'large,2024'.")
+			return
 		}
-		if hasNextPage {
-			fmt.Fprintf(&builder, "=> /search/images/%d/ Next Page\n", page_int+1)
+		pageStr := request.GetParam("page")
+		page_int, parse_err := strconv.ParseInt(pageStr, 10, 64)
+		if parse_err != nil {
+			request.BadRequest("Page Number Error")
+			return
 		}
+		request.SetScrollMetadataResponse(sis.ScrollMetadata{Author: "Christian Lee Seibold", PublishDate: publishDate, UpdateDate: updateDate, Abstract: "# AuraGem Search - " + imageListingTitle(filter) + ", Page " + pageStr + "\n"})
+		if request.ScrollMetadataRequested() {
+			request.SendAbstract("")
+			return
+		}
+		handleImageListing(request, conn, filter, page_int)
+	})
 
-		request.Gemini(fmt.Sprintf(`# Indexed Image Files
-
-=> /search/ Home
-=> /search/s/ Search
+	s.AddRoute("/search/images/s", func(request *sis.Request) {
+		query, err := request.Query()
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		} else if query == "" {
+			request.RequestInput("Image Search Query:")
+			return
+		} else {
+			// Page 1
+			handleImageSearch(request, conn, query, 1)
+			return
+		}
+	})
+	s.AddRoute("/search/images/s/:page", func(request *sis.Request) {
+		pageStr := request.GetParam("page")
+		page, err := strconv.Atoi(pageStr)
+		if err != nil {
+			request.BadRequest("Couldn't parse int.")
+			return
+		}
 
-%s
-`, builder.String()))
+		query, err := request.Query()
+		if err != nil {
+			request.TemporaryFailure("%s", err.Error())
+			return
+		} else if query == "" {
+			request.RequestInput("Image Search Query:")
+			return
+		} else {
+			handleImageSearch(request, conn, query, page)
+			return
+		}
 	})
 
 	s.AddRoute("/search/twtxt", func(request *sis.Request) {
@@ -1467,6 +1850,19 @@ ORDER BY (r.ID + cast(? as bigint))*4294967291-((r.ID + cast(? as bigint))*42949
 	})
 }
 
+// Sends a certificate request or not-authorized response and returns false unless the request's certificate is config.AdminCertHash
+// or in config.AdminCertHashes
+func checkAdminCert(request *sis.Request) bool {
+	if !request.HasUserCert() {
+		request.RequestClientCert("Please enable a certificate")
+		return false
+	} else if hash := request.UserCertHash(); (config.AdminCertHash == "" || hash != config.AdminCertHash) && !slices.Contains(config.AdminCertHashes, hash) {
+		request.ClientCertNotAuthorized("Not authorized for this page")
+		return false
+	}
+	return true
+}
+
 func handleBacklinks(request *sis.Request, conn *sql.DB, url *url.URL) {
 	q := `SELECT COUNT(*) OVER () totalCount, r.ID, P_FROM.ID, P_FROM.URL, r.TITLE, r.CROSSHOST, r.CRAWLINDEX,
     r.DATE_ADDED
@@ -1510,7 +1906,8 @@ ORDER BY r.CROSSHOST ASC`
 `, url.String(), builder.String()))
 }
 
-func handleSearch(request *sis.Request, conn *sql.DB, query string, page int, showScores bool, gemini_only bool, scroll_only bool, spartan_only bool) {
+// Searches pages from all protocols, or only from the given protocol (scheme)
+func handleSearch(request *sis.Request, conn *sql.DB, query string, page int, showScores bool, protocol string) {
 	//rawQuery := c.URL().RawQuery
 	rawQuery, err := request.RawQuery()
 	if err != nil {
@@ -1520,52 +1917,32 @@ func handleSearch(request *sis.Request, conn *sql.DB, query string, page int, sh
 	results := 30
 	skip := (page - 1) * results
 
-	// Escape single quotes ('test' => '''test''')
-	queryFiltered := strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(query, "\n", " "), "\r", ""), "'", "''")
-	queryFiltered = strings.Replace(queryFiltered, "wikipedia", "gemipedia^2 wikipedia", 1)
-	queryFiltered = strings.Replace(queryFiltered, "Wikipedia", "gemipedia^2 Wikipedia", 1)
-	queryFiltered = strings.Replace(queryFiltered, "project gemini", "\"project gemini\"", 1)
-	queryFiltered = strings.Replace(queryFiltered, "Project Gemini", "\"Project Gemini\"", 1)
-	queryFiltered = strings.Replace(queryFiltered, "Project Gemini", "\"Project Gemini\"", 1)
-	queryFiltered = strings.Replace(queryFiltered, "project Gemini", "\"project Gemini\"", 1)
-	queryFiltered = strings.Replace(queryFiltered, "Project gemini", "\"Project gemini\"", 1)
-	//queryFiltered = strings.Replace(queryFiltered, "gemini", "\"gemini protocol\"", 1) // TODO: Doesn't work well yet
-
-	actualQuery := ""
-	if !gemini_only && !scroll_only && !spartan_only {
-		actualQuery = strings.Replace(fts_searchQuery, `%%query%%`, queryFiltered, 2) // TODO: Support for protocol-specific searching.
-	} else if gemini_only {
-		actualQuery = strings.Replace(fts_searchQuery_protocol, `%%query%%`, queryFiltered, 2) // TODO: Support for protocol-specific searching.
-		actualQuery = strings.Replace(actualQuery, `%%protocol%%`, "gemini", 1)
-	} else if scroll_only {
-		actualQuery = strings.Replace(fts_searchQuery_protocol, `%%query%%`, queryFiltered, 2) // TODO: Support for protocol-specific searching.
-		actualQuery = strings.Replace(actualQuery, `%%protocol%%`, "scroll", 1)
-	} else if spartan_only {
-		actualQuery = strings.Replace(fts_searchQuery_protocol, `%%query%%`, queryFiltered, 2) // TODO: Support for protocol-specific searching.
-		actualQuery = strings.Replace(actualQuery, `%%protocol%%`, "spartan", 1)
-	}
-	actualQuery = strings.Replace(actualQuery, `%%first%%`, strconv.Itoa(results), 1)
-	actualQuery = strings.Replace(actualQuery, `%%skip%%`, strconv.Itoa(skip), 1)
+	fullQuery := query
+	query, facets := parseQueryFacets(query)
+	filteredQuery := query // Without the facet filters, but with the lang: operator
+	query, queryLang := parseQueryLanguage(query)
+	path := searchPath(protocol, showScores)
 
-	parts := strings.Split(queryFiltered, " ")
-	var matchesBuilder strings.Builder
-	fmt.Fprintf(&matchesBuilder, "t.NAME = '%s' ", queryFiltered)
-	for _, part := range parts {
-		if part == "" {
-			continue
-		}
-		fmt.Fprintf(&matchesBuilder, "OR t.NAME = '%s' ", part)
+	rules := currentRewriteRules()
+	if target, isBang := rules.bang(query); isBang {
+		request.Redirect("%s", target)
+		return
 	}
-
-	actualQuery = strings.Replace(actualQuery, `%%matches%%`, matchesBuilder.String(), 1)
+	searchQuery, err := parseSearchQuery(query)
+	if err != nil {
+		showQueryError(request, query, err)
+		return
+	}
+	rules.rewrite(searchQuery)
+	actualQuery, args := pageSearchSQL(searchQuery, queryLang, protocol, facets, results, skip)
 	//q := `SELECT id, url, urlhash, scheme, domainid, contenttype, charset, language, title, prompt, size, hash, feed, publishdate, indextime, album, artist, albumartist, composer, track, disc, copyright, crawlindex, date_added, hidden FROM pages WHERE lower(url) LIKE lower(?) OR lower(title) LIKE lower(?) OR lower(artist) LIKE lower(?) OR lower(album) LIKE lower(?) OR lower(albumartist) LIKE lower(?) OR id IN (SELECT keywords.pageid FROM keywords where lower(keywords.keyword) LIKE ?)`
 
 	//fmt.Printf("Query: %s", queryBuilder.String())
 
-	fmt.Printf("%s\n", actualQuery)
+	fmt.Printf("Lucene Query: %s\n", searchQuery)
 
 	before := time.Now()
-	rows, rows_err := conn.QueryContext(context.Background(), actualQuery)
+	rows, rows_err := conn.QueryContext(context.Background(), actualQuery, args...)
 	after := time.Now()
 	timeTaken := after.Sub(before)
 	fmt.Printf("Time taken: %v\n", timeTaken)
@@ -1576,7 +1953,7 @@ func handleSearch(request *sis.Request, conn *sql.DB, query string, page int, sh
 		defer rows.Close()
 		for rows.Next() {
 			var page Page
-			scan_err := rows.Scan(&totalResultsCount, &page.Score, &page.Id, &page.Url, &page.Scheme, &page.DomainId, &page.Content_type, &page.Charset, &page.Language, &page.Linecount, &page.Udc, &page.Title, &page.Prompt, &page.Size, &page.Hash, &page.Feed, &page.PublishDate, &page.Index_time, &page.Album, &page.Artist, &page.AlbumArtist, &page.Composer, &page.Track, &page.Disc, &page.Copyright, &page.CrawlIndex, &page.Date_added, &page.LastSuccessfulVisit, &page.Hidden)
+			scan_err := rows.Scan(&totalResultsCount, &page.Score, &page.Signals.FTS, &page.Signals.AnchorText, &page.Signals.InboundHosts, &page.Highlight, &page.TitleHighlight, &page.HeadingsHighlight, &page.Id, &page.Url, &page.Scheme, &page.DomainId, &page.Content_type, &page.Charset, &page.Language, &page.Linecount, &page.Udc, &page.Title, &page.Prompt, &page.Size, &page.Hash, &page.Feed, &page.PublishDate, &page.Index_time, &page.Album, &page.Artist, &page.AlbumArtist, &page.Composer, &page.Track, &page.Disc, &page.Copyright, &page.CrawlIndex, &page.Date_added, &page.LastSuccessfulVisit, &page.Hidden)
 			if scan_err == nil {
 				pages = append(pages, page)
 			} else {
@@ -1584,14 +1961,17 @@ func handleSearch(request *sis.Request, conn *sql.DB, query string, page int, sh
 				if len(pages) > 0 {
 					prevPage = pages[len(pages)-1]
 				}
-				panic(fmt.Errorf("scan error after page %v; %s", prevPage, scan_err.Error()))
+				searchFailed(request, fmt.Errorf("scan error after page %v; %s", prevPage, scan_err.Error()))
+				return
 			}
 		}
 		if err := rows.Err(); err != nil {
-			panic(err)
+			searchFailed(request, err)
+			return
 		}
 	} else {
-		panic(rows_err)
+		searchFailed(request, rows_err)
+		return
 	}
 
 	resultsStart := skip + 1
@@ -1616,22 +1996,63 @@ func handleSearch(request *sis.Request, conn *sql.DB, query string, page int, sh
 		builder.WriteString("\n")
 	}
 
-	buildPageResults(&builder, pages, false, showScores)
+	buildPageResults(&builder, pages, true, showScores)
 
-	request.Gemini(fmt.Sprintf("\nQuery: '%s'\nTime Taken: %v\n\n%s\n", query, timeTaken, builder.String()))
+	var languageText string
+	if queryLang.Filter != "" {
+		languageText = fmt.Sprintf("Language: %s only\n=> %s?%s Search All Languages\n", queryLang.Name(), path, url.QueryEscape(facetQuery("lang:any "+query, facets)))
+	} else if queryLang.Detected {
+		languageText = fmt.Sprintf("Language: %s, detected from the query\n=> %s?%s Search Only %s Pages\n=> %s?%s Don't Detect the Language\n", queryLang.Name(), path, url.QueryEscape(facetQuery("lang:"+queryLang.Language.Code+" "+query, facets)), queryLang.Name(), path, url.QueryEscape(facetQuery("lang:any "+query, facets)))
+	}
+	var filtersText strings.Builder
+	buildFacetFilters(&filtersText, path, filteredQuery, facets)
+	request.Gemini(fmt.Sprintf("\nQuery: '%s'\n%s%sTime Taken: %v\n\n%s\n", fullQuery, languageText, filtersText.String(), timeTaken, builder.String()))
 
 	if hasPrevPage {
-		request.Gemini(fmt.Sprintf("\n=> /search/s/%d/?%s Previous Page\n", page-1, rawQuery))
+		request.Gemini(fmt.Sprintf("\n=> %s%d/?%s Previous Page\n", path, page-1, rawQuery))
 	}
 	if hasNextPage && !hasPrevPage {
-		request.Gemini(fmt.Sprintf("\n=> /search/s/%d/?%s Next Page\n", page+1, rawQuery))
+		request.Gemini(fmt.Sprintf("\n=> %s%d/?%s Next Page\n", path, page+1, rawQuery))
 	} else if hasNextPage && hasPrevPage {
-		request.Gemini(fmt.Sprintf("=> /search/s/%d/?%s Next Page\n", page+1, rawQuery))
+		request.Gemini(fmt.Sprintf("=> %s%d/?%s Next Page\n", path, page+1, rawQuery))
+	}
+
+	// The facets are only counted for the first page, since they're the same for the other pages
+	if page == 1 && totalResultsCount > 1 && config.SearchFacetValues > 0 {
+		facetSQL, facetArgs := facetSearchSQL(searchQuery, queryLang, protocol, facets)
+		if counts, err := getFacetCounts(conn, facetSQL, facetArgs); err != nil {
+			fmt.Printf("Couldn't count facets: %s\n", err.Error())
+		} else {
+			var facetsText strings.Builder
+			buildFacetLinks(&facetsText, path, filteredQuery, query, queryLang, facets, counts)
+			if facetsText.Len() > 0 {
+				request.Gemini(fmt.Sprintf("\n## Narrow Down\n%s", facetsText.String()))
+			}
+		}
 	}
 
 	request.Gemini("\nNote that AuraGem Search does not ensure or rank based on the popularity or accuracy of the information within any of the pages listed in these search results. One cannot presume that information published within Geminispace is or is not for ill-intent or misinformation, even if it's popular or well-linked, so one must use their best judgement in determining the trustworthiness of such content themselves.\n")
 }
 
+// Shows the user what's wrong with their query, pointing to where in the query the problem is
+func showQueryError(request *sis.Request, query string, err error) {
+	var builder strings.Builder
+	if queryErr, ok := err.(*QueryError); ok {
+		position := utf8.RuneCountInString(query[:queryErr.Position])
+		fmt.Fprintf(&builder, "%s.\n\n```\n%s\n%s^\n```\n", strings.TrimSuffix(queryErr.Message, "."), strings.ReplaceAll(query, "\n", " "), strings.Repeat(" ", position))
+	} else {
+		fmt.Fprintf(&builder, "%s\n", err.Error())
+	}
+	request.Gemini(fmt.Sprintf("# AuraGem Search - Problem With Query\n\n=> /search/ Home\n=> /search/features Search Syntax\n\n%s\n", builder.String()))
+	request.PromptLine("/search/s/", "New Search")
+}
+
+// Tells the user the search failed, rather than panicking, and logs why
+func searchFailed(request *sis.Request, err error) {
+	fmt.Printf("Search failed: %s\n", err.Error())
+	request.TemporaryFailure("The search failed. Please try again later.")
+}
+
 func handleSearchIndex(request sis.Request, conn *sql.DB) {
 	request.Gemini("Test\n")
 	query := "SELECT FIRST %%first%% SKIP %%skip%% COUNT(*) OVER () totalCount, P.ID, P.URL, P.SCHEME, P.DOMAINID, P.CONTENTTYPE, P.CHARSET, P.LANGUAGE, P.LINECOUNT, P.UDC, P.TITLE, P.PROMPT, P.SIZE, P.HASH, P.FEED, P.PUBLISHDATE, P.INDEXTIME, P.ALBUM, P.ARTIST, P.ALBUMARTIST, P.COMPOSER, P.TRACK, P.DISC, P.COPYRIGHT, P.CRAWLINDEX, P.DATE_ADDED, P.LAST_SUCCESSFUL_VISIT, P.HIDDEN FROM PAGES P"
@@ -1700,13 +2121,15 @@ func handleAudioSearch(request *sis.Request, conn *sql.DB, query string, page in
 	results := 30
 	skip := (page - 1) * results
 
-	queryFiltered := strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(query, "\n", " "), "\r", ""), "'", "''")
-	actualQuery := strings.Replace(fts_audioSearchQuery, `%%query%%`, queryFiltered, 2)
-	actualQuery = strings.Replace(actualQuery, `%%first%%`, strconv.Itoa(results), 1)
-	actualQuery = strings.Replace(actualQuery, `%%skip%%`, strconv.Itoa(skip), 1)
+	searchQuery, err := parseSearchQuery(query)
+	if err != nil {
+		showQueryError(request, query, err)
+		return
+	}
+	luceneQuery := searchQuery.String()
 
 	before := time.Now()
-	rows, rows_err := conn.QueryContext(context.Background(), actualQuery)
+	rows, rows_err := conn.QueryContext(context.Background(), fts_audioSearchQuery, results, skip, luceneQuery, luceneQuery)
 	after := time.Now()
 	timeTaken := after.Sub(before)
 	fmt.Printf("Time taken for audio search: %v\n", timeTaken)
@@ -1721,15 +2144,18 @@ func handleAudioSearch(request *sis.Request, conn *sql.DB, query string, page in
 			if scan_err == nil {
 				pages = append(pages, page)
 			} else {
-				panic(scan_err)
+				searchFailed(request, scan_err)
+				return
 			}
 		}
 
 		if err := rows.Err(); err != nil {
-			panic(err)
+			searchFailed(request, err)
+			return
 		}
 	} else {
-		panic(rows_err)
+		searchFailed(request, rows_err)
+		return
 	}
 
 	resultsStart := skip + 1
@@ -1761,6 +2187,206 @@ Time Taken: %v
 `, resultsStart, resultsEnd, totalResultsCount, query, timeTaken, builder.String()))
 }
 
+func imageListingTitle(filter imageFilter) string {
+	if filter == (imageFilter{}) {
+		return "Indexed Image Files"
+	}
+	return fmt.Sprintf("Indexed Image Files (%s)", filter.String())
+}
+
+// Lists the image files that match the filter, with links to filter them by size and by the year they were taken
+func handleImageListing(request *sis.Request, conn *sql.DB, filter imageFilter, page int64) {
+	title := imageListingTitle(filter)
+	images, _, hasNextPage := getImageFiles(conn, page, filter)
+	if len(images) == 0 && page > 1 {
+		request.NotFound("Page not found.")
+		return
+	}
+
+	var builder strings.Builder
+	if page == 1 {
+		fmt.Fprintf(&builder, "## Filter by Size\n")
+		for _, size := range []struct{ name, label string }{{"small", "Small, under 640 pixels"}, {"medium", "Medium, 640 to 1919 pixels"}, {"large", "Large, 1920 pixels and over"}} {
+			sizeFilter := filter
+			sizeFilter.Size = size.name
+			fmt.Fprintf(&builder, "=> %s %s\n", sizeFilter.Url(), size.label)
+		}
+		if filter.Size != "" {
+			anySize := filter
+			anySize.Size = ""
+			fmt.Fprintf(&builder, "=> %s Any Size\n", anySize.Url())
+		}
+
+		fmt.Fprintf(&builder, "\n## Filter by Year Taken\n")
+		for _, item := range getImageYears(conn) {
+			yearFilter := filter
+			yearFilter.Year = item.year
+			fmt.Fprintf(&builder, "=> %s %d (%d images)\n", yearFilter.Url(), item.year, item.count)
+		}
+		if filter.Year != 0 {
+			anyYear := filter
+			anyYear.Year = 0
+			fmt.Fprintf(&builder, "=> %s Any Year\n", anyYear.Url())
+		}
+		fmt.Fprintf(&builder, "\n## Images\n")
+	}
+	buildImageResults(&builder, images, false)
+
+	// Handle pagination
+	if page > 1 {
+		fmt.Fprintf(&builder, "=> %s%d/ Prev Page\n", filter.Url(), page-1)
+	}
+	if hasNextPage {
+		fmt.Fprintf(&builder, "=> %s%d/ Next Page\n", filter.Url(), page+1)
+	}
+
+	request.Gemini(fmt.Sprintf(`# %s
+
+=> /search/ Home
+=> /search/s/ Search
+=> /search/images/s/ 🔍 Search Image Titles, Descriptions, and Alt Text
+
+%s
+`, title, builder.String()))
+}
+
+func handleImageSearch(request *sis.Request, conn *sql.DB, query string, page int) {
+	rawQuery, err := request.RawQuery()
+	if err != nil {
+		request.TemporaryFailure("%s", err.Error())
+		return
+	}
+	results := 30
+	skip := (page - 1) * results
+
+	searchQuery, err := parseSearchQuery(query)
+	if err != nil {
+		showQueryError(request, query, err)
+		return
+	}
+	luceneQuery := searchQuery.String()
+
+	before := time.Now()
+	rows, rows_err := conn.QueryContext(context.Background(), fts_imageSearchQuery, results, skip, luceneQuery, luceneQuery)
+	after := time.Now()
+	timeTaken := after.Sub(before)
+	fmt.Printf("Time taken for image search: %v\n", timeTaken)
+
+	var images []ImagePage = make([]ImagePage, 0, results)
+	var totalResultsCount = 0 // Total count of all results, regardless of pagination
+	if rows_err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var image ImagePage
+			p := &image.Page
+			scan_err := rows.Scan(&totalResultsCount, &p.Score, &p.Highlight, &p.Id, &p.Url, &p.Scheme, &p.DomainId, &p.Content_type, &p.Charset, &p.Language, &p.Udc, &p.Title, &p.Prompt, &p.Size, &p.Hash, &p.Feed, &p.PublishDate, &p.Index_time, &p.Album, &p.Artist, &p.AlbumArtist, &p.Composer, &p.Track, &p.Disc, &p.Copyright, &p.CrawlIndex, &p.Date_added, &p.LastSuccessfulVisit, &p.Hidden, &image.Width, &image.Height, &image.CameraMake, &image.CameraModel, &image.CaptureDate, &image.Description, &image.AltText)
+			if scan_err == nil {
+				images = append(images, image)
+			} else {
+				searchFailed(request, scan_err)
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			searchFailed(request, err)
+			return
+		}
+	} else {
+		searchFailed(request, rows_err)
+		return
+	}
+
+	resultsStart := skip + 1
+	resultsEnd := Min(totalResultsCount, skip+results) // + 1 - 1
+	hasNextPage := resultsEnd < totalResultsCount && totalResultsCount != 0
+	hasPrevPage := resultsStart > results
+
+	var builder strings.Builder
+	buildImageResults(&builder, images, true)
+
+	if hasPrevPage {
+		fmt.Fprintf(&builder, "\n=> /search/images/s/%d/?%s Previous Page\n", page-1, rawQuery)
+	}
+	if hasNextPage && !hasPrevPage {
+		fmt.Fprintf(&builder, "\n=> /search/images/s/%d/?%s Next Page\n", page+1, rawQuery)
+	} else if hasNextPage && hasPrevPage {
+		fmt.Fprintf(&builder, "=> /search/images/s/%d/?%s Next Page\n", page+1, rawQuery)
+	}
+
+	request.Gemini(fmt.Sprintf(`# AuraGem Image Search - Results %d-%d/%d
+
+=> /search/ Home
+=> /search/images/ Indexed Image Files
+=> /search/images/s/ New Image Search
+
+Query: '%s'
+Time Taken: %v
+
+%s
+`, resultsStart, resultsEnd, totalResultsCount, query, timeTaken, builder.String()))
+}
+
+// Lists images with their dimensions, when they were taken and with what camera, and their alt text or description
+func buildImageResults(builder *strings.Builder, images []ImagePage, useHighlight bool) {
+	for _, image := range images {
+		page := image.Page
+		title := page.Title
+		if title == "" {
+			title = image.AltText
+		}
+		if title == "" {
+			title = page.Url
+		}
+		fmt.Fprintf(builder, "=> %s %s\n", page.Url, title)
+
+		details := make([]string, 0, 5)
+		if image.Width > 0 && image.Height > 0 {
+			details = append(details, fmt.Sprintf("%d×%d", image.Width, image.Height))
+		}
+		if image.CaptureDate.Valid && image.CaptureDate.V.Year() > 1800 {
+			details = append(details, "Taken on "+image.CaptureDate.V.Format("2006-01-02"))
+		}
+		if camera := strings.TrimSpace(image.CameraMake + " " + strings.TrimPrefix(image.CameraModel, image.CameraMake)); camera != "" {
+			details = append(details, camera)
+		}
+		if page.Artist != "" {
+			details = append(details, "by "+page.Artist)
+		}
+
+		size := float64(page.Size)
+		sizeLabel := "B"
+		if size > 1024 {
+			size /= 1024.0
+			sizeLabel = "KB"
+		}
+		if size > 1024 {
+			size /= 1024.0
+			sizeLabel = "MB"
+		}
+		if size > 1024 {
+			size /= 1024.0
+			sizeLabel = "GB"
+		}
+		details = append(details, fmt.Sprintf("%.1f %s", size, sizeLabel))
+		fmt.Fprintf(builder, "%s\n", strings.Join(details, " • "))
+
+		// The alt text is shown when it isn't the title already
+		if image.AltText != "" && image.AltText != title {
+			fmt.Fprintf(builder, "Alt Text: %s\n", image.AltText)
+		}
+		if useHighlight && page.Highlight != "" {
+			fmt.Fprintf(builder, "> %s\n", page.Highlight)
+		} else if description := strings.Join(strings.Fields(image.Description), " "); description != "" {
+			if utf8.RuneCountInString(description) > 200 {
+				description = string([]rune(description)[:200]) + "…"
+			}
+			fmt.Fprintf(builder, "> %s\n", description)
+		}
+		fmt.Fprintf(builder, "\n")
+	}
+}
+
 // TODO: Yiddish
 var Esperanto language.Tag = language.MustParse("eo")
 var Yiddish language.Tag = language.MustParse("yi")
@@ -1872,6 +2498,7 @@ func langTagToText(tag language.Tag) string {
 }
 
 func buildPageResults(builder *strings.Builder, pages []Page, useHighlight bool, showScores bool) {
+	seenSnippets := make(map[string]bool)
 	for _, page := range pages {
 		typeText := ""
 		if page.Prompt != "" {
@@ -1922,20 +2549,47 @@ func buildPageResults(builder *strings.Builder, pages []Page, useHighlight bool,
 			score = fmt.Sprintf(" (Score: %f)", page.Score)
 		}
 
+		title := page.Title
+		var snippets []string
+		if useHighlight {
+			title, snippets = pageSnippets(page, seenSnippets)
+		}
+
 		if page.Title == "" {
 			fmt.Fprintf(builder, "=> %s %s%s\n", page.Url, page.Url, score)
 			fmt.Fprintf(builder, "%s%s%s%s%d Lines • %.1f %s\n", typeText, publishDateString, langText, artist, page.Linecount, size, sizeLabel)
 		} else {
-			fmt.Fprintf(builder, "=> %s %s%s\n", page.Url, page.Title, score)
+			fmt.Fprintf(builder, "=> %s %s%s\n", page.Url, title, score)
 			fmt.Fprintf(builder, "%s%s%s%s%d Lines • %.1f %s • %s\n", typeText, publishDateString, langText, artist, page.Linecount, size, sizeLabel, page.Url)
 		}
-		if useHighlight {
-			fmt.Fprintf(builder, "> %s\n", page.Highlight)
+		if showScores {
+			fts, anchorText, inboundHosts := page.Signals.Contributions()
+			fmt.Fprintf(builder, "* FTS: %f (%f × %g)\n", fts, page.Signals.FTS, config.SearchFTSWeight)
+			fmt.Fprintf(builder, "* Anchor Text: %f (%f × %g)\n", anchorText, page.Signals.AnchorText, config.SearchAnchorTextWeight)
+			fmt.Fprintf(builder, "* Inbound Hosts: %f (ln(1 + %d) × %g)\n", inboundHosts, page.Signals.InboundHosts, config.SearchInboundHostsWeight)
+		}
+		for _, snippet := range snippets {
+			fmt.Fprintf(builder, "> %s\n", snippet)
 		}
 		fmt.Fprintf(builder, "\n")
 	}
 }
 
+// Builds a gemsub feed of the pages, dated by their publication date, or by when they were first indexed if they have none
+func buildGemsubFeed(builder *strings.Builder, pages []Page) {
+	for _, page := range pages {
+		date := page.PublishDate
+		if date.Year() < 1800 {
+			date = page.Date_added
+		}
+		title := page.Title
+		if title == "" {
+			title = page.Url
+		}
+		fmt.Fprintf(builder, "=> %s %s %s\n", page.Url, date.Format("2006-01-02"), title)
+	}
+}
+
 // Max returns the larger of x or y.
 func Max(x, y int) int {
 	if x < y {
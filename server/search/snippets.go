@@ -0,0 +1,141 @@
+package search
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+
+	"gitlab.com/clseibold/auragem_sis/config"
+)
+
+// The marks the FTS highlighter puts around the terms that matched. They're control characters so that they can't be confused with
+// the text of the page, and are replaced with snippetMark once a snippet has been made safe for gemtext.
+const highlightStart = "\x02"
+const highlightEnd = "\x03"
+
+// How matched terms are marked in snippets and titles. Gemtext has no inline formatting, so this is plain text that reads as
+// emphasis.
+const snippetMark = "**"
+
+// Fragment size of the title highlight, so that the whole title is kept
+const maxTitleFragment = 1024
+
+var snippetMarks = strings.NewReplacer(highlightStart, snippetMark, highlightEnd, snippetMark)
+
+// Gets the link text of a search result and its snippets, with the matched terms marked. Snippets are made from the best fragment
+// of the page's text and from its headings that matched. A snippet that repeats the link text or another snippet of the result is
+// left out, and so is one that's the same as a snippet of an earlier result in seen (like on mirrors of a page).
+func pageSnippets(page Page, seen map[string]bool) (string, []string) {
+	title := gemtextLine(page.Title)
+	linkText := title
+	if highlight := gemtextLine(page.TitleHighlight); highlight != "" && stripHighlights(highlight) == title {
+		linkText = snippetMarks.Replace(highlight)
+	}
+
+	candidates := make([]string, 0, 4)
+	if page.Highlight != "" {
+		candidates = append(candidates, page.Highlight)
+	}
+	for _, heading := range strings.Split(page.HeadingsHighlight, "\n") {
+		if strings.Contains(heading, highlightStart) {
+			candidates = append(candidates, strings.TrimLeft(strings.TrimSpace(heading), "# "))
+		}
+	}
+
+	snippets := make([]string, 0, config.SearchSnippetsPerResult)
+	keys := []string{snippetKey(title)}
+	for _, candidate := range candidates {
+		if len(snippets) >= config.SearchSnippetsPerResult {
+			break
+		}
+		snippet := truncateSnippet(gemtextLine(candidate), config.SearchSnippetLength)
+		key := snippetKey(stripHighlights(snippet))
+		if key == "" || seen[key] || slices.ContainsFunc(keys, func(k string) bool { return strings.Contains(k, key) }) {
+			continue
+		}
+		keys = append(keys, key)
+		seen[key] = true
+		snippets = append(snippets, snippetMarks.Replace(snippet))
+	}
+	return linkText, snippets
+}
+
+// Makes text safe to put on one line of gemtext, after a "> " or in the text of a link: line breaks and other spaces become single
+// spaces, and control characters other than the highlight marks are removed.
+func gemtextLine(text string) string {
+	var builder strings.Builder
+	space := false
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			space = builder.Len() > 0
+			continue
+		} else if unicode.IsControl(r) && string(r) != highlightStart && string(r) != highlightEnd {
+			continue
+		}
+		if space {
+			builder.WriteByte(' ')
+			space = false
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+func stripHighlights(text string) string {
+	return strings.NewReplacer(highlightStart, "", highlightEnd, "").Replace(text)
+}
+
+// The text a snippet is compared with to find repeats: its letters and digits, lowercased, with one space between words
+func snippetKey(text string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// Shortens a snippet to about length characters around its first highlight, cutting at spaces and marking the cuts with "…". A
+// highlight that's cut is closed, so that the marks stay paired.
+func truncateSnippet(snippet string, length int) string {
+	runes := []rune(snippet)
+	if len([]rune(stripHighlights(snippet))) <= length {
+		return snippet
+	}
+
+	start, first := 0, 0
+	if index := strings.Index(snippet, highlightStart); index > 0 {
+		first = len([]rune(snippet[:index]))
+		start = max(0, first-length/4)
+	}
+	for start > 0 && start < first && runes[start-1] != ' ' {
+		start++
+	}
+	end := min(len(runes), start+length)
+	if end < len(runes) {
+		for cut := end; cut > start+length/2; cut-- {
+			if runes[cut] == ' ' {
+				end = cut
+				break
+			}
+		}
+	}
+
+	var builder strings.Builder
+	if start > 0 {
+		builder.WriteString("…")
+	}
+	open := false
+	for _, r := range runes[start:end] {
+		if string(r) == highlightStart {
+			open = true
+		} else if string(r) == highlightEnd {
+			open = false
+		}
+		builder.WriteRune(r)
+	}
+	if open {
+		builder.WriteString(highlightEnd)
+	}
+	if end < len(runes) {
+		builder.WriteString("…")
+	}
+	return builder.String()
+}
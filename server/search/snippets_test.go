@@ -0,0 +1,65 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"gitlab.com/clseibold/auragem_sis/config"
+)
+
+func TestPageSnippets(t *testing.T) {
+	defer func(length, perResult int) {
+		config.SearchSnippetLength, config.SearchSnippetsPerResult = length, perResult
+	}(config.SearchSnippetLength, config.SearchSnippetsPerResult)
+	config.SearchSnippetLength, config.SearchSnippetsPerResult = 160, 2
+
+	page := Page{
+		Title:             "Gemini Capsules",
+		TitleHighlight:    "\x02Gemini\x03 Capsules",
+		Highlight:         "How to host a \x02gemini\x03 capsule.\n=> gemini://example.org/ Not a link\n```",
+		HeadingsHighlight: "# \x02Gemini\x03 Capsules\n## Hosting a \x02Gemini\x03 Capsule\n## Unrelated",
+	}
+	seen := make(map[string]bool)
+	linkText, snippets := pageSnippets(page, seen)
+	if linkText != "**Gemini** Capsules" {
+		t.Errorf("expected the matched terms of the title to be marked, got %q", linkText)
+	}
+	expected := []string{"How to host a **gemini** capsule. => gemini://example.org/ Not a link ```", "Hosting a **Gemini** Capsule"}
+	if strings.Join(snippets, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected snippets %q, got %q", expected, snippets)
+	}
+
+	// The snippets of an earlier result, like one on a mirror of the page, aren't repeated. The heading that repeated the title of
+	// the earlier result is shown now that the title is different.
+	page.Title = "Mirror"
+	if _, snippets := pageSnippets(page, seen); len(snippets) != 1 || snippets[0] != "**Gemini** Capsules" {
+		t.Errorf("expected only the snippet that wasn't shown before, got %q", snippets)
+	}
+
+	// A title that's been cut short by the highlighter isn't used as the link text
+	linkText, _ = pageSnippets(Page{Title: "Gemini Capsules", TitleHighlight: "\x02Gemini\x03"}, seen)
+	if linkText != "Gemini Capsules" {
+		t.Errorf("expected the title as the link text, got %q", linkText)
+	}
+}
+
+func TestTruncateSnippet(t *testing.T) {
+	text := strings.Repeat("lorem ipsum ", 20) + "\x02gemini\x03 " + strings.Repeat("dolor sit ", 20)
+	snippet := truncateSnippet(text, 60)
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") || !strings.Contains(snippet, "\x02gemini\x03") {
+		t.Errorf("expected a snippet around the highlight, got %q", snippet)
+	}
+	if length := utf8.RuneCountInString(snippet); length > 62 {
+		t.Errorf("expected at most 60 characters and the cut marks, got %d", length)
+	}
+
+	snippet = truncateSnippet("\x02"+strings.Repeat("a", 100)+"\x03", 10)
+	if strings.Count(snippet, "\x02") != strings.Count(snippet, "\x03") {
+		t.Errorf("expected the cut highlight to be closed, got %q", snippet)
+	}
+
+	if snippet := truncateSnippet("short \x02text\x03", 10); snippet != "short \x02text\x03" {
+		t.Errorf("expected a short snippet to be kept, got %q", snippet)
+	}
+}
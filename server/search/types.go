@@ -65,7 +65,29 @@ type Page struct {
 
 	Hidden bool
 
-	Highlight string // Used for highlights when searching
+	Highlight         string // Used for highlights when searching
+	TitleHighlight    string // The title with the matched terms marked, when searching
+	HeadingsHighlight string // The headings that matched, with the matched terms marked, when searching
+	Signals           ScoreSignals
+}
+
+// The signals blended into the score of a search result (see fts_searchQuery)
+type ScoreSignals struct {
+	FTS          float64 // FTS score of the page's metadata and text
+	AnchorText   float64 // FTS score of the text of links to the page from other capsules
+	InboundHosts int     // Capsules that link to the page
+}
+
+// An image file, with its metadata from the images table. Images indexed before their metadata was extracted have none.
+type ImagePage struct {
+	Page        Page
+	Width       int
+	Height      int
+	CameraMake  string
+	CameraModel string
+	CaptureDate sql.Null[time.Time]
+	Description string
+	AltText     string
 }
 
 type PageWithDomain struct {
@@ -82,3 +104,41 @@ type Backlink struct {
 	CrawlIndex   int
 	Date_added   time.Time
 }
+
+type PageFailure struct {
+	Id                  int64
+	Url                 string
+	Domain              string
+	Status              int
+	Meta                string
+	Permanent           bool
+	ConsecutiveFailures int
+	PermanentFailures   int // Consecutive crawls the page failed permanently in, without a temporary failure in between
+	TotalFailures       int
+	FirstFailure        time.Time
+	LastFailure         time.Time
+	LastSuccess         sql.Null[time.Time]
+}
+
+// Failure counts of one capsule, from the page_failures table
+type CapsuleFailures struct {
+	Domain         string
+	FailingPages   int // Pages that failed in the last crawl they were fetched in
+	RecoveredPages int // Pages that have failed before but were fetched successfully since
+	TotalFailures  int
+}
+
+// A TLS certificate a capsule was seen with, from the certs table
+type CertRecord struct {
+	Id                  int64
+	Domain              string
+	Port                int
+	Fingerprint         string // Hex of the SHA-256 of the certificate
+	Subject             string
+	Issuer              string
+	NotBefore           time.Time
+	NotAfter            time.Time
+	PreviousFingerprint sql.Null[string] // The certificate the capsule was seen with before this one
+	FirstSeen           time.Time
+	LastSeen            time.Time
+}